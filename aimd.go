@@ -0,0 +1,133 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	aimdInterval time.Duration = time.Second
+	// The rate is multiplied by this factor after an interval containing congestion signals
+	aimdDecreaseFactor float64 = 0.5
+	// The rate grows by this fraction of the maximum after each interval without congestion
+	aimdIncreaseFraction float64 = 0.1
+)
+
+// aimdController implements additive-increase/multiplicative-decrease adjustment of a query rate,
+// using REFUSED and SERVFAIL responses and timeouts as the congestion signals.
+type aimdController struct {
+	sync.Mutex
+	rate      float64
+	max       float64
+	congested bool
+	successes int
+}
+
+func newAIMDController(max int) *aimdController {
+	return &aimdController{
+		rate: float64(max),
+		max:  float64(max),
+	}
+}
+
+func (a *aimdController) congestion() {
+	a.Lock()
+	defer a.Unlock()
+
+	a.congested = true
+}
+
+func (a *aimdController) success() {
+	a.Lock()
+	defer a.Unlock()
+
+	a.successes++
+}
+
+// adjust applies the feedback collected during the last interval and returns true when the rate changed.
+func (a *aimdController) adjust() bool {
+	a.Lock()
+	defer a.Unlock()
+
+	old := a.rate
+	if a.congested {
+		a.rate *= aimdDecreaseFactor
+		if a.rate < 1 {
+			a.rate = 1
+		}
+	} else if a.successes > 0 {
+		a.rate += a.max * aimdIncreaseFraction
+		if a.rate > a.max {
+			a.rate = a.max
+		}
+	}
+
+	a.congested = false
+	a.successes = 0
+	return int(a.rate) != int(old)
+}
+
+func (a *aimdController) current() int {
+	a.Lock()
+	defer a.Unlock()
+
+	return int(a.rate)
+}
+
+func (a *aimdController) setMax(max int) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.max = float64(max)
+	if a.rate > a.max {
+		a.rate = a.max
+	}
+}
+
+func (r *baseResolver) aimdAdjustments() {
+	t := time.NewTicker(aimdInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+			if r.aimd.adjust() {
+				r.ratelock.Lock()
+				r.applyRate()
+				r.ratelock.Unlock()
+			}
+		}
+	}
+}
+
+// applyRate sets the rate limiter to the most restrictive of the current limits.
+// The ratelock must already be held by the caller.
+func (r *baseResolver) applyRate() {
+	rate := r.perSec
+	if r.sampled > 0 && r.sampled < rate {
+		rate = r.sampled
+	}
+	if a := r.aimd.current(); a < rate {
+		rate = a
+	}
+	if rate < 1 {
+		rate = 1
+	}
+
+	if rate != r.curRate {
+		r.curRate = rate
+		r.rlimit = newPacer(rate)
+	}
+}
+
+func (r *baseResolver) currentRate() int {
+	r.ratelock.Lock()
+	defer r.ratelock.Unlock()
+
+	return r.curRate
+}
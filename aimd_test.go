@@ -0,0 +1,68 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestAIMDController(t *testing.T) {
+	a := newAIMDController(100)
+
+	a.congestion()
+	if !a.adjust() || a.current() != 50 {
+		t.Errorf("The rate was %d instead of 50 after congestion", a.current())
+	}
+
+	a.congestion()
+	a.success()
+	if !a.adjust() || a.current() != 25 {
+		t.Errorf("The rate was %d instead of 25 after congestion", a.current())
+	}
+
+	if a.adjust() {
+		t.Errorf("The rate changed during an interval without feedback")
+	}
+
+	a.success()
+	if !a.adjust() || a.current() != 35 {
+		t.Errorf("The rate was %d instead of 35 after recovering", a.current())
+	}
+
+	for i := 0; i < 20; i++ {
+		a.success()
+		a.adjust()
+	}
+	if a.current() != 100 {
+		t.Errorf("The rate was %d instead of the maximum after recovering", a.current())
+	}
+}
+
+func TestAIMDRefusedBackoff(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeRefused)
+		w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	for i := 0; i < 5; i++ {
+		_, _ = r.Query(context.TODO(), QueryMsg("refused.net", dns.TypeA), PriorityNormal, nil)
+	}
+
+	time.Sleep(aimdInterval + 250*time.Millisecond)
+	if rate := r.(*baseResolver).currentRate(); rate >= 100 {
+		t.Errorf("The rate was %d after the resolver refused queries", rate)
+	}
+}
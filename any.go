@@ -0,0 +1,77 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// The types queried individually by QueryAny when the server responds to the ANY
+// query with the minimal RFC 8482 response, and no types are provided.
+var anyFallbackTypes = []uint16{
+	dns.TypeA,
+	dns.TypeAAAA,
+	dns.TypeCNAME,
+	dns.TypeNS,
+	dns.TypeMX,
+	dns.TypeTXT,
+	dns.TypeSOA,
+	dns.TypeSRV,
+	dns.TypeCAA,
+}
+
+// QueryAny performs an ANY query for the name. When the server returns the minimal HINFO response
+// described in RFC 8482, the types provided are queried individually and the answers are merged
+// into the returned message. The common types, such as A, AAAA, MX and TXT, are used when no types are provided.
+func QueryAny(ctx context.Context, r Resolver, name string, priority int, types ...uint16) (*dns.Msg, error) {
+	resp, err := r.Query(ctx, QueryMsg(name, dns.TypeANY), priority, RetryPolicy)
+	if err != nil || !minimalAnyResponse(resp) {
+		return resp, err
+	}
+
+	if len(types) == 0 {
+		types = anyFallbackTypes
+	}
+
+	merged := resp.Copy()
+	merged.Answer = nil
+	seen := make(map[string]struct{})
+	for _, qtype := range types {
+		m, err := r.Query(ctx, QueryMsg(name, qtype), priority, RetryPolicy)
+		if err != nil {
+			if e := checkContext(ctx); e != nil {
+				return nil, e
+			}
+			continue
+		}
+
+		for _, rr := range m.Answer {
+			// The same records can be returned for several types, such as a CNAME
+			if k := rr.String(); !hasKey(seen, k) {
+				seen[k] = struct{}{}
+				merged.Answer = append(merged.Answer, rr)
+			}
+		}
+	}
+	return merged, nil
+}
+
+func hasKey(m map[string]struct{}, k string) bool {
+	_, found := m[k]
+	return found
+}
+
+// minimalAnyResponse returns true when the message contains only the HINFO record
+// synthesized according to RFC 8482.
+func minimalAnyResponse(m *dns.Msg) bool {
+	if m == nil || len(m.Answer) != 1 {
+		return false
+	}
+
+	hinfo, ok := m.Answer[0].(*dns.HINFO)
+	return ok && strings.EqualFold(hinfo.Cpu, "RFC8482")
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func anyHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	name := req.Question[0].Name
+	hdr := dns.RR_Header{Name: name, Rrtype: req.Question[0].Qtype, Class: dns.ClassINET, Ttl: 300}
+	switch req.Question[0].Qtype {
+	case dns.TypeANY:
+		if name == "minimal.any.net." {
+			hdr.Rrtype = dns.TypeHINFO
+			m.Answer = append(m.Answer, &dns.HINFO{Hdr: hdr, Cpu: "RFC8482"})
+		} else {
+			m.Answer = append(m.Answer,
+				&dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET}, A: net.ParseIP("192.168.1.1")},
+				&dns.TXT{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET}, Txt: []string{"any"}},
+			)
+		}
+	case dns.TypeA:
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("192.168.1.1")})
+	case dns.TypeMX:
+		m.Answer = append(m.Answer, &dns.MX{Hdr: hdr, Preference: 10, Mx: "mail.any.net."})
+	default:
+		m.Rcode = dns.RcodeNameError
+	}
+	_ = w.WriteMsg(m)
+}
+
+func TestQueryAny(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(anyHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	resp, err := QueryAny(context.TODO(), r, "full.any.net", PriorityNormal)
+	if err != nil || len(resp.Answer) != 2 {
+		t.Errorf("The full ANY response was not returned: %v", err)
+	}
+
+	resp, err = QueryAny(context.TODO(), r, "minimal.any.net", PriorityNormal)
+	if err != nil {
+		t.Fatalf("The ANY query failed: %v", err)
+	}
+	if len(resp.Answer) != 2 || minimalAnyResponse(resp) {
+		t.Errorf("The fallback answers were not merged: %v", resp.Answer)
+	}
+
+	resp, err = QueryAny(context.TODO(), r, "minimal.any.net", PriorityNormal, dns.TypeMX)
+	if err != nil || len(resp.Answer) != 1 || resp.Answer[0].Header().Rrtype != dns.TypeMX {
+		t.Errorf("The provided fallback types were not used: %v", err)
+	}
+}
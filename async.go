@@ -0,0 +1,203 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// asyncResolver is implemented by the resolvers able to deliver results to a callback
+// without holding a goroutine for each query in flight.
+type asyncResolver interface {
+	queryAsync(ctx context.Context, msg *dns.Msg, priority int, callback func(*Result))
+}
+
+// QueryAsync sends a query for the name and type using the Resolver, and provides the outcome to
+// the callback once the query completes. The callback is executed by the goroutines of the resolver,
+// or by the calling goroutine when the query cannot be sent, and must not block.
+// QueryAsync can block the calling goroutine while the in-flight query cap has been reached.
+func QueryAsync(ctx context.Context, r Resolver, name string, qtype uint16, callback func(Result)) {
+	deliver := func(res *Result) {
+		res.Negative, _ = NegativeResponse(res.Msg)
+		res.Stale = StaleResponse(res.Msg)
+		callback(*res)
+	}
+	msg := QueryMsg(name, qtype)
+
+	if ar, ok := r.(asyncResolver); ok {
+		ar.queryAsync(ctx, msg, PriorityNormal, deliver)
+		return
+	}
+	go deliver(QueryResult(ctx, r, msg, PriorityNormal, nil))
+}
+
+func (r *baseResolver) queryAsync(ctx context.Context, msg *dns.Msg, priority int, callback func(*Result)) {
+	if err := r.checkQuery(priority); err != nil {
+		callback(&Result{Err: err})
+		return
+	}
+	if err := checkContext(ctx); err != nil {
+		callback(&Result{Err: err})
+		return
+	}
+
+	start := time.Now()
+	level := r.edns.level()
+	req := r.newRequest(ctx, msg)
+	req.Callback = func(res *resolveResult) {
+		if r.edns.resend(msg, res.Msg, level) {
+			// The query is sent again without the rejected EDNS features, off the goroutines of the resolver
+			go r.queryAsync(ctx, msg, priority, callback)
+			return
+		}
+
+		transport := TransportUDP
+		if res.Transport != "" {
+			transport = res.Transport
+		}
+		if res.Msg != nil {
+			// The identifier may have been replaced to avoid a collision with another query
+			res.Msg.Id = msg.Id
+		}
+
+		callback(&Result{
+			Msg:       res.Msg,
+			Err:       res.Err,
+			Resolver:  r.address,
+			RTT:       time.Since(start),
+			Attempts:  1,
+			Transport: transport,
+		})
+	}
+
+	if res := r.submitRequest(ctx, req, priority); res != nil {
+		req.Callback(res)
+	}
+}
+
+func (rp *ResolverPool) queryAsync(ctx context.Context, msg *dns.Msg, priority int, callback func(*Result)) {
+	if rp.requiresSyncQuery(ctx, msg) {
+		// Features that wait on the response of each attempt are performed by the synchronous path
+		go func() { callback(QueryResult(ctx, rp, msg, priority, nil)) }()
+		return
+	}
+
+	if err := rp.admit(msg); err != nil {
+		callback(&Result{Err: err})
+		return
+	}
+	done := callback
+	callback = func(res *Result) {
+		defer rp.release()
+		done(res)
+	}
+
+	q := rp.newPoolQuery(ctx, msg)
+	if resp, found, err := q.lookup(); found {
+		callback(&Result{Msg: resp, Err: err})
+		return
+	}
+
+	q.start()
+	deliver := func(res *Result) {
+		rp.filterBailiwick(res.Msg)
+		res.Msg, res.Err = q.finish(res.Msg, res.Err)
+		callback(res)
+	}
+
+	if sub := rp.typePool(msg); sub != nil {
+		sub.queryAsync(q.ctx, msg, priority, deliver)
+		return
+	}
+	if sb := rp.standbyPool(); sb != nil {
+		sb.queryAsync(q.ctx, msg, priority, deliver)
+		return
+	}
+
+	// The sub-pools create their own spans
+	q.startSpan()
+	rp.asyncAttempt(q.ctx, msg, priority, 1, func(res *Result) {
+		rp.recordPrimaryResult(sloFailureCause(res.Err) == "")
+		deliver(res)
+	})
+}
+
+// requiresSyncQuery returns true when the query sent by the pool uses features that are only
+// performed by the synchronous path, such as the baseline, the retry strategy and hedging.
+func (rp *ResolverPool) requiresSyncQuery(ctx context.Context, msg *dns.Msg) bool {
+	if rp.typePool(msg) != nil || rp.standbyPool() != nil {
+		return false
+	}
+
+	_, override := resolverFromContext(ctx)
+	return rp.baseline != nil || rp.retryStrategy() != nil || (rp.hedgeDelay() > 0 && !override)
+}
+
+// asyncAttempt sends attempt number times of the query, and continues with another attempt
+// from the callback when the result permits a retry.
+func (rp *ResolverPool) asyncAttempt(ctx context.Context, msg *dns.Msg, priority, times int, callback func(*Result)) {
+	if err := checkContext(ctx); err != nil {
+		callback(&Result{Err: err, Attempts: times - 1})
+		return
+	}
+
+	r := rp.selectResolver(ctx, msg)
+	if r == nil {
+		callback(&Result{Err: rp.unavailableError(ctx), Attempts: times - 1})
+		return
+	}
+
+	actx, span := rp.startSpan(ctx, SpanAttempt, msg)
+	if span != nil {
+		span.SetAttribute(AttrAttempt, times)
+	}
+	handle := func(res *Result) {
+		rp.releaseResolver(r)
+		rp.observeAttempt(r, res.RTT, res.Err)
+		endSpan(span, r, res.Msg, res.RTT, res.Err)
+		rp.audit(ctx, msg, r, res.Msg, res.RTT, res.Err)
+		sent := time.Now().Add(-res.RTT)
+		rp.tap(msg, r, res.Msg, sent, res.RTT)
+		rp.capture(msg, r, res.Msg, sent, res.RTT)
+		rp.notifyAttempt(msg, r, res.Msg, res.RTT, res.Err)
+		queryChainFromContext(ctx).add(r.String())
+		res.Attempts = times
+
+		// Timeouts, resolver errors and server failures cause retries
+		if e, ok := res.Err.(*ResolveError); ok && rp.asyncRetry(ctx, times, priority, e.Rcode) {
+			rp.recordRetry(msg, times+1)
+			go rp.asyncAttempt(ctx, msg, priority, times+1, callback)
+			return
+		}
+		callback(res)
+	}
+
+	rp.notifySend(r, msg)
+	if ar, ok := r.(asyncResolver); ok {
+		ar.queryAsync(actx, msg, priority, handle)
+		return
+	}
+	go handle(QueryResult(actx, r, msg, priority, nil))
+}
+
+func (rp *ResolverPool) asyncRetry(ctx context.Context, times, priority, rcode int) bool {
+	if attemptsExceeded(times, priority) {
+		return false
+	}
+	if limit := attemptsLimit(ctx); limit > 0 && times >= limit {
+		return false
+	}
+
+	switch rcode {
+	case TimeoutRcode, ResolverErrRcode:
+		return true
+	case dns.RcodeServerFailure:
+		rp.incServfailCount()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestQueryAsync(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	good := NewBaseResolver(addrstr, 1000, nil)
+	pool := NewResolverPool([]Resolver{good}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	for _, r := range []Resolver{good, pool} {
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		var results []Result
+
+		num := 50
+		wg.Add(num)
+		for i := 0; i < num; i++ {
+			QueryAsync(context.TODO(), r, "async.net", dns.TypeA, func(res Result) {
+				defer wg.Done()
+
+				lock.Lock()
+				results = append(results, res)
+				lock.Unlock()
+			})
+		}
+		wg.Wait()
+
+		for _, res := range results {
+			if res.Err != nil || res.Msg == nil {
+				t.Errorf("The asynchronous query failed: %v", res.Err)
+				break
+			}
+			if res.Resolver != good.String() || res.Attempts != 1 || res.Transport != TransportUDP {
+				t.Errorf("The result contained unexpected metadata: %+v", res)
+				break
+			}
+		}
+	}
+}
+
+func TestQueryAsyncCancelled(t *testing.T) {
+	r := NewBaseResolver("127.0.0.2:53", 10, nil)
+	defer r.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan Result, 1)
+	QueryAsync(ctx, r, "async.net", dns.TypeA, func(res Result) { done <- res })
+
+	select {
+	case res := <-done:
+		if res.Err == nil {
+			t.Errorf("The query with a cancelled context did not fail")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The callback was not executed for the cancelled query")
+	}
+}
+
+func TestQueryAsyncRetries(t *testing.T) {
+	var lock sync.Mutex
+	var count int
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		var fail bool
+		if req.Question[0].Name == "retry.async.net." {
+			lock.Lock()
+			count++
+			fail = count < 3
+			lock.Unlock()
+		}
+
+		if fail {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			_ = w.WriteMsg(m)
+			return
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	done := make(chan Result, 1)
+	QueryAsync(context.TODO(), pool, "retry.async.net", dns.TypeA, func(res Result) { done <- res })
+
+	res := <-done
+	if res.Err != nil {
+		t.Fatalf("The asynchronous query was not retried: %v", res.Err)
+	}
+	if res.Attempts != 3 {
+		t.Errorf("The result reported %d attempts instead of 3", res.Attempts)
+	}
+}
+
+func TestQueryAsyncRecordedOnce(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	for _, strategy := range []RetryStrategy{nil, &ExponentialBackoff{Attempts: 2}} {
+		pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+		pool.SetSLOTargets(SLOTargets{MinAnswerRatio: 0.9})
+		// The retry strategy causes the query to be performed by the synchronous path
+		if strategy != nil {
+			pool.SetRetryStrategy(strategy)
+		}
+
+		done := make(chan Result, 1)
+		QueryAsync(context.TODO(), pool, "once.async.net", dns.TypeA, func(res Result) { done <- res })
+		if res := <-done; res.Err != nil {
+			t.Errorf("The asynchronous query failed: %v", res.Err)
+		}
+		if report := pool.SLOReport(); report == nil || report.Queries != 1 {
+			t.Errorf("The asynchronous query was recorded %v times", report)
+		}
+		pool.Stop()
+	}
+}
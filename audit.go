@@ -0,0 +1,105 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// AuditRecord is the line written to the audit log for each attempt sent to a resolver.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Resolver string    `json:"resolver"`
+	Rcode    string    `json:"rcode,omitempty"`
+	RTT      float64   `json:"rtt_ms"`
+	// Answers summarizes each record in the answer section as the owner name, type and data.
+	Answers []string `json:"answers,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	// CorrelationID is the ID carried by the context of the query, as provided to WithCorrelationID.
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+type auditLog struct {
+	sync.Mutex
+	enc    *json.Encoder
+	failed bool
+}
+
+// SetAuditLog causes the question and the summarized answers of every attempt sent by the pool,
+// including the trusted resolvers, the type resolvers and the standby set, to be written to the
+// Writer in JSON Lines format, along with the time, resolver, rcode and RTT.
+// Providing nil stops writing the audit log.
+func (rp *ResolverPool) SetAuditLog(w io.Writer) {
+	var a *auditLog
+	if w != nil {
+		a = &auditLog{enc: json.NewEncoder(w)}
+	}
+
+	rp.setAuditLog(a)
+	rp.configChanged("audit_log", "enabled", w != nil)
+}
+
+func (rp *ResolverPool) setAuditLog(a *auditLog) {
+	rp.Lock()
+	rp.auditLog = a
+	subs := rp.subPools()
+	rp.Unlock()
+
+	for _, sub := range subs {
+		sub.setAuditLog(a)
+	}
+}
+
+// audit writes the record of the attempt to the audit log when one has been set.
+func (rp *ResolverPool) audit(ctx context.Context, msg *dns.Msg, r Resolver, resp *dns.Msg, rtt time.Duration, err error) {
+	rp.Lock()
+	a := rp.auditLog
+	rp.Unlock()
+
+	if a == nil || r == nil || len(msg.Question) == 0 {
+		return
+	}
+
+	rec := &AuditRecord{
+		Time:          time.Now().UTC(),
+		Name:          RemoveLastDot(msg.Question[0].Name),
+		Type:          dns.TypeToString[msg.Question[0].Qtype],
+		Resolver:      r.String(),
+		RTT:           float64(rtt) / float64(time.Millisecond),
+		CorrelationID: CorrelationID(ctx),
+	}
+	if e, ok := err.(*ResolveError); ok && e.Rcode != TimeoutRcode && e.Rcode != ResolverErrRcode {
+		rec.Rcode = dns.RcodeToString[e.Rcode]
+	} else if err == nil && resp != nil {
+		rec.Rcode = dns.RcodeToString[resp.Rcode]
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if resp != nil {
+		for _, ans := range ExtractAnswers(resp) {
+			rec.Answers = append(rec.Answers, ans.Name+" "+dns.TypeToString[ans.Type]+" "+ans.Data)
+		}
+	}
+
+	a.Lock()
+	e := a.enc.Encode(rec)
+	first := e != nil && !a.failed
+	if e != nil {
+		a.failed = true
+	}
+	a.Unlock()
+	// Only the first failure is logged to avoid an event for every attempt
+	if first {
+		rp.logEvent(LevelError, "Audit log write failed", "error", e)
+	}
+}
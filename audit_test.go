@@ -0,0 +1,110 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestAuditLog(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	var buf bytes.Buffer
+	pool.SetAuditLog(&buf)
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("www.audit.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+	done := make(chan Result, 1)
+	QueryAsync(context.TODO(), pool, "async.audit.net", dns.TypeA, func(res Result) { done <- res })
+	<-done
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("Failed to decode the audit record %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d audit records were written instead of 2", len(records))
+	}
+
+	for i, name := range []string{"www.audit.net", "async.audit.net"} {
+		rec := records[i]
+		if rec.Name != name || rec.Type != "A" || rec.Resolver != r.String() || rec.Rcode != "NOERROR" || rec.Time.IsZero() {
+			t.Errorf("The audit record was unexpected: %+v", rec)
+		}
+		if len(rec.Answers) != 1 || rec.Answers[0] != name+" A 192.168.1.1" {
+			t.Errorf("The audit record summarized the answers as %v", rec.Answers)
+		}
+	}
+
+	pool.SetAuditLog(nil)
+	buf.Reset()
+	if _, err := pool.Query(context.TODO(), QueryMsg("off.audit.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("An audit record was written after the audit log was removed")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestAuditLogWriteFailure(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	l := new(testEventLogger)
+	pool.SetEventLogger(l)
+	pool.SetAuditLog(failingWriter{})
+
+	for i := 0; i < 3; i++ {
+		if _, err := pool.Query(context.TODO(), QueryMsg("www.audit.net", dns.TypeA), PriorityNormal, nil); err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	var failures int
+	for _, e := range l.events {
+		if e.level == LevelError {
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Errorf("The audit log failure was logged %d times instead of once", failures)
+	}
+}
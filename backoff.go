@@ -0,0 +1,127 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryStrategy controls how a ResolverPool retries failed queries, replacing the
+// default behavior driven by the query priority.
+type RetryStrategy interface {
+	// MaxAttempts returns the maximum number of times a query with the priority is sent.
+	MaxAttempts(priority int) int
+	// Backoff returns the delay before the attempt following the provided attempt number.
+	Backoff(attempt int) time.Duration
+	// ShouldRetry returns true when a failure with the rcode triggers another attempt.
+	ShouldRetry(rcode int) bool
+	// SwitchResolver returns true when each attempt should use a different resolver.
+	SwitchResolver() bool
+}
+
+// ExponentialBackoff is a RetryStrategy with exponentially growing, jittered delays between attempts.
+type ExponentialBackoff struct {
+	Attempts int
+	// Base is the delay after the first attempt, which doubles after each following attempt.
+	Base time.Duration
+	// Max caps the delay between attempts when greater than zero.
+	Max time.Duration
+	// Jitter is the fraction, between 0 and 1, of each delay that is randomized.
+	Jitter float64
+	// Rcodes are the rcodes that trigger another attempt, defaulting to PoolRetryCodes.
+	Rcodes []int
+	// Switch causes each attempt to use a different resolver.
+	Switch bool
+}
+
+// MaxAttempts implements the RetryStrategy interface.
+func (b *ExponentialBackoff) MaxAttempts(priority int) int {
+	return b.Attempts
+}
+
+// Backoff implements the RetryStrategy interface.
+func (b *ExponentialBackoff) Backoff(attempt int) time.Duration {
+	if attempt < 1 || b.Base <= 0 {
+		return 0
+	}
+
+	d := float64(b.Base) * math.Exp2(float64(attempt-1))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if j := math.Min(math.Max(b.Jitter, 0), 1); j > 0 {
+		d -= d * j * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// ShouldRetry implements the RetryStrategy interface.
+func (b *ExponentialBackoff) ShouldRetry(rcode int) bool {
+	codes := b.Rcodes
+	if len(codes) == 0 {
+		codes = PoolRetryCodes
+	}
+
+	for _, code := range codes {
+		if rcode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// SwitchResolver implements the RetryStrategy interface.
+func (b *ExponentialBackoff) SwitchResolver() bool {
+	return b.Switch
+}
+
+// SetRetryStrategy causes the pool to retry failed queries according to the provided strategy.
+// Providing nil restores the default behavior.
+func (rp *ResolverPool) SetRetryStrategy(s RetryStrategy) {
+	defer rp.configChanged("retry_strategy", "enabled", s != nil)
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.strategy = s
+}
+
+func (rp *ResolverPool) retryStrategy() RetryStrategy {
+	rp.Lock()
+	defer rp.Unlock()
+
+	return rp.strategy
+}
+
+// retainResolver selects the resolver for another attempt, when it is still usable.
+func (rp *ResolverPool) retainResolver(r Resolver) Resolver {
+	if r == nil || r.Stopped() {
+		return nil
+	}
+
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.outstanding[r.String()]++
+	return r
+}
+
+// sleepContext waits for the provided duration and returns false if the context expires first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+	}
+	return true
+}
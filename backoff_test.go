@@ -0,0 +1,98 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &ExponentialBackoff{
+		Base: 10 * time.Millisecond,
+		Max:  50 * time.Millisecond,
+	}
+
+	for attempt, expected := range map[int]time.Duration{
+		0: 0,
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 40 * time.Millisecond,
+		4: 50 * time.Millisecond,
+	} {
+		if d := b.Backoff(attempt); d != expected {
+			t.Errorf("Attempt %d returned a delay of %s instead of %s", attempt, d, expected)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		if d := b.Backoff(2); d < 10*time.Millisecond || d > 20*time.Millisecond {
+			t.Errorf("The jittered delay %s is outside of the expected range", d)
+		}
+	}
+
+	if !b.ShouldRetry(dns.RcodeServerFailure) || b.ShouldRetry(dns.RcodeNameError) {
+		t.Errorf("The default retry codes were not used")
+	}
+	b.Rcodes = []int{dns.RcodeNameError}
+	if b.ShouldRetry(dns.RcodeServerFailure) || !b.ShouldRetry(dns.RcodeNameError) {
+		t.Errorf("The provided retry codes were not used")
+	}
+}
+
+func TestPoolRetryStrategy(t *testing.T) {
+	var count int32
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Name == "retry.net." {
+			atomic.AddInt32(&count, 1)
+		}
+
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeServerFailure)
+		w.WriteMsg(m)
+	})
+
+	var res []Resolver
+	for i := 0; i < 2; i++ {
+		s, addrstr, _, err := runLocalUDPHandlerServer(":0", handler)
+		if err != nil {
+			t.Fatalf("Unable to run test server: %v", err)
+		}
+		defer s.Shutdown()
+
+		res = append(res, NewBaseResolver(addrstr, 100, nil))
+	}
+
+	pool := NewResolverPool(res, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetRetryStrategy(&ExponentialBackoff{
+		Attempts: 3,
+		Base:     20 * time.Millisecond,
+	})
+
+	start := time.Now()
+	result := QueryResult(context.TODO(), pool, QueryMsg("retry.net", dns.TypeA), PriorityNormal, nil)
+	if n := atomic.LoadInt32(&count); n != 3 || result.Attempts != 3 {
+		t.Errorf("The query was sent %d times instead of 3", n)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("The backoff delays were not applied: %s", elapsed)
+	}
+
+	pool.SetRetryStrategy(&ExponentialBackoff{
+		Attempts: 2,
+		Rcodes:   []int{dns.RcodeNameError},
+	})
+	atomic.StoreInt32(&count, 0)
+	_, _ = pool.Query(context.TODO(), QueryMsg("retry.net", dns.TypeA), PriorityNormal, nil)
+	if n := atomic.LoadInt32(&count); n != 1 {
+		t.Errorf("The query was retried %d times for an rcode not in the strategy", n-1)
+	}
+}
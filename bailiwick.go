@@ -0,0 +1,120 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// FilterBailiwick removes the records from the response that are out of bailiwick for the question,
+// and returns the number of records removed. The bailiwick is the registered domain of the question name.
+// Answers must belong to the question name or the names reached through its CNAME and DNAME records.
+// Authority records must belong to the question name or its ancestors within the bailiwick, except
+// the SOA, NSEC and NSEC3 records and their signatures, which must belong to the zone the response
+// came from. That zone can be above the registered domain, such as the TLD zone answering for a
+// domain that does not exist. Additional records must belong to names within the bailiwick.
+func FilterBailiwick(resp *dns.Msg) int {
+	if resp == nil || len(resp.Question) == 0 {
+		return 0
+	}
+
+	qname := strings.ToLower(dns.Fqdn(resp.Question[0].Name))
+	bailiwick := dns.Fqdn(registeredDomain(qname))
+
+	var removed int
+	filter := func(records []dns.RR, keep func(rr dns.RR, owner string) bool) []dns.RR {
+		var kept []dns.RR
+
+		for _, rr := range records {
+			if keep(rr, strings.ToLower(rr.Header().Name)) {
+				kept = append(kept, rr)
+			} else {
+				removed++
+			}
+		}
+		return kept
+	}
+
+	owners := answerOwners(qname, resp.Answer)
+	resp.Answer = filter(resp.Answer, func(rr dns.RR, owner string) bool {
+		if _, ok := rr.(*dns.DNAME); ok {
+			return dns.IsSubDomain(owner, qname)
+		}
+		return owners[owner]
+	})
+	zone := responseZone(qname, bailiwick, resp.Ns)
+	resp.Ns = filter(resp.Ns, func(rr dns.RR, owner string) bool {
+		rrtype := rr.Header().Rrtype
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			rrtype = sig.TypeCovered
+		}
+
+		switch rrtype {
+		case dns.TypeSOA:
+			return owner == zone
+		case dns.TypeNSEC, dns.TypeNSEC3:
+			return dns.IsSubDomain(zone, owner)
+		}
+		return dns.IsSubDomain(owner, qname) && dns.IsSubDomain(bailiwick, owner)
+	})
+	resp.Extra = filter(resp.Extra, func(rr dns.RR, owner string) bool {
+		return rr.Header().Rrtype == dns.TypeOPT || dns.IsSubDomain(bailiwick, owner)
+	})
+	return removed
+}
+
+// responseZone returns the zone the response came from, which is the closest ancestor of the question
+// name with an SOA record in the authority section, or the bailiwick when the section has no SOA record.
+func responseZone(qname, bailiwick string, authority []dns.RR) string {
+	zone := bailiwick
+	var found bool
+
+	for _, rr := range authority {
+		owner := strings.ToLower(rr.Header().Name)
+
+		if _, ok := rr.(*dns.SOA); ok && dns.IsSubDomain(owner, qname) {
+			if !found || dns.CountLabel(owner) > dns.CountLabel(zone) {
+				zone = owner
+				found = true
+			}
+		}
+	}
+	return zone
+}
+
+// answerOwners returns the question name and the names reached through the CNAME and DNAME records.
+func answerOwners(qname string, answers []dns.RR) map[string]bool {
+	owners := map[string]bool{qname: true}
+
+	// The records can appear in any order, so the chain is followed until no names are added
+	for added := true; added; {
+		added = false
+
+		for _, rr := range answers {
+			var target string
+			owner := strings.ToLower(rr.Header().Name)
+
+			switch v := rr.(type) {
+			case *dns.CNAME:
+				if owners[owner] {
+					target = strings.ToLower(v.Target)
+				}
+			case *dns.DNAME:
+				for name := range owners {
+					if name != owner && dns.IsSubDomain(owner, name) {
+						target = strings.ToLower(name[:len(name)-len(owner)] + v.Target)
+						break
+					}
+				}
+			}
+			if target != "" && !owners[target] {
+				owners[target] = true
+				added = true
+			}
+		}
+	}
+	return owners
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("Failed to parse the record %q: %v", s, err)
+	}
+	return rr
+}
+
+func TestFilterBailiwick(t *testing.T) {
+	resp := new(dns.Msg)
+	resp.SetQuestion("www.example.com.", dns.TypeA)
+	resp.Answer = []dns.RR{
+		mustRR(t, "cdn.other.net. 300 IN A 192.168.1.2"),
+		mustRR(t, "www.example.com. 300 IN CNAME cdn.other.net."),
+		mustRR(t, "evil.com. 300 IN A 10.0.0.1"),
+	}
+	resp.Ns = []dns.RR{
+		mustRR(t, "example.com. 300 IN NS ns1.example.com."),
+		mustRR(t, "com. 300 IN NS ns.evil.com."),
+		mustRR(t, "other.example.com. 300 IN NS ns.evil.com."),
+	}
+	resp.Extra = []dns.RR{
+		mustRR(t, "ns1.example.com. 300 IN A 192.168.1.3"),
+		mustRR(t, "ns.evil.com. 300 IN A 10.0.0.2"),
+	}
+	resp.SetEdns0(dns.DefaultMsgSize, false)
+
+	if n := FilterBailiwick(resp); n != 4 {
+		t.Errorf("%d records were removed instead of 4", n)
+	}
+	if len(resp.Answer) != 2 {
+		t.Errorf("The answer section kept %d records instead of the CNAME chain", len(resp.Answer))
+	}
+	if len(resp.Ns) != 1 || resp.Ns[0].Header().Name != "example.com." {
+		t.Errorf("The authority section kept records out of bailiwick: %v", resp.Ns)
+	}
+	if len(resp.Extra) != 2 || resp.IsEdns0() == nil {
+		t.Errorf("The additional section kept records out of bailiwick: %v", resp.Extra)
+	}
+}
+
+func TestFilterBailiwickDNAME(t *testing.T) {
+	resp := new(dns.Msg)
+	resp.SetQuestion("www.old.example.com.", dns.TypeA)
+	resp.Answer = []dns.RR{
+		mustRR(t, "old.example.com. 300 IN DNAME new.example.net."),
+		mustRR(t, "www.old.example.com. 300 IN CNAME www.new.example.net."),
+		mustRR(t, "www.new.example.net. 300 IN A 192.168.1.1"),
+		mustRR(t, "unrelated.example.net. 300 IN A 192.168.1.2"),
+	}
+
+	if n := FilterBailiwick(resp); n != 1 || len(resp.Answer) != 3 {
+		t.Errorf("The DNAME chain was not preserved: %v", resp.Answer)
+	}
+}
+
+func TestFilterBailiwickNXDOMAIN(t *testing.T) {
+	resp := new(dns.Msg)
+	resp.SetQuestion("nosuchname12345.com.", dns.TypeA)
+	resp.Rcode = dns.RcodeNameError
+	resp.Ns = []dns.RR{
+		mustRR(t, "com. 900 IN SOA a.gtld-servers.net. nstld.verisign-grs.com. 1 1800 900 604800 86400"),
+		mustRR(t, "com. 900 IN RRSIG SOA 13 1 900 20261101000000 20261001000000 19718 com. AAAA"),
+		mustRR(t, "CK0POJMG874LJREF7EFN8430QVIT8BSM.com. 86400 IN NSEC3 1 1 0 - CK0Q3UDG8CEKKAE7RUKPGCT1DVSSH8LL NS SOA RRSIG DNSKEY NSEC3PARAM"),
+		mustRR(t, "CK0POJMG874LJREF7EFN8430QVIT8BSM.com. 86400 IN RRSIG NSEC3 13 2 86400 20261101000000 20261001000000 19718 com. AAAA"),
+		mustRR(t, "net. 900 IN SOA a.gtld-servers.net. nstld.verisign-grs.com. 1 1800 900 604800 86400"),
+		mustRR(t, "CK0POJMG874LJREF7EFN8430QVIT8BSM.net. 86400 IN NSEC3 1 1 0 - CK0Q3UDG8CEKKAE7RUKPGCT1DVSSH8LL NS"),
+	}
+
+	if n := FilterBailiwick(resp); n != 2 {
+		t.Errorf("%d records were removed instead of 2", n)
+	}
+	if len(resp.Ns) != 4 {
+		t.Fatalf("The authority section kept %d records instead of 4: %v", len(resp.Ns), resp.Ns)
+	}
+	if soa, ok := resp.Ns[0].(*dns.SOA); !ok || soa.Hdr.Name != "com." {
+		t.Errorf("The SOA record of the parent zone was not kept: %v", resp.Ns[0])
+	}
+}
+
+func TestFilterBailiwickNSEC3Denial(t *testing.T) {
+	resp := new(dns.Msg)
+	resp.SetQuestion("unsigned.com.", dns.TypeDS)
+	resp.Ns = []dns.RR{
+		mustRR(t, "com. 900 IN SOA a.gtld-servers.net. nstld.verisign-grs.com. 1 1800 900 604800 86400"),
+		mustRR(t, "com. 900 IN RRSIG SOA 13 1 900 20261101000000 20261001000000 19718 com. AAAA"),
+		mustRR(t, "VV0O7EOLI46H9SRGB3ID5MLL2LT4CHF2.com. 86400 IN NSEC3 1 1 0 - VV0Q2ANM3F6EH3SRPDLI9SNJLG5RMGGG NS DS RRSIG"),
+		mustRR(t, "VV0O7EOLI46H9SRGB3ID5MLL2LT4CHF2.com. 86400 IN RRSIG NSEC3 13 2 86400 20261101000000 20261001000000 19718 com. AAAA"),
+		mustRR(t, "unsigned.com. 300 IN NS ns.evil.net."),
+	}
+
+	if n := FilterBailiwick(resp); n != 0 {
+		t.Errorf("%d records were removed from the denial of the DS records", n)
+	}
+	if len(resp.Ns) != 5 {
+		t.Errorf("The authority section kept %d records instead of 5: %v", len(resp.Ns), resp.Ns)
+	}
+}
+
+func TestPoolBailiwickFiltering(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = []dns.RR{
+			mustRR(t, req.Question[0].Name+" 300 IN A 192.168.1.1"),
+			mustRR(t, "victim.net. 300 IN A 10.0.0.1"),
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetCache(NewMemoryCache(10))
+
+	for i := 0; i < 2; i++ {
+		resp, err := pool.Query(context.TODO(), QueryMsg("poison.example.com", dns.TypeA), PriorityNormal, nil)
+		if err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+		if len(resp.Answer) != 1 {
+			t.Errorf("The response contained %d answers instead of 1", len(resp.Answer))
+		}
+	}
+
+	pool.SetConfig(PoolConfig{DisableBailiwickFiltering: true})
+	resp, err := pool.Query(context.TODO(), QueryMsg("unfiltered.example.com", dns.TypeA), PriorityNormal, nil)
+	if err != nil || len(resp.Answer) != 2 {
+		t.Errorf("The records out of bailiwick were removed while the filtering was disabled: %v", err)
+	}
+}
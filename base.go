@@ -9,7 +9,9 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/caffix/queue"
@@ -21,23 +23,35 @@ const (
 	maxDelayBetweenSamples time.Duration = 250 * time.Millisecond
 	minSamplingTime        time.Duration = 5 * time.Second
 	minSampleSetSize       int           = 5
+	maxIdentifierAttempts  int           = 8
 )
 
 type baseResolver struct {
+	// Accessed atomically and kept first for 64-bit alignment
+	mismatches uint64
 	sync.Mutex
 	stopped bool
 	done    chan struct{}
+	// Closed once the goroutine reading the connection has returned
+	readsDone chan struct{}
 	// Rate limiter to enforce the maximum DNS queries
 	ratelock         sync.Mutex
 	rlimit           ratelimit.Limiter
+	curRate          int
+	sampled          int
+	aimd             *aimdController
+	rtt              *rttEstimator
+	edns             *ednsCapabilities
 	sampleQueue      queue.Queue
 	xchgQueue        queue.Queue
 	xchgs            *xchgManager
-	readMsgs         queue.Queue
+	readMsgs         *responseQueue
 	wildcardChannels *wildcardChans
+	wcConfig         WildcardConfig
 	address          string
 	log              *log.Logger
 	perSec           int
+	counters         *responseCounters
 	conn             *dns.Conn
 }
 
@@ -71,26 +85,36 @@ func NewBaseResolver(addr string, perSec int, logger *log.Logger) Resolver {
 
 	r := &baseResolver{
 		done:        make(chan struct{}, 2),
-		rlimit:      ratelimit.New(perSec, ratelimit.WithoutSlack),
+		readsDone:   make(chan struct{}),
+		rlimit:      newPacer(perSec),
+		curRate:     perSec,
+		aimd:        newAIMDController(perSec),
+		rtt:         newRTTEstimator(),
+		edns:        newEDNSCapabilities(),
 		sampleQueue: queue.NewQueue(),
 		xchgQueue:   queue.NewQueue(),
 		xchgs:       newXchgManager(),
-		readMsgs:    queue.NewQueue(),
+		readMsgs:    newResponseQueue(defaultResponseQueueSize),
+		counters:    newResponseCounters(),
 		wildcardChannels: &wildcardChans{
 			WildcardReq:     queue.NewQueue(),
 			IPsAcrossLevels: make(chan *ipsAcrossLevels, 10),
 			TestResult:      make(chan *testResult, 10),
+			States:          make(chan chan []*WildcardState),
+			Invalidate:      make(chan string),
 		},
 		address: addr,
 		log:     logger,
 		perSec:  perSec,
 		conn:    conn,
 	}
+	r.xchgs.timeout = r.rtt.timeout
 
 	go r.manageWildcards(r.wildcardChannels)
 	go r.sendQueries()
 	go r.responses()
 	go r.rateAdjustments()
+	go r.aimdAdjustments()
 	go r.timeouts()
 	go r.handleReads()
 	return r
@@ -103,6 +127,8 @@ func (r *baseResolver) Stop() {
 
 	if !r.stopped {
 		close(r.done)
+		// Unblocks the goroutine reading responses from the connection
+		_ = r.conn.Close()
 	}
 
 	r.stopped = true
@@ -123,39 +149,52 @@ func (r *baseResolver) String() string {
 
 func (r *baseResolver) rateLimiterTake() {
 	r.ratelock.Lock()
-	defer r.ratelock.Unlock()
+	rlimit := r.rlimit
+	r.ratelock.Unlock()
 
-	r.rlimit.Take()
+	// Waiting outside of the lock keeps the pool from blocking on maxRate
+	rlimit.Take()
 }
 
 func (r *baseResolver) setRateLimit(perSec int) {
 	r.ratelock.Lock()
 	defer r.ratelock.Unlock()
 
-	r.rlimit = ratelimit.New(perSec, ratelimit.WithoutSlack)
+	r.sampled = perSec
+	r.applyRate()
 }
 
-// Query implements the Resolver interface.
-func (r *baseResolver) Query(ctx context.Context, msg *dns.Msg, priority int, retry Retry) (*dns.Msg, error) {
-	if priority != PriorityCritical && priority != PriorityHigh &&
-		priority != PriorityNormal && priority != PriorityLow {
-		return nil, &ResolveError{
-			Err:   fmt.Sprintf("Resolver: Invalid priority parameter: %d", priority),
-			Rcode: ResolverErrRcode,
-		}
+func (r *baseResolver) maxRate() int {
+	r.ratelock.Lock()
+	defer r.ratelock.Unlock()
+
+	return r.perSec
+}
+
+func (r *baseResolver) setMaxRate(perSec int) {
+	if perSec <= 0 {
+		return
 	}
 
-	if r.Stopped() {
-		return nil, &ResolveError{
-			Err:   fmt.Sprintf("Resolver: %s has been stopped", r.String()),
-			Rcode: ResolverErrRcode,
-		}
+	r.ratelock.Lock()
+	defer r.ratelock.Unlock()
+
+	r.perSec = perSec
+	r.aimd.setMax(perSec)
+	r.applyRate()
+}
+
+// Query implements the Resolver interface.
+func (r *baseResolver) Query(ctx context.Context, msg *dns.Msg, priority int, retry Retry) (*dns.Msg, error) {
+	if err := r.checkQuery(priority); err != nil {
+		return nil, err
 	}
 
 	again := true
 	var times int
 	var err error
 	var resp *dns.Msg
+	info := resultInfoFromContext(ctx)
 	for again {
 		err = checkContext(ctx)
 		if err != nil {
@@ -163,9 +202,21 @@ func (r *baseResolver) Query(ctx context.Context, msg *dns.Msg, priority int, re
 		}
 
 		times++
+		start := time.Now()
+		level := r.edns.level()
 		result := r.queueQuery(ctx, msg, priority)
+		transport := TransportUDP
+		if result.Transport != "" {
+			transport = result.Transport
+		}
+		info.attempt(r.address, time.Since(start), times, transport)
+
 		resp = result.Msg
 		err = result.Err
+		if r.edns.resend(msg, resp, level) {
+			// The rejected EDNS features have been removed from the queries sent to the resolver
+			continue
+		}
 		if err == nil || retry == nil {
 			break
 		}
@@ -173,18 +224,98 @@ func (r *baseResolver) Query(ctx context.Context, msg *dns.Msg, priority int, re
 		resp := result.Msg
 		rcode := (result.Err.(*ResolveError)).Rcode
 		if resp == nil {
-			resp = msg
-			resp.Rcode = rcode
+			// The query may still be read by other goroutines, so the rcode is provided in a separate message
+			resp = &dns.Msg{MsgHdr: dns.MsgHdr{Id: msg.Id, Rcode: rcode}, Question: msg.Question}
 		}
 		again = retry(times, priority, resp)
 	}
 
+	if retry != nil {
+		err = retriesExhausted(err)
+	}
 	return resp, err
 }
 
+func (r *baseResolver) checkQuery(priority int) error {
+	if priority != PriorityCritical && priority != PriorityHigh &&
+		priority != PriorityNormal && priority != PriorityLow {
+		return &ResolveError{
+			Err:    fmt.Sprintf("Resolver: Invalid priority parameter: %d", priority),
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonInvalidRequest,
+		}
+	}
+
+	if r.Stopped() {
+		return &ResolveError{
+			Err:    fmt.Sprintf("Resolver: %s has been stopped", r.String()),
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonResolverStopped,
+		}
+	}
+	return nil
+}
+
+// The result channels of the queries are reused once the result has been received, since each
+// request delivers exactly one result. Channels of the queries abandoned by the caller are not reused.
+var resultChanPool = sync.Pool{
+	New: func() interface{} { return make(chan *resolveResult, 1) },
+}
+
 func (r *baseResolver) queueQuery(ctx context.Context, msg *dns.Msg, p int) *resolveResult {
-	resultChan := make(chan *resolveResult, 2)
+	resultChan := resultChanPool.Get().(chan *resolveResult)
+
+	req := r.newRequest(ctx, msg)
+	req.Result = resultChan
+	if res := r.submitRequest(ctx, req, p); res != nil {
+		resultChanPool.Put(resultChan)
+		return res
+	}
+
+	var result *resolveResult
+	select {
+	case <-ctx.Done():
+		reason := ReasonContextCancelled
+		// Requests that were never sent ran out of time waiting on the rate limiter
+		if sent := r.xchgs.remove(req.ID, req.Name); sent != nil && sent.Timestamp.IsZero() {
+			reason = ReasonRateBudgetExhausted
+		}
+		result = makeResolveResult(nil, false, "The request context was cancelled", TimeoutRcode, reason)
+	case res := <-resultChan:
+		result = res
+		resultChanPool.Put(resultChan)
+	}
+	if result.Msg != nil {
+		// The identifier may have been replaced to avoid a collision with another query
+		result.Msg.Id = msg.Id
+	}
+	return result
+}
+
+func (r *baseResolver) newRequest(ctx context.Context, msg *dns.Msg) *resolveRequest {
+	config := r.xchgs.config()
+	// Learn the EDNS support of the resolver on first use
+	if config.probeEDNS {
+		r.edns.once.Do(func() { go r.probeEDNS() })
+	}
+
+	req := &resolveRequest{
+		ID:       msg.Id,
+		Name:     RemoveLastDot(msg.Question[0].Name),
+		Qtype:    msg.Question[0].Qtype,
+		Question: msg.Question[0],
+		Msg:      r.edns.adapt(msg),
+		Ctx:      ctx,
+	}
+	if config.use0x20 {
+		req.Msg = encode0x20(req.Msg)
+		req.Encoded = true
+	}
+	return req
+}
 
+// submitRequest queues the request to be sent, and returns a result only when it could not be queued.
+func (r *baseResolver) submitRequest(ctx context.Context, req *resolveRequest, p int) *resolveResult {
 	priority := queue.PriorityNormal
 	switch p {
 	case PriorityCritical:
@@ -195,39 +326,60 @@ func (r *baseResolver) queueQuery(ctx context.Context, msg *dns.Msg, p int) *res
 		priority = queue.PriorityLow
 	}
 
-	req := &resolveRequest{
-		ID:     msg.Id,
-		Name:   RemoveLastDot(msg.Question[0].Name),
-		Qtype:  msg.Question[0].Qtype,
-		Msg:    msg,
-		Result: resultChan,
+	limits, err := r.xchgs.reserve(ctx, p)
+	if err == errInFlightCap {
+		return makeResolveResult(nil, false, "Resolver: The in-flight query cap has been reached", ResolverErrRcode, ReasonInFlightCapReached)
+	} else if err != nil {
+		return makeResolveResult(nil, false, "The request context was cancelled", TimeoutRcode, ReasonContextCancelled)
 	}
 
-	if err := r.xchgs.add(req); err != nil {
-		estr := fmt.Sprintf("Failed to obtain a valid message identifier: %v", err)
-		return makeResolveResult(nil, true, estr, ResolverErrRcode)
+	req.limits = limits
+	for attempt := 1; ; attempt++ {
+		err := r.xchgs.add(req)
+		if err == nil {
+			break
+		}
+		if attempt >= maxIdentifierAttempts {
+			r.xchgs.limiter(req).release(1)
+			estr := fmt.Sprintf("Failed to obtain a valid message identifier: %v", err)
+			return makeResolveResult(nil, true, estr, ResolverErrRcode, ReasonSendFailure)
+		}
+		// Another query for the name is using the identifier, so the message is sent with a fresh one
+		req.Msg = req.Msg.Copy()
+		req.Msg.Id = dns.Id()
+		req.ID = req.Msg.Id
 	}
 	r.xchgQueue.AppendPriority(req, priority)
-
-	var result *resolveResult
-	select {
-	case <-ctx.Done():
-		result = makeResolveResult(nil, false, "The request context was cancelled", TimeoutRcode)
-	case res := <-resultChan:
-		result = res
-	}
-	return result
+	return nil
 }
 
 func (r *baseResolver) sendQueries() {
+	r.labelGoroutine(PhaseSend)
+
 	for {
 		select {
 		case <-r.done:
 			return
 		case <-r.xchgQueue.Signal():
+			// Extra signals must not consume the rate limit
+			if r.xchgQueue.Empty() {
+				continue
+			}
+			// Wait for the rate limiter before selecting the request, so higher priority
+			// requests that arrive during the wait are sent first
+			r.rateLimiterTake()
 			if element, ok := r.xchgQueue.Next(); ok {
-				r.rateLimiterTake()
-				r.writeMessage(element.(*resolveRequest))
+				req := element.(*resolveRequest)
+
+				// Requests abandoned by the caller are not sent
+				if checkContext(req.Ctx) != nil {
+					if r.xchgs.remove(req.ID, req.Name) != nil {
+						r.returnRequest(req, makeResolveResult(nil, false,
+							"The request context was cancelled", TimeoutRcode, ReasonContextCancelled))
+					}
+					continue
+				}
+				r.writeMessage(req)
 			}
 		}
 	}
@@ -237,25 +389,47 @@ func (r *baseResolver) writeMessage(req *resolveRequest) {
 	if err := r.conn.SetWriteDeadline(time.Now().Add(2 * time.Second)); err != nil {
 		estr := fmt.Sprintf("Failed to set the write deadline: %v", err)
 
-		r.xchgs.remove(req.ID, req.Name)
-		r.returnRequest(req, makeResolveResult(nil, true, estr, TimeoutRcode))
+		r.failSend(req, estr)
 		return
 	}
 
-	if err := r.conn.WriteMsg(req.Msg); err != nil {
-		estr := fmt.Sprintf("Failed to write the query msg: %v", err)
+	// Set the timestamp for message expiration before a response can arrive
+	r.xchgs.updateTimestamp(req.ID, req.Name)
+	if err := r.writeQuery(req.Msg); err != nil {
+		r.failSend(req, fmt.Sprintf("Failed to write the query msg: %v", err))
+	}
+}
 
-		r.xchgs.remove(req.ID, req.Name)
-		r.returnRequest(req, makeResolveResult(nil, true, estr, TimeoutRcode))
-		return
+// failSend returns the request that could not be written, unless it was already returned,
+// such as by Stop, so each request delivers exactly one result.
+func (r *baseResolver) failSend(req *resolveRequest, estr string) {
+	if r.xchgs.remove(req.ID, req.Name) != nil {
+		r.returnRequest(req, makeResolveResult(nil, true, estr, TimeoutRcode, ReasonSendFailure))
 	}
+}
 
-	// Set the timestamp for message expiration
-	r.xchgs.updateTimestamp(req.ID, req.Name)
+// writeQuery packs the message into a buffer from the pool and writes it to the connection.
+func (r *baseResolver) writeQuery(msg *dns.Msg) error {
+	bp := packBufPool.Get().(*[]byte)
+	defer packBufPool.Put(bp)
+
+	out, err := msg.PackBuffer(*bp)
+	if err != nil {
+		return err
+	}
+	// Keep the larger buffer allocated for a message that did not fit
+	if cap(out) > cap(*bp) {
+		*bp = out[:cap(out)]
+	}
+
+	_, err = r.conn.Write(out)
+	return err
 }
 
 func (r *baseResolver) timeouts() {
-	t := time.NewTicker(500 * time.Millisecond)
+	r.labelGoroutine(PhaseExpire)
+
+	t := time.NewTicker(timeoutSweepInterval)
 	defer t.Stop()
 loop:
 	for {
@@ -263,22 +437,16 @@ loop:
 		case <-r.done:
 			break loop
 		case <-t.C:
-			for _, req := range r.xchgs.removeExpired() {
-				if req.Msg != nil {
-					estr := fmt.Sprintf("Query on resolver %s, for %s type %d timed out",
-						r.address, req.Name, req.Qtype)
-					r.returnRequest(req, makeResolveResult(nil, true, estr, TimeoutRcode))
-				}
-			}
+			r.expire(r.xchgs.removeExpired())
 		}
 	}
 	// Drains the xchgs of all messages and allows callers to return
-	for _, req := range r.xchgs.removeAll() {
+	estr := fmt.Sprintf("Resolver %s has stopped", r.address)
+	forEachRequest(r.xchgs.removeAll(), func(req *resolveRequest) {
 		if req.Msg != nil {
-			estr := fmt.Sprintf("Resolver %s has stopped", r.address)
-			r.returnRequest(req, makeResolveResult(nil, false, estr, ResolverErrRcode))
+			r.returnRequest(req, makeResolveResult(nil, false, estr, ResolverErrRcode, ReasonResolverStopped))
 		}
-	}
+	})
 }
 
 type readMsg struct {
@@ -286,29 +454,171 @@ type readMsg struct {
 	Resp *dns.Msg
 }
 
+// The buffers used to pack the queries, and the buffers, messages and queue elements used while
+// reading responses, are reused to reduce the pressure on the garbage collector at high packet rates.
+// Messages are only returned to the pool when dropped, since the responses accepted
+// are owned by the callers once provided.
+var (
+	packBufPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, dns.MinMsgSize)
+			return &b
+		},
+	}
+	readBufPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, dns.MinMsgSize)
+			return &b
+		},
+	}
+	readMsgPool = sync.Pool{
+		New: func() interface{} { return new(readMsg) },
+	}
+	dnsMsgPool = sync.Pool{
+		New: func() interface{} { return new(dns.Msg) },
+	}
+)
+
+// releaseMsg returns a message that was read and dropped to the pool for reuse.
+func releaseMsg(m *dns.Msg) {
+	if m == nil {
+		return
+	}
+
+	*m = dns.Msg{}
+	dnsMsgPool.Put(m)
+}
+
+// responses blocks reading the connection until Stop closes it, so idle resolvers consume no CPU.
 func (r *baseResolver) responses() {
+	defer close(r.readsDone)
+	r.labelGoroutine(PhaseParse)
+
 	for {
-		select {
-		case <-r.done:
-			return
-		default:
+		m, from, err := r.readResponse()
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			// Packets that were received but could not be unpacked are reported with the sender
+			if from != nil {
+				r.counters.drop(DropUnpackFailure, 1)
+			}
+			continue
+		}
+		if m == nil || len(m.Question) == 0 {
+			r.counters.drop(DropQuestionMismatch, 1)
+			releaseMsg(m)
+			continue
 		}
 
-		if m, err := r.conn.ReadMsg(); err == nil && m != nil && len(m.Question) > 0 {
-			rtime := time.Now()
-
-			if req := r.xchgs.remove(m.Id, m.Question[0].Name); req != nil {
-				r.sampleQueue.Append(rtime)
-
-				r.readMsgs.Append(&readMsg{
-					Req:  req,
-					Resp: m,
-				})
+		rtime := time.Now()
+		req, reason := r.xchgs.take(m.Id, m.Question[0].Name, func(req *resolveRequest) DropReason {
+			return r.checkResponse(req, m, from)
+		})
+		if reason != "" {
+			if reason != DropNoExchange {
+				atomic.AddUint64(&r.mismatches, 1)
 			}
+			r.counters.drop(reason, 1)
+			releaseMsg(m)
+			continue
+		}
+		if req.Encoded {
+			m.Question[0] = req.Question
+		}
+		r.sampleQueue.Append(rtime)
+		if !req.Timestamp.IsZero() {
+			r.rtt.observe(rtime.Sub(req.Timestamp))
+		}
+		r.counters.response(m.Rcode)
+
+		read := readMsgPool.Get().(*readMsg)
+		read.Req, read.Resp = req, m
+		if old := r.readMsgs.Append(read); old != nil {
+			r.dropResponse(old)
 		}
 	}
 }
 
+// dropResponse fails the query answered by a response that could not be queued, so it can be retried.
+func (r *baseResolver) dropResponse(read *readMsg) {
+	r.counters.drop(DropQueueOverflow, 1)
+
+	estr := fmt.Sprintf("The response from resolver %s, for %s type %d, was dropped since the queue was full",
+		r.address, read.Req.Name, read.Req.Qtype)
+	r.returnRequest(read.Req, makeResolveResult(nil, true, estr, TimeoutRcode, ReasonAttemptTimeout))
+
+	releaseMsg(read.Resp)
+	read.Req, read.Resp = nil, nil
+	readMsgPool.Put(read)
+}
+
+// readResponse reads the next message from the connection along with the address it was sent from.
+func (r *baseResolver) readResponse() (*dns.Msg, net.Addr, error) {
+	pc, ok := r.conn.Conn.(net.PacketConn)
+	if !ok {
+		m, err := r.conn.ReadMsg()
+		return m, r.conn.RemoteAddr(), err
+	}
+
+	size := r.conn.UDPSize
+	if size < dns.MinMsgSize {
+		size = dns.MinMsgSize
+	}
+
+	bp := readBufPool.Get().(*[]byte)
+	defer readBufPool.Put(bp)
+	if cap(*bp) < int(size) {
+		*bp = make([]byte, size)
+	}
+	buf := (*bp)[:size]
+
+	n, from, err := pc.ReadFrom(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := dnsMsgPool.Get().(*dns.Msg)
+	if err := m.Unpack(buf[:n]); err != nil {
+		releaseMsg(m)
+		return nil, from, err
+	}
+	return m, from, nil
+}
+
+// validResponse returns true when the response was sent by the resolver and answers the question sent.
+func (r *baseResolver) validResponse(req *resolveRequest, m *dns.Msg, from net.Addr) bool {
+	return r.checkResponse(req, m, from) == ""
+}
+
+// checkResponse returns the reason the response must be dropped, or an empty DropReason when it is valid.
+func (r *baseResolver) checkResponse(req *resolveRequest, m *dns.Msg, from net.Addr) DropReason {
+	if from == nil || from.String() != r.conn.RemoteAddr().String() {
+		return DropSourceMismatch
+	}
+
+	q := req.Msg.Question[0]
+	if len(m.Question) != 1 || m.Question[0].Qtype != q.Qtype || m.Question[0].Qclass != q.Qclass {
+		return DropQuestionMismatch
+	}
+	// Responses not echoing the case of the name sent are likely spoofed
+	if req.Encoded && !caseMatches(req, m) {
+		return DropQuestionMismatch
+	}
+	if !req.Encoded && !strings.EqualFold(m.Question[0].Name, q.Name) {
+		return DropQuestionMismatch
+	}
+	return ""
+}
+
+// responseMismatches returns the number of responses dropped for not matching the query sent.
+func (r *baseResolver) responseMismatches() uint64 {
+	return atomic.LoadUint64(&r.mismatches)
+}
+
 func (r *baseResolver) rateAdjustments() {
 	atMax := true
 
@@ -324,7 +634,7 @@ loop:
 
 		if r.sampleQueue.Len() < minSampleSetSize {
 			if !atMax {
-				r.setRateLimit(r.perSec)
+				r.setRateLimit(r.maxRate())
 				atMax = true
 			}
 			continue
@@ -365,37 +675,53 @@ func (r *baseResolver) calcNewRate(times []time.Time) {
 	}
 
 	// Calculate the new rate based on the samples collected
+	max := r.maxRate()
 	persec := int(time.Second / fastest)
 	if fastest > time.Second || persec <= 1 {
 		persec = 1
-	} else if persec > r.perSec {
-		persec = r.perSec
+	} else if persec > max {
+		persec = max
 	}
 	r.setRateLimit(persec + 1)
 }
 
 func (r *baseResolver) handleReads() {
-	each := func(element interface{}) {
-		if read, ok := element.(*readMsg); ok {
-			r.processMessage(read.Resp, read.Req)
-		}
+	r.labelGoroutine(PhaseProcess)
+
+	each := func(read *readMsg) {
+		r.processMessage(read.Resp, read.Req)
+
+		read.Req, read.Resp = nil, nil
+		readMsgPool.Put(read)
 	}
 loop:
 	for {
 		select {
 		case <-r.done:
 			break loop
-		case <-r.readMsgs.Signal():
-			if e, ok := r.readMsgs.Next(); ok {
-				each(e)
-			}
+		case <-r.readMsgs.Ready():
+			r.readMsgs.Drain(each)
 		}
 	}
-	// Drains the queue of all messages and allows callers to return
-	r.readMsgs.Process(each)
+	// Drains the queue of all messages and allows callers to return,
+	// once no more responses can be read from the connection
+	<-r.readsDone
+	r.readMsgs.Drain(each)
 }
 
 func (r *baseResolver) processMessage(m *dns.Msg, req *resolveRequest) {
+	// Provide feedback for the adaptive rate limiting
+	if m.Rcode == dns.RcodeRefused || m.Rcode == dns.RcodeServerFailure {
+		r.aimd.congestion()
+	} else {
+		r.aimd.success()
+	}
+
+	// Old forwarders reject the OPT record or its options
+	if ednsRejected(m) {
+		r.edns.downgrade(req.Msg)
+	}
+
 	// Check that the query was successful
 	if m.Rcode != dns.RcodeSuccess {
 		var again bool
@@ -409,7 +735,7 @@ func (r *baseResolver) processMessage(m *dns.Msg, req *resolveRequest) {
 
 		estr := fmt.Sprintf("Query on resolver %s, for %s type %d returned error %s",
 			r.address, req.Name, req.Qtype, dns.RcodeToString[m.Rcode])
-		r.returnRequest(req, makeResolveResult(m, again, estr, m.Rcode))
+		r.returnRequest(req, makeResolveResult(m, again, estr, m.Rcode, ReasonErrorRcode))
 		return
 	}
 
@@ -434,13 +760,18 @@ func (r *baseResolver) tcpExchange(req *resolveRequest) {
 	m, _, err := client.Exchange(req.Msg, r.address)
 	if err != nil {
 		estr := fmt.Sprintf("Failed to perform the exchange via TCP to %s: %v", r.address, err)
-		r.returnRequest(req, makeResolveResult(nil, true, estr, ResolverErrRcode))
+		r.returnRequest(req, makeResolveResult(nil, true, estr, ResolverErrRcode, ReasonTruncated))
 		return
 	}
+	if req.Encoded && len(m.Question) > 0 {
+		m.Question[0] = req.Question
+	}
+	r.counters.response(m.Rcode)
 
 	r.returnRequest(req, &resolveResult{
-		Msg:   m,
-		Again: false,
-		Err:   nil,
+		Msg:       m,
+		Again:     false,
+		Err:       nil,
+		Transport: TransportTCP,
 	})
 }
@@ -5,7 +5,10 @@ package resolve
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -73,6 +76,38 @@ func TestQueryTimeout(t *testing.T) {
 	if e, ok := err.(*ResolveError); ok && e.Rcode != TimeoutRcode {
 		t.Errorf("The query did not return the correct error code")
 	}
+	// A single attempt that timed out was not retried
+	if reason := ErrorReason(err); reason != ReasonAttemptTimeout {
+		t.Errorf("The query returned reason %s instead of %s", reason, ReasonAttemptTimeout)
+	}
+}
+
+func TestQueryRetriesExhausted(t *testing.T) {
+	// The server never responds to the queries
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 10, nil)
+	defer r.Stop()
+
+	var attempts int
+	retry := func(times, priority int, m *dns.Msg) bool {
+		attempts = times
+		return times < 2
+	}
+	_, err = r.Query(context.TODO(), QueryMsg("exhausted.org", 1), PriorityNormal, retry)
+	if attempts != 2 {
+		t.Errorf("The query was attempted %d times", attempts)
+	}
+	if reason := ErrorReason(err); reason != ReasonTimeout {
+		t.Errorf("The retried query returned reason %s instead of %s", reason, ReasonTimeout)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("The retried query did not return ErrTimeout")
+	}
 }
 
 func typeAHandler(w dns.ResponseWriter, req *dns.Msg) {
@@ -98,11 +133,15 @@ func timeoutHandler(w dns.ResponseWriter, req *dns.Msg) {
 }
 
 func runLocalUDPServer(laddr string) (*dns.Server, string, chan error, error) {
+	return runLocalUDPHandlerServer(laddr, nil)
+}
+
+func runLocalUDPHandlerServer(laddr string, handler dns.Handler) (*dns.Server, string, chan error, error) {
 	pc, err := net.ListenPacket("udp", laddr)
 	if err != nil {
 		return nil, "", nil, err
 	}
-	server := &dns.Server{PacketConn: pc, ReadTimeout: time.Hour, WriteTimeout: time.Hour}
+	server := &dns.Server{PacketConn: pc, Handler: handler, ReadTimeout: time.Hour, WriteTimeout: time.Hour}
 
 	waitLock := sync.Mutex{}
 	waitLock.Lock()
@@ -153,5 +192,209 @@ func TestEdgeCases(t *testing.T) {
 	r.Stop()
 	if _, err := r.Query(ctx, QueryMsg("google.com", 1), PriorityNormal, nil); err == nil {
 		t.Errorf("Query was successful when provided a stopped Resolver")
+	} else if reason := ErrorReason(err); reason != ReasonResolverStopped {
+		t.Errorf("The query returned reason %s instead of %s", reason, ReasonResolverStopped)
+	}
+}
+
+func TestResponseValidation(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		// Respond with a question that does not match the query sent
+		if req.Question[0].Name == "wrongtype.valid.net." {
+			req.Question[0].Qtype = dns.TypeAAAA
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if _, err := r.Query(context.TODO(), QueryMsg("www.valid.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The query with a matching response failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := r.Query(ctx, QueryMsg("wrongtype.valid.net", dns.TypeA), PriorityNormal, nil); err == nil {
+		t.Errorf("The response with a mismatched question was accepted")
+	}
+	if stats := pool.Stats(); len(stats) != 1 || stats[0].Mismatches != 1 {
+		t.Errorf("The mismatched response was not counted: %+v", stats)
+	}
+
+	base := r.(*baseResolver)
+	req := base.newRequest(context.TODO(), QueryMsg("www.valid.net", dns.TypeA))
+	resp := new(dns.Msg)
+	resp.SetReply(req.Msg)
+	if !base.validResponse(req, resp, base.conn.RemoteAddr()) {
+		t.Errorf("The matching response was rejected")
+	}
+	if base.validResponse(req, resp, &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}) {
+		t.Errorf("The response from another address was accepted")
+	}
+}
+
+func TestPooledReadBuffers(t *testing.T) {
+	num := 100
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		// The response exceeds the size of the buffers initially in the pool
+		for i := 0; i < num; i++ {
+			m.Answer = append(m.Answer, mustRR(t, fmt.Sprintf("%s 60 IN A 192.0.2.%d", req.Question[0].Name, i+1)))
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	for i := 0; i < 5; i++ {
+		resp, err := r.Query(context.TODO(), QueryMsg("large.pooled.net", dns.TypeA), PriorityNormal, nil)
+		if err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+		if len(resp.Answer) != num {
+			t.Errorf("The response contained %d answers instead of %d", len(resp.Answer), num)
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("dropped.pooled.net.", dns.TypeA)
+	m.Compress = true
+	releaseMsg(m)
+	if m.Id != 0 || m.Compress || len(m.Question) != 0 {
+		t.Errorf("The released message was not reset before reuse")
+	}
+}
+
+func TestStopUnblocksReads(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	if _, err := r.Query(context.TODO(), QueryMsg("www.blocking.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+
+	base := r.(*baseResolver)
+	select {
+	case <-base.readsDone:
+		t.Fatalf("The goroutine reading responses returned before the resolver was stopped")
+	default:
+	}
+
+	r.Stop()
+	select {
+	case <-base.readsDone:
+	case <-time.After(time.Second):
+		t.Errorf("The goroutine reading responses remained blocked after the resolver was stopped")
+	}
+}
+
+func TestWriteQueryPooledBuffers(t *testing.T) {
+	// The server of the tests reads only 512 bytes, so the packets are read from the socket directly
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen for the queries: %v", err)
+	}
+	defer pc.Close()
+
+	r := NewBaseResolver(pc.LocalAddr().String(), 100, nil)
+	defer r.Stop()
+	base := r.(*baseResolver)
+
+	large := QueryMsg("large.packed.net", dns.TypeA)
+	// The query exceeds the size of the buffers initially in the pool
+	large.Extra = append(large.Extra, mustRR(t, "large.packed.net. 0 IN TXT \""+strings.Repeat("a", 250)+"\" \""+strings.Repeat("b", 250)+"\""))
+	for _, msg := range []*dns.Msg{large, QueryMsg("small.packed.net", dns.TypeA)} {
+		if err := base.writeQuery(msg); err != nil {
+			t.Fatalf("Failed to write the query: %v", err)
+		}
+
+		buf := make([]byte, dns.DefaultMsgSize)
+		_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("The query was not received: %v", err)
+		}
+
+		req := new(dns.Msg)
+		if err := req.Unpack(buf[:n]); err != nil || req.Id != msg.Id ||
+			req.Question[0].Name != msg.Question[0].Name || len(req.Extra) != len(msg.Extra) {
+			t.Errorf("The query received did not match the message written: %v", err)
+		}
+	}
+}
+
+func TestIdentifierCollision(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 10, nil)
+	defer r.Stop()
+	base := r.(*baseResolver)
+
+	// The same message identifier and name are used by both queries
+	msg := QueryMsg("collision.net", dns.TypeA)
+	first := base.newRequest(context.TODO(), msg)
+	first.Result = make(chan *resolveResult, 1)
+	if err := base.xchgs.add(first); err != nil {
+		t.Fatalf("Failed to add the request: %v", err)
+	}
+	defer base.xchgs.remove(first.ID, first.Name)
+
+	resp, err := r.Query(context.TODO(), msg, PriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("The query colliding with another query failed: %v", err)
+	}
+	if resp.Id != msg.Id {
+		t.Errorf("The response returned identifier %d instead of %d", resp.Id, msg.Id)
+	}
+	if ans := ExtractAnswers(resp); len(ans) == 0 || ans[0].Data != "192.168.1.1" {
+		t.Errorf("The query did not return the expected IP address")
+	}
+}
+
+func TestSingleResultPerRequest(t *testing.T) {
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	defer r.Stop()
+	base := r.(*baseResolver)
+
+	req := base.newRequest(context.TODO(), QueryMsg("single.result.net", dns.TypeA))
+	req.Result = make(chan *resolveResult, 1)
+	if err := base.xchgs.add(req); err != nil {
+		t.Fatalf("Failed to add the request: %v", err)
+	}
+
+	// The request was already returned, such as when the resolver is stopped
+	base.xchgs.removeAll()
+	base.failSend(req, "The write failed")
+	if n := len(req.Result); n != 0 {
+		t.Errorf("The request that failed to send delivered %d results after it was returned", n)
+	}
+
+	if err := base.xchgs.add(req); err != nil {
+		t.Fatalf("Failed to add the request: %v", err)
+	}
+	base.failSend(req, "The write failed")
+	if res := <-req.Result; ErrorReason(res.Err) != ReasonSendFailure {
+		t.Errorf("The request that failed to send was returned with %v", res.Err)
 	}
 }
@@ -0,0 +1,109 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// The bounds on the number of batch queries performed at the same time.
+const (
+	minBatchConcurrency = 10
+	maxBatchConcurrency = 10000
+)
+
+// SetBatchOrder sets the sequence in which QueryBatch submits the names, defaulting to OrderAsGiven.
+func (rp *ResolverPool) SetBatchOrder(order NameOrder) {
+	defer rp.configChanged("batch_order", "enabled", order != nil)
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.batchOrder = order
+}
+
+// batchConcurrency allows roughly one second of queries outstanding for each resolver in the pool.
+func (rp *ResolverPool) batchConcurrency() int {
+	var n int
+
+	for _, r := range rp.resolvers() {
+		if rl, ok := r.(rateLimitedResolver); ok {
+			n += rl.maxRate()
+		} else {
+			n++
+		}
+	}
+
+	if n < minBatchConcurrency {
+		n = minBatchConcurrency
+	} else if n > maxBatchConcurrency {
+		n = maxBatchConcurrency
+	}
+	return n
+}
+
+// QueryBatch queries each of the provided names for the qtype, and returns the results in the
+// same order as the names. The number of queries performed at the same time is managed internally.
+// An error is returned, without performing the queries, when the NameOrder set for the pool does
+// not provide each index of the names exactly once.
+func (rp *ResolverPool) QueryBatch(ctx context.Context, names []string, qtype uint16) ([]Result, error) {
+	results := make([]Result, len(names))
+	if len(names) == 0 {
+		return results, nil
+	}
+
+	rp.Lock()
+	order := rp.batchOrder
+	rp.Unlock()
+	if order == nil {
+		order = OrderAsGiven
+	}
+
+	idxs := order.Order(names)
+	if err := checkOrder(idxs, len(names)); err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, rp.batchConcurrency())
+	for _, idx := range idxs {
+		if err := checkContext(ctx); err != nil {
+			results[idx].Err = err
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			res := QueryResult(ctx, rp, QueryMsg(names[i], qtype), PriorityNormal, PoolRetryPolicy)
+			results[i] = *res
+		}(idx)
+	}
+
+	wg.Wait()
+	return results, nil
+}
+
+// checkOrder returns an error when the indices are not a permutation of the indices of n names.
+func checkOrder(idxs []int, n int) error {
+	if len(idxs) != n {
+		return fmt.Errorf("QueryBatch: The order provided %d indices for %d names", len(idxs), n)
+	}
+
+	seen := make([]bool, n)
+	for _, idx := range idxs {
+		if idx < 0 || idx >= n {
+			return fmt.Errorf("QueryBatch: The order provided the index %d for %d names", idx, n)
+		}
+		if seen[idx] {
+			return fmt.Errorf("QueryBatch: The order provided the index %d more than once", idx)
+		}
+		seen[idx] = true
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestQueryBatch(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if strings.HasPrefix(req.Question[0].Name, "missing") {
+			nxdomainHandler(w, req)
+			return
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetBatchOrder(OrderShuffled)
+
+	var names []string
+	for i := 0; i < 50; i++ {
+		prefix := "host"
+		if i%5 == 0 {
+			prefix = "missing"
+		}
+		names = append(names, fmt.Sprintf("%s%d.batch.net", prefix, i))
+	}
+
+	results, err := pool.QueryBatch(context.TODO(), names, dns.TypeA)
+	if err != nil {
+		t.Fatalf("QueryBatch failed: %v", err)
+	}
+	if len(results) != len(names) {
+		t.Fatalf("QueryBatch returned %d results for %d names", len(results), len(names))
+	}
+
+	for i, res := range results {
+		if i%5 == 0 {
+			if e, ok := res.Err.(*ResolveError); !ok || e.Rcode != dns.RcodeNameError {
+				t.Errorf("The result for %s was %v instead of NXDOMAIN", names[i], res.Err)
+			}
+			continue
+		}
+
+		if res.Err != nil || res.Msg == nil {
+			t.Errorf("The query for %s failed: %v", names[i], res.Err)
+		} else if q := RemoveLastDot(res.Msg.Question[0].Name); q != names[i] {
+			t.Errorf("The result for %s contained the response for %s", names[i], q)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, _ = pool.QueryBatch(ctx, names[:3], dns.TypeA)
+	for _, res := range results {
+		if res.Err == nil {
+			t.Errorf("A batch query succeeded with an expired context")
+		}
+	}
+}
+
+func TestQueryBatchInvalidOrder(t *testing.T) {
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.1:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	names := []string{"a.batch.net", "b.batch.net", "c.batch.net"}
+	for _, order := range [][]int{{0, 1, 3}, {0, 1, 1}, {0, 1}, {-1, 0, 1}} {
+		idxs := order
+		pool.SetBatchOrder(NameOrderFunc(func(names []string) []int { return idxs }))
+
+		if results, err := pool.QueryBatch(context.TODO(), names, dns.TypeA); err == nil || results != nil {
+			t.Errorf("The order %v was accepted for %d names", order, len(names))
+		}
+	}
+}
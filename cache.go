@@ -0,0 +1,363 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Cache is implemented by the stores that can hold the responses cached by a ResolverPool.
+// Values are opaque to the store, and implementations backed by shared services, such as
+// Redis or memcached, allow the responses to be shared across processes.
+type Cache interface {
+	// Get returns the value stored for the key, unless it is missing or its TTL has expired.
+	Get(key string) ([]byte, bool)
+	// Set stores the value for the key until the TTL expires.
+	Set(key string, value []byte, ttl time.Duration)
+	// Delete removes the value stored for the key.
+	Delete(key string)
+}
+
+// memoryEntryOverhead approximates the bytes occupied by each value beyond its key and value.
+const memoryEntryOverhead = 96
+
+// MemoryCacheConfig tunes the behavior of the Cache returned by NewMemoryCacheWithConfig.
+type MemoryCacheConfig struct {
+	// MaxEntries is the number of values the cache can hold. Zero or less places no limit.
+	MaxEntries int
+	// MaxBytes is the approximate memory the values can occupy. Zero or less places no limit.
+	MaxBytes int64
+	// Policy selects the value evicted when a limit has been reached.
+	Policy EvictionPolicy
+}
+
+// memoryCache is a Cache that evicts values selected by the policy when it is full.
+type memoryCache struct {
+	sync.Mutex
+	config    MemoryCacheConfig
+	entries   map[string]*memoryEntry
+	order     evictionOrder
+	bytes     int64
+	evictions uint64
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+	// The state maintained by the eviction policy
+	hits int
+	idx  int
+	el   *list.Element
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key)+len(e.value)) + memoryEntryOverhead
+}
+
+// NewMemoryCache returns a Cache held in memory with room for the provided number of values,
+// which evicts the least recently used value when it is full.
+func NewMemoryCache(entries int) Cache {
+	if entries <= 0 {
+		entries = 1
+	}
+	return NewMemoryCacheWithConfig(MemoryCacheConfig{MaxEntries: entries})
+}
+
+// NewMemoryCacheWithConfig returns a Cache held in memory with the limits and eviction policy
+// provided in the configuration. Without any limit, the cache grows until values expire.
+func NewMemoryCacheWithConfig(config MemoryCacheConfig) Cache {
+	return &memoryCache{
+		config:  config,
+		entries: make(map[string]*memoryEntry),
+		order:   newEvictionOrder(config.Policy),
+	}
+}
+
+// Get implements the Cache interface.
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expires) {
+		c.remove(entry)
+		return nil, false
+	}
+
+	c.order.touch(entry)
+	return entry.value, true
+}
+
+// Set implements the Cache interface.
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) {
+	entry := &memoryEntry{
+		key:     key,
+		value:   value,
+		expires: time.Now().Add(ttl),
+	}
+	if c.config.MaxBytes > 0 && entry.size() > c.config.MaxBytes {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if old, found := c.entries[key]; found {
+		entry.hits = old.hits
+		c.remove(old)
+	}
+	for c.full(entry) {
+		c.remove(c.order.victim())
+		c.evictions++
+	}
+
+	c.entries[key] = entry
+	c.bytes += entry.size()
+	c.order.add(entry)
+}
+
+// Delete implements the Cache interface.
+func (c *memoryCache) Delete(key string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if entry, found := c.entries[key]; found {
+		c.remove(entry)
+	}
+}
+
+// Evictions returns the number of values removed from the cache to respect the limits.
+func (c *memoryCache) Evictions() uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.evictions
+}
+
+// full returns true when storing the entry would exceed a limit. The lock must already be held by the caller.
+func (c *memoryCache) full(entry *memoryEntry) bool {
+	if len(c.entries) == 0 {
+		return false
+	}
+	if c.config.MaxEntries > 0 && len(c.entries) >= c.config.MaxEntries {
+		return true
+	}
+	return c.config.MaxBytes > 0 && c.bytes+entry.size() > c.config.MaxBytes
+}
+
+// remove drops the entry from the cache. The lock must already be held by the caller.
+func (c *memoryCache) remove(entry *memoryEntry) {
+	c.order.remove(entry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size()
+}
+
+// responseCache stores positive responses in the Cache until the TTLs of their answers expire,
+// or for the additional stale period when serving stale responses has been enabled.
+type responseCache struct {
+	// stale is the nanoseconds responses are retained after expiring, accessed atomically
+	stale  int64
+	hits   uint64
+	misses uint64
+	served uint64
+	store  Cache
+}
+
+// CacheStats contains the counters maintained for the cache of a ResolverPool.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Stale is the number of expired responses served after the resolvers failed.
+	Stale uint64
+	// Evictions is the number of values removed to respect the limits of the Cache,
+	// which is only available from Cache implementations that provide the Evictions method.
+	Evictions uint64
+}
+
+// cacheMode selects how a query uses the cache of a ResolverPool.
+type cacheMode int
+
+const (
+	cacheDefault cacheMode = iota
+	cacheBypass
+	cacheOnly
+)
+
+type cacheModeKey struct{}
+
+func cacheModeFromContext(ctx context.Context) cacheMode {
+	mode, _ := ctx.Value(cacheModeKey{}).(cacheMode)
+	return mode
+}
+
+// cacheMissError is returned when a query restricted to the cache has no response available.
+func cacheMissError(msg *dns.Msg) error {
+	var name string
+	if len(msg.Question) > 0 {
+		name = RemoveLastDot(msg.Question[0].Name)
+	}
+
+	return &ResolveError{
+		Err:    fmt.Sprintf("Cache: No cached response is available for %s", name),
+		Rcode:  ResolverErrRcode,
+		Reason: ReasonCacheMiss,
+	}
+}
+
+// evictionCounter is implemented by the Cache stores that count the values they evict.
+type evictionCounter interface {
+	Evictions() uint64
+}
+
+// get returns a copy of the cached response for the question in the message, with the TTLs
+// reduced by the time spent in the cache, or nil when the response is missing or expired.
+// The fraction of the TTL remaining for the response is also returned.
+func (c *responseCache) get(key string, msg *dns.Msg) (*dns.Msg, float64) {
+	resp, age, ttl := c.lookup(key, msg)
+	if resp == nil || age >= ttl {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, 0
+	}
+	atomic.AddUint64(&c.hits, 1)
+
+	ageRecords(resp, uint32(age/time.Second))
+	return resp, float64(ttl-age) / float64(ttl)
+}
+
+// lookup returns a copy of the cached response, including expired responses still retained,
+// along with the time spent in the cache and the TTL the response was stored with.
+func (c *responseCache) lookup(key string, msg *dns.Msg) (*dns.Msg, time.Duration, time.Duration) {
+	value, found := c.store.Get(key)
+	if !found {
+		return nil, 0, 0
+	}
+
+	resp, stored, err := decodeCacheValue(value)
+	if err != nil {
+		c.store.Delete(key)
+		return nil, 0, 0
+	}
+
+	ttl, _ := cacheTTL(resp)
+	resp.Id = msg.Id
+	resp.Question = msg.Question
+	return resp, time.Since(stored), ttl
+}
+
+// set stores the response when it is positive and its answers have a TTL greater than zero.
+func (c *responseCache) set(key string, resp *dns.Msg) {
+	ttl, ok := cacheTTL(resp)
+	if !ok {
+		return
+	}
+
+	if value, err := encodeCacheValue(resp, time.Now()); err == nil {
+		c.store.Set(key, value, ttl+time.Duration(atomic.LoadInt64(&c.stale)))
+	}
+}
+
+// encodeCacheValue provides the time the response was stored, followed by the response in wire format.
+func encodeCacheValue(resp *dns.Msg, stored time.Time) ([]byte, error) {
+	packed, err := resp.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, 8, 8+len(packed))
+	binary.BigEndian.PutUint64(value, uint64(stored.UnixNano()))
+	return append(value, packed...), nil
+}
+
+func decodeCacheValue(value []byte) (*dns.Msg, time.Time, error) {
+	if len(value) < 8 {
+		return nil, time.Time{}, dns.ErrShortRead
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(value[8:]); err != nil {
+		return nil, time.Time{}, err
+	}
+	return resp, time.Unix(0, int64(binary.BigEndian.Uint64(value))), nil
+}
+
+// cacheTTL returns the smallest TTL among the answers of a positive response.
+func cacheTTL(resp *dns.Msg) (time.Duration, bool) {
+	if resp == nil || resp.Rcode != dns.RcodeSuccess || resp.Truncated || len(resp.Answer) == 0 {
+		return 0, false
+	}
+
+	min := resp.Answer[0].Header().Ttl
+	for _, rr := range resp.Answer[1:] {
+		if ttl := rr.Header().Ttl; ttl < min {
+			min = ttl
+		}
+	}
+	if min == 0 {
+		return 0, false
+	}
+	return time.Duration(min) * time.Second, true
+}
+
+// ageRecords reduces the TTLs of the records in the response by the provided number of seconds.
+func ageRecords(resp *dns.Msg, secs uint32) {
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				continue
+			}
+			if hdr.Ttl > secs {
+				hdr.Ttl -= secs
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+}
+
+// SetCache places the Cache in front of the pool, where positive responses are held until
+// the TTLs of their answers expire. A nil Cache disables caching.
+func (rp *ResolverPool) SetCache(c Cache) {
+	defer rp.configChanged("cache", "enabled", c != nil)
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.cache = nil
+	if c != nil {
+		rp.cache = &responseCache{store: c, stale: int64(rp.staleWindow)}
+	}
+}
+
+// CacheStats returns the counters maintained for the cache provided to SetCache.
+func (rp *ResolverPool) CacheStats() CacheStats {
+	rp.Lock()
+	cache := rp.cache
+	rp.Unlock()
+
+	if cache == nil {
+		return CacheStats{}
+	}
+
+	stats := CacheStats{
+		Hits:   atomic.LoadUint64(&cache.hits),
+		Misses: atomic.LoadUint64(&cache.misses),
+		Stale:  atomic.LoadUint64(&cache.served),
+	}
+	if ec, ok := cache.store.(evictionCounter); ok {
+		stats.Evictions = ec.Evictions()
+	}
+	return stats
+}
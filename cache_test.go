@@ -0,0 +1,208 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ttlHandler answers with the TTL provided as the first label of the name, and counts the queries.
+func ttlHandler(count *int32) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		name := req.Question[0].Name
+		if strings.HasSuffix(name, "cache.net.") {
+			atomic.AddInt32(count, 1)
+		}
+
+		var ttl uint32
+		_, _ = fmt.Sscanf(name, "ttl%d.", &ttl)
+
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   net.ParseIP("192.168.1.1"),
+		})
+		_ = w.WriteMsg(m)
+	}
+}
+
+func TestPoolCache(t *testing.T) {
+	var count int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", ttlHandler(&count))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetCache(NewMemoryCache(10))
+
+	for i := 0; i < 5; i++ {
+		msg := QueryMsg("ttl300.cache.net", dns.TypeA)
+		resp, err := pool.Query(context.TODO(), msg, PriorityNormal, nil)
+		if err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+		if resp.Id != msg.Id || len(resp.Answer) != 1 {
+			t.Errorf("The cached response did not match the query")
+		}
+	}
+	if n := atomic.LoadInt32(&count); n != 1 {
+		t.Errorf("%d queries were sent for the cached response", n)
+	}
+	if stats := pool.CacheStats(); stats.Hits != 4 || stats.Misses != 1 {
+		t.Errorf("The cache counted %d hits and %d misses instead of 4 and 1", stats.Hits, stats.Misses)
+	}
+
+	// Responses without a TTL are not cached
+	atomic.StoreInt32(&count, 0)
+	for i := 0; i < 2; i++ {
+		_, _ = pool.Query(context.TODO(), QueryMsg("ttl0.cache.net", dns.TypeA), PriorityNormal, nil)
+	}
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Errorf("%d queries were sent instead of 2 for the uncacheable response", n)
+	}
+
+	// Responses are removed once the TTL expires
+	atomic.StoreInt32(&count, 0)
+	_, _ = pool.Query(context.TODO(), QueryMsg("ttl1.cache.net", dns.TypeA), PriorityNormal, nil)
+	time.Sleep(1100 * time.Millisecond)
+	_, _ = pool.Query(context.TODO(), QueryMsg("ttl1.cache.net", dns.TypeA), PriorityNormal, nil)
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Errorf("%d queries were sent instead of 2 for the expired response", n)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	c := NewMemoryCache(2)
+
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(key, []byte(key), time.Minute)
+		// Keep the first value recently used
+		c.Get("a")
+	}
+
+	if _, found := c.Get("a"); !found {
+		t.Errorf("The recently used value was evicted")
+	}
+	if _, found := c.Get("b"); found {
+		t.Errorf("The least recently used value was not evicted")
+	}
+
+	c.Delete("a")
+	if _, found := c.Get("a"); found {
+		t.Errorf("The deleted value was returned")
+	}
+
+	c.Set("expired", []byte("expired"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, found := c.Get("expired"); found {
+		t.Errorf("The expired value was returned")
+	}
+}
+
+func TestCacheValue(t *testing.T) {
+	c := &responseCache{store: NewMemoryCache(10)}
+
+	resp := new(dns.Msg)
+	resp.SetQuestion("value.cache.net.", dns.TypeA)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "value.cache.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP("192.168.1.1"),
+	}}
+	c.set("value", resp)
+
+	msg := QueryMsg("value.cache.net", dns.TypeA)
+	cached, left := c.get("value", msg)
+	if cached == nil || cached.Id != msg.Id || len(cached.Answer) != 1 {
+		t.Fatalf("The cached response was not returned")
+	}
+	if left <= 0.9 || left > 1 {
+		t.Errorf("The fraction of the TTL remaining was %f", left)
+	}
+
+	// Values that cannot be decoded are removed from the store
+	c.store.Set("corrupt", []byte{1, 2, 3}, time.Minute)
+	if resp, _ := c.get("corrupt", msg); resp != nil {
+		t.Errorf("The corrupt value was returned as a response")
+	}
+	if _, found := c.store.Get("corrupt"); found {
+		t.Errorf("The corrupt value was not deleted")
+	}
+}
+
+func TestAgeRecords(t *testing.T) {
+	resp := new(dns.Msg)
+	resp.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "age.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP("192.168.1.1"),
+	}}
+	resp.SetEdns0(dns.DefaultMsgSize, false)
+
+	ageRecords(resp, 20)
+	if ttl := resp.Answer[0].Header().Ttl; ttl != 40 {
+		t.Errorf("The TTL was %d instead of 40", ttl)
+	}
+	ageRecords(resp, 50)
+	if ttl := resp.Answer[0].Header().Ttl; ttl != 0 {
+		t.Errorf("The TTL was %d instead of 0", ttl)
+	}
+	if resp.IsEdns0() == nil {
+		t.Errorf("The OPT record was modified")
+	}
+}
+
+func TestCacheModes(t *testing.T) {
+	var count int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", ttlHandler(&count))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetCache(NewMemoryCache(10))
+
+	name := "ttl300.modes.cache.net"
+	if res := LookupResult(context.TODO(), pool, name, WithCacheOnly()); ErrorReason(res.Err) != ReasonCacheMiss {
+		t.Errorf("The cache-only lookup did not report a cache miss: %v", res.Err)
+	}
+	if n := atomic.LoadInt32(&count); n != 0 {
+		t.Errorf("The cache-only lookup sent %d queries", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := LookupResult(context.TODO(), pool, name, WithCacheBypass()); res.Err != nil {
+			t.Fatalf("The lookup bypassing the cache failed: %v", res.Err)
+		}
+	}
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Errorf("The lookups bypassing the cache sent %d queries instead of 2", n)
+	}
+
+	// The response obtained while bypassing the cache was still stored
+	if res := LookupResult(context.TODO(), pool, name, WithCacheOnly()); res.Err != nil || res.Msg == nil {
+		t.Errorf("The cache-only lookup did not provide the cached response: %v", res.Err)
+	}
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Errorf("The cache-only lookup sent a query")
+	}
+
+	// Resolvers without a cache cannot satisfy cache-only lookups
+	if res := LookupResult(context.TODO(), r, name, WithCacheOnly()); ErrorReason(res.Err) != ReasonCacheMiss {
+		t.Errorf("The cache-only lookup without a cache did not report a cache miss: %v", res.Err)
+	}
+}
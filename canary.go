@@ -0,0 +1,92 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Canary is a name with known A record answers used to detect resolvers that tamper with responses.
+type Canary struct {
+	Name    string
+	Answers []string
+}
+
+// CanaryConfig controls the tamper checks performed by CheckCanaries.
+type CanaryConfig struct {
+	Canaries []Canary
+	// Interval is the time between checks of the resolvers in the pool.
+	Interval time.Duration
+	// Evict causes resolvers that deviate from the known answers to be removed from the pool
+	// and stopped, instead of only being counted in the pool statistics.
+	Evict bool
+}
+
+// CheckCanaries queries the canary names through each resolver in the pool immediately,
+// and again on the configured interval until the pool is stopped. Resolvers returning
+// answers that deviate from the known answers are counted in the CanaryFailures statistic.
+func (rp *ResolverPool) CheckCanaries(config CanaryConfig) {
+	if len(config.Canaries) == 0 || config.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		rp.checkCanaries(config)
+		rp.periodically(config.Interval, func() { rp.checkCanaries(config) })
+	}()
+}
+
+// checkCanaries returns the addresses of the resolvers that tampered with a canary answer.
+func (rp *ResolverPool) checkCanaries(config CanaryConfig) []string {
+	var tampered []string
+
+	timeout := 2 * rp.queryTimeout()
+	for _, r := range rp.resolvers() {
+		if r.Stopped() {
+			continue
+		}
+
+		var failures int
+		for _, c := range config.Canaries {
+			if canaryTampered(r, c, timeout) {
+				failures++
+			}
+		}
+		if failures == 0 {
+			continue
+		}
+
+		rp.stats.canaryFailures(r.String(), failures)
+		tampered = append(tampered, r.String())
+		rp.logEvent(LevelWarn, "Resolver returned unexpected canary answers", "resolver", r.String(), "failures", failures)
+	}
+
+	if config.Evict {
+		for _, r := range rp.removeResolvers(tampered) {
+			rp.logEvent(LevelWarn, "Evicting resolver", "resolver", r.String(), "reason", EvictCanaryFailures)
+			r.Stop()
+			rp.notifyEvict(r.String(), EvictCanaryFailures)
+		}
+	}
+	return tampered
+}
+
+func canaryTampered(r Resolver, c Canary, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp, err := r.Query(ctx, QueryMsg(c.Name, dns.TypeA), PriorityHigh, nil)
+	if err != nil {
+		// Only a claim that the canary does not exist is a deviation,
+		// since timeouts and other failures are not evidence of tampering
+		e, ok := err.(*ResolveError)
+		return ok && e.Rcode == dns.RcodeNameError
+	}
+
+	answers := AnswersByType(ExtractAnswers(resp), dns.TypeA)
+	return len(answers) == 0 || !answersExpected(answers, c.Answers)
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCheckCanaries(t *testing.T) {
+	good, gaddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer good.Shutdown()
+
+	censor, caddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(nxdomainHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer censor.Shutdown()
+
+	censored := NewBaseResolver(caddr, 100, nil)
+	pool := NewResolverPool([]Resolver{NewBaseResolver(gaddr, 100, nil), censored}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	config := CanaryConfig{
+		Canaries: []Canary{{Name: "canary.net", Answers: []string{"192.168.1.1"}}},
+		Interval: time.Minute,
+	}
+	if tampered := pool.checkCanaries(config); len(tampered) != 1 || tampered[0] != caddr {
+		t.Errorf("The canary check flagged %v instead of the censoring resolver", tampered)
+	}
+
+	for _, st := range pool.Stats() {
+		if st.Address == caddr && st.CanaryFailures != 1 {
+			t.Errorf("The stats counted %d canary failures instead of 1", st.CanaryFailures)
+		} else if st.Address == gaddr && st.CanaryFailures != 0 {
+			t.Errorf("The stats counted canary failures for the honest resolver")
+		}
+	}
+
+	config.Evict = true
+	pool.checkCanaries(config)
+	if !censored.Stopped() {
+		t.Errorf("The censoring resolver was not stopped")
+	}
+	if addrs := pool.resolverAddrs(); len(addrs) != 1 || addrs[0] != gaddr {
+		t.Errorf("The pool contains %v after the eviction", addrs)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"crypto/rand"
+
+	"github.com/miekg/dns"
+)
+
+// encode0x20 returns a copy of the message with the case of the letters in the question name randomized.
+func encode0x20(msg *dns.Msg) *dns.Msg {
+	name := []byte(msg.Question[0].Name)
+
+	bits := make([]byte, len(name))
+	if _, err := rand.Read(bits); err != nil {
+		return msg
+	}
+
+	for i, c := range name {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			if bits[i]&1 == 1 {
+				c |= 0x20
+			} else {
+				c &^= 0x20
+			}
+			name[i] = c
+		}
+	}
+
+	m := msg.Copy()
+	m.Question[0].Name = string(name)
+	return m
+}
+
+// caseMatches returns true when the question name in the response exactly matches the name that was sent.
+func caseMatches(req *resolveRequest, resp *dns.Msg) bool {
+	return resp.Question[0].Name == req.Msg.Question[0].Name
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestEncode0x20(t *testing.T) {
+	msg := QueryMsg("www.caffix-0x20.net", dns.TypeA)
+	encoded := encode0x20(msg)
+
+	if msg.Question[0].Name != "www.caffix-0x20.net." {
+		t.Errorf("The original message was modified")
+	}
+	if !strings.EqualFold(encoded.Question[0].Name, msg.Question[0].Name) {
+		t.Errorf("The encoded name %s does not match the original name", encoded.Question[0].Name)
+	}
+
+	var mixed bool
+	for i := 0; i < 10 && !mixed; i++ {
+		mixed = encode0x20(msg).Question[0].Name != msg.Question[0].Name
+	}
+	if !mixed {
+		t.Errorf("The case of the name was never randomized")
+	}
+}
+
+func TestUse0x20Encoding(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		// A spoofed response does not know the case of the name that was sent
+		if strings.HasPrefix(strings.ToLower(req.Question[0].Name), "spoofed") {
+			req.Question[0].Name = strings.ToLower(req.Question[0].Name)
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetConfig(PoolConfig{Use0x20Encoding: true})
+
+	name := "www.mixed-case-encoding.net"
+	resp, err := r.Query(context.TODO(), QueryMsg(name, dns.TypeA), PriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+	if resp.Question[0].Name != dns.Fqdn(name) {
+		t.Errorf("The response question %s was not restored to the name provided", resp.Question[0].Name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := r.Query(ctx, QueryMsg("spoofed.mixed-case-encoding.net", dns.TypeA), PriorityNormal, nil); err == nil {
+		t.Errorf("The response with a mismatched case was accepted")
+	}
+}
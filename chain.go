@@ -0,0 +1,107 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultChaseDepth is the maximum number of CNAME and DNAME records followed when no depth is provided.
+const DefaultChaseDepth = 10
+
+// CNAMEChain contains the CNAME and DNAME records followed from the queried name,
+// and the records of the requested type found for the final name.
+type CNAMEChain struct {
+	Links   []dns.RR
+	Records []dns.RR
+}
+
+// ChaseCNAME queries the name for the qtype using the Resolver, and follows the CNAME and DNAME records
+// returned until records of the qtype are found or the depth limit is reached. An error is returned
+// when the chain contains a loop or exceeds the depth limit.
+func ChaseCNAME(ctx context.Context, r Resolver, name string, qtype uint16, depth int) (*CNAMEChain, error) {
+	query := func(n string) (*dns.Msg, error) {
+		return r.Query(ctx, QueryMsg(n, qtype), PriorityNormal, RetryPolicy)
+	}
+
+	resp, err := query(name)
+	if err != nil {
+		return nil, err
+	}
+	return chaseChain(name, qtype, depth, resp, query)
+}
+
+func chaseChain(name string, qtype uint16, depth int,
+	resp *dns.Msg, query func(string) (*dns.Msg, error)) (*CNAMEChain, error) {
+	if depth <= 0 {
+		depth = DefaultChaseDepth
+	}
+
+	chain := new(CNAMEChain)
+	cur := strings.ToLower(dns.Fqdn(name))
+	visited := map[string]struct{}{cur: {}}
+	for {
+		for _, rr := range resp.Answer {
+			if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, cur) {
+				chain.Records = append(chain.Records, rr)
+			}
+		}
+		if len(chain.Records) > 0 || qtype == dns.TypeCNAME {
+			return chain, nil
+		}
+
+		link, next := chainLink(resp, cur)
+		if link == nil {
+			// The name has already been queried without providing records
+			if strings.EqualFold(resp.Question[0].Name, cur) {
+				return chain, nil
+			}
+
+			var err error
+			resp, err = query(cur)
+			if err != nil {
+				return chain, err
+			}
+			continue
+		}
+
+		if len(chain.Links) >= depth {
+			return chain, fmt.Errorf("ChaseCNAME: The chain for %s exceeds %d links", RemoveLastDot(name), depth)
+		}
+		chain.Links = append(chain.Links, link)
+
+		if _, found := visited[next]; found {
+			return chain, fmt.Errorf("ChaseCNAME: The chain for %s contains a loop at %s", RemoveLastDot(name), RemoveLastDot(next))
+		}
+		visited[next] = struct{}{}
+		cur = next
+	}
+}
+
+// chainLink returns the CNAME or DNAME record in the response that applies to the name,
+// along with the name it leads to.
+func chainLink(resp *dns.Msg, name string) (dns.RR, string) {
+	for _, rr := range resp.Answer {
+		if c, ok := rr.(*dns.CNAME); ok && strings.EqualFold(c.Hdr.Name, name) {
+			return c, strings.ToLower(dns.Fqdn(c.Target))
+		}
+	}
+
+	for _, rr := range resp.Answer {
+		d, ok := rr.(*dns.DNAME)
+		if !ok {
+			continue
+		}
+
+		owner := strings.ToLower(d.Hdr.Name)
+		if strings.HasSuffix(name, "."+owner) {
+			return d, strings.TrimSuffix(name, owner) + strings.ToLower(dns.Fqdn(d.Target))
+		}
+	}
+	return nil, ""
+}
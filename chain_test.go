@@ -0,0 +1,94 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func chainHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	cname := func(owner, target string) dns.RR {
+		return &dns.CNAME{Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeCNAME, Class: dns.ClassINET}, Target: target}
+	}
+	name := req.Question[0].Name
+	switch {
+	case name == "a.chain.net.":
+		m.Answer = append(m.Answer, cname("a.chain.net.", "b.chain.net."), cname("b.chain.net.", "c.other.net."))
+	case name == "c.other.net.":
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.ParseIP("192.168.1.1"),
+		})
+	case name == "x.chain.net.":
+		m.Answer = append(m.Answer, cname("x.chain.net.", "y.chain.net."))
+	case name == "y.chain.net.":
+		m.Answer = append(m.Answer, cname("y.chain.net.", "x.chain.net."))
+	case strings.HasSuffix(name, ".dname.net."):
+		m.Answer = append(m.Answer, &dns.DNAME{
+			Hdr:    dns.RR_Header{Name: "dname.net.", Rrtype: dns.TypeDNAME, Class: dns.ClassINET},
+			Target: "other.net.",
+		})
+	default:
+		m.Rcode = dns.RcodeNameError
+	}
+	_ = w.WriteMsg(m)
+}
+
+func TestChaseCNAME(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(chainHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	chain, err := ChaseCNAME(context.TODO(), r, "a.chain.net", dns.TypeA, 5)
+	if err != nil {
+		t.Fatalf("ChaseCNAME failed: %v", err)
+	}
+	if len(chain.Links) != 2 || len(chain.Records) != 1 {
+		t.Errorf("The chain contained %d links and %d records", len(chain.Links), len(chain.Records))
+	}
+
+	if _, err := ChaseCNAME(context.TODO(), r, "a.chain.net", dns.TypeA, 1); err == nil {
+		t.Errorf("The chain exceeding the depth limit did not return an error")
+	}
+	if _, err := ChaseCNAME(context.TODO(), r, "x.chain.net", dns.TypeA, 5); err == nil || !strings.Contains(err.Error(), "loop") {
+		t.Errorf("The loop in the chain was not detected: %v", err)
+	}
+
+	chain, err = ChaseCNAME(context.TODO(), r, "c.dname.net", dns.TypeA, 5)
+	if err != nil || len(chain.Links) != 1 || len(chain.Records) != 1 {
+		t.Errorf("The DNAME was not followed: %v", err)
+	}
+}
+
+func TestLookupChaseCNAME(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(chainHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	resp, err := Lookup(context.TODO(), r, "a.chain.net", WithChaseCNAME(5))
+	if err != nil {
+		t.Fatalf("The lookup failed: %v", err)
+	}
+	if len(resp.Answer) != 3 || resp.Answer[2].Header().Rrtype != dns.TypeA {
+		t.Errorf("The answer section did not contain the full chain: %v", resp.Answer)
+	}
+}
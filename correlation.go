@@ -0,0 +1,21 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import "context"
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a context carrying the correlation ID, which the ResolverPool includes
+// in the events logged, the audit records written and the spans created for the queries performed
+// using the context, so the DNS activity can be associated with the work that caused it.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by the context, or an empty string when there is none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
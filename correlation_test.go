@@ -0,0 +1,75 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCorrelationID(t *testing.T) {
+	if id := CorrelationID(context.Background()); id != "" {
+		t.Errorf("The context without a correlation ID returned %q", id)
+	}
+
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	var buf bytes.Buffer
+	l := new(testEventLogger)
+	tracer := new(testTracer)
+	pool.SetAuditLog(&buf)
+	pool.SetEventLogger(l)
+	pool.SetTracer(tracer)
+	// Every query is reported as slow, so an event is logged for the query
+	pool.SetSlowQueryLog(SlowQueryConfig{Threshold: time.Nanosecond})
+
+	ctx := WithCorrelationID(context.Background(), "work-item-42")
+	if _, err := pool.Query(ctx, QueryMsg("www.correlation.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+
+	var rec AuditRecord
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("Failed to decode the audit record: %v", err)
+	}
+	if rec.CorrelationID != "work-item-42" {
+		t.Errorf("The audit record had the correlation ID %q", rec.CorrelationID)
+	}
+
+	l.Lock()
+	var found bool
+	for _, e := range l.events {
+		if e.msg == "Slow query" {
+			found = e.attrs["correlation_id"] == "work-item-42"
+		}
+	}
+	l.Unlock()
+	if !found {
+		t.Errorf("The event for the query did not include the correlation ID")
+	}
+
+	tracer.Lock()
+	defer tracer.Unlock()
+
+	if len(tracer.spans) == 0 {
+		t.Fatalf("No spans were created for the query")
+	}
+	for _, span := range tracer.spans {
+		if span.attrs[AttrCorrelationID] != "work-item-42" {
+			t.Errorf("The %s span had the correlation ID %v", span.name, span.attrs[AttrCorrelationID])
+		}
+	}
+}
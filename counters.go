@@ -0,0 +1,120 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// DropReason identifies why a response, or records from a response, were discarded.
+type DropReason string
+
+// The reasons responses are dropped.
+const (
+	// DropUnpackFailure counts the packets that could not be unpacked as DNS messages.
+	DropUnpackFailure DropReason = "unpack_failure"
+	// DropSourceMismatch counts the responses received from an address other than the resolver.
+	DropSourceMismatch DropReason = "source_mismatch"
+	// DropQuestionMismatch counts the responses not echoing the question sent.
+	DropQuestionMismatch DropReason = "question_mismatch"
+	// DropNoExchange counts the responses not matching a query awaiting a response, such as late responses.
+	DropNoExchange DropReason = "no_matching_xchg"
+	// DropBailiwick counts the records removed from responses because they are out of bailiwick.
+	DropBailiwick DropReason = "bailiwick"
+)
+
+// ResponseCounts contains the number of responses accepted by rcode, and the number dropped by reason.
+type ResponseCounts struct {
+	Rcodes map[int]uint64        `json:"rcodes"`
+	Drops  map[DropReason]uint64 `json:"drops"`
+}
+
+func (c ResponseCounts) add(o ResponseCounts) {
+	for rcode, n := range o.Rcodes {
+		c.Rcodes[rcode] += n
+	}
+	for reason, n := range o.Drops {
+		c.Drops[reason] += n
+	}
+}
+
+// responseCounter is implemented by the resolvers counting the responses they receive.
+type responseCounter interface {
+	responseCounts() ResponseCounts
+}
+
+type responseCounters struct {
+	sync.Mutex
+	rcodes map[int]uint64
+	drops  map[DropReason]uint64
+}
+
+func newResponseCounters() *responseCounters {
+	return &responseCounters{
+		rcodes: make(map[int]uint64),
+		drops:  make(map[DropReason]uint64),
+	}
+}
+
+func (c *responseCounters) response(rcode int) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.rcodes[rcode]++
+}
+
+func (c *responseCounters) drop(reason DropReason, n int) {
+	if n <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.drops[reason] += uint64(n)
+}
+
+func (c *responseCounters) counts() ResponseCounts {
+	c.Lock()
+	defer c.Unlock()
+
+	counts := ResponseCounts{
+		Rcodes: make(map[int]uint64, len(c.rcodes)),
+		Drops:  make(map[DropReason]uint64, len(c.drops)),
+	}
+	for rcode, n := range c.rcodes {
+		counts.Rcodes[rcode] = n
+	}
+	for reason, n := range c.drops {
+		counts.Drops[reason] = n
+	}
+	return counts
+}
+
+func (r *baseResolver) responseCounts() ResponseCounts {
+	return r.counters.counts()
+}
+
+// ResponseCounts returns the responses received by the resolvers in the pool by rcode, and the
+// responses dropped by reason, including the records removed by the bailiwick filtering.
+func (rp *ResolverPool) ResponseCounts() ResponseCounts {
+	counts := rp.counters.counts()
+
+	for _, r := range rp.resolvers() {
+		if rc, ok := r.(responseCounter); ok {
+			counts.add(rc.responseCounts())
+		}
+	}
+	return counts
+}
+
+// filterBailiwick strips the records out of bailiwick from the response, unless disabled
+// for the pool, and counts the records removed.
+func (rp *ResolverPool) filterBailiwick(resp *dns.Msg) {
+	if rp.bailiwickFiltering() {
+		rp.counters.drop(DropBailiwick, FilterBailiwick(resp))
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestResponseCounts(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		switch req.Question[0].Name {
+		case "nxdomain.counts.net.":
+			m.SetRcode(req, dns.RcodeNameError)
+		case "garbage.counts.net.":
+			_, _ = w.Write([]byte{0x01, 0x02, 0x03})
+		case "duplicate.counts.net.":
+			// The second response no longer matches a query awaiting a response
+			_ = w.WriteMsg(m)
+		case "wrongtype.counts.net.":
+			wrong := m.Copy()
+			wrong.Question[0].Qtype = dns.TypeAAAA
+			_ = w.WriteMsg(wrong)
+		case "poison.counts.net.":
+			m.Answer = []dns.RR{
+				mustRR(t, "poison.counts.net. 300 IN A 192.168.1.1"),
+				mustRR(t, "victim.net. 300 IN A 10.0.0.1"),
+			}
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	for _, name := range []string{"www.counts.net", "nxdomain.counts.net", "garbage.counts.net",
+		"duplicate.counts.net", "wrongtype.counts.net", "poison.counts.net"} {
+		_, _ = pool.Query(context.TODO(), QueryMsg(name, dns.TypeA), PriorityNormal, nil)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	counts := pool.ResponseCounts()
+	if counts.Rcodes[dns.RcodeSuccess] != 5 || counts.Rcodes[dns.RcodeNameError] != 1 {
+		t.Errorf("The responses were counted by rcode as %v", counts.Rcodes)
+	}
+	for reason, n := range map[DropReason]uint64{
+		DropUnpackFailure:    1,
+		DropNoExchange:       1,
+		DropQuestionMismatch: 1,
+		DropBailiwick:        1,
+		DropSourceMismatch:   0,
+	} {
+		if counts.Drops[reason] != n {
+			t.Errorf("%d drops were counted for %s instead of %d", counts.Drops[reason], reason, n)
+		}
+	}
+
+	stats := pool.Stats()
+	if len(stats) != 1 || stats[0].Rcodes[dns.RcodeNameError] != 1 || stats[0].Drops[DropNoExchange] != 1 {
+		t.Errorf("The counts were not provided with the resolver stats: %+v", stats)
+	}
+}
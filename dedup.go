@@ -0,0 +1,114 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// flightGroup tracks the questions in flight so identical questions share a single query.
+type flightGroup struct {
+	sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	resp *dns.Msg
+	err  error
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// flightKey identifies the question in the message, and returns false when the
+// context requests behavior that prevents sharing the response.
+func flightKey(ctx context.Context, msg *dns.Msg) (string, bool) {
+	if len(msg.Question) != 1 {
+		return "", false
+	}
+	if _, override := resolverFromContext(ctx); override {
+		return "", false
+	}
+	if _, regional := regionFromContext(ctx); regional {
+		return "", false
+	}
+
+	q := msg.Question[0]
+	var do bool
+	var subnet string
+	if opt := msg.IsEdns0(); opt != nil {
+		do = opt.Do()
+		// The responses for different client subnets cannot be shared
+		for _, o := range opt.Option {
+			if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+				subnet = fmt.Sprintf("/%d/%d/%s", ecs.Family, ecs.SourceNetmask, ecs.Address)
+			}
+		}
+	}
+	return fmt.Sprintf("%s/%d/%d/%t%s", strings.ToLower(q.Name), q.Qtype, q.Qclass, do, subnet), true
+}
+
+// do executes the query unless an identical question is already in flight, in which case
+// the caller waits for the response of the query already sent.
+func (fg *flightGroup) do(ctx context.Context, key string, msg *dns.Msg,
+	query func() (*dns.Msg, error)) (*dns.Msg, error) {
+	fg.Lock()
+	if call, found := fg.calls[key]; found {
+		fg.Unlock()
+		return fg.wait(ctx, call, msg, query)
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	fg.calls[key] = call
+	fg.Unlock()
+
+	call.resp, call.err = query()
+
+	fg.Lock()
+	delete(fg.calls, key)
+	fg.Unlock()
+	close(call.done)
+	return call.resp, call.err
+}
+
+func (fg *flightGroup) wait(ctx context.Context, call *flightCall, msg *dns.Msg,
+	query func() (*dns.Msg, error)) (*dns.Msg, error) {
+	select {
+	case <-ctx.Done():
+		return nil, checkContext(ctx)
+	case <-call.done:
+	}
+
+	// The query is performed again when only the caller that sent it gave up
+	if ErrorReason(call.err) == ReasonContextCancelled && checkContext(ctx) == nil {
+		return query()
+	}
+	if call.resp == nil {
+		return nil, call.err
+	}
+
+	resp := call.resp.Copy()
+	resp.Id = msg.Id
+	return resp, call.err
+}
+
+// SetDeduplication controls whether identical questions asked while a query for the question
+// is already in flight share the response, instead of sending another query.
+func (rp *ResolverPool) SetDeduplication(enabled bool) {
+	defer rp.configChanged("deduplication", "enabled", enabled)
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.flights = nil
+	if enabled {
+		rp.flights = newFlightGroup()
+	}
+}
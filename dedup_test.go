@@ -0,0 +1,83 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestDeduplication(t *testing.T) {
+	var count int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Name == "dup.net." {
+			atomic.AddInt32(&count, 1)
+			time.Sleep(200 * time.Millisecond)
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	for _, enabled := range []bool{true, false} {
+		pool.SetDeduplication(enabled)
+		atomic.StoreInt32(&count, 0)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				msg := QueryMsg("dup.net", dns.TypeA)
+				resp, err := pool.Query(context.TODO(), msg, PriorityNormal, nil)
+				if err != nil {
+					t.Errorf("The query failed: %v", err)
+				} else if resp.Id != msg.Id {
+					t.Errorf("The response did not have the identifier of the query")
+				}
+			}()
+		}
+		wg.Wait()
+
+		if n := atomic.LoadInt32(&count); enabled && n != 1 {
+			t.Errorf("%d queries were sent for the identical questions", n)
+		} else if !enabled && n < 2 {
+			t.Errorf("The questions were deduplicated while disabled")
+		}
+	}
+}
+
+func TestFlightKey(t *testing.T) {
+	if _, ok := flightKey(WithResolver(context.Background(), "8.8.8.8"), QueryMsg("dup.net", dns.TypeA)); ok {
+		t.Errorf("A query sent to a requested resolver was deduplicated")
+	}
+
+	a, _ := flightKey(context.Background(), QueryMsg("DUP.net", dns.TypeA))
+	b, _ := flightKey(context.Background(), QueryMsg("dup.net", dns.TypeA))
+	c, _ := flightKey(context.Background(), QueryMsg("dup.net", dns.TypeAAAA))
+	if a != b || a == c {
+		t.Errorf("The flight keys did not identify the questions")
+	}
+
+	_, n1, _ := net.ParseCIDR("192.0.2.0/24")
+	_, n2, _ := net.ParseCIDR("198.51.100.0/24")
+	d, _ := flightKey(context.Background(), ClientSubnetMsg("dup.net", dns.TypeA, n1))
+	e, _ := flightKey(context.Background(), ClientSubnetMsg("dup.net", dns.TypeA, n2))
+	f, _ := flightKey(context.Background(), ClientSubnetMsg("dup.net", dns.TypeA, n1))
+	if d == e || d != f || d == b {
+		t.Errorf("The flight keys did not identify the client subnets")
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// proveDenial checks the authenticated NSEC or NSEC3 records for a proof that the name does not exist,
+// when nxdomain is set, or that the name has no records of the type, as described in RFC 4035 and RFC 5155.
+// The opt-out result is set when the proof relies on an NSEC3 opt-out span, which leaves the name insecure.
+func proveDenial(records []dns.RR, name string, qtype uint16, nxdomain bool) (proven bool, optOut bool) {
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+
+	for _, rr := range records {
+		switch v := rr.(type) {
+		case *dns.NSEC:
+			nsecs = append(nsecs, v)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, v)
+		}
+	}
+
+	name = strings.ToLower(dns.Fqdn(name))
+	if len(nsecs) > 0 {
+		return nsecDenial(nsecs, name, qtype, nxdomain), false
+	}
+	if len(nsec3s) > 0 {
+		return nsec3Denial(nsec3s, name, qtype, nxdomain)
+	}
+	return false, false
+}
+
+func nsecDenial(nsecs []*dns.NSEC, name string, qtype uint16, nxdomain bool) bool {
+	if !nxdomain {
+		if n := nsecMatching(nsecs, name); n != nil {
+			return deniesType(n.TypeBitMap, qtype)
+		}
+	}
+
+	// The name, or the type at the name, can only be absent when the name is not covered by the wildcard
+	cover := nsecCovering(nsecs, name)
+	if cover == nil {
+		return false
+	}
+	if !nxdomain && canonicalCompare(cover.NextDomain, name) != 0 && dns.IsSubDomain(name, cover.NextDomain) {
+		// The name is an empty non-terminal without records of any type
+		return true
+	}
+	ce := nsecClosestEncloser(cover, name)
+	wildcard := "*." + ce
+	if ce == "." {
+		wildcard = "*."
+	}
+	if nxdomain {
+		return nsecCovering(nsecs, wildcard) != nil
+	}
+	if n := nsecMatching(nsecs, wildcard); n != nil {
+		return deniesType(n.TypeBitMap, qtype)
+	}
+	return false
+}
+
+func nsecMatching(nsecs []*dns.NSEC, name string) *dns.NSEC {
+	for _, n := range nsecs {
+		if canonicalCompare(n.Hdr.Name, name) == 0 {
+			return n
+		}
+	}
+	return nil
+}
+
+// nsecCovering returns the NSEC record proving that the name does not exist.
+func nsecCovering(nsecs []*dns.NSEC, name string) *dns.NSEC {
+	for _, n := range nsecs {
+		owner, next := n.Hdr.Name, n.NextDomain
+		if canonicalCompare(owner, name) >= 0 {
+			continue
+		}
+		// The last record of the zone wraps around to the apex
+		if canonicalCompare(name, next) >= 0 && (canonicalCompare(next, owner) > 0 || !dns.IsSubDomain(next, name)) {
+			continue
+		}
+		// Names below a delegation point or DNAME are not proven absent by the parent zone
+		if dns.IsSubDomain(owner, name) && (isDelegation(n.TypeBitMap) || hasType(n.TypeBitMap, dns.TypeDNAME)) {
+			continue
+		}
+		return n
+	}
+	return nil
+}
+
+// nsecClosestEncloser returns the longest existing ancestor of the name, using the NSEC record covering it.
+func nsecClosestEncloser(n *dns.NSEC, name string) string {
+	common := dns.CompareDomainName(name, n.Hdr.Name)
+	if c := dns.CompareDomainName(name, n.NextDomain); c > common {
+		common = c
+	}
+	return ancestor(name, common)
+}
+
+func nsec3Denial(nsec3s []*dns.NSEC3, name string, qtype uint16, nxdomain bool) (bool, bool) {
+	if !nxdomain {
+		if n := nsec3Matching(nsec3s, name); n != nil {
+			return deniesType(n.TypeBitMap, qtype), false
+		}
+	}
+
+	ce, cover := nsec3ClosestEncloser(nsec3s, name)
+	if cover == nil {
+		return false, false
+	}
+	optOut := cover.Flags&1 == 1
+	if !nxdomain && qtype == dns.TypeDS && optOut {
+		// An insecure delegation may exist within the opt-out span
+		return true, true
+	}
+
+	wildcard := "*." + ce
+	if ce == "." {
+		wildcard = "*."
+	}
+	if nxdomain {
+		return nsec3Covering(nsec3s, wildcard) != nil, optOut
+	}
+	if n := nsec3Matching(nsec3s, wildcard); n != nil {
+		return deniesType(n.TypeBitMap, qtype), optOut
+	}
+	return false, false
+}
+
+func nsec3Matching(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, n := range nsec3s {
+		if n.Match(name) {
+			return n
+		}
+	}
+	return nil
+}
+
+func nsec3Covering(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, n := range nsec3s {
+		// Cover also accepts the hash matching the owner of the record
+		if n.Cover(name) && !n.Match(name) {
+			return n
+		}
+	}
+	return nil
+}
+
+// nsec3ClosestEncloser returns the closest encloser of the name and the NSEC3 record covering the next closer name.
+func nsec3ClosestEncloser(nsec3s []*dns.NSEC3, name string) (string, *dns.NSEC3) {
+	labels := dns.CountLabel(name)
+
+	for i := labels - 1; i >= 0; i-- {
+		ce := ancestor(name, i)
+		n := nsec3Matching(nsec3s, ce)
+		if n == nil {
+			continue
+		}
+		// Names below a delegation point or DNAME are not proven absent by the parent zone
+		if isDelegation(n.TypeBitMap) || hasType(n.TypeBitMap, dns.TypeDNAME) {
+			return "", nil
+		}
+		return ce, nsec3Covering(nsec3s, ancestor(name, i+1))
+	}
+	return "", nil
+}
+
+// deniesType returns true when the type bitmap proves the type, and a CNAME, absent at the name.
+func deniesType(bitmap []uint16, qtype uint16) bool {
+	if hasType(bitmap, qtype) || hasType(bitmap, dns.TypeCNAME) {
+		return false
+	}
+	if qtype == dns.TypeDS {
+		// The DS records are denied by the parent zone, not the apex of the child zone
+		return !hasType(bitmap, dns.TypeSOA)
+	}
+	// Other types are denied by the child zone, not the delegation point in the parent zone
+	return !isDelegation(bitmap)
+}
+
+func isDelegation(bitmap []uint16) bool {
+	return hasType(bitmap, dns.TypeNS) && !hasType(bitmap, dns.TypeSOA)
+}
+
+func hasType(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ancestor returns the ancestor of the name with the number of labels provided.
+func ancestor(name string, labels int) string {
+	if labels <= 0 {
+		return "."
+	}
+
+	idx := dns.Split(name)
+	if labels >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-labels]:]
+}
+
+// canonicalCompare orders the names as described in RFC 4034 section 6.1.
+func canonicalCompare(a, b string) int {
+	la := dns.SplitDomainName(strings.ToLower(a))
+	lb := dns.SplitDomainName(strings.ToLower(b))
+
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(la) < len(lb):
+		return -1
+	case len(la) > len(lb):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// nsec3Chain returns the NSEC3 records of the zone containing the names with the types provided.
+func nsec3Chain(zone string, optOut bool, names map[string][]uint16) []dns.RR {
+	type hashed struct {
+		hash  string
+		types []uint16
+	}
+
+	var chain []hashed
+	for name, types := range names {
+		chain = append(chain, hashed{hash: dns.HashName(name, dns.SHA1, 1, "AB"), types: types})
+	}
+	sort.Slice(chain, func(i, j int) bool { return chain[i].hash < chain[j].hash })
+
+	var flags uint8
+	if optOut {
+		flags = 1
+	}
+
+	var rrs []dns.RR
+	for i, h := range chain {
+		rrs = append(rrs, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: h.hash + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			Iterations: 1,
+			SaltLength: 1,
+			Salt:       "AB",
+			HashLength: 20,
+			NextDomain: chain[(i+1)%len(chain)].hash,
+			TypeBitMap: h.types,
+		})
+	}
+	return rrs
+}
+
+func TestNSEC3Denial(t *testing.T) {
+	chain := nsec3Chain("example.", false, map[string][]uint16{
+		"example.":     {dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY},
+		"www.example.": {dns.TypeA},
+		"del.example.": {dns.TypeNS},
+	})
+
+	cases := []struct {
+		name     string
+		qtype    uint16
+		nxdomain bool
+		want     bool
+	}{
+		{name: "missing.example.", qtype: dns.TypeA, nxdomain: true, want: true},
+		{name: "www.example.", qtype: dns.TypeA, nxdomain: true, want: false},
+		{name: "www.example.", qtype: dns.TypeTXT, want: true},
+		{name: "www.example.", qtype: dns.TypeA, want: false},
+		{name: "del.example.", qtype: dns.TypeDS, want: true},
+		// The names below the delegation are not proven absent by the parent zone
+		{name: "www.del.example.", qtype: dns.TypeA, nxdomain: true, want: false},
+		{name: "del.example.", qtype: dns.TypeA, want: false},
+		{name: "missing.other.", qtype: dns.TypeA, nxdomain: true, want: false},
+	}
+	for _, c := range cases {
+		if proven, optOut := proveDenial(chain, c.name, c.qtype, c.nxdomain); proven != c.want || optOut {
+			t.Errorf("The denial of %s %s returned %t, opt-out %t", c.name, dns.TypeToString[c.qtype], proven, optOut)
+		}
+	}
+
+	chain = nsec3Chain("example.", true, map[string][]uint16{
+		"example.": {dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY},
+	})
+	if proven, optOut := proveDenial(chain, "unsigned.example.", dns.TypeDS, false); !proven || !optOut {
+		t.Errorf("The opt-out denial of the DS records returned %t, opt-out %t", proven, optOut)
+	}
+}
+
+func TestNSECDenial(t *testing.T) {
+	nsec := func(name, next string, types ...uint16) dns.RR {
+		return &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+			NextDomain: next,
+			TypeBitMap: types,
+		}
+	}
+	records := []dns.RR{
+		nsec("example.", "a.b.example.", dns.TypeSOA, dns.TypeNS),
+		nsec("a.b.example.", "del.example.", dns.TypeA),
+		nsec("del.example.", "www.example.", dns.TypeNS),
+		nsec("www.example.", "example.", dns.TypeA),
+	}
+
+	cases := []struct {
+		name     string
+		qtype    uint16
+		nxdomain bool
+		want     bool
+	}{
+		{name: "c.example.", qtype: dns.TypeA, nxdomain: true, want: true},
+		{name: "zzz.example.", qtype: dns.TypeA, nxdomain: true, want: true},
+		{name: "www.example.", qtype: dns.TypeA, nxdomain: true, want: false},
+		{name: "www.example.", qtype: dns.TypeTXT, want: true},
+		{name: "b.example.", qtype: dns.TypeA, want: true},
+		{name: "del.example.", qtype: dns.TypeDS, want: true},
+		{name: "x.del.example.", qtype: dns.TypeA, nxdomain: true, want: false},
+		{name: "example.", qtype: dns.TypeDS, want: false},
+	}
+	for _, c := range cases {
+		if proven, _ := proveDenial(records, c.name, c.qtype, c.nxdomain); proven != c.want {
+			t.Errorf("The denial of %s %s returned %t", c.name, dns.TypeToString[c.qtype], proven)
+		}
+	}
+}
+
+func TestCanonicalCompare(t *testing.T) {
+	ordered := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "*.z.example."}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		if canonicalCompare(ordered[i], ordered[i+1]) >= 0 {
+			t.Errorf("%s was not ordered before %s", ordered[i], ordered[i+1])
+		}
+	}
+	if canonicalCompare("WWW.Example.", "www.example.") != 0 {
+		t.Errorf("The names were not compared without case")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Discovery ranges larger than this number of addresses are rejected.
+const maxDiscoveryRange = 1 << 16
+
+const defaultDiscoveryConcurrency = 100
+
+// DiscoveryCheck is a name with known answers used to validate candidate resolvers.
+type DiscoveryCheck struct {
+	Name string
+	// Answers are the acceptable A record addresses for the name.
+	// When empty, any non-empty answer is accepted.
+	Answers []string
+}
+
+// DiscoveryConfig controls the probing performed by DiscoverResolvers.
+type DiscoveryConfig struct {
+	// Checks must all be answered correctly for a candidate to be accepted.
+	Checks []DiscoveryCheck
+	// Timeout is the time allowed for each probe query, defaulting to QueryTimeout.
+	Timeout time.Duration
+	// Concurrency is the maximum number of candidates probed at the same time.
+	Concurrency int
+}
+
+// DiscoverResolvers probes the provided candidates for open recursion and returns the addresses
+// of the resolvers that correctly answered every check, ready to be provided to the pool.
+// Candidates can be IP addresses, IP address and port pairs, or CIDR ranges.
+func DiscoverResolvers(ctx context.Context, candidates []string, config DiscoveryConfig) ([]string, error) {
+	if len(config.Checks) == 0 {
+		return nil, fmt.Errorf("DiscoverResolvers: At least one check must be provided")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultQueryTimeout()
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultDiscoveryConcurrency
+	}
+
+	var addrs []string
+	for _, c := range candidates {
+		expanded, err := expandCandidate(c)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, expanded...)
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, config.Concurrency)
+	valid := make([]bool, len(addrs))
+loop:
+	for i, addr := range addrs {
+		select {
+		case <-ctx.Done():
+			break loop
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(idx int, addr string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if probeResolver(ctx, addr, config) {
+				lock.Lock()
+				valid[idx] = true
+				lock.Unlock()
+			}
+		}(i, addr)
+	}
+	wg.Wait()
+
+	var vetted []string
+	for i, addr := range addrs {
+		if valid[i] {
+			vetted = append(vetted, addr)
+		}
+	}
+	return vetted, nil
+}
+
+func expandCandidate(candidate string) ([]string, error) {
+	candidate = strings.TrimSpace(candidate)
+
+	if !strings.Contains(candidate, "/") {
+		if addr := resolverListAddr(candidate); addr != "" {
+			return []string{addr}, nil
+		}
+		return nil, fmt.Errorf("DiscoverResolvers: %s is not a valid candidate", candidate)
+	}
+
+	ip, ipnet, err := net.ParseCIDR(candidate)
+	if err != nil {
+		return nil, fmt.Errorf("DiscoverResolvers: %s is not a valid range: %v", candidate, err)
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	if bits-ones > 16 {
+		return nil, fmt.Errorf("DiscoverResolvers: The range %s exceeds %d addresses", candidate, maxDiscoveryRange)
+	}
+
+	var addrs []string
+	for cur := ip.Mask(ipnet.Mask); ipnet.Contains(cur); cur = nextIP(cur) {
+		addrs = append(addrs, net.JoinHostPort(cur.String(), "53"))
+	}
+	return addrs, nil
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func probeResolver(ctx context.Context, addr string, config DiscoveryConfig) bool {
+	client := dns.Client{
+		Net:     "udp",
+		UDPSize: dns.DefaultMsgSize,
+		Timeout: config.Timeout,
+	}
+
+	for _, check := range config.Checks {
+		m, _, err := client.ExchangeContext(ctx, QueryMsg(check.Name, dns.TypeA), addr)
+		// Open resolvers must offer recursion and answer the query
+		if err != nil || m == nil || !m.RecursionAvailable || m.Rcode != dns.RcodeSuccess {
+			return false
+		}
+
+		answers := AnswersByType(ExtractAnswers(m), dns.TypeA)
+		if len(answers) == 0 || !answersExpected(answers, check.Answers) {
+			return false
+		}
+	}
+	return true
+}
+
+// answersExpected returns true when every answer is one of the expected addresses.
+func answersExpected(answers []*ExtractedAnswer, expected []string) bool {
+	if len(expected) == 0 {
+		return true
+	}
+
+	for _, a := range answers {
+		var found bool
+
+		for _, e := range expected {
+			if ip := net.ParseIP(e); ip != nil && ip.String() == a.Data {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func recursiveHandler(w dns.ResponseWriter, req *dns.Msg) {
+	typeAHandler(&recursionWriter{w}, req)
+}
+
+type recursionWriter struct {
+	dns.ResponseWriter
+}
+
+func (w *recursionWriter) WriteMsg(m *dns.Msg) error {
+	m.RecursionAvailable = true
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+func TestDiscoverResolvers(t *testing.T) {
+	open, oaddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(recursiveHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer open.Shutdown()
+
+	closed, caddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer closed.Shutdown()
+
+	config := DiscoveryConfig{
+		Checks:  []DiscoveryCheck{{Name: "known.discovery.net", Answers: []string{"192.168.1.1"}}},
+		Timeout: 500 * time.Millisecond,
+	}
+	vetted, err := DiscoverResolvers(context.TODO(), []string{oaddr, caddr}, config)
+	if err != nil {
+		t.Fatalf("DiscoverResolvers failed: %v", err)
+	}
+	if len(vetted) != 1 || vetted[0] != oaddr {
+		t.Errorf("DiscoverResolvers returned %v instead of only the open resolver", vetted)
+	}
+
+	config.Checks[0].Answers = []string{"10.0.0.1"}
+	if vetted, _ := DiscoverResolvers(context.TODO(), []string{oaddr}, config); len(vetted) != 0 {
+		t.Errorf("DiscoverResolvers accepted a resolver returning incorrect answers")
+	}
+
+	if _, err := DiscoverResolvers(context.TODO(), []string{oaddr}, DiscoveryConfig{}); err == nil {
+		t.Errorf("DiscoverResolvers did not fail without any checks")
+	}
+}
+
+func TestExpandCandidate(t *testing.T) {
+	addrs, err := expandCandidate("192.168.1.0/30")
+	if err != nil || len(addrs) != 4 {
+		t.Fatalf("The range expanded into %v: %v", addrs, err)
+	}
+	if addrs[0] != "192.168.1.0:53" || addrs[3] != "192.168.1.3:53" {
+		t.Errorf("The range was not expanded in order: %v", addrs)
+	}
+
+	if addrs, err := expandCandidate("8.8.8.8"); err != nil || addrs[0] != "8.8.8.8:53" {
+		t.Errorf("The address was expanded into %v: %v", addrs, err)
+	}
+	if _, err := expandCandidate("10.0.0.0/8"); err == nil {
+		t.Errorf("A range exceeding the maximum size was accepted")
+	}
+	if _, err := expandCandidate("resolver"); err == nil {
+		t.Errorf("An invalid candidate was accepted")
+	}
+}
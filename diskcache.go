@@ -0,0 +1,352 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// The operations recorded in the disk cache file.
+const (
+	diskOpSet byte = iota + 1
+	diskOpDelete
+)
+
+// The operation, expiration time, key length and value length precede each key and value.
+const diskHeaderSize = 1 + 8 + 2 + 4
+
+// minCompactSize is the file size below which the disk cache is not compacted automatically.
+const minCompactSize = 1 << 20
+
+// DiskCacheConfig tunes the behavior of a DiskCache.
+type DiskCacheConfig struct {
+	// MaxSize is the number of bytes the values stored in the cache can occupy before the
+	// oldest values are evicted. Zero or less allows the cache to grow without limit.
+	MaxSize int64
+}
+
+// DiskCache is a Cache kept in an append-only file, so the responses survive the process
+// being restarted. The file is compacted once the removed and replaced values occupy more
+// of it than the values still stored.
+type DiskCache struct {
+	sync.Mutex
+	path      string
+	config    DiskCacheConfig
+	f         *os.File
+	size      int64
+	live      int64
+	evictions uint64
+	entries   map[string]*list.Element
+	order     *list.List
+}
+
+type diskEntry struct {
+	key     string
+	offset  int64
+	length  int64
+	expires time.Time
+}
+
+// recordSize returns the number of bytes occupied in the file by the record of the entry.
+func (e *diskEntry) recordSize() int64 {
+	return diskHeaderSize + int64(len(e.key)) + e.length
+}
+
+// NewDiskCache opens the cache file at the provided path, creating it when necessary,
+// and loads the values stored in it that have not expired.
+func NewDiskCache(path string, config DiskCacheConfig) (*DiskCache, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("NewDiskCache: Failed to open %s: %v", path, err)
+	}
+
+	c := &DiskCache{
+		path:    path,
+		config:  config,
+		f:       f,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+	if err := c.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("NewDiskCache: Failed to load %s: %v", path, err)
+	}
+
+	c.evict()
+	return c, nil
+}
+
+// load rebuilds the index from the records in the file, and discards a partial
+// record left at the end of the file by a process that did not complete the write.
+func (c *DiskCache) load() error {
+	if _, err := c.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var offset int64
+	r := bufio.NewReader(c.f)
+	header := make([]byte, diskHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+
+		op := header[0]
+		expires := time.Unix(0, int64(binary.BigEndian.Uint64(header[1:9])))
+		klen := int(binary.BigEndian.Uint16(header[9:11]))
+		vlen := int64(binary.BigEndian.Uint32(header[11:15]))
+
+		key := make([]byte, klen)
+		if _, err := io.ReadFull(r, key); err != nil {
+			break
+		}
+		if _, err := r.Discard(int(vlen)); err != nil {
+			break
+		}
+
+		c.remove(string(key))
+		if op == diskOpSet && now.Before(expires) {
+			c.insert(&diskEntry{
+				key:     string(key),
+				offset:  offset + diskHeaderSize + int64(klen),
+				length:  vlen,
+				expires: expires,
+			})
+		}
+		offset += diskHeaderSize + int64(klen) + vlen
+	}
+
+	c.size = offset
+	return c.f.Truncate(offset)
+}
+
+// Get implements the Cache interface.
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	el, found := c.entries[key]
+	if !found || c.f == nil {
+		return nil, false
+	}
+
+	entry := el.Value.(*diskEntry)
+	if !time.Now().Before(entry.expires) {
+		c.remove(key)
+		return nil, false
+	}
+
+	value := make([]byte, entry.length)
+	if _, err := c.f.ReadAt(value, entry.offset); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set implements the Cache interface.
+func (c *DiskCache) Set(key string, value []byte, ttl time.Duration) {
+	if len(key) > math.MaxUint16 || int64(len(value)) > math.MaxUint32 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.f == nil {
+		return
+	}
+
+	expires := time.Now().Add(ttl)
+	offset, err := c.write(diskOpSet, key, value, expires)
+	if err != nil {
+		return
+	}
+
+	c.remove(key)
+	c.insert(&diskEntry{
+		key:     key,
+		offset:  offset,
+		length:  int64(len(value)),
+		expires: expires,
+	})
+	c.evict()
+	c.maybeCompact()
+}
+
+// Delete implements the Cache interface.
+func (c *DiskCache) Delete(key string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if _, found := c.entries[key]; !found || c.f == nil {
+		return
+	}
+	if _, err := c.write(diskOpDelete, key, nil, time.Time{}); err == nil {
+		c.remove(key)
+		c.maybeCompact()
+	}
+}
+
+// Compact rewrites the cache file to contain only the values still stored.
+func (c *DiskCache) Compact() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.f == nil {
+		return fmt.Errorf("DiskCache: The cache has been closed")
+	}
+	return c.compact()
+}
+
+// Evictions returns the number of values removed from the cache to respect the maximum size.
+func (c *DiskCache) Evictions() uint64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.evictions
+}
+
+// Close writes the cache file to stable storage and closes it.
+func (c *DiskCache) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.f == nil {
+		return nil
+	}
+
+	err := c.f.Sync()
+	if e := c.f.Close(); err == nil {
+		err = e
+	}
+	c.f = nil
+	return err
+}
+
+// write appends a record to the file and returns the offset of the value.
+// The lock must already be held by the caller.
+func (c *DiskCache) write(op byte, key string, value []byte, expires time.Time) (int64, error) {
+	rec := make([]byte, diskHeaderSize, diskHeaderSize+len(key)+len(value))
+	rec[0] = op
+	if op == diskOpSet {
+		binary.BigEndian.PutUint64(rec[1:9], uint64(expires.UnixNano()))
+	}
+	binary.BigEndian.PutUint16(rec[9:11], uint16(len(key)))
+	binary.BigEndian.PutUint32(rec[11:15], uint32(len(value)))
+	rec = append(append(rec, key...), value...)
+
+	if _, err := c.f.WriteAt(rec, c.size); err != nil {
+		// Discard what was written of the incomplete record
+		_ = c.f.Truncate(c.size)
+		return 0, err
+	}
+
+	offset := c.size + diskHeaderSize + int64(len(key))
+	c.size += int64(len(rec))
+	return offset, nil
+}
+
+// insert adds the entry to the index as the newest value. The lock must already be held by the caller.
+func (c *DiskCache) insert(entry *diskEntry) {
+	c.entries[entry.key] = c.order.PushFront(entry)
+	c.live += entry.recordSize()
+}
+
+// remove drops the key from the index. The lock must already be held by the caller.
+func (c *DiskCache) remove(key string) {
+	if el, found := c.entries[key]; found {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		c.live -= el.Value.(*diskEntry).recordSize()
+	}
+}
+
+// evict removes the oldest values until the cache respects the maximum size.
+// The lock must already be held by the caller.
+func (c *DiskCache) evict() {
+	for c.config.MaxSize > 0 && c.live > c.config.MaxSize && c.order.Len() > 0 {
+		oldest := c.order.Back().Value.(*diskEntry)
+
+		if _, err := c.write(diskOpDelete, oldest.key, nil, time.Time{}); err != nil {
+			return
+		}
+		c.remove(oldest.key)
+		c.evictions++
+	}
+}
+
+// maybeCompact compacts the file once most of it is occupied by records no longer needed.
+// The lock must already be held by the caller.
+func (c *DiskCache) maybeCompact() {
+	if c.size >= minCompactSize && c.size-c.live > c.live {
+		_ = c.compact()
+	}
+}
+
+// compact writes the values still stored to a new file that replaces the cache file.
+// The lock must already be held by the caller.
+func (c *DiskCache) compact() error {
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	old := c.f
+	entries := c.order
+	c.f, c.size, c.live = f, 0, 0
+	c.entries = make(map[string]*list.Element)
+	c.order = list.New()
+	// Preserve the order of the values, from oldest to newest
+	for el := entries.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*diskEntry)
+		if !now.Before(entry.expires) {
+			continue
+		}
+
+		value := make([]byte, entry.length)
+		if _, err = old.ReadAt(value, entry.offset); err != nil {
+			break
+		}
+
+		var offset int64
+		if offset, err = c.write(diskOpSet, entry.key, value, entry.expires); err != nil {
+			break
+		}
+		c.insert(&diskEntry{
+			key:     entry.key,
+			offset:  offset,
+			length:  entry.length,
+			expires: entry.expires,
+		})
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, c.path)
+	}
+	if err != nil {
+		// Continue using the original file
+		f.Close()
+		os.Remove(tmp)
+		c.f, c.live = old, 0
+		c.entries = make(map[string]*list.Element)
+		c.order = list.New()
+		return c.load()
+	}
+
+	old.Close()
+	return nil
+}
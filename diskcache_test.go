@@ -0,0 +1,115 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	c, err := NewDiskCache(path, DiskCacheConfig{})
+	if err != nil {
+		t.Fatalf("Failed to open the disk cache: %v", err)
+	}
+	c.Set("kept", []byte("value"), time.Hour)
+	c.Set("replaced", []byte("first"), time.Hour)
+	c.Set("replaced", []byte("second"), time.Hour)
+	c.Set("deleted", []byte("value"), time.Hour)
+	c.Delete("deleted")
+	c.Set("expired", []byte("value"), time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Failed to close the disk cache: %v", err)
+	}
+
+	// Simulate a crash during a write
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.Write([]byte{diskOpSet, 0, 0})
+	f.Close()
+
+	time.Sleep(5 * time.Millisecond)
+	c, err = NewDiskCache(path, DiskCacheConfig{})
+	if err != nil {
+		t.Fatalf("Failed to reopen the disk cache: %v", err)
+	}
+	defer c.Close()
+
+	if v, found := c.Get("kept"); !found || string(v) != "value" {
+		t.Errorf("The stored value was not loaded from the file")
+	}
+	if v, found := c.Get("replaced"); !found || string(v) != "second" {
+		t.Errorf("The replaced value was %q instead of %q", v, "second")
+	}
+	if _, found := c.Get("deleted"); found {
+		t.Errorf("The deleted value was loaded from the file")
+	}
+	if _, found := c.Get("expired"); found {
+		t.Errorf("The expired value was loaded from the file")
+	}
+
+	// The cache continues to work after the partial record was discarded
+	c.Set("after", []byte("value"), time.Hour)
+	if _, found := c.Get("after"); !found {
+		t.Errorf("The value stored after loading the file was not returned")
+	}
+}
+
+func TestDiskCacheMaxSize(t *testing.T) {
+	c, err := NewDiskCache(filepath.Join(t.TempDir(), "cache.db"), DiskCacheConfig{MaxSize: 1000})
+	if err != nil {
+		t.Fatalf("Failed to open the disk cache: %v", err)
+	}
+	defer c.Close()
+
+	value := make([]byte, 100)
+	for i := 0; i < 20; i++ {
+		c.Set(fmt.Sprintf("key%d", i), value, time.Hour)
+	}
+
+	if _, found := c.Get("key0"); found {
+		t.Errorf("The oldest value was not evicted")
+	}
+	if _, found := c.Get("key19"); !found {
+		t.Errorf("The newest value was evicted")
+	}
+	if c.live > 1000 {
+		t.Errorf("The values occupy %d bytes, exceeding the maximum size", c.live)
+	}
+}
+
+func TestDiskCacheCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	c, err := NewDiskCache(path, DiskCacheConfig{})
+	if err != nil {
+		t.Fatalf("Failed to open the disk cache: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 100; i++ {
+		c.Set("key", []byte(fmt.Sprintf("value%d", i)), time.Hour)
+	}
+	c.Set("other", []byte("other"), time.Hour)
+
+	before, _ := os.Stat(path)
+	if err := c.Compact(); err != nil {
+		t.Fatalf("Failed to compact the disk cache: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("Compaction did not reduce the size of the file from %d bytes", before.Size())
+	}
+
+	if v, found := c.Get("key"); !found || string(v) != "value99" {
+		t.Errorf("The value after compaction was %q instead of %q", v, "value99")
+	}
+	if v, found := c.Get("other"); !found || string(v) != "other" {
+		t.Errorf("The value after compaction was %q instead of %q", v, "other")
+	}
+}
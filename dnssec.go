@@ -0,0 +1,139 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSECBogusName is a name with deliberately broken DNSSEC signatures.
+// Validating resolvers return SERVFAIL when asked to resolve it.
+var DNSSECBogusName = "dnssec-failed.org"
+
+// DNSSECSignedName is a name with valid DNSSEC signatures.
+// Validating resolvers return the answers with the AD bit set when asked to resolve it.
+var DNSSECSignedName = "isc.org"
+
+// The most resolvers probed for DNSSEC validation at the same time.
+const maxDNSSECProbes = 32
+
+// The delay before probing a resolver again after the previous probe failed to provide a result.
+var dnssecReprobeDelay = 30 * time.Second
+
+// ValidatesDNSSEC returns true when the resolver refuses to answer for a name with broken DNSSEC
+// signatures, and authenticates the answers for a name with valid signatures. The second check keeps
+// resolvers that fail or filter every query from passing. An error is returned when the resolver did
+// not provide a definitive response.
+func ValidatesDNSSEC(ctx context.Context, r Resolver) (bool, error) {
+	resp, err := r.Query(ctx, WalkMsg(DNSSECBogusName, dns.TypeA), PriorityHigh, nil)
+	if err == nil {
+		// Only non-validating resolvers return the bogus name without an error
+		return false, nil
+	}
+	if e, ok := err.(*ResolveError); !ok || e.Rcode != dns.RcodeServerFailure {
+		return false, fmt.Errorf("ValidatesDNSSEC: Failed to query %s: %v", r.String(), err)
+	}
+
+	msg := WalkMsg(DNSSECSignedName, dns.TypeA)
+	msg.AuthenticatedData = true
+	resp, err = r.Query(ctx, msg, PriorityHigh, nil)
+	if err != nil {
+		if e, ok := err.(*ResolveError); ok && e.Rcode == dns.RcodeServerFailure {
+			// The resolver fails for the signed name as well
+			return false, nil
+		}
+		return false, fmt.Errorf("ValidatesDNSSEC: Failed to query %s: %v", r.String(), err)
+	}
+	return resp.AuthenticatedData && len(resp.Answer) > 0, nil
+}
+
+// SetValidatingOnly restricts the pool to the resolvers confirmed to validate DNSSEC.
+// When enabled, the resolvers in the pool and those added later are probed, and remain
+// unused until the probe shows they validate.
+func (rp *ResolverPool) SetValidatingOnly(enabled bool) {
+	rp.configChanged("validating_only", "enabled", enabled)
+	rp.Lock()
+	rp.validatingOnly = enabled
+	rp.Unlock()
+
+	if enabled {
+		rp.probeDNSSEC(rp.resolvers())
+	}
+}
+
+// probeDNSSEC checks the resolvers concurrently, so the time taken does not grow with the number of resolvers.
+func (rp *ResolverPool) probeDNSSEC(resolvers []Resolver) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxDNSSECProbes)
+	timeout := 2 * rp.queryTimeout()
+
+	for _, r := range resolvers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r Resolver) {
+			defer func() { <-sem; wg.Done() }()
+
+			rp.probeResolverDNSSEC(r, timeout)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (rp *ResolverPool) probeResolverDNSSEC(r Resolver, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	validates, err := ValidatesDNSSEC(ctx, r)
+	cancel()
+
+	if err != nil {
+		rp.logEvent(LevelError, "DNSSEC validation check failed", "resolver", r.String(), "error", err)
+		time.AfterFunc(dnssecReprobeDelay, func() { rp.reprobeDNSSEC(r, timeout) })
+		return
+	}
+
+	rp.Lock()
+	rp.validates[r.String()] = validates
+	rp.Unlock()
+	if !validates {
+		rp.logEvent(LevelWarn, "Resolver does not validate DNSSEC and will not be used", "resolver", r.String())
+	}
+}
+
+// reprobeDNSSEC checks the resolver again, unless it is no longer needed by the pool.
+func (rp *ResolverPool) reprobeDNSSEC(r Resolver, timeout time.Duration) {
+	rp.Lock()
+	enabled := rp.validatingOnly
+	rp.Unlock()
+
+	if enabled && !r.Stopped() && !rp.Stopped() {
+		rp.probeResolverDNSSEC(r, timeout)
+	}
+}
+
+// excluded returns true when the resolver cannot be used in the current pool mode.
+// The pool lock must already be held by the caller.
+func (rp *ResolverPool) excluded(addr string) bool {
+	return rp.validatingOnly && !rp.validates[addr]
+}
+
+// noValidatingResolvers returns true when the pool is restricted to the validating resolvers and none
+// of the resolvers is confirmed to validate. The pool lock must already be held by the caller.
+func (rp *ResolverPool) noValidatingResolvers() bool {
+	if !rp.validatingOnly {
+		return false
+	}
+
+	for _, partition := range rp.partitions {
+		for _, r := range partition {
+			if !r.Stopped() && rp.validates[r.String()] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestValidatingOnly(t *testing.T) {
+	validating, vaddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Name == dns.Fqdn(DNSSECBogusName) {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+			return
+		}
+		authenticatedHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer validating.Shutdown()
+
+	broken, baddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeServerFailure)
+		w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer broken.Shutdown()
+
+	filtering, fladdr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer filtering.Shutdown()
+
+	forwarder, faddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer forwarder.Shutdown()
+
+	v := NewBaseResolver(vaddr, 100, nil)
+	f := NewBaseResolver(faddr, 100, nil)
+	if ok, err := ValidatesDNSSEC(context.TODO(), v); err != nil || !ok {
+		t.Errorf("The validating resolver was not detected: %v", err)
+	}
+	if ok, err := ValidatesDNSSEC(context.TODO(), f); err != nil || ok {
+		t.Errorf("The non-validating resolver was not detected: %v", err)
+	}
+	for _, addr := range []string{baddr, fladdr} {
+		r := NewBaseResolver(addr, 100, nil)
+		if ok, err := ValidatesDNSSEC(context.TODO(), r); err != nil || ok {
+			t.Errorf("The resolver without answers for the signed name was considered validating: %v", err)
+		}
+		r.Stop()
+	}
+
+	pool := NewResolverPool([]Resolver{f, v}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetValidatingOnly(true)
+	if n := pool.numUsableResolvers(); n != 1 {
+		t.Errorf("The pool has %d usable resolvers instead of 1", n)
+	}
+	for i := 0; i < 5; i++ {
+		r := pool.nextResolver(context.TODO())
+		pool.releaseResolver(r)
+
+		if r != v {
+			t.Errorf("The pool selected the non-validating resolver")
+			break
+		}
+	}
+
+	pool.SetValidatingOnly(false)
+	if n := pool.numUsableResolvers(); n != 2 {
+		t.Errorf("The pool has %d usable resolvers instead of 2 after disabling the mode", n)
+	}
+}
+
+func authenticatedHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.AuthenticatedData = true
+	m.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 0},
+		A:   net.ParseIP("192.168.1.1"),
+	}}
+	w.WriteMsg(m)
+}
+
+func TestProbeDNSSECConcurrently(t *testing.T) {
+	slow, addr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		time.Sleep(200 * time.Millisecond)
+		authenticatedHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer slow.Shutdown()
+
+	var resolvers []Resolver
+	for i := 0; i < 10; i++ {
+		resolvers = append(resolvers, NewBaseResolver(addr, 100, nil))
+	}
+	pool := NewResolverPool(resolvers, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	start := time.Now()
+	pool.SetValidatingOnly(true)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Probing the resolvers took %s", elapsed)
+	}
+}
+
+func TestValidatingOnlyUnavailable(t *testing.T) {
+	var queries int32
+	// The first queries are not answered, so the first probe fails without a result
+	s, addr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if atomic.AddInt32(&queries, 1) <= 2 {
+			return
+		}
+		if req.Question[0].Name == dns.Fqdn(DNSSECBogusName) {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+			return
+		}
+		authenticatedHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	delay := dnssecReprobeDelay
+	dnssecReprobeDelay = 500 * time.Millisecond
+	defer func() { dnssecReprobeDelay = delay }()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetConfig(PoolConfig{QueryTimeout: 250 * time.Millisecond})
+	pool.SetValidatingOnly(true)
+
+	start := time.Now()
+	_, err = pool.Query(context.Background(), QueryMsg("www.dnssec.net", dns.TypeA), PriorityNormal, nil)
+	if reason := ErrorReason(err); reason != ReasonNoResolvers {
+		t.Errorf("The query returned reason %s instead of %s", reason, ReasonNoResolvers)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("The query without a validating resolver took %s", elapsed)
+	}
+
+	// The resolver is probed again after the failed probe
+	for i := 0; i < 30 && pool.numUsableResolvers() == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if n := pool.numUsableResolvers(); n != 1 {
+		t.Errorf("The pool has %d usable resolvers after probing the resolver again", n)
+	}
+}
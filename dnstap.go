@@ -0,0 +1,263 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The content type of the Frame Streams carrying dnstap messages.
+const dnstapContentType = "protobuf:dnstap.Dnstap"
+
+// The Frame Streams control frame types.
+const (
+	fstrmControlAccept uint32 = 0x01
+	fstrmControlStart  uint32 = 0x02
+	fstrmControlStop   uint32 = 0x03
+	fstrmControlReady  uint32 = 0x04
+	fstrmControlFinish uint32 = 0x05
+	// The control frame field providing the content type
+	fstrmFieldContentType uint32 = 0x01
+)
+
+// The values of the dnstap protocol buffer enumerations used by the package.
+const (
+	dnstapTypeMessage      = 1
+	dnstapToolQuery        = 11
+	dnstapToolResponse     = 12
+	dnstapFamilyINET       = 1
+	dnstapFamilyINET6      = 2
+	dnstapProtocolUDP      = 1
+	dnstapHandshakeTimeout = 5 * time.Second
+)
+
+// DnstapWriter encodes the queries and responses of a ResolverPool as dnstap messages, using
+// the Frame Streams protocol, so the traffic can be provided to passive DNS and logging pipelines.
+type DnstapWriter struct {
+	sync.Mutex
+	w        io.Writer
+	conn     net.Conn
+	identity []byte
+	err      error
+	closed   bool
+}
+
+// NewDnstapWriter returns a DnstapWriter that writes a unidirectional Frame Stream, such as a dnstap
+// file, to the Writer. The identity is included in each message to identify the sender.
+func NewDnstapWriter(w io.Writer, identity string) (*DnstapWriter, error) {
+	d := &DnstapWriter{w: w, identity: []byte(identity)}
+
+	if err := d.writeControl(fstrmControlStart, true); err != nil {
+		return nil, fmt.Errorf("NewDnstapWriter: Failed to start the frame stream: %v", err)
+	}
+	return d, nil
+}
+
+// DialDnstap connects to a dnstap receiver, such as a unix socket, and performs the
+// bidirectional Frame Streams handshake before returning the DnstapWriter.
+func DialDnstap(network, address, identity string) (*DnstapWriter, error) {
+	conn, err := net.DialTimeout(network, address, dnstapHandshakeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("DialDnstap: Failed to connect to %s: %v", address, err)
+	}
+
+	d := &DnstapWriter{w: conn, conn: conn, identity: []byte(identity)}
+	_ = conn.SetDeadline(time.Now().Add(dnstapHandshakeTimeout))
+	if err := d.writeControl(fstrmControlReady, true); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("DialDnstap: Failed to send the ready frame: %v", err)
+	}
+	if t, err := readControl(conn); err != nil || t != fstrmControlAccept {
+		conn.Close()
+		return nil, fmt.Errorf("DialDnstap: The receiver at %s did not accept the frame stream: %v", address, err)
+	}
+	if err := d.writeControl(fstrmControlStart, true); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("DialDnstap: Failed to start the frame stream: %v", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return d, nil
+}
+
+// Close ends the frame stream, and closes the connection made by DialDnstap.
+func (d *DnstapWriter) Close() error {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+
+	err := d.writeControl(fstrmControlStop, false)
+	if d.conn != nil {
+		// The receiver acknowledges the end of a bidirectional stream
+		_ = d.conn.SetDeadline(time.Now().Add(dnstapHandshakeTimeout))
+		_, _ = readControl(d.conn)
+		if e := d.conn.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// writeControl writes the control frame, including the content type when requested.
+func (d *DnstapWriter) writeControl(ctype uint32, content bool) error {
+	var frame bytes.Buffer
+
+	_ = binary.Write(&frame, binary.BigEndian, ctype)
+	if content {
+		_ = binary.Write(&frame, binary.BigEndian, fstrmFieldContentType)
+		_ = binary.Write(&frame, binary.BigEndian, uint32(len(dnstapContentType)))
+		frame.WriteString(dnstapContentType)
+	}
+
+	// The escape sequence is followed by the length of the control frame
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, [2]uint32{0, uint32(frame.Len())})
+	buf.Write(frame.Bytes())
+	_, err := d.w.Write(buf.Bytes())
+	return err
+}
+
+// readControl reads a control frame and returns its type.
+func readControl(r io.Reader) (uint32, error) {
+	var hdr [8]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(hdr[:4]) != 0 {
+		return 0, fmt.Errorf("a data frame was received instead of a control frame")
+	}
+
+	frame := make([]byte, binary.BigEndian.Uint32(hdr[4:]))
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return 0, err
+	}
+	if len(frame) < 4 {
+		return 0, fmt.Errorf("the control frame was too short")
+	}
+	return binary.BigEndian.Uint32(frame[:4]), nil
+}
+
+// write encodes the message as a dnstap data frame. Writing stops after the first error.
+func (d *DnstapWriter) write(mtype int, msg *dns.Msg, addr string, queried, responded time.Time) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return
+	}
+
+	var m []byte
+	m = appendProtoVarint(m, 1, uint64(mtype))
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			family, ipbytes := uint64(dnstapFamilyINET6), []byte(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				family, ipbytes = dnstapFamilyINET, []byte(ip4)
+			}
+			m = appendProtoVarint(m, 2, family)
+			m = appendProtoVarint(m, 3, dnstapProtocolUDP)
+			m = appendProtoBytes(m, 5, ipbytes)
+		}
+		if p, err := strconv.Atoi(port); err == nil {
+			m = appendProtoVarint(m, 7, uint64(p))
+		}
+	}
+	m = appendProtoVarint(m, 8, uint64(queried.Unix()))
+	m = appendProtoFixed32(m, 9, uint32(queried.Nanosecond()))
+	if mtype == dnstapToolQuery {
+		m = appendProtoBytes(m, 10, packed)
+	} else {
+		m = appendProtoVarint(m, 12, uint64(responded.Unix()))
+		m = appendProtoFixed32(m, 13, uint32(responded.Nanosecond()))
+		m = appendProtoBytes(m, 14, packed)
+	}
+
+	var frame []byte
+	if len(d.identity) > 0 {
+		frame = appendProtoBytes(frame, 1, d.identity)
+	}
+	frame = appendProtoBytes(frame, 14, m)
+	frame = appendProtoVarint(frame, 15, dnstapTypeMessage)
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.closed || d.err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(frame)))
+	buf.Write(frame)
+	_, d.err = d.w.Write(buf.Bytes())
+}
+
+// SetDnstap causes the queries sent by the pool, including the trusted resolvers, the type resolvers
+// and the standby set, and the responses received to be written using the DnstapWriter.
+// Providing nil stops writing the messages. The DnstapWriter is not closed by the pool.
+func (rp *ResolverPool) SetDnstap(d *DnstapWriter) {
+	rp.Lock()
+	rp.dnstap = d
+	subs := rp.subPools()
+	rp.Unlock()
+
+	for _, sub := range subs {
+		sub.SetDnstap(d)
+	}
+}
+
+// tap writes the query of the attempt, and the response when one was received, to the DnstapWriter.
+func (rp *ResolverPool) tap(msg *dns.Msg, r Resolver, resp *dns.Msg, start time.Time, rtt time.Duration) {
+	rp.Lock()
+	d := rp.dnstap
+	rp.Unlock()
+
+	if d == nil || r == nil {
+		return
+	}
+
+	d.write(dnstapToolQuery, msg, r.String(), start, time.Time{})
+	if resp != nil && resp != msg {
+		d.write(dnstapToolResponse, resp, r.String(), start, start.Add(rtt))
+	}
+}
+
+func appendProtoKey(b []byte, field, wiretype int) []byte {
+	return appendVarint(b, uint64(field<<3|wiretype))
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	return appendVarint(appendProtoKey(b, field, 0), v)
+}
+
+func appendProtoFixed32(b []byte, field int, v uint32) []byte {
+	var buf [4]byte
+
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(appendProtoKey(b, field, 5), buf[:]...)
+}
+
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendVarint(appendProtoKey(b, field, 2), uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
@@ -0,0 +1,196 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// readFrame returns the payload of the next frame and whether it is a control frame.
+func readFrame(t *testing.T, r io.Reader) ([]byte, bool) {
+	var l uint32
+	if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+		t.Fatalf("Failed to read the frame length: %v", err)
+	}
+
+	control := l == 0
+	if control {
+		if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+			t.Fatalf("Failed to read the control frame length: %v", err)
+		}
+	}
+
+	frame := make([]byte, l)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		t.Fatalf("Failed to read the frame: %v", err)
+	}
+	return frame, control
+}
+
+// decodeProto returns the varint and length-delimited fields of the protocol buffer message.
+func decodeProto(t *testing.T, b []byte) map[int][]interface{} {
+	fields := make(map[int][]interface{})
+
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			fields[field] = append(fields[field], v)
+			b = b[n:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			fields[field] = append(fields[field], b[n:n+int(l)])
+			b = b[n+int(l):]
+		case 5:
+			fields[field] = append(fields[field], binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestDnstapWriter(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	var buf bytes.Buffer
+	d, err := NewDnstapWriter(&buf, "resolve-test")
+	if err != nil {
+		t.Fatalf("Failed to create the dnstap writer: %v", err)
+	}
+	pool.SetDnstap(d)
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("www.dnstap.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("Failed to close the dnstap writer: %v", err)
+	}
+
+	host, _, _ := net.SplitHostPort(addrstr)
+	frame, control := readFrame(t, &buf)
+	if !control || binary.BigEndian.Uint32(frame) != fstrmControlStart || !bytes.Contains(frame, []byte(dnstapContentType)) {
+		t.Fatalf("The stream did not begin with the start frame")
+	}
+
+	for _, mtype := range []uint64{dnstapToolQuery, dnstapToolResponse} {
+		frame, control := readFrame(t, &buf)
+		if control {
+			t.Fatalf("A control frame was found instead of the dnstap message")
+		}
+
+		tap := decodeProto(t, frame)
+		if string(tap[1][0].([]byte)) != "resolve-test" || tap[15][0].(uint64) != dnstapTypeMessage {
+			t.Errorf("The dnstap message had an unexpected identity or type")
+		}
+
+		m := decodeProto(t, tap[14][0].([]byte))
+		if m[1][0].(uint64) != mtype {
+			t.Errorf("The message had the type %v instead of %d", m[1][0], mtype)
+		}
+		if ip := net.IP(m[5][0].([]byte)); !ip.Equal(net.ParseIP(host)) {
+			t.Errorf("The message had the response address %v instead of %s", ip, host)
+		}
+
+		field := 10
+		if mtype == dnstapToolResponse {
+			field = 14
+		}
+		msg := new(dns.Msg)
+		if err := msg.Unpack(m[field][0].([]byte)); err != nil || msg.Question[0].Name != "www.dnstap.net." {
+			t.Errorf("The message did not contain the DNS message: %v", err)
+		}
+		if mtype == dnstapToolResponse && len(msg.Answer) != 1 {
+			t.Errorf("The response message did not contain the answer")
+		}
+	}
+
+	frame, control = readFrame(t, &buf)
+	if !control || binary.BigEndian.Uint32(frame) != fstrmControlStop {
+		t.Errorf("The stream did not end with the stop frame")
+	}
+}
+
+func TestDialDnstap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen on the unix socket: %v", err)
+	}
+	defer l.Close()
+
+	frames := make(chan uint32, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		accept := []byte{0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, byte(fstrmControlAccept)}
+		finish := []byte{0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, byte(fstrmControlFinish)}
+		for {
+			frame, control := readFrame(t, conn)
+			if !control {
+				frames <- 0
+				continue
+			}
+
+			ctype := binary.BigEndian.Uint32(frame)
+			frames <- ctype
+			if ctype == fstrmControlReady {
+				_, _ = conn.Write(accept)
+			} else if ctype == fstrmControlStop {
+				_, _ = conn.Write(finish)
+				close(frames)
+				return
+			}
+		}
+	}()
+
+	d, err := DialDnstap("unix", path, "")
+	if err != nil {
+		t.Fatalf("Failed to connect to the dnstap receiver: %v", err)
+	}
+	d.write(dnstapToolQuery, QueryMsg("www.dnstap.net", dns.TypeA), "127.0.0.1:53", time.Now(), time.Time{})
+	if err := d.Close(); err != nil {
+		t.Errorf("Failed to close the dnstap writer: %v", err)
+	}
+
+	var got []uint32
+	for ctype := range frames {
+		got = append(got, ctype)
+	}
+	expected := []uint32{fstrmControlReady, fstrmControlStart, 0, fstrmControlStop}
+	if len(got) != len(expected) {
+		t.Fatalf("The receiver got the frames %v instead of %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("The receiver got the frames %v instead of %v", got, expected)
+			break
+		}
+	}
+}
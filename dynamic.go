@@ -0,0 +1,104 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// defaultWildcardSamples is the number of names queried to sample the answers of dynamic wildcards.
+const defaultWildcardSamples = 10
+
+// The prefix lengths of the networks considered to be shared by addresses from a dynamic wildcard.
+const (
+	sampleIPv4Prefix = 24
+	sampleIPv6Prefix = 48
+)
+
+// sampleMatches returns true when the answers overlap the sample collected from a dynamic wildcard.
+// Answers overlap when an address is in the sample, shares the network or autonomous system of an
+// address in the sample, or when a CNAME target shares the parent domain of a target in the sample.
+func sampleMatches(answers, sample []*ExtractedAnswer, asn func(ip net.IP) int) bool {
+	nets := make(map[string]struct{})
+	parents := make(map[string]struct{})
+	asns := make(map[int]struct{})
+
+	for _, a := range sample {
+		switch a.Type {
+		case dns.TypeA, dns.TypeAAAA:
+			ip := net.ParseIP(a.Data)
+			if ip == nil {
+				continue
+			}
+
+			nets[addrNetwork(ip)] = struct{}{}
+			if asn != nil {
+				if n := asn(ip); n != 0 {
+					asns[n] = struct{}{}
+				}
+			}
+		case dns.TypeCNAME:
+			parents[parentName(a.Data)] = struct{}{}
+		}
+	}
+
+	for _, a := range answers {
+		switch a.Type {
+		case dns.TypeA, dns.TypeAAAA:
+			ip := net.ParseIP(a.Data)
+			if ip == nil {
+				continue
+			}
+
+			if _, found := nets[addrNetwork(ip)]; found {
+				return true
+			}
+			if asn != nil {
+				if _, found := asns[asn(ip)]; found {
+					return true
+				}
+			}
+		case dns.TypeCNAME:
+			if _, found := parents[parentName(a.Data)]; found {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addrNetwork returns the network containing the address used to compare answers with the sample.
+func addrNetwork(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(sampleIPv4Prefix, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(sampleIPv6Prefix, 128)).String()
+}
+
+// parentName returns the name with the first label removed.
+func parentName(name string) string {
+	name = strings.ToLower(strings.Trim(name, "."))
+
+	if idx := strings.Index(name, "."); idx != -1 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+// uniqueAnswers returns the answers without duplicate data.
+func uniqueAnswers(answers []*ExtractedAnswer) []*ExtractedAnswer {
+	var unique []*ExtractedAnswer
+
+	seen := make(map[string]struct{})
+	for _, a := range answers {
+		if _, found := seen[a.Data]; !found {
+			seen[a.Data] = struct{}{}
+			unique = append(unique, a)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSampleMatches(t *testing.T) {
+	sample := []*ExtractedAnswer{
+		{Type: dns.TypeA, Data: "10.20.30.1"},
+		{Type: dns.TypeAAAA, Data: "2001:db8:1::1"},
+		{Type: dns.TypeCNAME, Data: "x1y2.edge.cdn.net"},
+	}
+	asn := func(ip net.IP) int {
+		if ip.To4() != nil && ip.To4()[0] == 10 {
+			return 64500
+		}
+		return 0
+	}
+
+	cases := []struct {
+		label string
+		data  *ExtractedAnswer
+		asn   func(net.IP) int
+		want  bool
+	}{
+		{"address in the same network", &ExtractedAnswer{Type: dns.TypeA, Data: "10.20.30.200"}, nil, true},
+		{"address in another network", &ExtractedAnswer{Type: dns.TypeA, Data: "10.20.31.1"}, nil, false},
+		{"address in the same autonomous system", &ExtractedAnswer{Type: dns.TypeA, Data: "10.99.1.1"}, asn, true},
+		{"IPv6 address in the same network", &ExtractedAnswer{Type: dns.TypeAAAA, Data: "2001:db8:1:ff::1"}, nil, true},
+		{"CNAME target with the same parent", &ExtractedAnswer{Type: dns.TypeCNAME, Data: "z9.edge.cdn.net"}, nil, true},
+		{"CNAME target with another parent", &ExtractedAnswer{Type: dns.TypeCNAME, Data: "www.origin.net"}, nil, false},
+	}
+	for _, c := range cases {
+		if got := sampleMatches([]*ExtractedAnswer{c.data}, sample, c.asn); got != c.want {
+			t.Errorf("The %s returned %t instead of %t", c.label, got, c.want)
+		}
+	}
+}
+
+func TestDynamicWildcardSampling(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		q := req.Question[0]
+		var addr string
+		if q.Name == "www.dyn.domain.com." {
+			addr = "192.168.7.7"
+		} else if strings.HasSuffix(q.Name, ".dyn.domain.com.") {
+			// Each query receives a different address from the same network
+			addr = fmt.Sprintf("10.20.30.%d", 1+rand.Intn(254))
+		}
+		if addr != "" && q.Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.ParseIP(addr),
+			})
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	cases := []struct {
+		input string
+		want  int
+	}{
+		{input: "www.dyn.domain.com", want: WildcardTypeNone},
+		{input: "jeff_foley.dyn.domain.com", want: WildcardTypeDynamic},
+	}
+	for _, c := range cases {
+		resp, err := r.Query(context.TODO(), QueryMsg(c.input, dns.TypeA), PriorityNormal, nil)
+		if err != nil {
+			t.Fatalf("The query for %s failed: %v", c.input, err)
+		}
+		if got := r.WildcardType(context.TODO(), resp, "domain.com"); got != c.want {
+			t.Errorf("Wildcard detection for %s returned %d instead of %d", c.input, got, c.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package resolve
 
 import (
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -48,3 +49,48 @@ func ClientSubnetCheck(resolver string) error {
 	}
 	return nil
 }
+
+// ClientSubnetMsg generates a message for the query carrying an EDNS client subnet option for the
+// provided prefix. A prefix length of zero explicitly asks servers not to use the client address.
+func ClientSubnetMsg(name string, qtype uint16, subnet *net.IPNet) *dns.Msg {
+	m := QueryMsg(name, qtype)
+	if subnet == nil {
+		return m
+	}
+
+	family := uint16(1)
+	ip := subnet.IP.To4()
+	if ip == nil {
+		family = 2
+		ip = subnet.IP.To16()
+	}
+	ones, _ := subnet.Mask.Size()
+
+	opt := m.IsEdns0()
+	opt.Option = []dns.EDNS0{&dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: uint8(ones),
+		Address:       ip.Mask(subnet.Mask),
+	}}
+	return m
+}
+
+// ClientSubnetScope returns the scope prefix length from the EDNS client subnet option in the response,
+// which indicates the part of the client subnet the answer applies to.
+func ClientSubnetScope(resp *dns.Msg) (int, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return 0, false
+	}
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return int(e.SourceScope), true
+		}
+	}
+	return 0, false
+}
@@ -4,8 +4,12 @@
 package resolve
 
 import (
+	"context"
+	"net"
 	"testing"
 	"time"
+
+	"github.com/miekg/dns"
 )
 
 func TestClientSubnetCheck(t *testing.T) {
@@ -31,3 +35,60 @@ func TestClientSubnetCheck(t *testing.T) {
 		time.Sleep(500 * time.Millisecond)
 	}
 }
+
+func TestClientSubnetMsg(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("203.0.113.77/24")
+
+	msg := ClientSubnetMsg("ecs.net", dns.TypeA, subnet)
+	opt := msg.IsEdns0()
+	if opt == nil || len(opt.Option) != 1 {
+		t.Fatalf("The message did not contain the client subnet option")
+	}
+	e, ok := opt.Option[0].(*dns.EDNS0_SUBNET)
+	if !ok || e.Family != 1 || e.SourceNetmask != 24 || !e.Address.Equal(net.ParseIP("203.0.113.0")) {
+		t.Errorf("The client subnet option was %v", opt.Option[0])
+	}
+
+	_, subnet, _ = net.ParseCIDR("2001:db8::/48")
+	e = ClientSubnetMsg("ecs.net", dns.TypeA, subnet).IsEdns0().Option[0].(*dns.EDNS0_SUBNET)
+	if e.Family != 2 || e.SourceNetmask != 48 {
+		t.Errorf("The IPv6 client subnet option was %v", e)
+	}
+}
+
+func TestClientSubnetScope(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		if opt := req.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if e, ok := o.(*dns.EDNS0_SUBNET); ok && e.SourceNetmask > 0 {
+					e.SourceScope = e.SourceNetmask - 4
+				}
+			}
+			m.Extra = append(m.Extra, opt)
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	_, subnet, _ := net.ParseCIDR("203.0.113.0/24")
+	resp, err := Lookup(context.TODO(), r, "ecs.net", WithClientSubnet(subnet))
+	if err != nil {
+		t.Fatalf("The lookup failed: %v", err)
+	}
+	if scope, found := ClientSubnetScope(resp); !found || scope != 20 {
+		t.Errorf("The client subnet scope returned was %d", scope)
+	}
+
+	if _, found := ClientSubnetScope(new(dns.Msg)); found {
+		t.Errorf("A scope was returned for a response without the option")
+	}
+}
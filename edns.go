@@ -0,0 +1,145 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// ednsCapabilities caches the EDNS support discovered for a resolver.
+// Until the probe completes, full support is assumed.
+type ednsCapabilities struct {
+	sync.Mutex
+	once      sync.Once
+	supported bool
+	options   bool
+	// The UDP payload size advertised by the resolver, or zero when unknown
+	udpSize uint16
+}
+
+func newEDNSCapabilities() *ednsCapabilities {
+	return &ednsCapabilities{
+		supported: true,
+		options:   true,
+	}
+}
+
+func ednsRejected(m *dns.Msg) bool {
+	return m.Rcode == dns.RcodeFormatError || m.Rcode == dns.RcodeNotImplemented || m.Rcode == dns.RcodeBadVers
+}
+
+// probeEDNS discovers the EDNS support of the resolver, starting with the options sent in regular queries
+// and falling back to a bare OPT record. The probe is sent through the queue of the resolver, so it is paced
+// by the rate limiter and counted against the in-flight cap like the other queries.
+func (r *baseResolver) probeEDNS() {
+	_, max := r.xchgs.config().timeouts()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*max)
+	defer cancel()
+
+	resp, err := r.Query(ctx, QueryMsg(".", dns.TypeNS), PriorityLow, nil)
+	// Silence is not evidence of missing EDNS support
+	if resp == nil || (err != nil && !ednsRejected(resp)) {
+		return
+	}
+
+	caps := r.edns
+	caps.Lock()
+	defer caps.Unlock()
+
+	opt := resp.IsEdns0()
+	if ednsRejected(resp) || (opt == nil && caps.supported) {
+		caps.supported = false
+		caps.options = false
+		r.log.Printf("Resolver %s does not support EDNS", r.address)
+		return
+	}
+	if opt != nil {
+		caps.udpSize = opt.UDPSize()
+	}
+	if !caps.options {
+		r.log.Printf("Resolver %s does not support EDNS options", r.address)
+	}
+}
+
+// downgrade is called when the resolver rejects the query sent with an OPT record. Only the features
+// present in the rejected query are removed, so concurrent rejections do not remove more than once.
+func (c *ednsCapabilities) downgrade(sent *dns.Msg) {
+	opt := sent.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if len(opt.Option) > 0 {
+		c.options = false
+		return
+	}
+	c.supported = false
+}
+
+// level returns the number of EDNS features assumed to be supported, which only decreases.
+func (c *ednsCapabilities) level() int {
+	c.Lock()
+	defer c.Unlock()
+
+	var l int
+	if c.supported {
+		l++
+	}
+	if c.options {
+		l++
+	}
+	return l
+}
+
+// resend returns true when the query was rejected for the EDNS features the resolver has since been found
+// not to support, so the query can be sent again without them. The level is obtained before the query was sent.
+func (c *ednsCapabilities) resend(msg, resp *dns.Msg, level int) bool {
+	return resp != nil && ednsRejected(resp) && msg.IsEdns0() != nil && c.level() < level
+}
+
+// adapt returns the message to be sent to the resolver, which is a modified copy
+// when the provided message uses EDNS features the resolver does not support.
+func (c *ednsCapabilities) adapt(msg *dns.Msg) *dns.Msg {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return msg
+	}
+
+	c.Lock()
+	supported, options, size := c.supported, c.options, c.udpSize
+	c.Unlock()
+
+	shrink := size >= dns.MinMsgSize && opt.UDPSize() > size
+	if supported && (options || len(opt.Option) == 0) && !shrink {
+		return msg
+	}
+
+	m := msg.Copy()
+	var extra []dns.RR
+	for _, rr := range m.Extra {
+		if rr.Header().Rrtype != dns.TypeOPT {
+			extra = append(extra, rr)
+		}
+	}
+	m.Extra = extra
+	if !supported {
+		return m
+	}
+
+	o := dns.Copy(opt).(*dns.OPT)
+	if !options {
+		o.Option = nil
+	}
+	if shrink {
+		o.SetUDPSize(size)
+	}
+	m.Extra = append(m.Extra, o)
+	return m
+}
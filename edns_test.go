@@ -0,0 +1,145 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func oldForwarderHandler(allowOPT bool) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		if opt := req.IsEdns0(); opt != nil && (!allowOPT || len(opt.Option) > 0) {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeFormatError)
+			w.WriteMsg(m)
+			return
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if req.IsEdns0() != nil {
+			m.SetEdns0(1232, false)
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func TestEDNSProbe(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", oldForwarderHandler(true))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil).(*baseResolver)
+	defer r.Stop()
+
+	r.probeEDNS()
+	msg := QueryMsg("edns.net", dns.TypeA)
+	m := r.edns.adapt(msg)
+	opt := m.IsEdns0()
+	if opt == nil || len(opt.Option) != 0 || opt.UDPSize() != 1232 {
+		t.Errorf("The message was not adapted to the resolver EDNS capabilities: %v", opt)
+	}
+	if len(msg.IsEdns0().Option) == 0 {
+		t.Errorf("The original message was modified")
+	}
+
+	if _, err := r.Query(context.TODO(), msg, PriorityNormal, nil); err != nil {
+		t.Errorf("The adapted query failed: %v", err)
+	}
+}
+
+func TestEDNSUnsupported(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", oldForwarderHandler(false))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil).(*baseResolver)
+	defer r.Stop()
+
+	r.probeEDNS()
+	if m := r.edns.adapt(QueryMsg("edns.net", dns.TypeA)); m.IsEdns0() != nil {
+		t.Errorf("The OPT record was sent to a resolver without EDNS support")
+	}
+}
+
+func TestEDNSDowngrade(t *testing.T) {
+	c := newEDNSCapabilities()
+
+	msg := QueryMsg("edns.net", dns.TypeA)
+	if m := c.adapt(msg); m != msg {
+		t.Errorf("The message was copied while full EDNS support was assumed")
+	}
+
+	c.downgrade(msg)
+	// A concurrent rejection of a query sent with the options does not remove the OPT record
+	c.downgrade(msg)
+	bare := c.adapt(msg)
+	if opt := bare.IsEdns0(); opt == nil || len(opt.Option) != 0 {
+		t.Errorf("The options were not removed after the first downgrade")
+	}
+
+	c.downgrade(bare)
+	if opt := c.adapt(msg).IsEdns0(); opt != nil {
+		t.Errorf("The OPT record was not removed after the second downgrade")
+	}
+}
+
+func TestEDNSResend(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", oldForwarderHandler(false))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil).(*baseResolver)
+	defer r.Stop()
+
+	if _, err := r.Query(context.TODO(), QueryMsg("edns.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The query rejected for the EDNS features was not sent again: %v", err)
+	}
+
+	r2 := NewBaseResolver(addrstr, 100, nil).(*baseResolver)
+	defer r2.Stop()
+
+	done := make(chan *Result, 1)
+	r2.queryAsync(context.TODO(), QueryMsg("edns.net", dns.TypeA), PriorityNormal, func(res *Result) { done <- res })
+	if res := <-done; res.Err != nil {
+		t.Errorf("The async query rejected for the EDNS features was not sent again: %v", res.Err)
+	}
+}
+
+func TestPoolProbeEDNS(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", oldForwarderHandler(true))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil).(*baseResolver)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetConfig(PoolConfig{ProbeEDNS: true})
+	_, _ = pool.Query(context.TODO(), QueryMsg("edns.net", dns.TypeA), PriorityNormal, nil)
+
+	var size uint16
+	for i := 0; i < 20 && size == 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+
+		r.edns.Lock()
+		size = r.edns.udpSize
+		r.edns.Unlock()
+	}
+	if size != 1232 {
+		t.Errorf("The resolver of the pool was not probed for its EDNS support")
+	}
+}
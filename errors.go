@@ -0,0 +1,40 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import "errors"
+
+// The errors that a ResolveError can be compared against using errors.Is, so the failure modes
+// are distinguished without inspecting the message. The Reason provides the finer detail.
+var (
+	// ErrTimeout matches the queries that did not receive a response before the timeout expired.
+	ErrTimeout = errors.New("Resolver: The query timed out")
+	// ErrPoolClosed matches the queries sent to a resolver or pool that has been stopped.
+	ErrPoolClosed = errors.New("Resolver: The resolver has been stopped")
+	// ErrNoResolvers matches the queries for which no resolver was available, including when
+	// all the resolvers have been quarantined.
+	ErrNoResolvers = errors.New("Resolver: No resolvers are available")
+	// ErrTruncated matches the truncated responses that could not be obtained again using TCP.
+	ErrTruncated = errors.New("Resolver: The response was truncated")
+	// ErrRateLimited matches the queries not sent due to the rate limit or the in-flight query cap.
+	ErrRateLimited = errors.New("Resolver: The query was rate limited")
+)
+
+// Is reports whether the error matches the target, which allows errors.Is
+// to compare a ResolveError with the errors provided by the package.
+func (e *ResolveError) Is(target error) bool {
+	switch target {
+	case ErrTimeout:
+		return e.Reason == ReasonTimeout || e.Reason == ReasonAttemptTimeout
+	case ErrPoolClosed:
+		return e.Reason == ReasonResolverStopped
+	case ErrNoResolvers:
+		return e.Reason == ReasonNoResolvers || e.Reason == ReasonAllResolversQuarantined
+	case ErrTruncated:
+		return e.Reason == ReasonTruncated
+	case ErrRateLimited:
+		return e.Reason == ReasonRateBudgetExhausted || e.Reason == ReasonInFlightCapReached
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestResolveErrorIs(t *testing.T) {
+	sentinels := []error{ErrTimeout, ErrPoolClosed, ErrNoResolvers, ErrTruncated, ErrRateLimited}
+	tests := []struct {
+		reason Reason
+		target error
+	}{
+		{ReasonTimeout, ErrTimeout},
+		{ReasonAttemptTimeout, ErrTimeout},
+		{ReasonResolverStopped, ErrPoolClosed},
+		{ReasonNoResolvers, ErrNoResolvers},
+		{ReasonAllResolversQuarantined, ErrNoResolvers},
+		{ReasonTruncated, ErrTruncated},
+		{ReasonRateBudgetExhausted, ErrRateLimited},
+		{ReasonInFlightCapReached, ErrRateLimited},
+		{ReasonErrorRcode, nil},
+	}
+
+	for _, test := range tests {
+		// Wrapping the error must not prevent the comparison
+		err := fmt.Errorf("wrapped: %w", &ResolveError{Err: "failure", Rcode: ResolverErrRcode, Reason: test.reason})
+
+		for _, s := range sentinels {
+			if errors.Is(err, s) != (s == test.target) {
+				t.Errorf("The error with reason %s matched %v: %t", test.reason, s, errors.Is(err, s))
+			}
+		}
+		if ErrorReason(err) != test.reason {
+			t.Errorf("ErrorReason returned %s instead of %s", ErrorReason(err), test.reason)
+		}
+
+		var re *ResolveError
+		if !errors.As(err, &re) || re.Reason != test.reason {
+			t.Errorf("The ResolveError with reason %s was not found using errors.As", test.reason)
+		}
+	}
+}
+
+func TestUnknownErrorReason(t *testing.T) {
+	if reason := ErrorReason(errors.New("failure")); reason != ReasonUnknown {
+		t.Errorf("The error returned reason %s instead of %s", reason, ReasonUnknown)
+	}
+	if reason := ErrorReason(&ResolveError{Err: "failure", Rcode: dns.RcodeServerFailure}); reason != ReasonErrorRcode {
+		t.Errorf("The ResolveError returned reason %s instead of %s", reason, ReasonErrorRcode)
+	}
+}
+
+func TestStoppedErrors(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	pool.Stop()
+
+	for _, res := range []Resolver{r, pool} {
+		_, err := res.Query(context.TODO(), QueryMsg("www.errors.net", dns.TypeA), PriorityNormal, nil)
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("The query using the stopped %s returned %v", res.String(), err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"container/heap"
+	"container/list"
+	"math/rand"
+)
+
+// EvictionPolicy selects the value removed from a full memory cache.
+type EvictionPolicy int
+
+// The eviction policies supported by the memory cache.
+const (
+	// EvictLRU removes the least recently used value.
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU removes the least frequently used value.
+	EvictLFU
+	// EvictRandom removes a value selected at random.
+	EvictRandom
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLFU:
+		return "lfu"
+	case EvictRandom:
+		return "random"
+	}
+	return "lru"
+}
+
+// evictionOrder tracks the entries of the memory cache in the order they will be evicted.
+type evictionOrder interface {
+	add(e *memoryEntry)
+	touch(e *memoryEntry)
+	remove(e *memoryEntry)
+	victim() *memoryEntry
+}
+
+func newEvictionOrder(policy EvictionPolicy) evictionOrder {
+	switch policy {
+	case EvictLFU:
+		return new(lfuOrder)
+	case EvictRandom:
+		return new(randomOrder)
+	}
+	return &lruOrder{l: list.New()}
+}
+
+type lruOrder struct {
+	l *list.List
+}
+
+func (o *lruOrder) add(e *memoryEntry)    { e.el = o.l.PushFront(e) }
+func (o *lruOrder) touch(e *memoryEntry)  { o.l.MoveToFront(e.el) }
+func (o *lruOrder) remove(e *memoryEntry) { o.l.Remove(e.el) }
+
+func (o *lruOrder) victim() *memoryEntry {
+	return o.l.Back().Value.(*memoryEntry)
+}
+
+// lfuOrder is a min-heap of the entries ordered by the number of times they were requested.
+type lfuOrder []*memoryEntry
+
+func (o lfuOrder) Len() int           { return len(o) }
+func (o lfuOrder) Less(i, j int) bool { return o[i].hits < o[j].hits }
+
+func (o lfuOrder) Swap(i, j int) {
+	o[i], o[j] = o[j], o[i]
+	o[i].idx = i
+	o[j].idx = j
+}
+
+func (o *lfuOrder) Push(x interface{}) {
+	e := x.(*memoryEntry)
+	e.idx = len(*o)
+	*o = append(*o, e)
+}
+
+func (o *lfuOrder) Pop() interface{} {
+	old := *o
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*o = old[:n-1]
+	return e
+}
+
+func (o *lfuOrder) add(e *memoryEntry) { heap.Push(o, e) }
+
+func (o *lfuOrder) touch(e *memoryEntry) {
+	e.hits++
+	heap.Fix(o, e.idx)
+}
+
+func (o *lfuOrder) remove(e *memoryEntry) { heap.Remove(o, e.idx) }
+func (o *lfuOrder) victim() *memoryEntry  { return (*o)[0] }
+
+type randomOrder struct {
+	entries []*memoryEntry
+}
+
+func (o *randomOrder) add(e *memoryEntry) {
+	e.idx = len(o.entries)
+	o.entries = append(o.entries, e)
+}
+
+func (o *randomOrder) touch(e *memoryEntry) {}
+
+func (o *randomOrder) remove(e *memoryEntry) {
+	last := len(o.entries) - 1
+
+	o.entries[e.idx] = o.entries[last]
+	o.entries[e.idx].idx = e.idx
+	o.entries[last] = nil
+	o.entries = o.entries[:last]
+}
+
+func (o *randomOrder) victim() *memoryEntry {
+	return o.entries[rand.Intn(len(o.entries))]
+}
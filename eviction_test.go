@@ -0,0 +1,86 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEvictionPolicies(t *testing.T) {
+	lru := NewMemoryCacheWithConfig(MemoryCacheConfig{MaxEntries: 2, Policy: EvictLRU})
+	lru.Set("a", []byte("a"), time.Minute)
+	lru.Set("b", []byte("b"), time.Minute)
+	lru.Get("a")
+	lru.Set("c", []byte("c"), time.Minute)
+	if _, found := lru.Get("b"); found {
+		t.Errorf("The LRU policy did not evict the least recently used value")
+	}
+
+	lfu := NewMemoryCacheWithConfig(MemoryCacheConfig{MaxEntries: 2, Policy: EvictLFU})
+	lfu.Set("a", []byte("a"), time.Minute)
+	lfu.Set("b", []byte("b"), time.Minute)
+	for i := 0; i < 3; i++ {
+		lfu.Get("a")
+	}
+	lfu.Get("b")
+	lfu.Get("a")
+	lfu.Set("c", []byte("c"), time.Minute)
+	if _, found := lfu.Get("b"); found {
+		t.Errorf("The LFU policy did not evict the least frequently used value")
+	}
+	if _, found := lfu.Get("a"); !found {
+		t.Errorf("The LFU policy evicted the most frequently used value")
+	}
+
+	random := NewMemoryCacheWithConfig(MemoryCacheConfig{MaxEntries: 10, Policy: EvictRandom})
+	for i := 0; i < 100; i++ {
+		random.Set(fmt.Sprintf("key%d", i), []byte("value"), time.Minute)
+	}
+	random.Delete("key99")
+
+	var count int
+	for i := 0; i < 100; i++ {
+		if _, found := random.Get(fmt.Sprintf("key%d", i)); found {
+			count++
+		}
+	}
+	if count != 9 {
+		t.Errorf("The random policy kept %d values instead of 9", count)
+	}
+	if n := random.(evictionCounter).Evictions(); n != 90 {
+		t.Errorf("The cache counted %d evictions instead of 90", n)
+	}
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	c := NewMemoryCacheWithConfig(MemoryCacheConfig{MaxBytes: 10 * (memoryEntryOverhead + 104)})
+
+	value := make([]byte, 100)
+	for i := 0; i < 50; i++ {
+		c.Set(fmt.Sprintf("k%03d", i), value, time.Minute)
+	}
+
+	mc := c.(*memoryCache)
+	if mc.bytes > mc.config.MaxBytes || len(mc.entries) != 10 {
+		t.Errorf("The cache holds %d values in %d bytes", len(mc.entries), mc.bytes)
+	}
+
+	c.Set("large", make([]byte, mc.config.MaxBytes), time.Minute)
+	if _, found := c.Get("large"); found {
+		t.Errorf("The value larger than the memory cap was stored")
+	}
+	if len(mc.entries) != 10 {
+		t.Errorf("The value larger than the memory cap caused evictions")
+	}
+}
+
+func TestEvictionPolicyString(t *testing.T) {
+	for p, s := range map[EvictionPolicy]string{EvictLRU: "lru", EvictLFU: "lfu", EvictRandom: "random"} {
+		if p.String() != s {
+			t.Errorf("The policy provided %q instead of %q", p.String(), s)
+		}
+	}
+}
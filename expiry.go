@@ -0,0 +1,70 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// The most goroutines used to return a batch of requests to the callers
+	expiryWorkers = 4
+	// Batches smaller than this are returned by the goroutine that removed them
+	expiryBatchThreshold = 64
+)
+
+// expire fails the requests that timed out. A sweep finding expired requests is treated as a single
+// congestion signal and timeout backoff, so a timeout storm does not compound the adjustments.
+func (r *baseResolver) expire(reqs []*resolveRequest) {
+	var sent []*resolveRequest
+	for _, req := range reqs {
+		if req.Msg != nil {
+			sent = append(sent, req)
+		}
+	}
+	if len(sent) == 0 {
+		return
+	}
+
+	r.aimd.congestion()
+	_, max := r.xchgs.config().timeouts()
+	r.rtt.backoff(max)
+
+	forEachRequest(sent, func(req *resolveRequest) {
+		estr := fmt.Sprintf("Query on resolver %s, for %s type %d timed out", r.address, req.Name, req.Qtype)
+		r.returnRequest(req, makeResolveResult(nil, true, estr, TimeoutRcode, ReasonAttemptTimeout))
+	})
+}
+
+// forEachRequest executes the function for each request, spreading large batches across a bounded
+// number of goroutines, and returns once all the requests have been processed. Waiting for the batch
+// keeps the callers performing retries from piling up behind the following sweeps.
+func forEachRequest(reqs []*resolveRequest, f func(*resolveRequest)) {
+	if len(reqs) < expiryBatchThreshold {
+		for _, req := range reqs {
+			f(req)
+		}
+		return
+	}
+
+	ch := make(chan *resolveRequest, len(reqs))
+	for _, req := range reqs {
+		ch <- req
+	}
+	close(ch)
+
+	var wg sync.WaitGroup
+	for i := 0; i < expiryWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for req := range ch {
+				f(req)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestForEachRequestBounded(t *testing.T) {
+	var reqs []*resolveRequest
+	for i := 0; i < 10*expiryBatchThreshold; i++ {
+		reqs = append(reqs, &resolveRequest{ID: uint16(i)})
+	}
+
+	var lock sync.Mutex
+	var active, peak int32
+	seen := make(map[uint16]bool)
+	forEachRequest(reqs, func(req *resolveRequest) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+
+		lock.Lock()
+		if n > peak {
+			peak = n
+		}
+		seen[req.ID] = true
+		lock.Unlock()
+		time.Sleep(time.Millisecond)
+	})
+
+	if len(seen) != len(reqs) {
+		t.Errorf("%d of the %d requests were processed", len(seen), len(reqs))
+	}
+	if peak > expiryWorkers {
+		t.Errorf("%d requests were processed concurrently, exceeding the %d workers", peak, expiryWorkers)
+	}
+}
+
+func TestExpireBatch(t *testing.T) {
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	defer r.Stop()
+	base := r.(*baseResolver)
+	base.rtt.observe(100 * time.Millisecond)
+	before := base.xchgs.queryTimeout()
+
+	var results []chan *resolveResult
+	var reqs []*resolveRequest
+	for i := 0; i < 2*expiryBatchThreshold; i++ {
+		req := base.newRequest(context.TODO(), QueryMsg(fmt.Sprintf("host%d.expire.net", i), dns.TypeA))
+		req.Result = make(chan *resolveResult, 1)
+		results = append(results, req.Result)
+		reqs = append(reqs, req)
+	}
+	// Requests that were never sent are not returned as timeouts
+	reqs = append(reqs, &resolveRequest{Name: "unsent.expire.net"})
+
+	base.expire(reqs)
+	for _, ch := range results {
+		select {
+		case res := <-ch:
+			if ErrorReason(res.Err) != ReasonAttemptTimeout || !res.Again {
+				t.Errorf("The expired request was returned with %v", res.Err)
+			}
+		default:
+			t.Fatalf("The expired request was not returned")
+		}
+	}
+	// The batch is a single timeout event for the backoff
+	if after := base.xchgs.queryTimeout(); after != 2*before {
+		t.Errorf("The timeout changed from %v to %v instead of doubling once", before, after)
+	}
+}
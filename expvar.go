@@ -0,0 +1,58 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"expvar"
+	"fmt"
+)
+
+// RuntimeStats describes the internal state of a ResolverPool at a moment in time.
+type RuntimeStats struct {
+	// Resolvers is the number of resolvers in the pool that have not been stopped.
+	Resolvers int `json:"resolvers"`
+	// InFlight is the number of queries sent that are awaiting a response.
+	InFlight int `json:"in_flight"`
+	// Queued is the number of queries waiting to be sent.
+	Queued int `json:"queued"`
+	// Sockets is the number of connections held open by the resolvers.
+	Sockets int `json:"sockets"`
+	// Drops is the number of responses dropped for not matching the query sent.
+	Drops uint64 `json:"drops"`
+}
+
+// RuntimeStats returns the current internal state of the pool.
+func (rp *ResolverPool) RuntimeStats() RuntimeStats {
+	var s RuntimeStats
+
+	for _, r := range rp.resolvers() {
+		if r.Stopped() {
+			continue
+		}
+
+		s.Resolvers++
+		if qr, ok := r.(queueReporter); ok {
+			s.InFlight += qr.inFlightCount()
+			s.Queued += qr.queueDepth()
+			// Each resolver sending the queries itself holds a connection
+			s.Sockets++
+		}
+		if mc, ok := r.(mismatchCounter); ok {
+			s.Drops += mc.responseMismatches()
+		}
+	}
+	return s
+}
+
+// PublishExpvar publishes the RuntimeStats of the pool as an expvar variable with the provided
+// name, so they are available for inspection without a metrics system, such as from /debug/vars.
+// The stats are obtained each time the variable is read. An error is returned when the name is already in use.
+func (rp *ResolverPool) PublishExpvar(name string) error {
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("PublishExpvar: The variable %s has already been published", name)
+	}
+
+	expvar.Publish(name, expvar.Func(func() interface{} { return rp.RuntimeStats() }))
+	return nil
+}
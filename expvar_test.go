@@ -0,0 +1,46 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	stopped := NewBaseResolver(addrstr, 100, nil)
+	stopped.Stop()
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil), stopped}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if err := pool.PublishExpvar("resolve_test_pool"); err != nil {
+		t.Fatalf("Failed to publish the pool stats: %v", err)
+	}
+	if err := pool.PublishExpvar("resolve_test_pool"); err == nil {
+		t.Errorf("The stats were published twice using the same name")
+	}
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("www.expvar.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+
+	var stats RuntimeStats
+	if err := json.Unmarshal([]byte(expvar.Get("resolve_test_pool").String()), &stats); err != nil {
+		t.Fatalf("Failed to decode the published stats: %v", err)
+	}
+	if stats.Resolvers != 1 || stats.Sockets != 1 || stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("The published stats were unexpected: %+v", stats)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// The consistency status values for forward-confirmed reverse DNS checks.
+const (
+	FCrDNSNoPTR = iota
+	FCrDNSConsistent
+	FCrDNSInconsistent
+)
+
+// PTRConsistency describes whether a hostname from a PTR answer resolves back to the original address.
+type PTRConsistency struct {
+	Hostname   string
+	Addresses  []string
+	Consistent bool
+}
+
+// FCrDNSResult contains the forward-confirmed reverse DNS status for an IP address.
+type FCrDNSResult struct {
+	Addr   string
+	Status int
+	Names  []*PTRConsistency
+}
+
+// ForwardConfirmedReverse performs a PTR query for the provided IP address and checks
+// whether each hostname returned maps back to the same address via forward resolution.
+func ForwardConfirmedReverse(ctx context.Context, r Resolver, addr string, priority int) (*FCrDNSResult, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("ForwardConfirmedReverse: %s is not a valid IP address", addr)
+	}
+
+	msg := ReverseMsg(ip.String())
+	resp, err := r.Query(ctx, msg, priority, RetryPolicy)
+	if err != nil {
+		if e, ok := err.(*ResolveError); ok && e.Rcode == dns.RcodeNameError {
+			return &FCrDNSResult{Addr: ip.String(), Status: FCrDNSNoPTR}, nil
+		}
+		return nil, err
+	}
+
+	result := &FCrDNSResult{
+		Addr:   ip.String(),
+		Status: FCrDNSNoPTR,
+	}
+	for _, ptr := range AnswersByType(ExtractAnswers(resp), dns.TypePTR) {
+		c := forwardConsistency(ctx, r, ptr.Data, ip, priority)
+
+		result.Names = append(result.Names, c)
+		if c.Consistent {
+			result.Status = FCrDNSConsistent
+		} else if result.Status == FCrDNSNoPTR {
+			result.Status = FCrDNSInconsistent
+		}
+	}
+
+	return result, nil
+}
+
+func forwardConsistency(ctx context.Context, r Resolver, name string, ip net.IP, priority int) *PTRConsistency {
+	qtype := dns.TypeA
+	if ip.To4() == nil {
+		qtype = dns.TypeAAAA
+	}
+
+	c := &PTRConsistency{Hostname: name}
+	if resp, err := r.Query(ctx, QueryMsg(name, qtype), priority, RetryPolicy); err == nil {
+		for _, a := range AnswersByType(ExtractAnswers(resp), qtype) {
+			c.Addresses = append(c.Addresses, a.Data)
+
+			if fip := net.ParseIP(a.Data); fip != nil && fip.Equal(ip) {
+				c.Consistent = true
+			}
+		}
+	}
+
+	return c
+}
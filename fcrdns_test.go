@@ -0,0 +1,67 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestForwardConfirmedReverse(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(fcrdnsHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	cases := []struct {
+		addr string
+		want int
+	}{
+		{addr: "192.168.1.1", want: FCrDNSConsistent},
+		{addr: "192.168.1.2", want: FCrDNSInconsistent},
+		{addr: "192.168.1.3", want: FCrDNSNoPTR},
+	}
+
+	for _, c := range cases {
+		result, err := ForwardConfirmedReverse(context.TODO(), r, c.addr, PriorityNormal)
+		if err != nil {
+			t.Errorf("The check for %s failed: %v", c.addr, err)
+			continue
+		}
+		if result.Status != c.want {
+			t.Errorf("The check for %s returned status %d instead of %d", c.addr, result.Status, c.want)
+		}
+	}
+
+	if _, err := ForwardConfirmedReverse(context.TODO(), r, "caffix.net", PriorityNormal); err == nil {
+		t.Errorf("No error was returned for an invalid IP address")
+	}
+}
+
+func fcrdnsHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	hdr := dns.RR_Header{Name: req.Question[0].Name, Rrtype: req.Question[0].Qtype, Class: dns.ClassINET}
+	switch req.Question[0].Name {
+	case "1.1.168.192.in-addr.arpa.":
+		m.Answer = append(m.Answer, &dns.PTR{Hdr: hdr, Ptr: "host.caffix.net."})
+	case "2.1.168.192.in-addr.arpa.":
+		m.Answer = append(m.Answer, &dns.PTR{Hdr: hdr, Ptr: "poser.caffix.net."})
+	case "host.caffix.net.":
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("192.168.1.1")})
+	case "poser.caffix.net.":
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("10.0.0.1")})
+	default:
+		m.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(m)
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// wildcardFilterer is implemented by the Resolvers able to provide the wildcard types of many subdomains at once.
+type wildcardFilterer interface {
+	wildcardLeveler
+	wildcardTypes(ctx context.Context, subs []string) map[string]int
+}
+
+// FilterWildcards returns the names within the zone that do not match a DNS wildcard, in the order provided.
+// The wildcard determination of each label between the zone and the names is obtained once for all the
+// names, and only the names below subdomains with wildcards are resolved and compared with the wildcard
+// answers, using QueryBatch. Names outside of the zone are returned without being classified, and
+// all the names are returned when QueryBatch fails.
+func (rp *ResolverPool) FilterWildcards(ctx context.Context, zone string, names []string) []string {
+	f, ok := rp.wildcardResolver().(wildcardFilterer)
+	if !ok || len(names) == 0 {
+		return names
+	}
+
+	zone = strings.ToLower(RemoveLastDot(zone))
+	levels := make(map[string]struct{})
+	for _, name := range names {
+		for _, sub := range wildcardLevels(strings.ToLower(RemoveLastDot(name)), zone) {
+			levels[sub] = struct{}{}
+		}
+	}
+
+	subs := make([]string, 0, len(levels))
+	for sub := range levels {
+		subs = append(subs, sub)
+	}
+	types := f.wildcardTypes(ctx, subs)
+
+	// Only the names below a wildcard need to be resolved
+	var idxs []int
+	var check []string
+	for i, name := range names {
+		for _, sub := range wildcardLevels(strings.ToLower(RemoveLastDot(name)), zone) {
+			if types[sub] != WildcardTypeNone {
+				idxs = append(idxs, i)
+				check = append(check, name)
+				break
+			}
+		}
+	}
+
+	results, err := rp.QueryBatch(ctx, check, dns.TypeA)
+	if err != nil {
+		// The names cannot be classified without the answers
+		return names
+	}
+
+	wildcard := make(map[int]struct{})
+	for j, res := range results {
+		msg := res.Msg
+		if msg == nil {
+			msg = QueryMsg(check[j], dns.TypeA)
+		}
+		if _, wtype := f.wildcardLevel(ctx, msg, zone); wtype != WildcardTypeNone {
+			wildcard[idxs[j]] = struct{}{}
+		}
+	}
+
+	filtered := make([]string, 0, len(names)-len(wildcard))
+	for i, name := range names {
+		if _, found := wildcard[i]; !found {
+			filtered = append(filtered, name)
+		}
+	}
+	return filtered
+}
+
+// wildcardLevels returns the subdomains checked for wildcards when classifying the name,
+// starting with the zone and ending with the parent of the name.
+func wildcardLevels(name, zone string) []string {
+	if zone == "" || name == zone || !strings.HasSuffix(name, "."+zone) {
+		return nil
+	}
+
+	var levels []string
+	for sub := parentName(name); ; sub = parentName(sub) {
+		levels = append([]string{sub}, levels...)
+		if sub == zone {
+			break
+		}
+	}
+	return levels
+}
+
+// wildcardTypes obtains the wildcard determinations of the subdomains at the same time.
+func (r *baseResolver) wildcardTypes(ctx context.Context, subs []string) map[string]int {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	types := make(map[string]int, len(subs))
+
+	wg.Add(len(subs))
+	for _, sub := range subs {
+		go func(sub string) {
+			defer wg.Done()
+
+			w := r.fetchWildcardType(ctx, sub)
+			lock.Lock()
+			types[sub] = w.WildcardType
+			lock.Unlock()
+		}(sub)
+	}
+
+	wg.Wait()
+	return types
+}
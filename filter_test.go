@@ -0,0 +1,63 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestFilterWildcards(t *testing.T) {
+	var queried int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Name == "www.domain.com." {
+			atomic.AddInt32(&queried, 1)
+		}
+		wildcardHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	names := []string{
+		"www.domain.com",
+		"foo.wildcard.domain.com",
+		"ns.wildcard.domain.com",
+		"www.other.net",
+		"bar.wildcard.domain.com",
+	}
+	expected := []string{"www.domain.com", "ns.wildcard.domain.com", "www.other.net"}
+	if got := pool.FilterWildcards(context.TODO(), "domain.com", names); !reflect.DeepEqual(got, expected) {
+		t.Errorf("FilterWildcards returned %v instead of %v", got, expected)
+	}
+	if n := atomic.LoadInt32(&queried); n != 0 {
+		t.Errorf("The name without wildcards above it was resolved %d times", n)
+	}
+}
+
+func TestWildcardLevelNames(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		zone     string
+		expected []string
+	}{
+		{"a.b.example.com", "example.com", []string{"example.com", "b.example.com"}},
+		{"www.example.com", "example.com", []string{"example.com"}},
+		{"example.com", "example.com", nil},
+		{"www.example.net", "example.com", nil},
+	} {
+		if got := wildcardLevels(test.name, test.zone); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("The levels of %s were %v instead of %v", test.name, got, test.expected)
+		}
+	}
+}
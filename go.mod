@@ -8,4 +8,6 @@ require (
 	github.com/miekg/dns v1.1.43
 	github.com/stretchr/testify v1.7.0 // indirect
 	go.uber.org/ratelimit v0.2.0
+	golang.org/x/net v0.0.0-20210917221730-978cfadd31cf
+	golang.org/x/sys v0.0.0-20210917161153-d61c044b1678
 )
@@ -0,0 +1,135 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The number of responses observed before a hedge percentile replaces the fixed delay.
+const minHedgeSamples = 20
+
+// HedgeConfig controls when the pool sends a query to a second resolver.
+type HedgeConfig struct {
+	// Delay is the time waited for the first resolver before the query is hedged.
+	Delay time.Duration
+	// Percentile, between 0 and 1, replaces the fixed delay with the observed response
+	// latency at that percentile, such as 0.95, once enough responses have been observed.
+	Percentile float64
+}
+
+// SetHedging causes queries that have not been answered within the configured delay to also
+// be sent to a second resolver, returning the first response and cancelling the other query.
+// A configuration with a zero Delay disables hedging.
+func (rp *ResolverPool) SetHedging(config HedgeConfig) {
+	defer rp.configChanged("hedging", "delay", config.Delay, "percentile", config.Percentile)
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.hedge = config
+	rp.hedgeLatency = latencyHistogram{}
+}
+
+// hedgeDelay returns the time to wait before hedging, or zero when hedging is disabled.
+func (rp *ResolverPool) hedgeDelay() time.Duration {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if rp.hedge.Delay <= 0 {
+		return 0
+	}
+	if rp.hedge.Percentile > 0 && rp.hedgeLatency.count >= minHedgeSamples {
+		if d := rp.hedgeLatency.percentile(rp.hedge.Percentile); d > 0 {
+			return d
+		}
+	}
+	return rp.hedge.Delay
+}
+
+func (rp *ResolverPool) observeLatency(rtt time.Duration) {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if rp.hedge.Delay > 0 {
+		rp.hedgeLatency.observe(rtt)
+	}
+}
+
+type hedgeResult struct {
+	r    Resolver
+	resp *dns.Msg
+	err  error
+}
+
+// hedgedQuery sends the query to the selected resolver, and to a second resolver when hedging is
+// enabled and the first has not responded in time. Both resolvers are released by this method,
+// and the resolver that provided the returned response is identified.
+func (rp *ResolverPool) hedgedQuery(ctx context.Context, r Resolver, msg *dns.Msg, priority int) (Resolver, *dns.Msg, error) {
+	delay := rp.hedgeDelay()
+	if _, override := resolverFromContext(ctx); delay <= 0 || override {
+		var resp *dns.Msg
+		var err error
+
+		rp.notifySend(r, msg)
+		rp.profilePhase(ctx, PhaseWait, r.String(), func() {
+			resp, err = r.Query(ctx, msg, priority, nil)
+		})
+		rp.releaseResolver(r)
+		return r, resp, err
+	}
+
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan *hedgeResult, 2)
+	send := func(res Resolver, m *dns.Msg) {
+		var resp *dns.Msg
+		var err error
+
+		rp.notifySend(res, m)
+		rp.profilePhase(hctx, PhaseWait, res.String(), func() {
+			resp, err = res.Query(hctx, m, priority, nil)
+		})
+		rp.releaseResolver(res)
+		results <- &hedgeResult{r: res, resp: resp, err: err}
+	}
+	// Each attempt packs and modifies its own message, so the hedge is copied before the first is sent
+	hmsg := msg.Copy()
+	go send(r, msg)
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case res := <-results:
+		return res.r, res.resp, res.err
+	case <-t.C:
+	}
+
+	pending := 1
+	if second := rp.nextResolver(hctx); second != nil {
+		if second != r {
+			pending++
+			go send(second, hmsg)
+		} else {
+			rp.releaseResolver(second)
+		}
+	}
+
+	// Prefer a response over a failure from the other resolver
+	var first *hedgeResult
+	for i := 0; i < pending; i++ {
+		res := <-results
+		if res.err == nil {
+			return res.r, res.resp, nil
+		}
+		if first == nil {
+			first = res
+		}
+	}
+	return first.r, first.resp, first.err
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestHedgedQuery(t *testing.T) {
+	slow, saddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		time.Sleep(time.Second)
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer slow.Shutdown()
+
+	fast, faddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer fast.Shutdown()
+
+	sr := NewBaseResolver(saddr, 100, nil)
+	fr := NewBaseResolver(faddr, 100, nil)
+	pool := NewResolverPool([]Resolver{sr, fr}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetHedging(HedgeConfig{Delay: 50 * time.Millisecond})
+	// Select the slow resolver first, and the idle fast resolver for the hedge
+	pool.SetSelector(NewLeastOutstandingSelector())
+
+	start := time.Now()
+	res := QueryResult(context.TODO(), pool, QueryMsg("hedge.net", dns.TypeA), PriorityNormal, nil)
+	if res.Err != nil {
+		t.Fatalf("The hedged query failed: %v", res.Err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("The hedged query took %s", elapsed)
+	}
+	if res.Resolver != fr.String() {
+		t.Errorf("The response came from %s instead of the hedge resolver", res.Resolver)
+	}
+}
+
+func TestHedgeDelay(t *testing.T) {
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.2:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if d := pool.hedgeDelay(); d != 0 {
+		t.Errorf("A hedge delay of %s was returned while hedging is disabled", d)
+	}
+
+	pool.SetHedging(HedgeConfig{Delay: time.Second, Percentile: 0.95})
+	if d := pool.hedgeDelay(); d != time.Second {
+		t.Errorf("The fixed delay was not used before enough samples: %s", d)
+	}
+
+	for i := 0; i < minHedgeSamples; i++ {
+		pool.observeLatency(10 * time.Millisecond)
+	}
+	if d := pool.hedgeDelay(); d > 20*time.Millisecond {
+		t.Errorf("The percentile delay was not used: %s", d)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The domains used to build names that should never exist during NXDOMAIN hijack checks.
+var hijackCheckDomains = []string{"com", "net", "org"}
+
+// DetectHijacking checks each resolver in the pool immediately, and again on the provided interval
+// until the pool is stopped, by querying nonexistent names. Resolvers that return forged answers
+// instead of NXDOMAIN are removed from the pool and stopped.
+func (rp *ResolverPool) DetectHijacking(interval time.Duration) {
+	go func() {
+		rp.evictHijackers()
+		rp.periodically(interval, func() { rp.evictHijackers() })
+	}()
+}
+
+// evictHijackers removes the resolvers that answer queries for nonexistent names and returns them.
+func (rp *ResolverPool) evictHijackers() []string {
+	var hijackers []string
+
+	timeout := 2 * rp.queryTimeout()
+	for _, r := range rp.resolvers() {
+		if r.Stopped() || !hijacksNXDOMAIN(r, timeout) {
+			continue
+		}
+
+		hijackers = append(hijackers, r.String())
+		rp.logEvent(LevelWarn, "Evicting resolver", "resolver", r.String(), "reason", EvictNXDOMAINHijacking)
+	}
+
+	for _, r := range rp.removeResolvers(hijackers) {
+		r.Stop()
+		rp.notifyEvict(r.String(), EvictNXDOMAINHijacking)
+	}
+	return hijackers
+}
+
+func hijacksNXDOMAIN(r Resolver, timeout time.Duration) bool {
+	for _, domain := range hijackCheckDomains {
+		name := UnlikelyName(domain)
+		if name == "" {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		resp, err := r.Query(ctx, QueryMsg(name, dns.TypeA), PriorityHigh, nil)
+		cancel()
+
+		if err == nil && resp != nil && len(AnswersByType(ExtractAnswers(resp), dns.TypeA)) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func nxdomainHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetRcode(req, dns.RcodeNameError)
+	w.WriteMsg(m)
+}
+
+func TestEvictHijackers(t *testing.T) {
+	liar, laddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer liar.Shutdown()
+
+	honest, haddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(nxdomainHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer honest.Shutdown()
+
+	hijacker := NewBaseResolver(laddr, 100, nil)
+	pool := NewResolverPool([]Resolver{hijacker, NewBaseResolver(haddr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	evicted := pool.evictHijackers()
+	if len(evicted) != 1 || evicted[0] != hijacker.String() {
+		t.Errorf("The pool evicted %v instead of the hijacking resolver", evicted)
+	}
+	if !hijacker.Stopped() {
+		t.Errorf("The hijacking resolver was not stopped")
+	}
+	if addrs := pool.resolverAddrs(); len(addrs) != 1 || addrs[0] != haddr {
+		t.Errorf("The pool contains %v after the eviction", addrs)
+	}
+}
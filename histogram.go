@@ -0,0 +1,93 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"math"
+	"time"
+)
+
+// Each power of two microseconds is split into this many buckets.
+const histogramBucketsPerOctave = 4
+
+const histogramBuckets = 32 * histogramBucketsPerOctave
+
+// latencyHistogram tracks a distribution of durations using log-linear buckets,
+// so memory use stays fixed regardless of the number of observations.
+// The zero value is ready to use and the type is not safe for concurrent use.
+type latencyHistogram struct {
+	counts [histogramBuckets]uint64
+	count  uint64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func histogramIndex(d time.Duration) int {
+	usec := float64(d) / float64(time.Microsecond)
+	if usec < 1 {
+		return 0
+	}
+
+	idx := int(math.Log2(usec)*histogramBucketsPerOctave) + 1
+	if idx >= histogramBuckets {
+		idx = histogramBuckets - 1
+	}
+	return idx
+}
+
+func histogramUpperBound(idx int) time.Duration {
+	usec := math.Exp2(float64(idx) / histogramBucketsPerOctave)
+
+	return time.Duration(usec * float64(time.Microsecond))
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	h.counts[histogramIndex(d)]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// percentile returns an upper estimate of the provided percentile, expressed between 0 and 1.
+func (h *latencyHistogram) percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	if p <= 0 {
+		p = 0
+	} else if p > 1 {
+		p = 1
+	}
+
+	rank := uint64(math.Ceil(p * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var cum uint64
+	for i, c := range h.counts {
+		cum += c
+		if cum >= rank {
+			if d := histogramUpperBound(i); d < h.max {
+				return d
+			}
+			break
+		}
+	}
+	return h.max
+}
+
+func (h *latencyHistogram) mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	var h latencyHistogram
+
+	if p := h.percentile(0.5); p != 0 {
+		t.Errorf("An empty histogram returned a percentile of %s", p)
+	}
+
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	cases := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 0.5, want: 50 * time.Millisecond},
+		{p: 0.95, want: 95 * time.Millisecond},
+		{p: 1, want: 100 * time.Millisecond},
+	}
+	for _, c := range cases {
+		// The estimate must fall within the width of a single bucket
+		got := h.percentile(c.p)
+		if got < c.want || got > c.want+c.want/5 {
+			t.Errorf("Percentile %.2f returned %s instead of approximately %s", c.p, got, c.want)
+		}
+	}
+
+	if m := h.mean(); m != 50500*time.Microsecond {
+		t.Errorf("The mean was %s instead of %s", m, 50500*time.Microsecond)
+	}
+}
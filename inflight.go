@@ -0,0 +1,111 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errInFlightCap = errors.New("the maximum number of in-flight queries has been reached")
+
+// inFlightLimiter counts the queries outstanding in the xchgManagers sharing it, which are the resolvers
+// of a pool with the MaxInFlight cap set, or a single resolver without a cap.
+// When the cap is reached, released slots go to the waiting queries with the highest priority.
+type inFlightLimiter struct {
+	sync.Mutex
+	count int
+	// The number of queries waiting at each priority level
+	waiting [PriorityCritical + 1]int
+	// Closed and replaced each time a slot is released
+	released chan struct{}
+}
+
+func newInFlightLimiter() *inFlightLimiter {
+	return &inFlightLimiter{released: make(chan struct{})}
+}
+
+func (l *inFlightLimiter) acquire(ctx context.Context, priority, max int, failFast bool) error {
+	if priority < PriorityLow || priority > PriorityCritical {
+		priority = PriorityNormal
+	}
+
+	var waiting bool
+	defer func() {
+		if waiting {
+			l.Lock()
+			l.waiting[priority]--
+			l.Unlock()
+		}
+	}()
+
+	for {
+		l.Lock()
+		if max <= 0 || (l.count < max && !l.higherWaiting(priority)) {
+			l.count++
+			l.Unlock()
+			return nil
+		}
+		if failFast {
+			l.Unlock()
+			return errInFlightCap
+		}
+		if !waiting {
+			waiting = true
+			l.waiting[priority]++
+		}
+		released := l.released
+		l.Unlock()
+
+		select {
+		case <-ctx.Done():
+			l.Lock()
+			// Allow lower priority queries to use the slot this query was waiting for
+			l.broadcast()
+			l.Unlock()
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// higherWaiting returns true when queries with a higher priority are waiting for a slot.
+// The lock must already be held by the caller.
+func (l *inFlightLimiter) higherWaiting(priority int) bool {
+	for p := priority + 1; p <= PriorityCritical; p++ {
+		if l.waiting[p] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast wakes all the waiting queries. The lock must already be held by the caller.
+func (l *inFlightLimiter) broadcast() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+func (l *inFlightLimiter) release(n int) {
+	if n <= 0 {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.count -= n
+	if l.count < 0 {
+		l.count = 0
+	}
+	l.broadcast()
+}
+
+func (l *inFlightLimiter) current() int {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.count
+}
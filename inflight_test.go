@@ -0,0 +1,103 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInFlightLimiter(t *testing.T) {
+	l := newInFlightLimiter()
+
+	if err := l.acquire(context.TODO(), PriorityNormal, 1, true); err != nil {
+		t.Fatalf("The first acquire failed: %v", err)
+	}
+	if err := l.acquire(context.TODO(), PriorityNormal, 1, true); err != errInFlightCap {
+		t.Errorf("The fail fast acquire returned %v instead of the cap error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx, PriorityNormal, 1, false); err == nil {
+		t.Errorf("The blocking acquire succeeded while the cap was reached")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.acquire(context.Background(), PriorityNormal, 1, false)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	l.release(1)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("The blocked acquire failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The blocked acquire did not return after a release")
+	}
+
+	if err := l.acquire(context.TODO(), PriorityNormal, 0, true); err != nil || l.current() != 2 {
+		t.Errorf("The acquire without a cap failed: %v", err)
+	}
+}
+
+func TestXchgManagerReleasesReservations(t *testing.T) {
+	x := newXchgManager()
+	x.limits = newInFlightLimiter()
+
+	for i := 0; i < 3; i++ {
+		if _, err := x.reserve(context.TODO(), PriorityNormal); err != nil {
+			t.Fatalf("The reservation failed: %v", err)
+		}
+	}
+
+	_ = x.add(&resolveRequest{ID: 1, Name: "caffix.net"})
+	_ = x.add(&resolveRequest{ID: 2, Name: "caffix.net"})
+	if err := x.add(&resolveRequest{ID: 1, Name: "caffix.net"}); err == nil {
+		t.Errorf("A duplicate request was added")
+	}
+	// The reservation of the duplicate is kept for another identifier, and given back by the caller
+	if n := x.limits.current(); n != 3 {
+		t.Errorf("%d reservations remain instead of 3 after the duplicate", n)
+	}
+	x.limits.release(1)
+
+	x.remove(1, "caffix.net")
+	x.removeAll()
+	if n := x.limits.current(); n != 0 {
+		t.Errorf("%d reservations remain after removing all requests", n)
+	}
+}
+
+func TestInFlightLimiterPriority(t *testing.T) {
+	l := newInFlightLimiter()
+
+	if err := l.acquire(context.TODO(), PriorityNormal, 1, false); err != nil {
+		t.Fatalf("The first acquire failed: %v", err)
+	}
+
+	order := make(chan int, 2)
+	for _, p := range []int{PriorityLow, PriorityHigh} {
+		go func(priority int) {
+			if err := l.acquire(context.Background(), priority, 1, false); err == nil {
+				order <- priority
+			}
+		}(p)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	l.release(1)
+	if p := <-order; p != PriorityHigh {
+		t.Errorf("The query with priority %d acquired the slot before the high priority query", p)
+	}
+
+	l.release(1)
+	if p := <-order; p != PriorityLow {
+		t.Errorf("The low priority query did not acquire the next slot")
+	}
+}
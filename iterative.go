@@ -0,0 +1,392 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RootServers are the addresses of the root nameservers used to begin iterative resolution.
+var RootServers = []string{
+	"198.41.0.4",
+	"199.9.14.201",
+	"192.33.4.12",
+	"199.7.91.13",
+	"192.203.230.10",
+	"192.5.5.241",
+	"192.112.36.4",
+	"198.97.190.53",
+	"192.36.148.17",
+	"192.58.128.30",
+	"193.0.14.129",
+	"199.7.83.42",
+	"202.12.27.33",
+}
+
+// The limits placed on each iterative resolution.
+const (
+	maxReferrals        = 30
+	maxNameserverHops   = 5
+	maxMinimizedQueries = 10
+)
+
+type delegation struct {
+	servers []string
+	expires time.Time
+}
+
+type iterativeResolver struct {
+	sync.Mutex
+	stopped bool
+	// Iterative resolution reveals only the labels necessary at each level, as described in RFC 9156,
+	// unless disabled by the pool
+	config resolverConfig
+	roots  []string
+	port   string
+	cache  map[string]*delegation
+}
+
+// NewIterativeResolver returns a Resolver that performs iterative resolution itself, starting from the
+// provided root server addresses, or RootServers when none are provided, and following the referrals
+// down to the authoritative nameservers. Delegations are cached until their TTLs expire.
+// The port of the first root server address is also used to reach the nameservers found during resolution.
+func NewIterativeResolver(roots []string) Resolver {
+	if len(roots) == 0 {
+		roots = RootServers
+	}
+
+	port := "53"
+	var addrs []string
+	for _, root := range roots {
+		addr := resolverListAddr(root)
+		if addr == "" {
+			continue
+		}
+		if len(addrs) == 0 {
+			_, port, _ = net.SplitHostPort(addr)
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	return &iterativeResolver{
+		roots: addrs,
+		port:  port,
+		cache: make(map[string]*delegation),
+	}
+}
+
+// Stop implements the Resolver interface.
+func (r *iterativeResolver) Stop() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.stopped = true
+}
+
+// Stopped implements the Resolver interface.
+func (r *iterativeResolver) Stopped() bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.stopped
+}
+
+func (r *iterativeResolver) setConfig(c resolverConfig) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.config = c
+}
+
+func (r *iterativeResolver) minimization() bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return !r.config.noMinimization
+}
+
+// queryTimeout returns the time allowed for each query sent to a nameserver.
+func (r *iterativeResolver) queryTimeout() time.Duration {
+	r.Lock()
+	defer r.Unlock()
+
+	_, max := r.config.timeouts()
+	return max
+}
+
+// String implements the Stringer interface.
+func (r *iterativeResolver) String() string {
+	return "iterative"
+}
+
+// Query implements the Resolver interface.
+func (r *iterativeResolver) Query(ctx context.Context, msg *dns.Msg, priority int, retry Retry) (*dns.Msg, error) {
+	if r.Stopped() {
+		return nil, &ResolveError{
+			Err:    "Resolver: The iterative resolver has been stopped",
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonResolverStopped,
+		}
+	}
+	if len(msg.Question) == 0 {
+		return nil, &ResolveError{
+			Err:    "Resolver: The message does not contain a question",
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonInvalidRequest,
+		}
+	}
+
+	q := msg.Question[0]
+	resp, err := r.resolve(ctx, strings.ToLower(dns.Fqdn(q.Name)), q.Qtype, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Id = msg.Id
+	resp.Question = msg.Question
+	if resp.Rcode != dns.RcodeSuccess {
+		estr := fmt.Sprintf("Iterative query for %s type %d returned error %s",
+			RemoveLastDot(q.Name), q.Qtype, dns.RcodeToString[resp.Rcode])
+		return resp, &ResolveError{Err: estr, Rcode: resp.Rcode, Reason: ReasonErrorRcode}
+	}
+	return resp, nil
+}
+
+// WildcardType implements the Resolver interface.
+// Wildcard detection is not performed by the iterative resolver.
+func (r *iterativeResolver) WildcardType(ctx context.Context, msg *dns.Msg, domain string) int {
+	return WildcardTypeNone
+}
+
+func (r *iterativeResolver) resolve(ctx context.Context, name string, qtype uint16, hops int) (*dns.Msg, error) {
+	zone, servers := r.closestDelegation(name)
+
+	// The number of labels below the zone revealed by the next minimized query
+	extra := 1
+	var minimized int
+	minimize := r.minimization()
+	for i := 0; i < maxReferrals; i++ {
+		if err := checkContext(ctx); err != nil {
+			return nil, err
+		}
+
+		qname, qt := name, qtype
+		if minimize && minimized < maxMinimizedQueries {
+			if n := dns.CountLabel(zone) + extra; n < dns.CountLabel(name) {
+				qname, qt = lastLabels(name, n), dns.TypeA
+				minimized++
+			}
+		}
+
+		resp, err := r.exchange(ctx, servers, qname, qt)
+		if err != nil {
+			return nil, err
+		}
+
+		child, ns, ttl := referral(resp, zone, qname)
+		if qname != name && child == "" {
+			// Names that do not exist have no names below them (RFC 8020)
+			if resp.Rcode == dns.RcodeNameError {
+				return resp, nil
+			}
+			// The zone also contains the minimized name, so another label is revealed
+			extra++
+			continue
+		}
+		if resp.Authoritative || len(resp.Answer) > 0 || resp.Rcode != dns.RcodeSuccess {
+			return resp, nil
+		}
+		if child == "" {
+			// The server provided neither an answer nor a referral
+			return resp, nil
+		}
+
+		addrs := r.nameserverAddrs(ctx, resp, child, ns, hops)
+		if len(addrs) == 0 {
+			return nil, &ResolveError{
+				Err:    fmt.Sprintf("Iterative: Failed to obtain the nameserver addresses for %s", RemoveLastDot(child)),
+				Rcode:  ResolverErrRcode,
+				Reason: ReasonNoResolvers,
+			}
+		}
+
+		r.cacheDelegation(child, addrs, ttl)
+		zone, servers, extra = child, addrs, 1
+	}
+
+	return nil, &ResolveError{
+		Err:    fmt.Sprintf("Iterative: Exceeded %d referrals while resolving %s", maxReferrals, RemoveLastDot(name)),
+		Rcode:  ResolverErrRcode,
+		Reason: ReasonNoResolvers,
+	}
+}
+
+// lastLabels returns the name made of the last n labels of the provided name.
+func lastLabels(name string, n int) string {
+	idx := dns.Split(name)
+	if n >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-n]:]
+}
+
+// referral returns the delegated zone found in the authority section, when it is closer to the name
+// than the current zone, along with the names of the nameservers and the smallest TTL.
+func referral(resp *dns.Msg, zone, name string) (string, []string, uint32) {
+	var child string
+	var ttl uint32
+	var servers []string
+
+	for _, rr := range resp.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		owner := strings.ToLower(ns.Hdr.Name)
+		if owner == zone || !dns.IsSubDomain(zone, owner) || !dns.IsSubDomain(owner, name) {
+			continue
+		}
+		if child != "" && owner != child {
+			continue
+		}
+
+		child = owner
+		servers = append(servers, strings.ToLower(ns.Ns))
+		if ttl == 0 || ns.Hdr.Ttl < ttl {
+			ttl = ns.Hdr.Ttl
+		}
+	}
+	return child, servers, ttl
+}
+
+// nameserverAddrs returns the addresses of the nameservers using the glue records provided,
+// and resolves the names of the nameservers lacking glue. Glue is only trusted for nameservers
+// in bailiwick of the delegated zone, so the names of other nameservers are resolved instead.
+func (r *iterativeResolver) nameserverAddrs(ctx context.Context, resp *dns.Msg, zone string, servers []string, hops int) []string {
+	var addrs []string
+	var missing []string
+
+	for _, ns := range servers {
+		var found bool
+		inZone := dns.IsSubDomain(zone, ns)
+
+		for _, rr := range resp.Extra {
+			if a, ok := rr.(*dns.A); ok && inZone && strings.EqualFold(a.Hdr.Name, ns) {
+				addrs = append(addrs, net.JoinHostPort(a.A.String(), r.port))
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, ns)
+		}
+	}
+	if len(addrs) > 0 || hops >= maxNameserverHops {
+		return addrs
+	}
+
+	for _, ns := range missing {
+		resp, err := r.resolve(ctx, ns, dns.TypeA, hops+1)
+		if err != nil || resp.Rcode != dns.RcodeSuccess {
+			continue
+		}
+
+		for _, a := range AnswersByType(ExtractAnswers(resp), dns.TypeA) {
+			addrs = append(addrs, net.JoinHostPort(a.Data, r.port))
+		}
+		if len(addrs) > 0 {
+			break
+		}
+	}
+	return addrs
+}
+
+// exchange sends the query to each of the servers until one provides a response.
+func (r *iterativeResolver) exchange(ctx context.Context, servers []string, name string, qtype uint16) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.RecursionDesired = false
+	msg.SetEdns0(dns.DefaultMsgSize, false)
+
+	timeout := r.queryTimeout()
+	client := dns.Client{
+		Net:     "udp",
+		UDPSize: dns.DefaultMsgSize,
+		Timeout: timeout,
+	}
+	tcp := dns.Client{
+		Net:     "tcp",
+		Timeout: timeout,
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		resp, _, err := client.ExchangeContext(ctx, msg, server)
+		if err == nil && resp.Truncated {
+			resp, _, err = tcp.ExchangeContext(ctx, msg, server)
+		}
+		if err != nil {
+			lastErr = err
+			if e := checkContext(ctx); e != nil {
+				return nil, e
+			}
+			continue
+		}
+		// Lame or broken servers are skipped
+		if resp.Rcode == dns.RcodeRefused || resp.Rcode == dns.RcodeServerFailure {
+			lastErr = fmt.Errorf("returned error %s", dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		return resp, nil
+	}
+
+	return nil, &ResolveError{
+		Err:    fmt.Sprintf("Iterative: No nameserver responded for %s: %v", RemoveLastDot(name), lastErr),
+		Rcode:  TimeoutRcode,
+		Reason: ReasonTimeout,
+	}
+}
+
+// closestDelegation returns the cached delegation nearest to the name, or the root servers.
+func (r *iterativeResolver) closestDelegation(name string) (string, []string) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	for zone := name; zone != "."; {
+		if d, found := r.cache[zone]; found {
+			if now.Before(d.expires) {
+				return zone, d.servers
+			}
+			delete(r.cache, zone)
+		}
+
+		idx, end := dns.NextLabel(zone, 0)
+		if end {
+			break
+		}
+		zone = zone[idx:]
+	}
+	return ".", r.roots
+}
+
+func (r *iterativeResolver) cacheDelegation(zone string, servers []string, ttl uint32) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.cache[zone] = &delegation{
+		servers: servers,
+		expires: time.Now().Add(time.Duration(ttl) * time.Second),
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type testHierarchy struct {
+	sync.Mutex
+	servers []*dns.Server
+	queries map[string]int
+	names   map[string][]string
+}
+
+// runTestHierarchy starts root, TLD and authoritative servers for iter.net on the same
+// port of 127.0.0.1, 127.0.0.2 and 127.0.0.3 respectively.
+func runTestHierarchy(t *testing.T) (*testHierarchy, string) {
+	h := &testHierarchy{
+		queries: make(map[string]int),
+		names:   make(map[string][]string),
+	}
+
+	s, addr, _, err := runLocalUDPHandlerServer("127.0.0.1:0", h.handler("root", rootHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	h.servers = append(h.servers, s)
+	_, port, _ := net.SplitHostPort(addr)
+
+	for ip, level := range map[string]string{"127.0.0.2": "tld", "127.0.0.3": "auth"} {
+		handler := tldHandler
+		if level == "auth" {
+			handler = authHandler
+		}
+
+		s, _, _, err := runLocalUDPHandlerServer(net.JoinHostPort(ip, port), h.handler(level, handler))
+		if err != nil {
+			h.shutdown()
+			t.Skipf("Unable to run test server on the loopback network: %v", err)
+		}
+		h.servers = append(h.servers, s)
+	}
+	return h, addr
+}
+
+func (h *testHierarchy) handler(level string, f dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		h.Lock()
+		h.queries[level]++
+		h.names[level] = append(h.names[level], req.Question[0].Name)
+		h.Unlock()
+
+		f(w, req)
+	}
+}
+
+func (h *testHierarchy) count(level string) int {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.queries[level]
+}
+
+func (h *testHierarchy) queried(level string) []string {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.names[level]
+}
+
+func (h *testHierarchy) shutdown() {
+	for _, s := range h.servers {
+		_ = s.Shutdown()
+	}
+}
+
+func rootHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	m.Ns = append(m.Ns, &dns.NS{Hdr: dns.RR_Header{Name: "net.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "a.tld.net."})
+	m.Extra = append(m.Extra, &dns.A{
+		Hdr: dns.RR_Header{Name: "a.tld.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("127.0.0.2"),
+	})
+	_ = w.WriteMsg(m)
+}
+
+func tldHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	name := req.Question[0].Name
+	switch {
+	case strings.HasSuffix(name, "iter.net."):
+		m.Ns = append(m.Ns, &dns.NS{Hdr: dns.RR_Header{Name: "iter.net.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns.iter.net."})
+		m.Extra = append(m.Extra, &dns.A{
+			Hdr: dns.RR_Header{Name: "ns.iter.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("127.0.0.3"),
+		})
+	case strings.HasSuffix(name, "badglue.net."):
+		// The glue for the out of bailiwick nameserver points at an address without a server
+		m.Ns = append(m.Ns, &dns.NS{Hdr: dns.RR_Header{Name: "badglue.net.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns.iter.net."})
+		m.Extra = append(m.Extra, &dns.A{
+			Hdr: dns.RR_Header{Name: "ns.iter.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("127.0.0.4"),
+		})
+	case strings.HasSuffix(name, "noglue.net."):
+		m.Ns = append(m.Ns, &dns.NS{Hdr: dns.RR_Header{Name: "noglue.net.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300}, Ns: "ns.iter.net."})
+	default:
+		m.Authoritative = true
+		m.Rcode = dns.RcodeNameError
+	}
+	_ = w.WriteMsg(m)
+}
+
+func authHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+
+	name := req.Question[0].Name
+	hdr := dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}
+	switch name {
+	case "www.iter.net.", "mail.iter.net.", "www.noglue.net.", "www.badglue.net.":
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("192.168.1.1")})
+	case "ns.iter.net.":
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("127.0.0.3")})
+	default:
+		m.Rcode = dns.RcodeNameError
+	}
+	_ = w.WriteMsg(m)
+}
+
+func TestIterativeResolver(t *testing.T) {
+	h, root := runTestHierarchy(t)
+	defer h.shutdown()
+
+	r := NewIterativeResolver([]string{root})
+	defer r.Stop()
+
+	resp, err := r.Query(context.TODO(), QueryMsg("www.iter.net", dns.TypeA), PriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("The iterative query failed: %v", err)
+	}
+	if ans := AnswersByType(ExtractAnswers(resp), dns.TypeA); len(ans) != 1 || ans[0].Data != "192.168.1.1" {
+		t.Errorf("The iterative query returned an unexpected answer: %v", resp.Answer)
+	}
+
+	// The cached delegation is used for other names in the zone
+	if _, err := r.Query(context.TODO(), QueryMsg("mail.iter.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The second iterative query failed: %v", err)
+	}
+	if h.count("root") != 1 || h.count("tld") != 1 {
+		t.Errorf("The delegations were not cached: %d root and %d TLD queries", h.count("root"), h.count("tld"))
+	}
+
+	if _, err := r.Query(context.TODO(), QueryMsg("www.noglue.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The query for a delegation without glue failed: %v", err)
+	}
+
+	_, err = r.Query(context.TODO(), QueryMsg("missing.iter.net", dns.TypeA), PriorityNormal, nil)
+	if e, ok := err.(*ResolveError); !ok || e.Rcode != dns.RcodeNameError {
+		t.Errorf("The query for a missing name returned %v instead of NXDOMAIN", err)
+	}
+
+	r.Stop()
+	if _, err := r.Query(context.TODO(), QueryMsg("www.iter.net", dns.TypeA), PriorityNormal, nil); err == nil {
+		t.Errorf("The stopped resolver performed the query")
+	}
+}
+
+func TestIterativeOutOfBailiwickGlue(t *testing.T) {
+	h, root := runTestHierarchy(t)
+	defer h.shutdown()
+
+	r := NewIterativeResolver([]string{root})
+	defer r.Stop()
+
+	resp, err := r.Query(context.TODO(), QueryMsg("www.badglue.net", dns.TypeA), PriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("The query for a delegation with out of bailiwick glue failed: %v", err)
+	}
+	if ans := AnswersByType(ExtractAnswers(resp), dns.TypeA); len(ans) != 1 || ans[0].Data != "192.168.1.1" {
+		t.Errorf("The query returned an unexpected answer: %v", resp.Answer)
+	}
+
+	ir := r.(*iterativeResolver)
+	ir.Lock()
+	defer ir.Unlock()
+	for _, addr := range ir.cache["badglue.net."].servers {
+		if strings.HasPrefix(addr, "127.0.0.4") {
+			t.Errorf("The out of bailiwick glue was cached for the delegation: %v", addr)
+		}
+	}
+}
+
+func TestQNAMEMinimization(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		h, root := runTestHierarchy(t)
+
+		r := NewIterativeResolver([]string{root})
+		pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+		pool.SetConfig(PoolConfig{DisableQNAMEMinimization: !enabled})
+		if _, err := r.Query(context.TODO(), QueryMsg("www.iter.net", dns.TypeA), PriorityNormal, nil); err != nil {
+			t.Errorf("The iterative query failed: %v", err)
+		}
+		pool.Stop()
+		h.shutdown()
+
+		want := []string{"www.iter.net.", "www.iter.net."}
+		if enabled {
+			want = []string{"net.", "iter.net."}
+		}
+		if names := h.queried("root"); len(names) != 1 || names[0] != want[0] {
+			t.Errorf("The root servers received %v with minimization set to %t", names, enabled)
+		}
+		if names := h.queried("tld"); len(names) != 1 || names[0] != want[1] {
+			t.Errorf("The TLD servers received %v with minimization set to %t", names, enabled)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The reasons provided to LifecycleObserver.OnEvict for taking a resolver out of use.
+const (
+	EvictCanaryFailures     = "canary_failures"
+	EvictNXDOMAINHijacking  = "nxdomain_hijacking"
+	EvictUnconfirmedAnswers = "unconfirmed_answers"
+)
+
+// LifecycleObserver is notified of the key events in the life of the queries performed by a ResolverPool,
+// so custom metrics, adaptive throttling and alerting can be built upon them. The methods are executed
+// by the goroutines performing the queries, must not block and must not modify the messages provided.
+type LifecycleObserver interface {
+	// OnSend is called before the query is sent to the resolver, including hedged queries.
+	OnSend(resolver string, msg *dns.Msg)
+	// OnResponse is called when the resolver responded to the attempt, regardless of the rcode.
+	OnResponse(resolver string, msg, resp *dns.Msg, rtt time.Duration)
+	// OnTimeout is called when the resolver did not respond to the attempt in time.
+	OnTimeout(resolver string, msg *dns.Msg)
+	// OnRetry is called before attempt number attempt is made for a query that did not succeed.
+	OnRetry(msg *dns.Msg, attempt int)
+	// OnEvict is called when the pool stops using the resolver, with one of the Evict reasons.
+	OnEvict(resolver string, reason string)
+}
+
+// SetLifecycleObserver provides the LifecycleObserver notified of the events of the pool, including the
+// trusted resolvers, the type resolvers and the standby set. Providing nil stops the notifications.
+func (rp *ResolverPool) SetLifecycleObserver(o LifecycleObserver) {
+	rp.Lock()
+	rp.lifecycle = o
+	subs := rp.subPools()
+	rp.Unlock()
+
+	for _, sub := range subs {
+		sub.SetLifecycleObserver(o)
+	}
+}
+
+func (rp *ResolverPool) lifecycleObserver() LifecycleObserver {
+	rp.Lock()
+	defer rp.Unlock()
+
+	return rp.lifecycle
+}
+
+// notifySend informs the LifecycleObserver that the query is being sent to the resolver.
+func (rp *ResolverPool) notifySend(r Resolver, msg *dns.Msg) {
+	if o := rp.lifecycleObserver(); o != nil {
+		o.OnSend(r.String(), msg)
+	}
+}
+
+// notifyAttempt informs the LifecycleObserver of the outcome of an attempt sent to the resolver.
+func (rp *ResolverPool) notifyAttempt(msg *dns.Msg, r Resolver, resp *dns.Msg, rtt time.Duration, err error) {
+	o := rp.lifecycleObserver()
+	if o == nil || r == nil {
+		return
+	}
+
+	if e, ok := err.(*ResolveError); ok && e.Rcode == TimeoutRcode {
+		o.OnTimeout(r.String(), msg)
+		return
+	}
+	if resp != nil && resp != msg {
+		o.OnResponse(r.String(), msg, resp, rtt)
+	}
+}
+
+// notifyEvict informs the LifecycleObserver that the resolver is no longer used by the pool.
+func (rp *ResolverPool) notifyEvict(addr, reason string) {
+	if o := rp.lifecycleObserver(); o != nil {
+		o.OnEvict(addr, reason)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type testObserver struct {
+	sync.Mutex
+	events []string
+	evicts map[string]string
+}
+
+func newTestObserver() *testObserver {
+	return &testObserver{evicts: make(map[string]string)}
+}
+
+func (o *testObserver) add(event string) {
+	o.Lock()
+	defer o.Unlock()
+
+	o.events = append(o.events, event)
+}
+
+func (o *testObserver) OnSend(resolver string, msg *dns.Msg) {
+	o.add("send")
+}
+
+func (o *testObserver) OnResponse(resolver string, msg, resp *dns.Msg, rtt time.Duration) {
+	o.add("response:" + dns.RcodeToString[resp.Rcode])
+}
+
+func (o *testObserver) OnTimeout(resolver string, msg *dns.Msg) {
+	o.add("timeout")
+}
+
+func (o *testObserver) OnRetry(msg *dns.Msg, attempt int) {
+	o.add("retry")
+}
+
+func (o *testObserver) OnEvict(resolver string, reason string) {
+	o.Lock()
+	defer o.Unlock()
+
+	o.evicts[resolver] = reason
+}
+
+func (o *testObserver) sequence() []string {
+	o.Lock()
+	defer o.Unlock()
+
+	return append([]string(nil), o.events...)
+}
+
+func TestLifecycleObserver(t *testing.T) {
+	var lock sync.Mutex
+	var count int
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		// Only the queries for the test name are counted, since the resolver also probes with its own queries
+		if !strings.EqualFold(req.Question[0].Name, "www.lifecycle.net.") {
+			typeAHandler(w, req)
+			return
+		}
+
+		lock.Lock()
+		count++
+		fail := count < 2
+		lock.Unlock()
+
+		if fail {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			_ = w.WriteMsg(m)
+			return
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	expected := []string{"send", "response:SERVFAIL", "retry", "send", "response:NOERROR"}
+	for _, async := range []bool{false, true} {
+		lock.Lock()
+		count = 0
+		lock.Unlock()
+
+		pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+		o := newTestObserver()
+		pool.SetLifecycleObserver(o)
+
+		if async {
+			done := make(chan Result, 1)
+			QueryAsync(context.TODO(), pool, "www.lifecycle.net", dns.TypeA, func(res Result) { done <- res })
+			err = (<-done).Err
+		} else {
+			_, err = pool.Query(context.TODO(), QueryMsg("www.lifecycle.net", dns.TypeA), PriorityNormal, nil)
+		}
+		pool.Stop()
+		if err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+
+		events := o.sequence()
+		if len(events) != len(expected) {
+			t.Fatalf("The observer was notified of %v instead of %v", events, expected)
+		}
+		for i, e := range expected {
+			if events[i] != e {
+				t.Errorf("The observer was notified of %v instead of %v", events, expected)
+				break
+			}
+		}
+	}
+}
+
+func TestLifecycleTimeout(t *testing.T) {
+	r := NewBaseResolver("127.0.0.2:53", 10, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	o := newTestObserver()
+	pool.SetLifecycleObserver(o)
+
+	msg := QueryMsg("timeout.lifecycle.net", dns.TypeA)
+	pool.notifyAttempt(msg, r, nil, time.Second, &ResolveError{Err: "timeout", Rcode: TimeoutRcode})
+	// Failures to send the query are not reported
+	pool.notifyAttempt(msg, r, nil, 0, &ResolveError{Err: "stopped", Rcode: ResolverErrRcode})
+
+	if events := o.sequence(); len(events) != 1 || events[0] != "timeout" {
+		t.Errorf("The observer was notified of %v instead of the timeout", events)
+	}
+}
+
+func TestLifecycleEvict(t *testing.T) {
+	liar, laddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer liar.Shutdown()
+
+	hijacker := NewBaseResolver(laddr, 100, nil)
+	pool := NewResolverPool([]Resolver{hijacker}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	o := newTestObserver()
+	pool.SetLifecycleObserver(o)
+	pool.evictHijackers()
+
+	if reason := o.evicts[hijacker.String()]; reason != EvictNXDOMAINHijacking {
+		t.Errorf("The eviction was reported with the reason %q", reason)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ParseResolverList returns the resolver addresses found in the provided list.
+// Each line is expected to start with an IP address, optionally followed by a port
+// number and comma-separated fields, as found in the public-dns.info dumps.
+func ParseResolverList(r io.Reader) ([]string, error) {
+	var addrs []string
+	seen := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || c == ' ' || c == '\t'
+		})
+		if len(fields) == 0 {
+			continue
+		}
+
+		addr := resolverListAddr(fields[0])
+		if addr == "" {
+			continue
+		}
+		if _, found := seen[addr]; !found {
+			seen[addr] = struct{}{}
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs, scanner.Err()
+}
+
+func resolverListAddr(field string) string {
+	if ip := net.ParseIP(field); ip != nil {
+		return net.JoinHostPort(ip.String(), "53")
+	}
+
+	if host, port, err := net.SplitHostPort(field); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			return net.JoinHostPort(ip.String(), port)
+		}
+	}
+	return ""
+}
+
+// FetchResolverList retrieves and parses the resolver list available at the provided HTTP(S) URL.
+func FetchResolverList(ctx context.Context, url string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("FetchResolverList: Failed to build the request for %s: %v", url, err)
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("FetchResolverList: Failed to obtain the list at %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("FetchResolverList: The request for %s returned status %s", url, resp.Status)
+	}
+	return ParseResolverList(resp.Body)
+}
+
+// ResolverListFromFile returns the resolver addresses listed in the provided file.
+func ResolverListFromFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ResolverListFromFile: Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	return ParseResolverList(f)
+}
+
+// SyncResolvers updates the pool to contain exactly the resolvers at the provided addresses.
+// New resolvers are created with the perSec rate limit, unless a cap was provided to
+// SetResolverQPS for the address, and removed resolvers are stopped.
+func (rp *ResolverPool) SyncResolvers(addrs []string, perSec int) (added, removed int) {
+	current := make(map[string]struct{})
+	for _, addr := range rp.resolverAddrs() {
+		current[addr] = struct{}{}
+	}
+
+	wanted := make(map[string]struct{}, len(addrs))
+	var resolvers []Resolver
+	for _, addr := range addrs {
+		wanted[addr] = struct{}{}
+		if _, found := current[addr]; found {
+			continue
+		}
+
+		if r := NewBaseResolver(addr, rp.resolverQPS(addr, perSec), rp.log); r != nil {
+			resolvers = append(resolvers, r)
+		}
+	}
+	rp.addResolvers(resolvers)
+
+	var stale []string
+	for addr := range current {
+		if _, found := wanted[addr]; !found {
+			stale = append(stale, addr)
+		}
+	}
+
+	return len(resolvers), rp.RemoveResolvers(stale)
+}
+
+// RefreshFromURL synchronizes the pool with the resolver list at the provided URL, and continues
+// to do so on the provided interval until the pool is stopped.
+func (rp *ResolverPool) RefreshFromURL(url string, interval time.Duration, perSec int) error {
+	refresh := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		addrs, err := FetchResolverList(ctx, url)
+		if err != nil {
+			return err
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("RefreshFromURL: The list at %s did not contain any resolvers", url)
+		}
+
+		added, removed := rp.SyncResolvers(addrs, perSec)
+		rp.logEvent(LevelInfo, "Resolver list synchronized", "url", url, "added", added, "removed", removed)
+		return nil
+	}
+
+	if err := refresh(); err != nil {
+		return err
+	}
+
+	go rp.periodically(interval, func() {
+		if err := refresh(); err != nil {
+			rp.logEvent(LevelError, "Resolver list refresh failed", "url", url, "error", err)
+		}
+	})
+	return nil
+}
+
+// WatchFile synchronizes the pool with the resolver list in the provided file, and checks the file
+// for modifications on the provided interval, applying any changes until the pool is stopped.
+func (rp *ResolverPool) WatchFile(path string, interval time.Duration, perSec int) error {
+	var modified time.Time
+	var size int64
+
+	reload := func() error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("WatchFile: Failed to obtain information on %s: %v", path, err)
+		}
+		if info.ModTime().Equal(modified) && info.Size() == size {
+			return nil
+		}
+
+		addrs, err := ResolverListFromFile(path)
+		if err != nil {
+			return err
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("WatchFile: The file %s did not contain any resolvers", path)
+		}
+
+		modified, size = info.ModTime(), info.Size()
+		added, removed := rp.SyncResolvers(addrs, perSec)
+		rp.logEvent(LevelInfo, "Resolver file synchronized", "path", path, "added", added, "removed", removed)
+		return nil
+	}
+
+	if err := reload(); err != nil {
+		return err
+	}
+
+	go rp.periodically(interval, func() {
+		if err := reload(); err != nil {
+			rp.logEvent(LevelError, "Resolver file reload failed", "path", path, "error", err)
+		}
+	})
+	return nil
+}
+
+func (rp *ResolverPool) periodically(interval time.Duration, callback func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-rp.done:
+			return
+		case <-t.C:
+			callback()
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseResolverList(t *testing.T) {
+	list := "# comment\n\nip_address,name,as_number\n8.8.8.8,dns.google,15169\n1.1.1.1:5353\n8.8.8.8\n2001:4860:4860::8888\nbogus\n"
+
+	addrs, err := ParseResolverList(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("Failed to parse the list: %v", err)
+	}
+
+	expected := []string{"8.8.8.8:53", "1.1.1.1:5353", "[2001:4860:4860::8888]:53"}
+	if len(addrs) != len(expected) {
+		t.Fatalf("Parsed %v instead of the expected %v", addrs, expected)
+	}
+	for i, addr := range expected {
+		if addrs[i] != addr {
+			t.Errorf("Parsed %s instead of the expected %s", addrs[i], addr)
+		}
+	}
+}
+
+func TestSyncResolvers(t *testing.T) {
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	added, removed := pool.SyncResolvers([]string{"127.0.0.2:53", "127.0.0.3:53"}, 10)
+	if added != 2 || removed != 1 {
+		t.Errorf("The pool added %d and removed %d resolvers instead of 2 and 1", added, removed)
+	}
+	// Removed resolvers are stopped once drained
+	time.Sleep(100 * time.Millisecond)
+	if !r.Stopped() {
+		t.Errorf("The removed resolver was not stopped")
+	}
+
+	if addrs := pool.resolverAddrs(); len(addrs) != 2 {
+		t.Errorf("The pool contains %v after the synchronization", addrs)
+	}
+}
+
+func TestRefreshFromURL(t *testing.T) {
+	var lock sync.Mutex
+	list := "127.0.0.1\n127.0.0.2\n"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprint(w, list)
+	}))
+	defer ts.Close()
+
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if err := pool.RefreshFromURL(ts.URL, 100*time.Millisecond, 10); err != nil {
+		t.Fatalf("Failed to refresh the pool: %v", err)
+	}
+	if addrs := pool.resolverAddrs(); len(addrs) != 2 {
+		t.Errorf("The pool contains %v after the first refresh", addrs)
+	}
+
+	lock.Lock()
+	list = "127.0.0.3\n"
+	lock.Unlock()
+
+	time.Sleep(500 * time.Millisecond)
+	if addrs := pool.resolverAddrs(); len(addrs) != 1 || addrs[0] != "127.0.0.3:53" {
+		t.Errorf("The pool contains %v after the list was changed", addrs)
+	}
+
+	if err := pool.RefreshFromURL(ts.URL+"/missing", time.Minute, 10); err == nil {
+		t.Errorf("No error was returned for an invalid list")
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchfile")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "resolvers.txt")
+	if err := ioutil.WriteFile(path, []byte("127.0.0.1\n127.0.0.2\n"), 0644); err != nil {
+		t.Fatalf("Failed to write the resolvers file: %v", err)
+	}
+
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if err := pool.WatchFile(path, 50*time.Millisecond, 10); err != nil {
+		t.Fatalf("Failed to watch the resolvers file: %v", err)
+	}
+	if addrs := pool.resolverAddrs(); len(addrs) != 2 {
+		t.Errorf("The pool contains %v after the file was loaded", addrs)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("127.0.0.3\n"), 0644); err != nil {
+		t.Fatalf("Failed to write the resolvers file: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if addrs := pool.resolverAddrs(); len(addrs) != 1 || addrs[0] != "127.0.0.3:53" {
+		t.Errorf("The pool contains %v after the file was changed", addrs)
+	}
+
+	if err := pool.WatchFile(filepath.Join(dir, "missing.txt"), time.Minute, 10); err == nil {
+		t.Errorf("No error was returned for a missing file")
+	}
+}
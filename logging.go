@@ -0,0 +1,127 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// LogLevel is the severity of an event logged by a ResolverPool. The values match the levels of log/slog.
+type LogLevel int
+
+// The severities of the events logged by a ResolverPool.
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// EventLogger receives the structured events of a ResolverPool, such as resolver evictions, bursts of
+// timeouts and configuration changes. The arguments alternate between the string keys and the values
+// of the attributes, as with log/slog, and SlogEventLogger adapts a *slog.Logger to this interface.
+type EventLogger interface {
+	LogEvent(ctx context.Context, level LogLevel, msg string, args ...interface{})
+}
+
+// SetEventLogger provides the EventLogger that receives the events of the pool in place of the
+// *log.Logger provided to NewResolverPool, including the events of the trusted resolvers, the type
+// resolvers and the standby set. Providing nil restores the *log.Logger.
+func (rp *ResolverPool) SetEventLogger(l EventLogger) {
+	rp.Lock()
+	rp.events = l
+	subs := rp.subPools()
+	rp.Unlock()
+
+	for _, sub := range subs {
+		sub.SetEventLogger(l)
+	}
+}
+
+// inheritObservers provides the observers of the pool, such as the Metrics, Tracer and EventLogger, to the sub-pool.
+func (rp *ResolverPool) inheritObservers(sub *ResolverPool) {
+	rp.Lock()
+	m, t, l, a, d, p := rp.metrics, rp.tracer, rp.events, rp.auditLog, rp.dnstap, rp.pcap
+	o := rp.lifecycle
+	rp.Unlock()
+
+	if m != nil {
+		sub.SetMetrics(m)
+	}
+	if t != nil {
+		sub.SetTracer(t)
+	}
+	if l != nil {
+		sub.SetEventLogger(l)
+	}
+	if a != nil {
+		sub.setAuditLog(a)
+	}
+	if d != nil {
+		sub.SetDnstap(d)
+	}
+	if p != nil {
+		sub.SetPcap(p)
+	}
+	if o != nil {
+		sub.SetLifecycleObserver(o)
+	}
+}
+
+// logEvent provides the event to the EventLogger, or writes it to the *log.Logger of the pool when
+// no EventLogger has been set.
+func (rp *ResolverPool) logEvent(level LogLevel, msg string, args ...interface{}) {
+	rp.logQueryEvent(context.Background(), level, msg, args...)
+}
+
+// logQueryEvent logs the event caused by the query performed using the context,
+// including the correlation ID carried by the context.
+func (rp *ResolverPool) logQueryEvent(ctx context.Context, level LogLevel, msg string, args ...interface{}) {
+	rp.Lock()
+	l := rp.events
+	rp.Unlock()
+
+	if id := CorrelationID(ctx); id != "" {
+		args = append(args, "correlation_id", id)
+	}
+	if l != nil {
+		l.LogEvent(ctx, level, msg, args...)
+		return
+	}
+	rp.log.Print(formatEvent(level, msg, args...))
+}
+
+// configChanged logs the change of a pool setting.
+func (rp *ResolverPool) configChanged(setting string, args ...interface{}) {
+	rp.logEvent(LevelInfo, "Configuration changed", append([]interface{}{"setting", setting}, args...)...)
+}
+
+// formatEvent writes the event as a line of text with the attributes as key=value pairs.
+func formatEvent(level LogLevel, msg string, args ...interface{}) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "ResolverPool: %s: %s", level, msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " %v", args[i])
+			break
+		}
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	return b.String()
+}
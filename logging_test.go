@@ -0,0 +1,88 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testEvent struct {
+	level LogLevel
+	msg   string
+	attrs map[string]interface{}
+}
+
+type testEventLogger struct {
+	sync.Mutex
+	events []testEvent
+}
+
+func (l *testEventLogger) LogEvent(ctx context.Context, level LogLevel, msg string, args ...interface{}) {
+	l.Lock()
+	defer l.Unlock()
+
+	attrs := make(map[string]interface{})
+	for i := 0; i+1 < len(args); i += 2 {
+		attrs[args[i].(string)] = args[i+1]
+	}
+	l.events = append(l.events, testEvent{level: level, msg: msg, attrs: attrs})
+}
+
+func TestEventLogger(t *testing.T) {
+	var buf bytes.Buffer
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.2:53", 10, nil)}, time.Second, nil, 1, log.New(&buf, "", 0))
+	defer pool.Stop()
+
+	pool.SetDeduplication(true)
+	if got := buf.String(); !strings.Contains(got, "INFO: Configuration changed setting=deduplication enabled=true") {
+		t.Errorf("The event was not written to the logger: %q", got)
+	}
+
+	l := new(testEventLogger)
+	pool.SetEventLogger(l)
+	buf.Reset()
+
+	pool.SetStickyZones(true)
+	pool.SetStandby(StandbyConfig{Resolvers: []Resolver{NewBaseResolver("127.0.0.3:53", 10, nil)}})
+	if buf.Len() != 0 {
+		t.Errorf("Events were written to the logger after an EventLogger was set: %q", buf.String())
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.events) != 2 {
+		t.Fatalf("%d events were logged instead of 2", len(l.events))
+	}
+	if e := l.events[0]; e.level != LevelInfo || e.attrs["setting"] != "sticky_zones" || e.attrs["enabled"] != true {
+		t.Errorf("The configuration event was unexpected: %+v", e)
+	}
+	if e := l.events[1]; e.attrs["setting"] != "standby" || e.attrs["resolvers"] != 1 {
+		t.Errorf("The configuration event was unexpected: %+v", e)
+	}
+	if pool.standby.pool.events != l {
+		t.Errorf("The standby pool did not inherit the EventLogger")
+	}
+}
+
+func TestFormatEvent(t *testing.T) {
+	for _, test := range []struct {
+		args     []interface{}
+		expected string
+	}{
+		{nil, "ResolverPool: WARN: Evicting resolver"},
+		{[]interface{}{"resolver", "8.8.8.8:53"}, "ResolverPool: WARN: Evicting resolver resolver=8.8.8.8:53"},
+		{[]interface{}{"resolver", "8.8.8.8:53", "extra"}, "ResolverPool: WARN: Evicting resolver resolver=8.8.8.8:53 extra"},
+	} {
+		if got := formatEvent(LevelWarn, "Evicting resolver", test.args...); got != test.expected {
+			t.Errorf("The event was formatted as %q instead of %q", got, test.expected)
+		}
+	}
+}
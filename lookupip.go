@@ -0,0 +1,64 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// IPResult contains the addresses found by LookupIP, along with the error for each address family.
+type IPResult struct {
+	// Addrs contains the IPv4 addresses followed by the IPv6 addresses.
+	Addrs   []net.IP
+	IPv4Err error
+	IPv6Err error
+}
+
+// LookupIP performs the A and AAAA queries for the name in parallel using the Resolver, and merges
+// the addresses found. An error is returned only when the queries for both families failed.
+func LookupIP(ctx context.Context, r Resolver, name string) (*IPResult, error) {
+	var wg sync.WaitGroup
+	var v4, v6 []net.IP
+	result := new(IPResult)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		v4, result.IPv4Err = lookupAddrs(ctx, r, name, dns.TypeA)
+	}()
+	go func() {
+		defer wg.Done()
+		v6, result.IPv6Err = lookupAddrs(ctx, r, name, dns.TypeAAAA)
+	}()
+	wg.Wait()
+
+	result.Addrs = append(v4, v6...)
+	if result.IPv4Err != nil && result.IPv6Err != nil {
+		return result, fmt.Errorf("LookupIP: Failed to resolve %s: %v", name, result.IPv4Err)
+	}
+	return result, nil
+}
+
+func lookupAddrs(ctx context.Context, r Resolver, name string, qtype uint16) ([]net.IP, error) {
+	records, err := lookupRecords(ctx, r, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []net.IP
+	for _, rr := range records {
+		switch v := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, v.A)
+		case *dns.AAAA:
+			addrs = append(addrs, v.AAAA)
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func dualStackHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	name := req.Question[0].Name
+	hdr := dns.RR_Header{Name: name, Rrtype: req.Question[0].Qtype, Class: dns.ClassINET, Ttl: 300}
+	switch {
+	case name == "missing.ip.net.":
+		m.Rcode = dns.RcodeNameError
+	case req.Question[0].Qtype == dns.TypeA:
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("192.168.1.1")})
+	case req.Question[0].Qtype == dns.TypeAAAA && name == "dual.ip.net.":
+		m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP("2001:db8::1")})
+	case req.Question[0].Qtype == dns.TypeAAAA:
+		m.Rcode = dns.RcodeServerFailure
+	}
+	_ = w.WriteMsg(m)
+}
+
+func TestLookupIP(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(dualStackHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	res, err := LookupIP(context.TODO(), r, "dual.ip.net")
+	if err != nil || len(res.Addrs) != 2 || res.Addrs[0].To4() == nil || res.Addrs[1].To4() != nil {
+		t.Errorf("LookupIP returned %v: %v", res.Addrs, err)
+	}
+
+	res, err = LookupIP(context.TODO(), r, "v4only.ip.net")
+	if err != nil || len(res.Addrs) != 1 || res.IPv4Err != nil || res.IPv6Err == nil {
+		t.Errorf("LookupIP did not provide the error for the failed family: %v", err)
+	}
+
+	if _, err := LookupIP(context.TODO(), r, "missing.ip.net"); err == nil {
+		t.Errorf("LookupIP did not fail when both families failed")
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// How often the gauges of a ResolverPool are reported to its Metrics, when the pool does not set
+// PoolConfig.MetricsInterval.
+const defaultMetricsInterval = 5 * time.Second
+
+// Metrics receives the measurements taken by a ResolverPool, so they can be exported to a monitoring
+// system, such as Prometheus counters and histograms, without this package depending on one.
+// The methods are executed by the goroutines performing the queries and must not block.
+type Metrics interface {
+	// QuerySent counts an attempt sent to the resolver.
+	QuerySent(resolver string)
+	// ResponseReceived counts a response from the resolver by rcode, and observes its round-trip time.
+	ResponseReceived(resolver string, rcode int, rtt time.Duration)
+	// QueryTimeout counts an attempt that received no response from the resolver.
+	QueryTimeout(resolver string)
+	// QueryRetried counts an attempt performed again for a query that did not succeed.
+	QueryRetried()
+	// InFlight sets the gauge for the number of queries sent to the resolver awaiting a response.
+	InFlight(resolver string, n int)
+	// QueueDepth sets the gauge for the number of queries waiting to be sent to the resolver.
+	QueueDepth(resolver string, n int)
+}
+
+// ResponseQueueMetrics is optionally implemented by the Metrics provided to SetMetrics, to receive
+// the gauge for the number of responses from each resolver waiting to be processed.
+type ResponseQueueMetrics interface {
+	ResponseQueueDepth(resolver string, n int)
+}
+
+// queueReporter is implemented by the Resolvers able to report the queries they hold.
+type queueReporter interface {
+	inFlightCount() int
+	queueDepth() int
+	responseQueueDepth() int
+}
+
+// SetMetrics provides the Metrics that receive the measurements of the pool, including the trusted
+// resolvers, the type resolvers and the standby set. The gauges are reported on the MetricsInterval
+// of the pool until the pool is stopped. Providing nil stops reporting the measurements.
+func (rp *ResolverPool) SetMetrics(m Metrics) {
+	rp.Lock()
+	start := rp.metrics == nil && m != nil && !rp.gaugesStarted
+	if start {
+		rp.gaugesStarted = true
+	}
+	rp.metrics = m
+	subs := rp.subPools()
+	rp.Unlock()
+
+	for _, sub := range subs {
+		sub.SetMetrics(m)
+	}
+	if start {
+		go rp.reportGaugesPeriodically()
+	}
+}
+
+// reportGaugesPeriodically reports the gauges until the pool is stopped, waiting the interval
+// currently set for the pool between the reports.
+func (rp *ResolverPool) reportGaugesPeriodically() {
+	t := time.NewTimer(rp.metricsInterval())
+	defer t.Stop()
+
+	for {
+		select {
+		case <-rp.done:
+			return
+		case <-t.C:
+			rp.reportGauges()
+			t.Reset(rp.metricsInterval())
+		}
+	}
+}
+
+// subPools returns the pools used by the pool to perform queries. The lock must already be held by the caller.
+func (rp *ResolverPool) subPools() []*ResolverPool {
+	var pools []*ResolverPool
+
+	if b, ok := rp.baseline.(*ResolverPool); ok {
+		pools = append(pools, b)
+	}
+	seen := make(map[*ResolverPool]struct{})
+	for _, p := range rp.typePools {
+		if _, found := seen[p]; !found {
+			seen[p] = struct{}{}
+			pools = append(pools, p)
+		}
+	}
+	if rp.standby != nil {
+		pools = append(pools, rp.standby.pool)
+	}
+	return pools
+}
+
+func (rp *ResolverPool) metricsRecorder() Metrics {
+	rp.Lock()
+	defer rp.Unlock()
+
+	return rp.metrics
+}
+
+// recordMetrics reports the outcome of an attempt sent to the resolver.
+func (rp *ResolverPool) recordMetrics(addr string, rtt time.Duration, err error) {
+	m := rp.metricsRecorder()
+	if m == nil {
+		return
+	}
+
+	rcode := dns.RcodeSuccess
+	if err != nil {
+		e, ok := err.(*ResolveError)
+		// The query was never sent to the resolver
+		if !ok || e.Rcode == ResolverErrRcode {
+			return
+		}
+		rcode = e.Rcode
+	}
+
+	m.QuerySent(addr)
+	if rcode == TimeoutRcode {
+		m.QueryTimeout(addr)
+		return
+	}
+	m.ResponseReceived(addr, rcode, rtt)
+}
+
+// recordRetry reports that attempt number times is performed for a query.
+func (rp *ResolverPool) recordRetry(msg *dns.Msg, times int) {
+	if m := rp.metricsRecorder(); m != nil {
+		m.QueryRetried()
+	}
+	if o := rp.lifecycleObserver(); o != nil {
+		o.OnRetry(msg, times)
+	}
+}
+
+func (rp *ResolverPool) reportGauges() {
+	m := rp.metricsRecorder()
+	if m == nil {
+		return
+	}
+
+	for _, r := range rp.resolvers() {
+		if qr, ok := r.(queueReporter); ok {
+			m.InFlight(r.String(), qr.inFlightCount())
+			m.QueueDepth(r.String(), qr.queueDepth())
+			if rm, ok := m.(ResponseQueueMetrics); ok {
+				rm.ResponseQueueDepth(r.String(), qr.responseQueueDepth())
+			}
+		}
+	}
+}
+
+func (r *baseResolver) inFlightCount() int {
+	return r.xchgs.sent()
+}
+
+func (r *baseResolver) queueDepth() int {
+	return r.xchgQueue.Len()
+}
+
+func (r *baseResolver) responseQueueDepth() int {
+	return r.readMsgs.Len()
+}
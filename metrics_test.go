@@ -0,0 +1,143 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type testMetrics struct {
+	sync.Mutex
+	sent     map[string]int
+	rcodes   map[int]int
+	timeouts int
+	retries  int
+	gauges   map[string]int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{
+		sent:   make(map[string]int),
+		rcodes: make(map[int]int),
+		gauges: make(map[string]int),
+	}
+}
+
+func (m *testMetrics) QuerySent(resolver string) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.sent[resolver]++
+}
+
+func (m *testMetrics) ResponseReceived(resolver string, rcode int, rtt time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.rcodes[rcode]++
+}
+
+func (m *testMetrics) QueryTimeout(resolver string) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.timeouts++
+}
+
+func (m *testMetrics) QueryRetried() {
+	m.Lock()
+	defer m.Unlock()
+
+	m.retries++
+}
+
+func (m *testMetrics) InFlight(resolver string, n int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.gauges["inflight:"+resolver] = n
+}
+
+func (m *testMetrics) QueueDepth(resolver string, n int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.gauges["queue:"+resolver] = n
+}
+
+func (m *testMetrics) ResponseQueueDepth(resolver string, n int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.gauges["responses:"+resolver] = n
+}
+
+func TestMetrics(t *testing.T) {
+	var lock sync.Mutex
+	var count int
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		var fail bool
+		if req.Question[0].Name == "retry.metrics.net." {
+			lock.Lock()
+			count++
+			fail = count < 3
+			lock.Unlock()
+		}
+
+		if fail {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			_ = w.WriteMsg(m)
+			return
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetConfig(PoolConfig{MetricsInterval: 50 * time.Millisecond})
+	m := newTestMetrics()
+	pool.SetMetrics(m)
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("www.metrics.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+	if _, err := pool.Query(context.TODO(), QueryMsg("retry.metrics.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if n := m.sent[r.String()]; n != 4 {
+		t.Errorf("%d queries were reported as sent instead of 4", n)
+	}
+	if m.rcodes[dns.RcodeSuccess] != 2 || m.rcodes[dns.RcodeServerFailure] != 2 {
+		t.Errorf("The responses were reported with unexpected rcodes: %v", m.rcodes)
+	}
+	if m.retries != 2 {
+		t.Errorf("%d retries were reported instead of 2", m.retries)
+	}
+	if n, found := m.gauges["inflight:"+r.String()]; !found || n != 0 {
+		t.Errorf("The in-flight gauge was not reported as empty: %v", m.gauges)
+	}
+	if _, found := m.gauges["queue:"+r.String()]; !found {
+		t.Errorf("The queue depth gauge was not reported")
+	}
+	if _, found := m.gauges["responses:"+r.String()]; !found {
+		t.Errorf("The response queue depth gauge was not reported")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
 )
 
 // RemoveLastDot removes the '.' at the end of the provided FQDN.
@@ -19,6 +20,17 @@ func RemoveLastDot(name string) string {
 	return name
 }
 
+// registeredDomain returns the domain name that was registered with a registrar for the provided name.
+// The name is returned unchanged when the domain cannot be determined.
+func registeredDomain(name string) string {
+	name = strings.ToLower(RemoveLastDot(name))
+
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(name); err == nil {
+		return domain
+	}
+	return name
+}
+
 // QueryMsg generates a message used for a forward DNS query.
 func QueryMsg(name string, qtype uint16) *dns.Msg {
 	m := new(dns.Msg)
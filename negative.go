@@ -0,0 +1,91 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// NegativeType identifies the kind of negative response described in RFC 2308.
+type NegativeType int
+
+// The kinds of negative responses.
+const (
+	// NegativeNXDomain indicates that the queried name does not exist.
+	NegativeNXDomain NegativeType = iota + 1
+	// NegativeNoData indicates that the name exists without records of the queried type.
+	NegativeNoData
+)
+
+func (t NegativeType) String() string {
+	switch t {
+	case NegativeNXDomain:
+		return "NXDOMAIN"
+	case NegativeNoData:
+		return "NODATA"
+	}
+	return "none"
+}
+
+// NegativeResult describes a negative response using the SOA record from the authority section.
+type NegativeResult struct {
+	Type NegativeType
+	// Zone is the apex of the zone that provided the negative response.
+	Zone string
+	// TTL is how long the negative response can be trusted, which is zero when the
+	// authority section lacks a SOA record and the response should not be cached.
+	TTL time.Duration
+	SOA *dns.SOA
+}
+
+// NegativeResponse returns the details of the response when it is NXDOMAIN or NODATA.
+func NegativeResponse(resp *dns.Msg) (*NegativeResult, bool) {
+	if resp == nil || len(resp.Question) == 0 {
+		return nil, false
+	}
+
+	var t NegativeType
+	switch resp.Rcode {
+	case dns.RcodeNameError:
+		t = NegativeNXDomain
+	case dns.RcodeSuccess:
+		if hasQuestionType(resp) {
+			return nil, false
+		}
+		t = NegativeNoData
+	default:
+		return nil, false
+	}
+
+	neg := &NegativeResult{Type: t}
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			neg.SOA = soa
+			neg.Zone = RemoveLastDot(strings.ToLower(soa.Hdr.Name))
+			// The negative TTL is the lesser of the SOA TTL and MINIMUM field (RFC 2308)
+			ttl := soa.Minttl
+			if soa.Hdr.Ttl < ttl {
+				ttl = soa.Hdr.Ttl
+			}
+			neg.TTL = time.Duration(ttl) * time.Second
+			break
+		}
+	}
+	return neg, true
+}
+
+// hasQuestionType checks for answer records of the type requested in the question.
+func hasQuestionType(resp *dns.Msg) bool {
+	qtype := resp.Question[0].Qtype
+
+	for _, rr := range resp.Answer {
+		if qtype == dns.TypeANY || rr.Header().Rrtype == qtype {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func negativeSOA(ttl, minttl uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "Negative.NET.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:     "ns.negative.net.",
+		Mbox:   "admin.negative.net.",
+		Serial: 1,
+		Minttl: minttl,
+	}
+}
+
+func TestNegativeResponse(t *testing.T) {
+	nx := new(dns.Msg)
+	nx.SetQuestion("missing.negative.net.", dns.TypeA)
+	nx.Rcode = dns.RcodeNameError
+	nx.Ns = []dns.RR{negativeSOA(3600, 300)}
+
+	neg, ok := NegativeResponse(nx)
+	if !ok || neg.Type != NegativeNXDomain {
+		t.Fatalf("The NXDOMAIN response was not identified")
+	}
+	if neg.Zone != "negative.net" || neg.SOA == nil {
+		t.Errorf("The zone apex was %q instead of %q", neg.Zone, "negative.net")
+	}
+	if neg.TTL != 300*time.Second {
+		t.Errorf("The negative TTL was %v instead of %v", neg.TTL, 300*time.Second)
+	}
+
+	nodata := new(dns.Msg)
+	nodata.SetQuestion("www.negative.net.", dns.TypeAAAA)
+	nodata.Answer = []dns.RR{&dns.CNAME{
+		Hdr:    dns.RR_Header{Name: "www.negative.net.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60},
+		Target: "host.negative.net.",
+	}}
+	nodata.Ns = []dns.RR{negativeSOA(120, 600)}
+
+	neg, ok = NegativeResponse(nodata)
+	if !ok || neg.Type != NegativeNoData {
+		t.Fatalf("The NODATA response was not identified")
+	}
+	if neg.TTL != 120*time.Second {
+		t.Errorf("The negative TTL was %v instead of %v", neg.TTL, 120*time.Second)
+	}
+
+	nodata.Ns = nil
+	if neg, ok = NegativeResponse(nodata); !ok || neg.TTL != 0 || neg.SOA != nil {
+		t.Errorf("The response without a SOA record provided a negative TTL")
+	}
+
+	positive := new(dns.Msg)
+	positive.SetQuestion("www.negative.net.", dns.TypeA)
+	positive.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "www.negative.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP("192.168.1.1"),
+	}}
+	if _, ok := NegativeResponse(positive); ok {
+		t.Errorf("The positive response was identified as negative")
+	}
+
+	servfail := new(dns.Msg)
+	servfail.SetQuestion("www.negative.net.", dns.TypeA)
+	servfail.Rcode = dns.RcodeServerFailure
+	if _, ok := NegativeResponse(servfail); ok {
+		t.Errorf("The SERVFAIL response was identified as negative")
+	}
+}
+
+func TestResultNegative(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNameError)
+		m.Ns = []dns.RR{negativeSOA(3600, 900)}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 10, nil)
+	defer r.Stop()
+
+	res := QueryResult(context.Background(), r, QueryMsg("missing.negative.net", dns.TypeA), PriorityNormal, nil)
+	if res.Negative == nil || res.Negative.Type != NegativeNXDomain {
+		t.Fatalf("The result did not describe the negative response")
+	}
+	if res.Negative.Zone != "negative.net" || res.Negative.TTL != 900*time.Second {
+		t.Errorf("The result provided unexpected negative details: %+v", res.Negative)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"encoding/hex"
+
+	"github.com/miekg/dns"
+)
+
+// requestNSID adds the empty NSID option (RFC 5001) to the message, asking the server to identify itself.
+func requestNSID(msg *dns.Msg) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(dns.DefaultMsgSize, false)
+		opt = msg.IsEdns0()
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+}
+
+// ResponseNSID returns the server identifier from the NSID option in the response.
+func ResponseNSID(resp *dns.Msg) (string, bool) {
+	if resp == nil {
+		return "", false
+	}
+
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return "", false
+	}
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_NSID); ok {
+			if id, err := hex.DecodeString(e.Nsid); err == nil {
+				return string(id), true
+			}
+			return e.Nsid, true
+		}
+	}
+	return "", false
+}
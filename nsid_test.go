@@ -0,0 +1,78 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestLookupNSID(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("192.168.1.1"),
+		})
+
+		if opt := req.IsEdns0(); opt != nil {
+			m.SetEdns0(opt.UDPSize(), false)
+			for _, o := range opt.Option {
+				if _, ok := o.(*dns.EDNS0_NSID); ok {
+					nsid := &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte("anycast-1"))}
+					m.IsEdns0().Option = append(m.IsEdns0().Option, nsid)
+				}
+			}
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 10, nil)
+	defer r.Stop()
+
+	res := LookupResult(context.Background(), r, "nsid.net", WithNSID())
+	if res.Err != nil {
+		t.Fatalf("The lookup failed: %v", res.Err)
+	}
+	if res.NSID != "anycast-1" {
+		t.Errorf("The result provided the NSID %q instead of %q", res.NSID, "anycast-1")
+	}
+
+	res = LookupResult(context.Background(), r, "nsid.net")
+	if res.Err != nil || res.NSID != "" {
+		t.Errorf("The NSID was provided without being requested: %q", res.NSID)
+	}
+}
+
+func TestResponseNSID(t *testing.T) {
+	if _, ok := ResponseNSID(nil); ok {
+		t.Errorf("ResponseNSID returned an identifier for a nil response")
+	}
+
+	msg := QueryMsg("nsid.net", dns.TypeA)
+	if _, ok := ResponseNSID(msg); ok {
+		t.Errorf("ResponseNSID returned an identifier without the option")
+	}
+
+	requestNSID(msg)
+	if id, ok := ResponseNSID(msg); !ok || id != "" {
+		t.Errorf("ResponseNSID failed to find the empty option: %q, %v", id, ok)
+	}
+
+	plain := new(dns.Msg)
+	plain.SetQuestion("nsid.net.", dns.TypeA)
+	requestNSID(plain)
+	if plain.IsEdns0() == nil {
+		t.Errorf("requestNSID did not add the OPT record to the message")
+	}
+}
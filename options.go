@@ -0,0 +1,219 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// QueryOption tunes the behavior of a single Lookup.
+type QueryOption func(*queryOptions)
+
+type queryOptions struct {
+	timeout  time.Duration
+	retries  int
+	qtype    uint16
+	edns     bool
+	priority int
+	chase    int
+	validate bool
+	subnet   *net.IPNet
+	nsid     bool
+	cache    cacheMode
+}
+
+// WithTimeout limits the total time spent on the lookup, including all retries.
+func WithTimeout(d time.Duration) QueryOption {
+	return func(o *queryOptions) {
+		o.timeout = d
+	}
+}
+
+// WithRetries sets the number of attempts made after the first one fails.
+func WithRetries(n int) QueryOption {
+	return func(o *queryOptions) {
+		if n >= 0 {
+			o.retries = n
+		}
+	}
+}
+
+// WithQtype sets the type of the query, which defaults to A.
+func WithQtype(qtype uint16) QueryOption {
+	return func(o *queryOptions) {
+		o.qtype = qtype
+	}
+}
+
+// WithEDNS controls whether the query includes the OPT record, which is included by default.
+func WithEDNS(enabled bool) QueryOption {
+	return func(o *queryOptions) {
+		o.edns = enabled
+	}
+}
+
+// WithPriority sets the priority of the query, which defaults to PriorityNormal.
+func WithPriority(priority int) QueryOption {
+	return func(o *queryOptions) {
+		o.priority = priority
+	}
+}
+
+// WithChaseCNAME follows the CNAME and DNAME records in the response up to the depth limit, and returns
+// the full chain followed by the records found for the final name in the answer section.
+func WithChaseCNAME(depth int) QueryOption {
+	return func(o *queryOptions) {
+		if depth > 0 {
+			o.chase = depth
+		}
+	}
+}
+
+// WithValidation performs DNSSEC validation of the response, and sets the Validation field of the Result.
+// Responses that fail validation are returned with a ResolveError using ReasonValidationRejected.
+func WithValidation() QueryOption {
+	return func(o *queryOptions) {
+		o.validate = true
+	}
+}
+
+// WithClientSubnet attaches an EDNS client subnet option for the prefix to the query, replacing the
+// default option that hides the client address. Use ClientSubnetScope to read the scope returned.
+func WithClientSubnet(subnet *net.IPNet) QueryOption {
+	return func(o *queryOptions) {
+		o.subnet = subnet
+	}
+}
+
+// WithNSID asks the server to identify itself using the NSID option, and sets the NSID field of the Result.
+func WithNSID() QueryOption {
+	return func(o *queryOptions) {
+		o.nsid = true
+	}
+}
+
+// WithCacheBypass sends the query to the resolvers without using a cached response, so the
+// response is fresh. The response still replaces the one held by the cache of a ResolverPool.
+func WithCacheBypass() QueryOption {
+	return func(o *queryOptions) {
+		o.cache = cacheBypass
+	}
+}
+
+// WithCacheOnly provides the response from the cache of a ResolverPool without sending the query,
+// and fails with ReasonCacheMiss when no cached response is available.
+func WithCacheOnly() QueryOption {
+	return func(o *queryOptions) {
+		o.cache = cacheOnly
+	}
+}
+
+type attemptsKey struct{}
+
+// attemptsLimit returns the maximum number of attempts requested for the query, or zero without a limit.
+func attemptsLimit(ctx context.Context) int {
+	if n, ok := ctx.Value(attemptsKey{}).(int); ok {
+		return n
+	}
+	return 0
+}
+
+func (o *queryOptions) newMsg(n string) *dns.Msg {
+	if o.validate {
+		return WalkMsg(n, o.qtype)
+	}
+	if !o.edns {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(n), o.qtype)
+		return msg
+	}
+	if o.subnet != nil {
+		return ClientSubnetMsg(n, o.qtype, o.subnet)
+	}
+	return QueryMsg(n, o.qtype)
+}
+
+// Lookup queries the provided name using the Resolver, with the behavior tuned by the options.
+// The query is sent to a specific resolver when the context is provided by WithResolver.
+func Lookup(ctx context.Context, r Resolver, name string, opts ...QueryOption) (*dns.Msg, error) {
+	res := LookupResult(ctx, r, name, opts...)
+	return res.Msg, res.Err
+}
+
+// LookupResult performs the same query as Lookup, and returns the response with its metadata.
+func LookupResult(ctx context.Context, r Resolver, name string, opts ...QueryOption) *Result {
+	o := &queryOptions{
+		retries:  -1,
+		qtype:    dns.TypeA,
+		edns:     true,
+		priority: PriorityNormal,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	newMsg := func(n string) *dns.Msg {
+		msg := o.newMsg(n)
+		if o.nsid {
+			requestNSID(msg)
+		}
+		return msg
+	}
+
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	if o.cache != cacheDefault {
+		// Only a ResolverPool has a cache to consult
+		if _, ok := r.(*ResolverPool); !ok && o.cache == cacheOnly {
+			return &Result{Err: cacheMissError(newMsg(name))}
+		}
+		ctx = context.WithValue(ctx, cacheModeKey{}, o.cache)
+	}
+
+	retry := PoolRetryPolicy
+	if o.retries >= 0 {
+		attempts := o.retries + 1
+
+		ctx = context.WithValue(ctx, attemptsKey{}, attempts)
+		retry = func(times, priority int, msg *dns.Msg) bool {
+			return times < attempts && PoolRetryPolicy(times, priority, msg)
+		}
+	}
+
+	res := QueryResult(ctx, r, newMsg(name), o.priority, retry)
+	if o.nsid {
+		res.NSID, _ = ResponseNSID(res.Msg)
+	}
+	if o.validate && res.Msg != nil {
+		validateResult(ctx, r, res)
+	}
+	if o.chase == 0 || res.Err != nil {
+		return res
+	}
+
+	chain, err := chaseChain(name, o.qtype, o.chase, res.Msg, func(n string) (*dns.Msg, error) {
+		next := QueryResult(ctx, r, newMsg(n), o.priority, retry)
+		if o.validate && next.Msg != nil {
+			validateResult(ctx, r, next)
+			// The chain is only as trustworthy as its weakest link
+			if next.Validation > res.Validation {
+				res.Validation = next.Validation
+			}
+		}
+		return next.Msg, next.Err
+	})
+	msg := res.Msg.Copy()
+	msg.Answer = append(chain.Links, chain.Records...)
+	res.Msg = msg
+	res.Err = err
+	return res
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestLookupOptions(t *testing.T) {
+	var servfails, opts int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Name == "servfail.options.net." {
+			atomic.AddInt32(&servfails, 1)
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+			return
+		}
+		if req.IsEdns0() != nil {
+			atomic.AddInt32(&opts, 1)
+		}
+		if req.Question[0].Qtype != dns.TypeA {
+			nxdomainHandler(w, req)
+			return
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	// Skip the EDNS probe, since the test server does not return OPT records
+	pool.resolvers()[0].(*baseResolver).edns.once.Do(func() {})
+
+	if _, err := Lookup(context.TODO(), pool, "options.net", WithEDNS(false)); err != nil {
+		t.Errorf("The lookup without EDNS failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&opts); n != 0 {
+		t.Errorf("The lookup included the OPT record after disabling EDNS")
+	}
+	if _, err := Lookup(context.TODO(), pool, "options.net"); err != nil || atomic.LoadInt32(&opts) != 1 {
+		t.Errorf("The lookup did not include the OPT record by default: %v", err)
+	}
+	if _, err := Lookup(context.TODO(), pool, "options.net", WithEDNS(false), WithQtype(dns.TypeAAAA)); err == nil {
+		t.Errorf("The lookup did not use the requested type")
+	}
+
+	_, _ = Lookup(context.TODO(), pool, "servfail.options.net", WithRetries(2), WithTimeout(5*time.Second))
+	if n := atomic.LoadInt32(&servfails); n != 3 {
+		t.Errorf("The lookup made %d attempts instead of 3", n)
+	}
+
+	if _, err := Lookup(WithResolver(context.TODO(), "127.0.0.2"), pool, "options.net", WithEDNS(false),
+		WithTimeout(100*time.Millisecond), WithPriority(PriorityHigh)); err == nil {
+		t.Errorf("The lookup was not sent to the requested resolver")
+	}
+}
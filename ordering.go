@@ -0,0 +1,93 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// NameOrder determines the sequence in which a list of names is submitted for resolution.
+// The order has a strong effect on rate limiting behavior and the time until the first results arrive.
+type NameOrder interface {
+	// Order returns the indices of the provided names in the sequence they should be queried.
+	Order(names []string) []int
+}
+
+// NameOrderFunc is an adapter allowing ordinary functions to be used as a NameOrder.
+type NameOrderFunc func(names []string) []int
+
+// Order implements the NameOrder interface.
+func (f NameOrderFunc) Order(names []string) []int {
+	return f(names)
+}
+
+// The built-in NameOrder strategies.
+var (
+	// OrderAsGiven queries the names in the sequence provided by the caller.
+	OrderAsGiven NameOrder = NameOrderFunc(orderAsGiven)
+	// OrderShuffled queries the names in a random sequence.
+	OrderShuffled NameOrder = NameOrderFunc(orderShuffled)
+	// OrderDomainInterleaved alternates between the registered domains so no zone receives a burst of queries.
+	OrderDomainInterleaved NameOrder = NameOrderFunc(orderDomainInterleaved)
+	// OrderShortestFirst queries the names with the fewest labels first.
+	OrderShortestFirst NameOrder = NameOrderFunc(orderShortestFirst)
+)
+
+func orderAsGiven(names []string) []int {
+	indices := make([]int, len(names))
+
+	for i := range names {
+		indices[i] = i
+	}
+	return indices
+}
+
+func orderShuffled(names []string) []int {
+	return rand.Perm(len(names))
+}
+
+func orderDomainInterleaved(names []string) []int {
+	var domains []string
+	groups := make(map[string][]int)
+
+	for i, name := range names {
+		d := registeredDomain(name)
+
+		if _, found := groups[d]; !found {
+			domains = append(domains, d)
+		}
+		groups[d] = append(groups[d], i)
+	}
+
+	indices := make([]int, 0, len(names))
+	for round := 0; len(indices) < len(names); round++ {
+		for _, d := range domains {
+			if g := groups[d]; round < len(g) {
+				indices = append(indices, g[round])
+			}
+		}
+	}
+	return indices
+}
+
+func orderShortestFirst(names []string) []int {
+	indices := orderAsGiven(names)
+	labels := make([]int, len(names))
+
+	for i, name := range names {
+		labels[i] = strings.Count(RemoveLastDot(name), ".")
+	}
+
+	sort.SliceStable(indices, func(i, j int) bool {
+		a, b := indices[i], indices[j]
+
+		if labels[a] != labels[b] {
+			return labels[a] < labels[b]
+		}
+		return len(names[a]) < len(names[b])
+	})
+	return indices
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNameOrders(t *testing.T) {
+	names := []string{
+		"www.caffix.net",
+		"mail.caffix.net",
+		"a.b.caffix.net",
+		"www.owasp.org",
+		"caffix.net",
+		"ftp.owasp.org",
+	}
+
+	cases := []struct {
+		label string
+		order NameOrder
+		want  []int
+	}{
+		{
+			label: "as given",
+			order: OrderAsGiven,
+			want:  []int{0, 1, 2, 3, 4, 5},
+		},
+		{
+			label: "domain interleaved",
+			order: OrderDomainInterleaved,
+			want:  []int{0, 3, 1, 5, 2, 4},
+		},
+		{
+			label: "shortest first",
+			order: OrderShortestFirst,
+			want:  []int{4, 3, 5, 0, 1, 2},
+		},
+	}
+
+	for _, c := range cases {
+		if got := c.order.Order(names); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("The %s order returned %v instead of the expected %v", c.label, got, c.want)
+		}
+	}
+
+	shuffled := OrderShuffled.Order(names)
+	sort.Ints(shuffled)
+	if !reflect.DeepEqual(shuffled, []int{0, 1, 2, 3, 4, 5}) {
+		t.Errorf("The shuffled order did not return each index exactly once: %v", shuffled)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// The queries per second cap for resolvers created to serve WithResolver queries.
+const defaultOverrideQPS = 10
+
+type resolverKey struct{}
+
+// WithResolver returns a context that causes a ResolverPool to send the query to the resolver
+// at the provided address, instead of selecting one of its resolvers. The port defaults to 53.
+// Answers obtained this way are not validated against the baseline resolver.
+func WithResolver(ctx context.Context, addr string) context.Context {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	return context.WithValue(ctx, resolverKey{}, addr)
+}
+
+func resolverFromContext(ctx context.Context) (string, bool) {
+	addr, ok := ctx.Value(resolverKey{}).(string)
+	return addr, ok && addr != ""
+}
+
+// The most resolvers created to serve WithResolver queries that a pool keeps at the same time.
+const maxOverrideResolvers = 16
+
+// The time a resolver created to serve WithResolver queries is kept after its last use.
+const overrideIdleTimeout = time.Minute
+
+type overrideEntry struct {
+	r        Resolver
+	lastUsed time.Time
+}
+
+// overrideResolver returns the resolver for the provided address, using the one in the pool when
+// available, and otherwise creating a resolver that is kept until it has been idle for a while.
+// Nil is returned when the maximum number of created resolvers are all in use.
+func (rp *ResolverPool) overrideResolver(addr string) Resolver {
+	rp.Lock()
+	r := rp.findResolver(addr)
+	if e := rp.overrides[addr]; r == nil && e != nil {
+		e.lastUsed = time.Now()
+		r = e.r
+	}
+	if r != nil {
+		rp.outstanding[addr]++
+		rp.Unlock()
+		return r
+	}
+	expired := rp.expireOverrides(time.Now())
+	full := len(rp.overrides) >= maxOverrideResolvers
+	rc := rp.resolverConfig
+	rp.Unlock()
+
+	for _, e := range expired {
+		e.Stop()
+	}
+	if full {
+		return nil
+	}
+
+	created := NewBaseResolver(addr, rp.resolverQPS(addr, defaultOverrideQPS), rp.log)
+	if created == nil {
+		return nil
+	}
+	// The queries routed to the resolver are sent with the settings of the pool
+	rp.configureResolver(created, rc)
+
+	rp.Lock()
+	defer rp.Unlock()
+	// Another query could have created the resolver in the meantime
+	if e := rp.overrides[addr]; e != nil {
+		created.Stop()
+		e.lastUsed = time.Now()
+		r = e.r
+	} else if len(rp.overrides) >= maxOverrideResolvers {
+		created.Stop()
+		return nil
+	} else {
+		rp.overrides[addr] = &overrideEntry{r: created, lastUsed: time.Now()}
+		r = created
+	}
+
+	rp.outstanding[addr]++
+	return r
+}
+
+// expireOverrides removes the created resolvers that have been idle for too long, and the least recently
+// used idle resolver when no more can be created. The pool lock must already be held by the caller.
+func (rp *ResolverPool) expireOverrides(now time.Time) []Resolver {
+	var expired []Resolver
+	var lru string
+
+	for addr, e := range rp.overrides {
+		if rp.outstanding[addr] > 0 {
+			continue
+		}
+		if now.Sub(e.lastUsed) >= overrideIdleTimeout {
+			expired = append(expired, e.r)
+			delete(rp.overrides, addr)
+		} else if lru == "" || e.lastUsed.Before(rp.overrides[lru].lastUsed) {
+			lru = addr
+		}
+	}
+
+	if len(rp.overrides) >= maxOverrideResolvers && lru != "" {
+		expired = append(expired, rp.overrides[lru].r)
+		delete(rp.overrides, lru)
+	}
+	return expired
+}
+
+// findResolver returns the resolver in the pool with the provided address.
+// The pool lock must already be held by the caller.
+func (rp *ResolverPool) findResolver(addr string) Resolver {
+	for _, partition := range rp.partitions {
+		for _, r := range partition {
+			if r.String() == addr {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+func (rp *ResolverPool) stopOverrides() {
+	rp.Lock()
+	overrides := rp.overrides
+	rp.overrides = make(map[string]*overrideEntry)
+	rp.Unlock()
+
+	for _, e := range overrides {
+		e.r.Stop()
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestWithResolver(t *testing.T) {
+	pooled, paddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer pooled.Shutdown()
+
+	other, oaddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(nxdomainHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer other.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(paddr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	ctx := WithResolver(context.Background(), oaddr)
+	_, err = pool.Query(ctx, QueryMsg("override.net", dns.TypeA), PriorityNormal, nil)
+	if e, ok := err.(*ResolveError); !ok || e.Rcode != dns.RcodeNameError {
+		t.Errorf("The query was not sent to the requested resolver: %v", err)
+	}
+	if len(pool.overrides) != 1 {
+		t.Errorf("The pool created %d resolvers instead of 1 for the override", len(pool.overrides))
+	}
+
+	ctx = WithResolver(context.Background(), paddr)
+	if _, err := pool.Query(ctx, QueryMsg("override.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The query sent to the pooled resolver failed: %v", err)
+	}
+	if len(pool.overrides) != 1 {
+		t.Errorf("The pool created a resolver for an address already in the pool")
+	}
+
+	if addr, _ := resolverFromContext(WithResolver(context.Background(), "8.8.8.8")); addr != "8.8.8.8:53" {
+		t.Errorf("The default port was not added to the address: %s", addr)
+	}
+}
+
+func TestOverrideResolversBounded(t *testing.T) {
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.1:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	addr := func(i int) string { return fmt.Sprintf("127.0.1.%d:53", i) }
+	for i := 0; i < maxOverrideResolvers; i++ {
+		if r := pool.overrideResolver(addr(i)); r == nil {
+			t.Fatalf("The resolver for %s was not created", addr(i))
+		}
+	}
+	// The created resolvers are all in use
+	if r := pool.overrideResolver(addr(maxOverrideResolvers)); r != nil {
+		t.Errorf("A resolver was created beyond the maximum while the others were in use")
+	}
+
+	first := pool.overrides[addr(0)].r
+	for i := 0; i < maxOverrideResolvers; i++ {
+		pool.releaseResolver(pool.overrides[addr(i)].r)
+	}
+	r := pool.overrideResolver(addr(maxOverrideResolvers))
+	if r == nil {
+		t.Fatalf("The least recently used resolver was not replaced")
+	}
+	pool.releaseResolver(r)
+	if n := len(pool.overrides); n != maxOverrideResolvers || !first.Stopped() {
+		t.Errorf("The pool kept %d created resolvers, and the least recently used was not stopped", n)
+	}
+
+	pool.Lock()
+	for _, e := range pool.overrides {
+		e.lastUsed = time.Now().Add(-overrideIdleTimeout)
+	}
+	pool.Unlock()
+	if r := pool.overrideResolver(addr(0)); r != nil {
+		pool.releaseResolver(r)
+	}
+	if n := len(pool.overrides); n != 1 {
+		t.Errorf("The pool kept %d created resolvers after they were idle", n)
+	}
+}
+
+func TestOverrideResolverConfig(t *testing.T) {
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.1:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetConfig(PoolConfig{QueryTimeout: 500 * time.Millisecond, MaxInFlight: 10, Use0x20Encoding: true})
+	r := pool.overrideResolver("127.0.1.1:53")
+	if r == nil {
+		t.Fatalf("The resolver for the override was not created")
+	}
+	pool.releaseResolver(r)
+
+	c := r.(*baseResolver).xchgs.config()
+	if _, max := c.timeouts(); max != 500*time.Millisecond {
+		t.Errorf("The resolver for the override used a query timeout of %s", max)
+	}
+	if c.limits == nil || c.maxInFlight != 10 || !c.use0x20 {
+		t.Errorf("The resolver for the override did not use the settings of the pool")
+	}
+
+	// The resolvers already created receive the later settings
+	pool.SetConfig(PoolConfig{QueryTimeout: time.Second})
+	if _, max := r.(*baseResolver).xchgs.config().timeouts(); max != time.Second {
+		t.Errorf("The resolver for the override kept a query timeout of %s", max)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"sync"
+	"time"
+)
+
+// Slots missed by less than this are still used without waiting, which makes up for the timers of the
+// runtime waking late at high rates, while longer idle periods are not banked as credit for bursts.
+const pacerTimerSlack = time.Millisecond
+
+// pacer spaces the sends evenly at the configured rate. Slots are reserved ahead of the
+// sends, and idle time is never banked as credit, so sends do not arrive in micro-bursts
+// that trigger the rate limiting of upstream resolvers even when the average is within limits.
+// It implements the ratelimit.Limiter interface.
+type pacer struct {
+	sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newPacer(perSec int) *pacer {
+	if perSec < 1 {
+		perSec = 1
+	}
+	return &pacer{interval: time.Second / time.Duration(perSec)}
+}
+
+// Take blocks until the next slot for a send and returns the time of the slot.
+func (p *pacer) Take() time.Time {
+	p.Lock()
+	now := time.Now()
+	// Slots missed while idle are not made up for
+	if now.Sub(p.next) > pacerTimerSlack {
+		p.next = now
+	}
+	at := p.next
+	p.next = at.Add(p.interval)
+	p.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		time.Sleep(d)
+	}
+	return at
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacerRate(t *testing.T) {
+	p := newPacer(1000)
+
+	num := 200
+	start := time.Now()
+	for i := 0; i < num; i++ {
+		p.Take()
+	}
+	// The first send does not wait
+	if d := time.Since(start); d < time.Duration(num-1)*time.Millisecond {
+		t.Errorf("%d sends at 1000 per second completed in %v", num, d)
+	}
+}
+
+func TestPacerNoBursts(t *testing.T) {
+	p := newPacer(100)
+
+	p.Take()
+	// Idle time must not be banked as credit for a burst of sends
+	time.Sleep(100 * time.Millisecond)
+
+	first := p.Take()
+	var prev time.Time
+	for i := 0; i < 5; i++ {
+		at := p.Take()
+		if i == 0 && at.Sub(first) < p.interval {
+			t.Errorf("The send after an idle period was not spaced by the interval")
+		}
+		if !prev.IsZero() && at.Sub(prev) < p.interval {
+			t.Errorf("The slots were spaced by %v instead of %v", at.Sub(prev), p.interval)
+		}
+		if now := time.Now(); now.Before(at) {
+			t.Errorf("Take returned %v before the slot", at.Sub(now))
+		}
+		prev = at
+	}
+}
+
+func TestPacerHighRate(t *testing.T) {
+	p := newPacer(10000)
+
+	num := 2000
+	start := time.Now()
+	for i := 0; i < num; i++ {
+		p.Take()
+	}
+	// Timers waking late must not reduce the rate well below the one configured
+	if d := time.Since(start); d < 199*time.Millisecond || d > 300*time.Millisecond {
+		t.Errorf("%d sends at 10000 per second completed in %v", num, d)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import "github.com/miekg/dns"
+
+// The block sizes recommended by RFC 8467 for padding queries and responses.
+const (
+	QueryPaddingBlock    = 128
+	ResponsePaddingBlock = 468
+)
+
+// Length of the EDNS option code and length fields preceding the padding.
+const paddingOptionHeader = 4
+
+// PadMsg adds the EDNS padding option (RFC 7830) to the message, so the length of the packed message
+// is a multiple of the block size. Padding only protects messages sent over encrypted transports,
+// and must not be added to queries sent in the clear. The package resolvers currently send queries
+// over UDP and TCP only, so the padding is left to callers providing their own encrypted transport.
+func PadMsg(msg *dns.Msg, block int) *dns.Msg {
+	if block <= 0 {
+		return msg
+	}
+
+	m := msg.Copy()
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(dns.DefaultMsgSize, false)
+		opt = m.IsEdns0()
+	}
+
+	// Remove any existing padding before measuring the message
+	var options []dns.EDNS0
+	for _, o := range opt.Option {
+		if o.Option() != dns.EDNS0PADDING {
+			options = append(options, o)
+		}
+	}
+	opt.Option = options
+
+	size := m.Len() + paddingOptionHeader
+	padding := (block - size%block) % block
+	opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, padding)})
+	return m
+}
+
+// MsgPadded returns true when the message contains the EDNS padding option and its packed
+// length is a multiple of the block size.
+func MsgPadded(msg *dns.Msg, block int) bool {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return false
+	}
+
+	for _, o := range opt.Option {
+		if o.Option() == dns.EDNS0PADDING {
+			return block <= 0 || msg.Len()%block == 0
+		}
+	}
+	return false
+}
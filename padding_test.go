@@ -0,0 +1,38 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestPadMsg(t *testing.T) {
+	for _, name := range []string{"a.net", "www.caffix.net", "a.much.longer.name.within.the.padding.net"} {
+		msg := QueryMsg(name, dns.TypeA)
+
+		padded := PadMsg(msg, QueryPaddingBlock)
+		if l := padded.Len(); l%QueryPaddingBlock != 0 {
+			t.Errorf("The padded query for %s has length %d", name, l)
+		}
+		if !MsgPadded(padded, QueryPaddingBlock) {
+			t.Errorf("The padded query for %s was not recognized", name)
+		}
+		if MsgPadded(msg, QueryPaddingBlock) {
+			t.Errorf("The original message for %s was modified", name)
+		}
+
+		// Padding again must not grow the message
+		if again := PadMsg(padded, QueryPaddingBlock); again.Len() != padded.Len() {
+			t.Errorf("Padding the message twice changed the length from %d to %d", padded.Len(), again.Len())
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("noedns.net.", dns.TypeA)
+	if padded := PadMsg(m, ResponsePaddingBlock); padded.Len()%ResponsePaddingBlock != 0 {
+		t.Errorf("The message without EDNS was not padded")
+	}
+}
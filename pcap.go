@@ -0,0 +1,211 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The values of the pcap file header written by the PcapWriter.
+const (
+	pcapMagic        uint32 = 0xa1b2c3d4
+	pcapVersionMajor uint16 = 2
+	pcapVersionMinor uint16 = 4
+	pcapSnapLen      uint32 = 65535
+	// LINKTYPE_RAW packets begin with the IPv4 or IPv6 header
+	pcapLinkTypeRaw uint32 = 101
+)
+
+// The values used in the synthesized IP and UDP headers.
+const (
+	pcapLocalPort = 53000
+	pcapTTL       = 64
+	ipProtoUDP    = 17
+	udpHeaderSize = 8
+)
+
+// PcapWriter writes the queries sent and responses received by a ResolverPool to a pcap file,
+// so the traffic can be examined with tools such as Wireshark and tcpdump while debugging.
+// The IP and UDP headers are synthesized for each message, using the unspecified address
+// for the local end, since the messages are captured above the sockets used to send them.
+type PcapWriter struct {
+	sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewPcapWriter writes the pcap file header to the Writer and returns the PcapWriter.
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	var hdr bytes.Buffer
+
+	_ = binary.Write(&hdr, binary.LittleEndian, pcapMagic)
+	_ = binary.Write(&hdr, binary.LittleEndian, pcapVersionMajor)
+	_ = binary.Write(&hdr, binary.LittleEndian, pcapVersionMinor)
+	// The time zone offset and timestamp accuracy
+	_ = binary.Write(&hdr, binary.LittleEndian, int32(0))
+	_ = binary.Write(&hdr, binary.LittleEndian, uint32(0))
+	_ = binary.Write(&hdr, binary.LittleEndian, pcapSnapLen)
+	_ = binary.Write(&hdr, binary.LittleEndian, pcapLinkTypeRaw)
+
+	if _, err := w.Write(hdr.Bytes()); err != nil {
+		return nil, fmt.Errorf("NewPcapWriter: Failed to write the file header: %v", err)
+	}
+	return &PcapWriter{w: w}, nil
+}
+
+// Err returns the error that caused the PcapWriter to stop writing packets.
+func (p *PcapWriter) Err() error {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.err
+}
+
+// write records the message as a UDP packet exchanged with the address of the resolver.
+// Writing stops after the first error.
+func (p *PcapWriter) write(msg *dns.Msg, addr string, outbound bool, t time.Time) {
+	payload, err := msg.Pack()
+	if err != nil {
+		return
+	}
+
+	remote, port := net.IPv4zero, 53
+	if host, pstr, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			remote = ip
+		}
+		if n, err := strconv.Atoi(pstr); err == nil {
+			port = n
+		}
+	}
+
+	src, dst := net.IP(net.IPv4zero), remote
+	sport, dport := pcapLocalPort, port
+	if remote.To4() == nil {
+		src = net.IPv6unspecified
+	}
+	if !outbound {
+		src, dst = dst, src
+		sport, dport = dport, sport
+	}
+	pkt := udpPacket(src, dst, uint16(sport), uint16(dport), payload)
+
+	var rec bytes.Buffer
+	_ = binary.Write(&rec, binary.LittleEndian, uint32(t.Unix()))
+	_ = binary.Write(&rec, binary.LittleEndian, uint32(t.Nanosecond()/1000))
+	_ = binary.Write(&rec, binary.LittleEndian, uint32(len(pkt)))
+	_ = binary.Write(&rec, binary.LittleEndian, uint32(len(pkt)))
+	rec.Write(pkt)
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.err == nil {
+		_, p.err = p.w.Write(rec.Bytes())
+	}
+}
+
+// udpPacket returns the payload within UDP and IP headers for the provided addresses.
+func udpPacket(src, dst net.IP, sport, dport uint16, payload []byte) []byte {
+	ulen := udpHeaderSize + len(payload)
+	udp := make([]byte, ulen)
+	binary.BigEndian.PutUint16(udp[0:2], sport)
+	binary.BigEndian.PutUint16(udp[2:4], dport)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(ulen))
+	copy(udp[udpHeaderSize:], payload)
+
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		ip := make([]byte, 20, 20+ulen)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:4], uint16(20+ulen))
+		// Don't fragment
+		binary.BigEndian.PutUint16(ip[6:8], 0x4000)
+		ip[8] = pcapTTL
+		ip[9] = ipProtoUDP
+		copy(ip[12:16], src4)
+		copy(ip[16:20], dst4)
+		binary.BigEndian.PutUint16(ip[10:12], ^uint16(checksumSum(0, ip)))
+
+		binary.BigEndian.PutUint16(udp[6:8], udpChecksum(src4, dst4, udp))
+		return append(ip, udp...)
+	}
+
+	ip := make([]byte, 40, 40+ulen)
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:6], uint16(ulen))
+	ip[6] = ipProtoUDP
+	ip[7] = pcapTTL
+	copy(ip[8:24], src.To16())
+	copy(ip[24:40], dst.To16())
+
+	binary.BigEndian.PutUint16(udp[6:8], udpChecksum(src.To16(), dst.To16(), udp))
+	return append(ip, udp...)
+}
+
+// udpChecksum computes the UDP checksum using the pseudo header for the addresses.
+func udpChecksum(src, dst net.IP, udp []byte) uint16 {
+	sum := checksumSum(0, src)
+	sum = checksumSum(sum, dst)
+	sum += ipProtoUDP + uint32(len(udp))
+	sum = checksumSum(sum, udp)
+
+	// A computed checksum of zero is transmitted as all ones
+	if c := ^uint16(sum); c != 0 {
+		return c
+	}
+	return 0xffff
+}
+
+// checksumSum adds the data to the ones' complement sum and returns the folded result.
+func checksumSum(sum uint32, data []byte) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return sum
+}
+
+// SetPcap causes the queries sent by the pool, including the trusted resolvers, the type resolvers
+// and the standby set, and the responses received to be written using the PcapWriter.
+// Providing nil stops writing the packets. Capturing the traffic is intended for debugging.
+func (rp *ResolverPool) SetPcap(p *PcapWriter) {
+	rp.Lock()
+	rp.pcap = p
+	subs := rp.subPools()
+	rp.Unlock()
+
+	for _, sub := range subs {
+		sub.SetPcap(p)
+	}
+}
+
+// capture writes the query of the attempt, and the response when one was received, to the PcapWriter.
+func (rp *ResolverPool) capture(msg *dns.Msg, r Resolver, resp *dns.Msg, start time.Time, rtt time.Duration) {
+	rp.Lock()
+	p := rp.pcap
+	rp.Unlock()
+
+	if p == nil || r == nil {
+		return
+	}
+
+	p.write(msg, r.String(), true, start)
+	if resp != nil && resp != msg {
+		p.write(resp, r.String(), false, start.Add(rtt))
+	}
+}
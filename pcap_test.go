@@ -0,0 +1,125 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// readPacket returns the next packet recorded in the pcap file.
+func readPacket(t *testing.T, r io.Reader) []byte {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		t.Fatalf("Failed to read the packet header: %v", err)
+	}
+
+	incl := binary.LittleEndian.Uint32(hdr[8:12])
+	if orig := binary.LittleEndian.Uint32(hdr[12:16]); incl != orig {
+		t.Errorf("The packet was truncated from %d to %d bytes", orig, incl)
+	}
+
+	pkt := make([]byte, incl)
+	if _, err := io.ReadFull(r, pkt); err != nil {
+		t.Fatalf("Failed to read the packet: %v", err)
+	}
+	return pkt
+}
+
+func TestPcapWriter(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	var buf bytes.Buffer
+	p, err := NewPcapWriter(&buf)
+	if err != nil {
+		t.Fatalf("Failed to create the pcap writer: %v", err)
+	}
+	pool.SetPcap(p)
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("www.pcap.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(&buf, hdr); err != nil {
+		t.Fatalf("Failed to read the file header: %v", err)
+	}
+	if binary.LittleEndian.Uint32(hdr[0:4]) != pcapMagic || binary.LittleEndian.Uint32(hdr[20:24]) != pcapLinkTypeRaw {
+		t.Fatalf("The file header had an unexpected magic number or link type")
+	}
+
+	host, port, _ := net.SplitHostPort(addrstr)
+	for _, outbound := range []bool{true, false} {
+		pkt := readPacket(t, &buf)
+		if pkt[0]>>4 != 6 || pkt[6] != ipProtoUDP {
+			t.Fatalf("The packet did not contain an IPv6 header for UDP")
+		}
+
+		remote, rport := net.IP(pkt[24:40]), binary.BigEndian.Uint16(pkt[42:44])
+		if !outbound {
+			remote, rport = net.IP(pkt[8:24]), binary.BigEndian.Uint16(pkt[40:42])
+		}
+		if !remote.Equal(net.ParseIP(host)) || port != strconv.Itoa(int(rport)) {
+			t.Errorf("The packet had the resolver address %v:%d instead of %s", remote, rport, addrstr)
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(pkt[48:]); err != nil || msg.Question[0].Name != "www.pcap.net." {
+			t.Errorf("The packet did not contain the DNS message: %v", err)
+		}
+		if msg.Response == outbound {
+			t.Errorf("The packets were not recorded in the order sent and received")
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("The capture contained %d unexpected bytes", buf.Len())
+	}
+}
+
+func TestUDPPacketChecksums(t *testing.T) {
+	payload := []byte("odd payload")
+
+	pkt := udpPacket(net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.53"), 53000, 53, payload)
+	if len(pkt) != 20+udpHeaderSize+len(payload) {
+		t.Fatalf("The IPv4 packet had the length %d", len(pkt))
+	}
+	if c := checksumSum(0, pkt[:20]); c != 0xffff {
+		t.Errorf("The IPv4 header checksum was invalid: %#x", c)
+	}
+
+	pseudo := append(append([]byte{}, pkt[12:20]...), 0, ipProtoUDP, 0, byte(udpHeaderSize+len(payload)))
+	if c := checksumSum(checksumSum(0, pseudo), pkt[20:]); c != 0xffff {
+		t.Errorf("The IPv4 UDP checksum was invalid: %#x", c)
+	}
+
+	pkt = udpPacket(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::53"), 53000, 53, payload)
+	if len(pkt) != 40+udpHeaderSize+len(payload) || !bytes.Equal(pkt[48:], payload) {
+		t.Fatalf("The IPv6 packet did not contain the payload")
+	}
+	pseudo = append(append([]byte{}, pkt[8:40]...), 0, ipProtoUDP, 0, byte(udpHeaderSize+len(payload)))
+	if c := checksumSum(checksumSum(0, pseudo), pkt[40:]); c != 0xffff {
+		t.Errorf("The IPv6 UDP checksum was invalid: %#x", c)
+	}
+}
+
+func TestPcapWriterError(t *testing.T) {
+	if _, err := NewPcapWriter(failingWriter{}); err == nil {
+		t.Errorf("The file header write error was not returned")
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The version of the format written by ExportPerformance.
+const performanceVersion = 1
+
+type performanceData struct {
+	Version   int                   `json:"version"`
+	Exported  time.Time             `json:"exported"`
+	Resolvers []resolverPerformance `json:"resolvers"`
+}
+
+type resolverPerformance struct {
+	Address   string    `json:"address"`
+	Samples   int       `json:"samples"`
+	RTT       float64   `json:"rtt_ns"`
+	Timeouts  float64   `json:"timeout_rate"`
+	Mismatch  float64   `json:"mismatch_rate"`
+	Hijacks   int       `json:"hijack_signals"`
+	Queries   int       `json:"queries"`
+	Answers   int       `json:"answers"`
+	Timedout  int       `json:"timeouts"`
+	Servfails int       `json:"servfails"`
+	TotalRTT  int64     `json:"total_rtt_ns"`
+	LastSeen  time.Time `json:"last_seen"`
+	Canaries  int       `json:"canary_failures"`
+}
+
+// ExportPerformance writes the statistics and reputation collected for the resolvers
+// in the pool as JSON, so they can be provided to ImportPerformance in a later run.
+func (rp *ResolverPool) ExportPerformance(w io.Writer) error {
+	data := performanceData{
+		Version:  performanceVersion,
+		Exported: time.Now(),
+	}
+
+	for _, addr := range rp.resolverAddrs() {
+		p := resolverPerformance{Address: addr}
+
+		rp.rep.Lock()
+		if e, found := rp.rep.entries[addr]; found {
+			p.Samples = e.samples
+			p.RTT = e.rtt
+			p.Timeouts = e.timeouts
+			p.Mismatch = e.mismatch
+			p.Hijacks = e.hijacks
+		}
+		rp.rep.Unlock()
+
+		rp.stats.Lock()
+		if e, found := rp.stats.entries[addr]; found {
+			p.Queries = e.queries
+			p.Answers = e.answers
+			p.Timedout = e.timeouts
+			p.Servfails = e.servfails
+			p.TotalRTT = int64(e.rtt)
+			p.LastSeen = e.lastSeen
+			p.Canaries = e.canaries
+		}
+		rp.stats.Unlock()
+
+		data.Resolvers = append(data.Resolvers, p)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&data); err != nil {
+		return fmt.Errorf("ExportPerformance: Failed to encode the performance data: %v", err)
+	}
+	return nil
+}
+
+// ImportPerformance loads the data written by ExportPerformance, replacing the statistics and
+// reputation of the listed resolvers, including those added to the pool later.
+func (rp *ResolverPool) ImportPerformance(r io.Reader) error {
+	var data performanceData
+
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return fmt.Errorf("ImportPerformance: Failed to decode the performance data: %v", err)
+	}
+	if data.Version != performanceVersion {
+		return fmt.Errorf("ImportPerformance: Unsupported performance data version %d", data.Version)
+	}
+
+	for _, p := range data.Resolvers {
+		rp.rep.Lock()
+		rp.rep.entries[p.Address] = &reputationEntry{
+			samples:  p.Samples,
+			rtt:      p.RTT,
+			timeouts: p.Timeouts,
+			mismatch: p.Mismatch,
+			hijacks:  p.Hijacks,
+		}
+		rp.rep.Unlock()
+
+		rp.stats.Lock()
+		rp.stats.entries[p.Address] = &statsEntry{
+			queries:   p.Queries,
+			answers:   p.Answers,
+			timeouts:  p.Timedout,
+			servfails: p.Servfails,
+			rtt:       time.Duration(p.TotalRTT),
+			lastSeen:  p.LastSeen,
+			canaries:  p.Canaries,
+		}
+		rp.stats.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPerformancePersistence(t *testing.T) {
+	addr := "127.0.0.2:53"
+
+	first := NewResolverPool([]Resolver{NewBaseResolver(addr, 10, nil)}, time.Second, nil, 1, nil)
+	for i := 0; i < minReputationSamples; i++ {
+		first.rep.observe(addr, 0, true)
+		first.stats.record(addr, 0, &ResolveError{Rcode: TimeoutRcode})
+	}
+	first.rep.hijack(addr)
+
+	var buf bytes.Buffer
+	if err := first.ExportPerformance(&buf); err != nil {
+		t.Fatalf("ExportPerformance failed: %v", err)
+	}
+	first.Stop()
+
+	second := NewResolverPool([]Resolver{NewBaseResolver(addr, 10, nil)}, time.Second, nil, 1, nil)
+	defer second.Stop()
+
+	if err := second.ImportPerformance(&buf); err != nil {
+		t.Fatalf("ImportPerformance failed: %v", err)
+	}
+
+	rep := second.Reputations()[0]
+	if rep.Samples != minReputationSamples || rep.HijackSignals != 1 || rep.TimeoutRate != 1 {
+		t.Errorf("The reputation was not restored: %+v", rep)
+	}
+	if !second.rep.poor(addr) {
+		t.Errorf("The restored reputation did not mark the resolver as poor")
+	}
+	if st := second.Stats()[0]; st.Queries != minReputationSamples || st.Timeouts != minReputationSamples {
+		t.Errorf("The stats were not restored: %+v", st)
+	}
+
+	if err := second.ImportPerformance(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Errorf("Data with an unsupported version was accepted")
+	}
+}
@@ -5,15 +5,18 @@ package resolve
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-type resolverPool struct {
+// ResolverPool distributes DNS queries across a set of Resolvers.
+type ResolverPool struct {
 	sync.Mutex
 	done chan struct{}
 	// Logger for error messages
@@ -28,10 +31,63 @@ type resolverPool struct {
 	waits          map[string]time.Time
 	delay          time.Duration
 	hasBeenStopped bool
+	slo            *sloTracker
+	standby        *standbyState
+	qps            map[string]int
+	outstanding    map[string]int
+	rep            *reputationTracker
+	stats          *statsTracker
+	regions        map[string]Region
+	regionIdx      int
+	sticky         bool
+	overrides      map[string]*overrideEntry
+	selector       Selector
+	validatingOnly bool
+	validates      map[string]bool
+	typePools      map[uint16]*ResolverPool
+	strategy       RetryStrategy
+	hedge          HedgeConfig
+	hedgeLatency   latencyHistogram
+	batchOrder     NameOrder
+	flights        *flightGroup
+	cache          *responseCache
+	refresher      *refreshScheduler
+	staleWindow    time.Duration
+	wildcardConfig *WildcardConfig
+	metrics        Metrics
+	tracer         Tracer
+	events         EventLogger
+	auditLog       *auditLog
+	dnstap         *DnstapWriter
+	pcap           *PcapWriter
+	lifecycle      LifecycleObserver
+	slowQueries    SlowQueryConfig
+	counters       *responseCounters
+	gaugesStarted  bool
+	// The queries accepted while the pool has not begun to shut down
+	draining bool
+	active   int
+	// The settings provided to SetConfig and applied to the resolvers
+	config         PoolConfig
+	resolverConfig resolverConfig
+}
+
+// NewResolverPoolWithConfig initializes a ResolverPool that uses the provided Resolvers, with the settings applied
+// before any queries are sent, such as the in-flight cap of the pool.
+func NewResolverPoolWithConfig(resolvers []Resolver, delay time.Duration, baseline Resolver,
+	partnum int, logger *log.Logger, config PoolConfig) *ResolverPool {
+	rp := NewResolverPool(resolvers, delay, baseline, partnum, logger)
+	if rp == nil {
+		return nil
+	}
+
+	rp.SetConfig(config)
+	return rp
 }
 
 // NewResolverPool initializes a ResolverPool that uses the provided Resolvers.
-func NewResolverPool(resolvers []Resolver, delay time.Duration, baseline Resolver, partnum int, logger *log.Logger) Resolver {
+// A nil ResolverPool is returned when no Resolvers are provided.
+func NewResolverPool(resolvers []Resolver, delay time.Duration, baseline Resolver, partnum int, logger *log.Logger) *ResolverPool {
 	l := len(resolvers)
 	if l == 0 {
 		return nil
@@ -43,26 +99,36 @@ func NewResolverPool(resolvers []Resolver, delay time.Duration, baseline Resolve
 		partnum = l
 	}
 
-	rp := &resolverPool{
-		baseline:   baseline,
-		partitions: make([][]Resolver, partnum),
-		last:       time.Now(),
-		avgs:       newSlidingWindowTimeouts(),
-		waits:      make(map[string]time.Time),
-		delay:      delay,
-		done:       make(chan struct{}, 2),
-		log:        logger,
+	rp := &ResolverPool{
+		baseline:    baseline,
+		partitions:  make([][]Resolver, partnum),
+		last:        time.Now(),
+		avgs:        newSlidingWindowTimeouts(),
+		waits:       make(map[string]time.Time),
+		qps:         make(map[string]int),
+		regions:     make(map[string]Region),
+		overrides:   make(map[string]*overrideEntry),
+		validates:   make(map[string]bool),
+		typePools:   make(map[uint16]*ResolverPool),
+		outstanding: make(map[string]int),
+		rep:         newReputationTracker(),
+		stats:       newStatsTracker(),
+		counters:    newResponseCounters(),
+		delay:       delay,
+		done:        make(chan struct{}, 2),
+		log:         logger,
 	}
 
 	num := l / partnum
 	for i := 0; i < partnum; i++ {
 		start := i * num
-		end := (start + num) - 1
+		end := start + num
 
+		// Copy the resolvers so partitions can grow without overwriting each other
 		if i == partnum-1 {
-			rp.partitions[i] = resolvers[start:]
+			rp.partitions[i] = append([]Resolver(nil), resolvers[start:]...)
 		} else {
-			rp.partitions[i] = resolvers[start:end]
+			rp.partitions[i] = append([]Resolver(nil), resolvers[start:end]...)
 		}
 	}
 
@@ -75,14 +141,23 @@ func NewResolverPool(resolvers []Resolver, delay time.Duration, baseline Resolve
 }
 
 // Stop implements the Resolver interface.
-func (rp *resolverPool) Stop() {
+func (rp *ResolverPool) Stop() {
 	if rp.hasBeenStopped {
 		return
 	}
 	rp.hasBeenStopped = true
 	close(rp.done)
 
-	for _, partition := range rp.partitions {
+	if report := rp.SLOReport(); report != nil {
+		rp.logEvent(LevelInfo, "SLO report", "met", report.Met(), "report", report)
+	}
+
+	rp.Lock()
+	partitions := rp.partitions
+	rp.partitions = [][]Resolver{}
+	rp.Unlock()
+
+	for _, partition := range partitions {
 		for _, r := range partition {
 			r.Stop()
 		}
@@ -91,30 +166,60 @@ func (rp *resolverPool) Stop() {
 	if rp.baseline != nil {
 		rp.baseline.Stop()
 	}
-
-	rp.partitions = [][]Resolver{}
+	rp.stopStandby()
+	rp.stopOverrides()
+	rp.stopTypePools()
 }
 
 // Stopped implements the Resolver interface.
-func (rp *resolverPool) Stopped() bool {
+func (rp *ResolverPool) Stopped() bool {
 	return rp.hasBeenStopped
 }
 
 // String implements the Stringer interface.
-func (rp *resolverPool) String() string {
+func (rp *ResolverPool) String() string {
 	return "ResolverPool"
 }
 
-func (rp *resolverPool) nextResolver(ctx context.Context) Resolver {
-	var count int
+// rateLimitedResolver is implemented by Resolvers that enforce their own queries per second cap.
+type rateLimitedResolver interface {
+	maxRate() int
+	setMaxRate(perSec int)
+}
+
+// resolverSaturated returns true when the Resolver has at least one second of queries outstanding.
+func resolverSaturated(r Resolver, outstanding int) bool {
+	if rl, ok := r.(rateLimitedResolver); ok {
+		return outstanding >= rl.maxRate()
+	}
+	return false
+}
+
+func (rp *ResolverPool) nextResolver(ctx context.Context) Resolver {
+	if region, ok := regionFromContext(ctx); ok {
+		return rp.nextRegionResolver(region)
+	}
+
+	rp.Lock()
+	selector := rp.selector
+	rp.Unlock()
+	if selector != nil {
+		return rp.selectorResolver(selector)
+	}
+
+	var count, skipped int
 	var r Resolver
 
 	for {
 		if checkContext(ctx) != nil {
-			break
+			return nil
 		}
 
 		rp.Lock()
+		if len(rp.partitions) == 0 || rp.noValidatingResolvers() {
+			rp.Unlock()
+			return nil
+		}
 		if rp.sfcount > 5 {
 			rp.nextPartition()
 		}
@@ -124,26 +229,53 @@ func (rp *resolverPool) nextResolver(ctx context.Context) Resolver {
 		rp.curIdx++
 		rp.curIdx = rp.curIdx % len(rp.partitions[part])
 		r = rp.partitions[part][idx]
-		t, found := rp.waits[r.String()]
-		rp.Unlock()
-
-		if (!found || t.IsZero() || time.Now().After(t)) && !r.Stopped() {
-			break
+		k := r.String()
+		t, found := rp.waits[k]
+		if (!found || t.IsZero() || time.Now().After(t)) && !r.Stopped() && !rp.excluded(k) {
+			// Respect the rate limit and avoid poor resolvers unless all of them are skipped
+			if (!resolverSaturated(r, rp.outstanding[k]) && !rp.rep.poor(k)) || skipped >= len(rp.partitions[part]) {
+				rp.outstanding[k]++
+				rp.Unlock()
+				break
+			}
+			skipped++
+			rp.Unlock()
+			continue
 		}
+		rp.Unlock()
 
 		count++
-		count = count % len(rp.partitions[part])
-		if count == 0 || count > 5 {
-			rp.Lock()
-			rp.nextPartition()
-			rp.Unlock()
+		rp.Lock()
+		if len(rp.partitions) > 0 {
+			count = count % len(rp.partitions[rp.curPart])
+			if count == 0 || count > 5 {
+				rp.nextPartition()
+			}
 		}
+		rp.Unlock()
 	}
 
 	return r
 }
 
-func (rp *resolverPool) nextPartition() {
+// releaseResolver must be called once the query sent to a Resolver returned by nextResolver is complete.
+func (rp *ResolverPool) releaseResolver(r Resolver) {
+	rp.Lock()
+	defer rp.Unlock()
+
+	k := r.String()
+	// The created resolvers are idle from the end of the last query
+	if e := rp.overrides[k]; e != nil {
+		e.lastUsed = time.Now()
+	}
+	if rp.outstanding[k] <= 1 {
+		delete(rp.outstanding, k)
+		return
+	}
+	rp.outstanding[k]--
+}
+
+func (rp *ResolverPool) nextPartition() {
 	if time.Now().Before(rp.last.Add(30 * time.Second)) {
 		return
 	}
@@ -154,7 +286,7 @@ func (rp *resolverPool) nextPartition() {
 	rp.curIdx = 0
 }
 
-func (rp *resolverPool) incServfailCount() {
+func (rp *ResolverPool) incServfailCount() {
 	rp.Lock()
 	defer rp.Unlock()
 
@@ -164,14 +296,14 @@ func (rp *resolverPool) incServfailCount() {
 	rp.sfcount++
 }
 
-func (rp *resolverPool) updateWait(key string, d time.Duration) {
+func (rp *ResolverPool) updateWait(key string, d time.Duration) {
 	rp.Lock()
 	defer rp.Unlock()
 
 	rp.waits[key] = time.Now().Add(d)
 }
 
-func (rp *resolverPool) numUsableResolvers() int {
+func (rp *ResolverPool) numUsableResolvers() int {
 	rp.Lock()
 	defer rp.Unlock()
 
@@ -179,9 +311,10 @@ func (rp *resolverPool) numUsableResolvers() int {
 	now := time.Now()
 	for _, partition := range rp.partitions {
 		for _, r := range partition {
-			t, found := rp.waits[r.String()]
+			k := r.String()
+			t, found := rp.waits[k]
 
-			if (!found || t.IsZero() || now.After(t)) && !r.Stopped() {
+			if (!found || t.IsZero() || now.After(t)) && !r.Stopped() && !rp.excluded(k) {
 				num++
 			}
 		}
@@ -189,45 +322,241 @@ func (rp *resolverPool) numUsableResolvers() int {
 	return num
 }
 
+// SetResolverQPS sets the queries per second cap for the resolver at the provided address.
+// The cap is applied to the resolver when it is already in the pool, and to any resolver
+// later added to the pool for the same address.
+func (rp *ResolverPool) SetResolverQPS(addr string, perSec int) {
+	if perSec <= 0 {
+		return
+	}
+	defer rp.configChanged("resolver_qps", "resolver", addr, "qps", perSec)
+
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.qps[addr] = perSec
+	for _, partition := range rp.partitions {
+		for _, r := range partition {
+			if rl, ok := r.(rateLimitedResolver); ok && r.String() == addr {
+				rl.setMaxRate(perSec)
+			}
+		}
+	}
+}
+
+func (rp *ResolverPool) resolverQPS(addr string, def int) int {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if perSec, found := rp.qps[addr]; found {
+		return perSec
+	}
+	return def
+}
+
+// SetSLOTargets starts tracking compliance of the pool with the provided objectives.
+// The final report is written to the pool logger when the pool is stopped.
+func (rp *ResolverPool) SetSLOTargets(targets SLOTargets) {
+	defer rp.configChanged("slo_targets")
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.slo = newSLOTracker(targets)
+}
+
+// SLOReport returns the current compliance with the objectives provided to SetSLOTargets,
+// or nil when no objectives have been set.
+func (rp *ResolverPool) SLOReport() *SLOReport {
+	rp.Lock()
+	slo := rp.slo
+	rp.Unlock()
+
+	if slo == nil {
+		return nil
+	}
+	return slo.report()
+}
+
 // Query implements the Resolver interface.
-func (rp *resolverPool) Query(ctx context.Context, msg *dns.Msg, priority int, retry Retry) (*dns.Msg, error) {
-	if rp.baseline != nil && rp.numUsableResolvers() == 0 {
+func (rp *ResolverPool) Query(ctx context.Context, msg *dns.Msg, priority int, retry Retry) (*dns.Msg, error) {
+	if err := rp.admit(msg); err != nil {
+		return nil, err
+	}
+	defer rp.release()
+
+	q := rp.newPoolQuery(ctx, msg)
+	if resp, found, err := q.lookup(); found {
+		return resp, err
+	}
+
+	rp.Lock()
+	flights := rp.flights
+	rp.Unlock()
+
+	q.startSpan()
+	q.start()
+	query := func() (*dns.Msg, error) {
+		resp, err := rp.wireQuery(q.ctx, msg, priority, retry)
+		rp.filterBailiwick(resp)
+		return resp, err
+	}
+
+	var err error
+	var resp *dns.Msg
+	if q.shareable && flights != nil {
+		resp, err = flights.do(q.ctx, q.key, msg, query)
+	} else {
+		resp, err = query()
+	}
+	return q.finish(resp, err)
+}
+
+// poolQuery holds the state shared by the stages of a query performed by the pool,
+// whether the response is returned by Query or provided to the callback of QueryAsync.
+type poolQuery struct {
+	rp        *ResolverPool
+	ctx       context.Context
+	msg       *dns.Msg
+	key       string
+	shareable bool
+	mode      cacheMode
+	cache     *responseCache
+	slo       *sloTracker
+	chain     *queryChain
+	span      Span
+	began     time.Time
+}
+
+func (rp *ResolverPool) newPoolQuery(ctx context.Context, msg *dns.Msg) *poolQuery {
+	key, shareable := flightKey(ctx, msg)
+
+	rp.Lock()
+	defer rp.Unlock()
+
+	return &poolQuery{
+		rp:        rp,
+		ctx:       ctx,
+		msg:       msg,
+		key:       key,
+		shareable: shareable,
+		mode:      cacheModeFromContext(ctx),
+		cache:     rp.cache,
+		slo:       rp.slo,
+	}
+}
+
+// lookup returns the cached response, or the error of a query restricted to the cache,
+// and reports whether the query is complete without being sent.
+func (q *poolQuery) lookup() (*dns.Msg, bool, error) {
+	if q.shareable && q.cache != nil && q.mode != cacheBypass {
+		if resp, left := q.cache.get(q.key, q.msg); resp != nil {
+			q.rp.refreshAhead(q.key, q.msg, left)
+			return resp, true, nil
+		}
+	}
+	if q.mode == cacheOnly {
+		return nil, true, cacheMissError(q.msg)
+	}
+	return nil, false, nil
+}
+
+func (q *poolQuery) startSpan() {
+	q.ctx, q.span = q.rp.startSpan(q.ctx, SpanQuery, q.msg)
+}
+
+// start begins collecting the resolvers attempted and timing the query.
+func (q *poolQuery) start() {
+	q.ctx, q.chain = q.rp.startQueryChain(q.ctx)
+	q.began = time.Now()
+}
+
+// finish caches the response, or falls back to a stale response, and records the outcome of the query.
+func (q *poolQuery) finish(resp *dns.Msg, err error) (*dns.Msg, error) {
+	if q.shareable && q.cache != nil {
+		if err == nil {
+			q.cache.set(q.key, resp)
+		} else if q.mode != cacheBypass && staleEligible(err) {
+			if stale := q.cache.getStale(q.key, q.msg); stale != nil {
+				resp, err = stale, nil
+			}
+		}
+	}
+	if q.slo != nil {
+		q.slo.record(err, time.Since(q.began))
+	}
+	q.rp.reportSlowQuery(q.ctx, q.chain, q.msg, time.Since(q.began), err)
+	endSpan(q.span, nil, resp, 0, err)
+	return resp, err
+}
+
+// wireQuery sends the query to the resolvers without consulting the cache.
+func (rp *ResolverPool) wireQuery(ctx context.Context, msg *dns.Msg, priority int, retry Retry) (*dns.Msg, error) {
+	if sub := rp.typePool(msg); sub != nil {
+		return sub.Query(ctx, msg, priority, retry)
+	}
+	return rp.standbyQuery(ctx, msg, priority, retry)
+}
+
+func (rp *ResolverPool) query(ctx context.Context, msg *dns.Msg, priority int, retry Retry) (*dns.Msg, error) {
+	_, override := resolverFromContext(ctx)
+	if rp.baseline != nil && !override && rp.numUsableResolvers() == 0 {
 		return rp.baseline.Query(ctx, msg, priority, retry)
 	}
 
 	var err error
 	var r Resolver
 	var resp *dns.Msg
-	for times := 1; !attemptsExceeded(times-1, priority); times++ {
+	limit := attemptsLimit(ctx)
+	strategy := rp.retryStrategy()
+	if strategy != nil && limit == 0 {
+		limit = strategy.MaxAttempts(priority)
+	}
+	for times := 1; !attemptsExceeded(times-1, priority) && (limit == 0 || times <= limit); times++ {
 		err = checkContext(ctx)
 		if err != nil {
 			break
 		}
+		if times > 1 {
+			rp.recordRetry(msg, times)
+		}
 
-		r = rp.nextResolver(ctx)
+		var last Resolver
+		if strategy != nil && !strategy.SwitchResolver() {
+			last = rp.retainResolver(r)
+		}
+		if r = last; r == nil {
+			r = rp.selectResolver(ctx, msg)
+		}
 		if r == nil {
+			err = rp.unavailableError(ctx)
 			break
 		}
 
-		resp, err = r.Query(ctx, msg, priority, nil)
-
-		var timeout bool
-		// Check if the response is considered a resolver failure to be tracked
-		if err != nil {
-			if e, ok := err.(*ResolveError); ok && e.Rcode == TimeoutRcode {
-				timeout = true
-			}
-		}
-
-		k := r.String()
-		// Pause use of the resolver if queries have failed too often
-		if rp.avgs.updateTimeouts(k, timeout) && timeout {
-			rp.updateWait(k, rp.delay)
+		start := time.Now()
+		actx, span := rp.startSpan(ctx, SpanAttempt, msg)
+		if span != nil {
+			span.SetAttribute(AttrAttempt, times)
 		}
-
+		r, resp, err = rp.hedgedQuery(actx, r, msg, priority)
+		rp.observeAttempt(r, time.Since(start), err)
+		endSpan(span, r, resp, time.Since(start), err)
+		rp.audit(ctx, msg, r, resp, time.Since(start), err)
+		rp.tap(msg, r, resp, start, time.Since(start))
+		rp.capture(msg, r, resp, start, time.Since(start))
+		rp.notifyAttempt(msg, r, resp, time.Since(start), err)
+		queryChainFromContext(ctx).add(r.String())
+
+		resultInfoFromContext(ctx).setAttempts(times)
 		if err == nil {
 			break
 		}
+		if strategy != nil {
+			e, ok := err.(*ResolveError)
+			if !ok || !strategy.ShouldRetry(e.Rcode) || !sleepContext(ctx, strategy.Backoff(times)) {
+				break
+			}
+			continue
+		}
 		// Timeouts and resolver errors can cause retries without executing the callback
 		if e, ok := err.(*ResolveError); ok && (e.Rcode == TimeoutRcode || e.Rcode == ResolverErrRcode) {
 			continue
@@ -240,26 +569,372 @@ func (rp *resolverPool) Query(ctx context.Context, msg *dns.Msg, priority int, r
 			break
 		}
 	}
+	err = retriesExhausted(err)
 
-	if rp.baseline != nil && err == nil && len(resp.Answer) > 0 {
+	if rp.baseline != nil && !override && err == nil && len(resp.Answer) > 0 {
 		// Validate findings from an untrusted resolver
 		resp, err = rp.baseline.Query(ctx, msg, priority, retry)
 		// False positives result in stopping the untrusted resolver
+		confirmed := true
 		if err == nil && resp != nil && len(resp.Answer) == 0 {
+			confirmed = false
+			rp.logQueryEvent(ctx, LevelWarn, "Stopping resolver", "resolver", r.String(), "reason", EvictUnconfirmedAnswers)
+			r.Stop()
+			rp.notifyEvict(r.String(), EvictUnconfirmedAnswers)
+		}
+		if e, ok := err.(*ResolveError); ok && e.Rcode == dns.RcodeNameError {
+			// Answers for names that do not exist are a sign of NXDOMAIN hijacking
+			confirmed = false
+			rp.rep.hijack(r.String())
+			e.Reason = ReasonValidationRejected
+			rp.logQueryEvent(ctx, LevelWarn, "Stopping resolver", "resolver", r.String(), "reason", EvictNXDOMAINHijacking)
 			r.Stop()
+			rp.notifyEvict(r.String(), EvictNXDOMAINHijacking)
 		}
+		rp.rep.consistency(r.String(), confirmed)
 	}
 
 	return resp, err
 }
 
+// observeAttempt tracks the outcome of a single attempt made by the resolver.
+func (rp *ResolverPool) observeAttempt(r Resolver, rtt time.Duration, err error) {
+	var timeout bool
+	// Check if the response is considered a resolver failure to be tracked
+	if err != nil {
+		if e, ok := err.(*ResolveError); ok && e.Rcode == TimeoutRcode {
+			timeout = true
+		}
+	}
+
+	k := r.String()
+	rp.rep.observe(k, rtt, timeout)
+	rp.stats.record(k, rtt, err)
+	rp.recordMetrics(k, rtt, err)
+	if !timeout {
+		rp.observeLatency(rtt)
+	}
+	// Pause use of the resolver if queries have failed too often
+	if rp.avgs.updateTimeouts(k, timeout) && timeout {
+		rp.logEvent(LevelWarn, "Pausing resolver after a burst of timeouts", "resolver", k, "delay", rp.delay)
+		rp.updateWait(k, rp.delay)
+	}
+}
+
+// selectResolver returns the resolver for the next attempt of the query, which must be released
+// using releaseResolver once the attempt is complete.
+func (rp *ResolverPool) selectResolver(ctx context.Context, msg *dns.Msg) Resolver {
+	if addr, ok := resolverFromContext(ctx); ok {
+		return rp.overrideResolver(addr)
+	}
+	if zone := rp.stickyZone(msg); zone != "" {
+		return rp.nextStickyResolver(ctx, zone)
+	}
+	return rp.nextResolver(ctx)
+}
+
+func (rp *ResolverPool) unavailableError(ctx context.Context) error {
+	if addr, ok := resolverFromContext(ctx); ok {
+		return &ResolveError{
+			Err:    fmt.Sprintf("ResolverPool: Failed to use the requested resolver at %s", addr),
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonNoResolvers,
+		}
+	}
+	if rp.Stopped() {
+		return &ResolveError{
+			Err:    "ResolverPool: The pool has been stopped",
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonResolverStopped,
+		}
+	}
+	if region, ok := regionFromContext(ctx); ok {
+		return &ResolveError{
+			Err:    fmt.Sprintf("ResolverPool: No resolvers are available in region %+v", region),
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonNoResolvers,
+		}
+	}
+
+	rp.Lock()
+	var total int
+	for _, partition := range rp.partitions {
+		total += len(partition)
+	}
+	nonValidating := rp.noValidatingResolvers()
+	rp.Unlock()
+
+	if total == 0 {
+		return &ResolveError{
+			Err:    "ResolverPool: No resolvers are available",
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonNoResolvers,
+		}
+	}
+	if nonValidating {
+		return &ResolveError{
+			Err:    "ResolverPool: No resolvers are confirmed to validate DNSSEC",
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonNoResolvers,
+		}
+	}
+	if rp.numUsableResolvers() == 0 {
+		return &ResolveError{
+			Err:    "ResolverPool: All resolvers are quarantined",
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonAllResolversQuarantined,
+		}
+	}
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	return &ResolveError{
+		Err:    "ResolverPool: No resolvers are available",
+		Rcode:  ResolverErrRcode,
+		Reason: ReasonNoResolvers,
+	}
+}
+
 // WildcardType implements the Resolver interface.
-func (rp *resolverPool) WildcardType(ctx context.Context, msg *dns.Msg, domain string) int {
-	wtype := rp.partitions[0][0].WildcardType
+func (rp *ResolverPool) WildcardType(ctx context.Context, msg *dns.Msg, domain string) int {
+	r := rp.wildcardResolver()
+	if r == nil {
+		return WildcardTypeNone
+	}
+	return r.WildcardType(ctx, msg, domain)
+}
+
+// WildcardLevel returns the subdomain whose DNS wildcard answered for the name along with the wildcard
+// type, so names found below nested wildcards, such as *.dev.example.com and *.example.com, are
+// attributed to the correct level. An empty subdomain is returned when the name matches no wildcard.
+func (rp *ResolverPool) WildcardLevel(ctx context.Context, msg *dns.Msg, domain string) (string, int) {
+	if l, ok := rp.wildcardResolver().(wildcardLeveler); ok {
+		return l.wildcardLevel(ctx, msg, domain)
+	}
+	return "", WildcardTypeNone
+}
 
+// wildcardResolver returns the Resolver that performs wildcard detection for the pool.
+func (rp *ResolverPool) wildcardResolver() Resolver {
 	if rp.baseline != nil {
-		wtype = rp.baseline.WildcardType
+		return rp.baseline
+	}
+
+	rp.Lock()
+	defer rp.Unlock()
+
+	if rp.wildcardConfig != nil && rp.wildcardConfig.TrustedOnly {
+		return nil
+	}
+	if len(rp.partitions) > 0 && len(rp.partitions[0]) > 0 {
+		return rp.partitions[0][0]
+	}
+	return nil
+}
+
+// WildcardStates returns the wildcard determinations currently held by the pool, sorted by subdomain.
+func (rp *ResolverPool) WildcardStates() []*WildcardState {
+	if h, ok := rp.wildcardResolver().(wildcardStateHolder); ok {
+		return h.wildcardStates()
+	}
+	return nil
+}
+
+// WildcardAnswers returns the records gathered by wildcard detection for the subdomain, which
+// are the answers of a static wildcard or the sample collected from a dynamic wildcard.
+// False is returned when no wildcard has been detected for the subdomain.
+func (rp *ResolverPool) WildcardAnswers(sub string) ([]*ExtractedAnswer, bool) {
+	sub = strings.ToLower(RemoveLastDot(sub))
+
+	for _, state := range rp.WildcardStates() {
+		if state.Subdomain != sub || state.Testing || state.WildcardType == WildcardTypeNone {
+			continue
+		}
+		if state.WildcardType == WildcardTypeDynamic {
+			return state.Sample, true
+		}
+		return state.Answers, true
+	}
+	return nil, false
+}
+
+// InvalidateWildcards discards the wildcard determinations for the subdomain and the names below it,
+// or all the determinations when the subdomain is empty, so detection is performed again.
+func (rp *ResolverPool) InvalidateWildcards(sub string) {
+	if h, ok := rp.wildcardResolver().(wildcardStateHolder); ok {
+		h.invalidateWildcards(sub)
 	}
+}
+
+// SetWildcardConfig tunes the probes sent by the resolvers of the pool, including the baseline and
+// resolvers added later, during DNS wildcard detection performed after the configuration is set.
+func (rp *ResolverPool) SetWildcardConfig(config WildcardConfig) {
+	defer rp.configChanged("wildcard", "trusted_only", config.TrustedOnly)
+	rp.Lock()
+	defer rp.Unlock()
 
-	return wtype(ctx, msg, domain)
+	rp.wildcardConfig = &config
+	resolvers := []Resolver{rp.baseline}
+	for _, partition := range rp.partitions {
+		resolvers = append(resolvers, partition...)
+	}
+	for _, r := range resolvers {
+		if wc, ok := r.(wildcardConfigurer); ok {
+			wc.setWildcardConfig(config)
+		}
+	}
+	if b, ok := rp.baseline.(*ResolverPool); ok {
+		// The resolvers of the baseline pool are the trusted resolvers
+		trusted := config
+		trusted.TrustedOnly = false
+		b.SetWildcardConfig(trusted)
+	}
+}
+
+// AddResolvers adds the provided resolvers to the pool, and is safe to call while queries are in flight.
+func (rp *ResolverPool) AddResolvers(resolvers []Resolver) {
+	rp.addResolvers(resolvers)
+}
+
+// RemoveResolvers takes the resolvers with the provided addresses out of the pool and returns the
+// number removed. Each removed resolver is stopped once the queries already sent to it complete.
+func (rp *ResolverPool) RemoveResolvers(addrs []string) int {
+	removed := rp.removeResolvers(addrs)
+
+	if len(removed) > 0 {
+		go rp.drainResolvers(removed)
+	}
+	return len(removed)
+}
+
+// drainResolvers stops the provided resolvers after their outstanding queries complete,
+// or after the drain timeout expires.
+func (rp *ResolverPool) drainResolvers(resolvers []Resolver) {
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+
+	deadline := time.Now().Add(2 * rp.queryTimeout())
+loop:
+	for time.Now().Before(deadline) {
+		var busy bool
+
+		rp.Lock()
+		for _, r := range resolvers {
+			if rp.outstanding[r.String()] > 0 {
+				busy = true
+				break
+			}
+		}
+		rp.Unlock()
+		if !busy {
+			break
+		}
+
+		select {
+		case <-rp.done:
+			break loop
+		case <-t.C:
+		}
+	}
+
+	for _, r := range resolvers {
+		r.Stop()
+	}
+}
+
+func (rp *ResolverPool) addResolvers(resolvers []Resolver) {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if rp.validatingOnly {
+		go rp.probeDNSSEC(resolvers)
+	}
+
+	for _, r := range resolvers {
+		if wc, ok := r.(wildcardConfigurer); ok && rp.wildcardConfig != nil {
+			wc.setWildcardConfig(*rp.wildcardConfig)
+		}
+		if rp.config != (PoolConfig{}) {
+			rp.configureResolver(r, rp.resolverConfig)
+		}
+		if len(rp.partitions) == 0 {
+			rp.partitions = [][]Resolver{{r}}
+			continue
+		}
+
+		// Grow the smallest partition
+		idx := 0
+		for i, partition := range rp.partitions {
+			if len(partition) < len(rp.partitions[idx]) {
+				idx = i
+			}
+		}
+		rp.partitions[idx] = append(rp.partitions[idx], r)
+	}
+}
+
+// removeResolvers takes the resolvers with the provided addresses out of the pool and returns them.
+func (rp *ResolverPool) removeResolvers(addrs []string) []Resolver {
+	rp.Lock()
+	defer rp.Unlock()
+
+	remove := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		remove[addr] = struct{}{}
+	}
+
+	var removed []Resolver
+	var partitions [][]Resolver
+	for _, partition := range rp.partitions {
+		var kept []Resolver
+
+		for _, r := range partition {
+			if _, found := remove[r.String()]; found {
+				removed = append(removed, r)
+				delete(rp.waits, r.String())
+				rp.rep.remove(r.String())
+				rp.stats.remove(r.String())
+				continue
+			}
+			kept = append(kept, r)
+		}
+
+		if len(kept) > 0 {
+			partitions = append(partitions, kept)
+		}
+	}
+
+	rp.partitions = partitions
+	if rp.curPart >= len(rp.partitions) {
+		rp.curPart = 0
+		rp.curIdx = 0
+	}
+	if len(rp.partitions) > 0 && rp.curIdx >= len(rp.partitions[rp.curPart]) {
+		rp.curIdx = 0
+	}
+	return removed
+}
+
+func (rp *ResolverPool) resolverAddrs() []string {
+	rp.Lock()
+	defer rp.Unlock()
+
+	var addrs []string
+	for _, partition := range rp.partitions {
+		for _, r := range partition {
+			addrs = append(addrs, r.String())
+		}
+	}
+	return addrs
+}
+
+func (rp *ResolverPool) resolvers() []Resolver {
+	rp.Lock()
+	defer rp.Unlock()
+
+	var resolvers []Resolver
+	for _, partition := range rp.partitions {
+		resolvers = append(resolvers, partition...)
+	}
+	return resolvers
 }
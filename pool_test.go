@@ -6,6 +6,7 @@ package resolve
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -117,3 +118,130 @@ func TestPoolEdgeCases(t *testing.T) {
 		t.Errorf("Pool not stopped after being requested")
 	}
 }
+
+func TestPoolResolverQPS(t *testing.T) {
+	var lock sync.Mutex
+	counts := make(map[string]int)
+	handler := func(id string) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, req *dns.Msg) {
+			lock.Lock()
+			counts[id]++
+			lock.Unlock()
+			typeAHandler(w, req)
+		}
+	}
+
+	slow, saddr, _, err := runLocalUDPHandlerServer(":0", handler("slow"))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer slow.Shutdown()
+
+	fast, faddr, _, err := runLocalUDPHandlerServer(":0", handler("fast"))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer fast.Shutdown()
+
+	res := []Resolver{NewBaseResolver(saddr, 100, nil), NewBaseResolver(faddr, 100, nil)}
+	pool := NewResolverPool(res, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetResolverQPS(saddr, 5)
+	if rl := res[0].(rateLimitedResolver); rl.maxRate() != 5 {
+		t.Errorf("The resolver cap was %d instead of 5", rl.maxRate())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = pool.Query(context.TODO(), QueryMsg("qps.net", dns.TypeA), PriorityNormal, nil)
+		}()
+	}
+	wg.Wait()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if counts["slow"] >= counts["fast"]/2 {
+		t.Errorf("The slow resolver received %d queries and the fast resolver received %d", counts["slow"], counts["fast"])
+	}
+}
+
+func TestPoolUnavailableReasons(t *testing.T) {
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.updateWait(r.String(), time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := pool.Query(ctx, QueryMsg("caffix.net", dns.TypeA), PriorityNormal, nil)
+	if reason := ErrorReason(err); reason != ReasonAllResolversQuarantined {
+		t.Errorf("The query returned reason %s instead of %s", reason, ReasonAllResolversQuarantined)
+	}
+
+	pool.SyncResolvers([]string{}, 10)
+	_, err = pool.Query(context.TODO(), QueryMsg("caffix.net", dns.TypeA), PriorityNormal, nil)
+	if reason := ErrorReason(err); reason != ReasonNoResolvers {
+		t.Errorf("The query returned reason %s instead of %s", reason, ReasonNoResolvers)
+	}
+}
+
+func TestPoolRetriesExhausted(t *testing.T) {
+	// The server never responds to the queries
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 10, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetConfig(PoolConfig{QueryTimeout: 250 * time.Millisecond})
+	pool.SetRetryStrategy(&ExponentialBackoff{Attempts: 2})
+	_, err = pool.Query(context.TODO(), QueryMsg("exhausted.net", dns.TypeA), PriorityNormal, nil)
+	if reason := ErrorReason(err); reason != ReasonTimeout {
+		t.Errorf("The query returned reason %s instead of %s", reason, ReasonTimeout)
+	}
+}
+
+func TestRemoveResolversDrains(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	busy := pool.nextResolver(context.TODO())
+	if n := pool.RemoveResolvers([]string{r.String()}); n != 1 {
+		t.Fatalf("RemoveResolvers removed %d resolvers instead of 1", n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if r.Stopped() {
+		t.Errorf("The resolver was stopped while a query was outstanding")
+	}
+	if _, err := busy.Query(context.TODO(), QueryMsg("drain.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The outstanding query failed: %v", err)
+	}
+	pool.releaseResolver(busy)
+
+	time.Sleep(100 * time.Millisecond)
+	if !r.Stopped() {
+		t.Errorf("The resolver was not stopped after being drained")
+	}
+
+	pool.AddResolvers([]Resolver{NewBaseResolver(addrstr, 100, nil)})
+	if _, err := pool.Query(context.TODO(), QueryMsg("drain.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The query using the added resolver failed: %v", err)
+	}
+}
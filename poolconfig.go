@@ -0,0 +1,227 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import "time"
+
+// PoolConfig contains the settings of a ResolverPool, so pools in the same process can use different
+// timeouts, limits and behaviors. The zero value of each field selects the default, which is the
+// package-level variable for QueryTimeout.
+type PoolConfig struct {
+	// QueryTimeout is the most time allowed for each query sent to a resolver of the pool.
+	QueryTimeout time.Duration
+	// MinQueryTimeout is the least time allowed, regardless of the round-trip times measured,
+	// defaulting to 250 milliseconds.
+	MinQueryTimeout time.Duration
+	// MaxInFlight caps the queries outstanding across the resolvers of the pool. Each pool has its own
+	// cap, and the queries are not capped when it is zero.
+	MaxInFlight int
+	// InFlightFailFast causes queries to fail immediately when the MaxInFlight cap of the pool is reached.
+	InFlightFailFast bool
+	// Use0x20Encoding causes the resolvers to randomize the case of the letters in query names, and to drop
+	// responses that do not echo the same case. This makes off-path spoofing of responses more difficult.
+	// Resolvers that do not preserve the case of query names will appear unresponsive while it is enabled.
+	Use0x20Encoding bool
+	// DisableBailiwickFiltering keeps the records that are out of bailiwick for the question in the
+	// responses, which are otherwise stripped before the responses are cached or returned.
+	DisableBailiwickFiltering bool
+	// DisableQNAMEMinimization causes the iterative resolvers of the pool to send the full name to the
+	// nameservers at each level of the hierarchy, instead of only the labels necessary (RFC 9156).
+	DisableQNAMEMinimization bool
+	// SweepPTRRate is the number of PTR queries SweepPTR sends each second into a single /24 (or IPv6 /120) block.
+	SweepPTRRate int
+	// ProfileQueryPhases attaches pprof labels to the goroutines performing each query attempt, so the CPU
+	// profiles of the application attribute the time spent waiting on each resolver. The goroutines of the
+	// resolvers are always labeled, since they are labeled once when started. Labeling each attempt allocates,
+	// so it is disabled by default.
+	ProfileQueryPhases bool
+	// ResponseQueueSize is the number of responses each resolver of the pool holds while waiting to be
+	// processed, defaulting to 4096. When the responses arrive faster than they are processed, the oldest
+	// response waiting is dropped to make room for the newest, and the query it answered fails with a
+	// timeout so it can be retried.
+	ResponseQueueSize int
+	// ProbeEDNS causes each resolver of the pool to send a query on first use that discovers its EDNS support
+	// and the UDP payload size it advertises. Without the probe, full support is assumed until the resolver
+	// rejects a query, which is then sent again without the rejected features.
+	ProbeEDNS bool
+	// MetricsInterval is how often the gauges of the pool are reported to its Metrics, defaulting to 5 seconds.
+	MetricsInterval time.Duration
+}
+
+// The number of PTR queries sent each second into a block when SweepPTRRate is not set.
+const defaultSweepPTRRate = 10
+
+// resolverConfig contains the settings a pool applies to each of its resolvers.
+type resolverConfig struct {
+	minTimeout  time.Duration
+	maxTimeout  time.Duration
+	limits      *inFlightLimiter
+	maxInFlight int
+	failFast    bool
+	use0x20     bool
+	// Iterative resolution reveals the full name at each level
+	noMinimization    bool
+	responseQueueSize int
+	probeEDNS         bool
+}
+
+// timeouts returns the bounds of the query timeout, using the package-level defaults for the unset values.
+func (c resolverConfig) timeouts() (time.Duration, time.Duration) {
+	min, max := c.minTimeout, c.maxTimeout
+	if max <= 0 {
+		max = QueryTimeout
+	}
+	if min <= 0 {
+		min = defaultMinQueryTimeout
+	}
+	if min > max {
+		min = max
+	}
+	return min, max
+}
+
+// inFlightCap returns the limiter, cap and fail fast behavior used to reserve in-flight queries.
+// The resolvers outside of a pool with a cap only count their queries using their own limiter.
+func (c resolverConfig) inFlightCap(own *inFlightLimiter) (*inFlightLimiter, int, bool) {
+	if c.limits == nil {
+		return own, 0, false
+	}
+	return c.limits, c.maxInFlight, c.failFast
+}
+
+// configurableResolver is implemented by the resolvers able to use the settings of the pool.
+type configurableResolver interface {
+	setConfig(c resolverConfig)
+}
+
+func (r *baseResolver) setConfig(c resolverConfig) {
+	r.xchgs.setConfig(c)
+
+	size := c.responseQueueSize
+	if size <= 0 {
+		size = defaultResponseQueueSize
+	}
+	for _, read := range r.readMsgs.setSize(size) {
+		r.dropResponse(read)
+	}
+}
+
+// SetConfig applies the settings to the pool and its resolvers, including the trusted resolvers, the type
+// resolvers and the standby set, and the resolvers added later. Queries already sent keep their timeouts.
+func (rp *ResolverPool) SetConfig(c PoolConfig) {
+	defer rp.configChanged("config", "query_timeout", c.QueryTimeout, "min_query_timeout", c.MinQueryTimeout,
+		"max_in_flight", c.MaxInFlight, "in_flight_fail_fast", c.InFlightFailFast, "use_0x20_encoding", c.Use0x20Encoding,
+		"disable_bailiwick_filtering", c.DisableBailiwickFiltering, "disable_qname_minimization", c.DisableQNAMEMinimization,
+		"sweep_ptr_rate", c.SweepPTRRate, "profile_query_phases", c.ProfileQueryPhases,
+		"response_queue_size", c.ResponseQueueSize, "probe_edns", c.ProbeEDNS,
+		"metrics_interval", c.MetricsInterval)
+
+	rc := resolverConfig{
+		minTimeout:        c.MinQueryTimeout,
+		maxTimeout:        c.QueryTimeout,
+		use0x20:           c.Use0x20Encoding,
+		noMinimization:    c.DisableQNAMEMinimization,
+		responseQueueSize: c.ResponseQueueSize,
+		probeEDNS:         c.ProbeEDNS,
+	}
+	if c.MaxInFlight > 0 {
+		rc.limits = newInFlightLimiter()
+		rc.maxInFlight = c.MaxInFlight
+		rc.failFast = c.InFlightFailFast
+	}
+	rp.applyConfig(c, rc)
+}
+
+// Config returns the settings provided to SetConfig.
+func (rp *ResolverPool) Config() PoolConfig {
+	rp.Lock()
+	defer rp.Unlock()
+
+	return rp.config
+}
+
+func (rp *ResolverPool) applyConfig(c PoolConfig, rc resolverConfig) {
+	rp.Lock()
+	rp.config = c
+	rp.resolverConfig = rc
+	subs := rp.subPools()
+	var overrides []Resolver
+	for _, e := range rp.overrides {
+		overrides = append(overrides, e.r)
+	}
+	rp.Unlock()
+
+	rp.rep.setConfig(rc)
+	for _, r := range append(rp.resolvers(), overrides...) {
+		rp.configureResolver(r, rc)
+	}
+	for _, sub := range subs {
+		// The sub-pools share the in-flight cap of the pool
+		sub.applyConfig(c, rc)
+	}
+}
+
+// configureResolver provides the settings of the pool to the resolver when it is able to use them.
+func (rp *ResolverPool) configureResolver(r Resolver, rc resolverConfig) {
+	if cr, ok := r.(configurableResolver); ok {
+		cr.setConfig(rc)
+	}
+}
+
+// inheritConfig provides the settings of the pool to the sub-pool.
+func (rp *ResolverPool) inheritConfig(sub *ResolverPool) {
+	rp.Lock()
+	c, rc := rp.config, rp.resolverConfig
+	rp.Unlock()
+
+	if c != (PoolConfig{}) {
+		sub.applyConfig(c, rc)
+	}
+}
+
+// bailiwickFiltering returns true when the records out of bailiwick are stripped from the responses.
+func (rp *ResolverPool) bailiwickFiltering() bool {
+	rp.Lock()
+	defer rp.Unlock()
+
+	return !rp.config.DisableBailiwickFiltering
+}
+
+// sweepPTRRate returns the number of PTR queries sent each second into a block by SweepPTR.
+func (rp *ResolverPool) sweepPTRRate() int {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if rp.config.SweepPTRRate > 0 {
+		return rp.config.SweepPTRRate
+	}
+	return defaultSweepPTRRate
+}
+
+// queryTimeout returns the most time allowed for each query sent by the pool.
+// defaultQueryTimeout returns the query timeout used without the settings of a pool.
+func defaultQueryTimeout() time.Duration {
+	_, max := resolverConfig{}.timeouts()
+	return max
+}
+
+// metricsInterval returns how often the gauges of the pool are reported to its Metrics.
+func (rp *ResolverPool) metricsInterval() time.Duration {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if d := rp.config.MetricsInterval; d > 0 {
+		return d
+	}
+	return defaultMetricsInterval
+}
+
+func (rp *ResolverPool) queryTimeout() time.Duration {
+	rp.Lock()
+	rc := rp.resolverConfig
+	rp.Unlock()
+
+	_, max := rc.timeouts()
+	return max
+}
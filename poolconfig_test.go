@@ -0,0 +1,149 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestPoolConfigTimeouts(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(timeoutHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	fast := NewBaseResolver(addrstr, 100, nil)
+	fastPool := NewResolverPool([]Resolver{fast}, time.Second, nil, 1, nil)
+	defer fastPool.Stop()
+	slowPool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer slowPool.Stop()
+
+	fastPool.SetConfig(PoolConfig{QueryTimeout: 300 * time.Millisecond})
+	if c := fastPool.Config(); c.QueryTimeout != 300*time.Millisecond {
+		t.Errorf("The pool returned the config %+v", c)
+	}
+	if to := fastPool.Snapshot().Resolvers[0].Timeout; to != 300*time.Millisecond {
+		t.Errorf("The resolver of the configured pool used the timeout %v", to)
+	}
+	if to := slowPool.Snapshot().Resolvers[0].Timeout; to != QueryTimeout {
+		t.Errorf("The resolver of the other pool used the timeout %v instead of QueryTimeout", to)
+	}
+
+	start := time.Now()
+	if _, err := fast.Query(context.TODO(), QueryMsg("www.timeout.net", dns.TypeA), PriorityNormal, nil); err == nil {
+		t.Errorf("The query to the unresponsive server succeeded")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("The query took %v to time out using the timeout of the pool", d)
+	}
+
+	added := NewBaseResolver(addrstr, 100, nil)
+	fastPool.AddResolvers([]Resolver{added})
+	if to := added.(*baseResolver).xchgs.queryTimeout(); to != 300*time.Millisecond {
+		t.Errorf("The resolver added to the pool used the timeout %v", to)
+	}
+}
+
+func TestPoolConfigTimeoutsApplied(t *testing.T) {
+	fast := NewResolverPool([]Resolver{NewIterativeResolver([]string{"127.0.0.1"})}, time.Second, nil, 1, nil)
+	defer fast.Stop()
+	slow := NewResolverPool([]Resolver{NewIterativeResolver([]string{"127.0.0.1"})}, time.Second, nil, 1, nil)
+	defer slow.Stop()
+
+	fast.SetConfig(PoolConfig{QueryTimeout: 500 * time.Millisecond})
+	slow.SetConfig(PoolConfig{QueryTimeout: 5 * time.Second})
+	for _, test := range []struct {
+		pool    *ResolverPool
+		timeout time.Duration
+	}{
+		{fast, 500 * time.Millisecond},
+		{slow, 5 * time.Second},
+	} {
+		if d := test.pool.queryTimeout(); d != test.timeout {
+			t.Errorf("The pool used a query timeout of %s instead of %s", d, test.timeout)
+		}
+		test.pool.rep.Lock()
+		d := test.pool.rep.queryTimeout()
+		test.pool.rep.Unlock()
+		if d != test.timeout {
+			t.Errorf("The reputation of the resolvers used a query timeout of %s instead of %s", d, test.timeout)
+		}
+		if d := test.pool.resolvers()[0].(*iterativeResolver).queryTimeout(); d != test.timeout {
+			t.Errorf("The iterative resolver used a query timeout of %s instead of %s", d, test.timeout)
+		}
+	}
+}
+
+func TestPoolConfigInFlight(t *testing.T) {
+	r1 := NewBaseResolver("127.0.0.1:53", 10, nil)
+	r2 := NewBaseResolver("127.0.0.2:53", 10, nil)
+	pool := NewResolverPool([]Resolver{r1, r2}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	other := NewBaseResolver("127.0.0.3:53", 10, nil)
+	defer other.Stop()
+
+	pool.SetConfig(PoolConfig{MaxInFlight: 1, InFlightFailFast: true})
+
+	x1, x2 := r1.(*baseResolver).xchgs, r2.(*baseResolver).xchgs
+	limits, err := x1.reserve(context.TODO(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("The first reservation failed: %v", err)
+	}
+	// The cap is shared by the resolvers of the pool
+	if _, err := x2.reserve(context.TODO(), PriorityNormal); err != errInFlightCap {
+		t.Errorf("The reservation beyond the cap of the pool returned %v", err)
+	}
+	// and does not apply to the resolvers outside the pool
+	if l, err := other.(*baseResolver).xchgs.reserve(context.TODO(), PriorityNormal); err != nil || l == limits {
+		t.Errorf("The resolver outside the pool was subject to its cap: %v", err)
+	} else {
+		l.release(1)
+	}
+
+	req := &resolveRequest{ID: 1, Name: "inflight.caffix.net", limits: limits}
+	if err := x1.add(req); err != nil {
+		t.Fatalf("Failed to add the request: %v", err)
+	}
+	// The reservation is given back to the limiter of the pool, even after the config changes
+	pool.SetConfig(PoolConfig{})
+	x1.remove(req.ID, req.Name)
+	if n := limits.current(); n != 0 {
+		t.Errorf("%d reservations remained with the limiter of the pool", n)
+	}
+}
+
+func TestNewResolverPoolWithConfig(t *testing.T) {
+	if pool := NewResolverPoolWithConfig(nil, time.Second, nil, 1, nil, PoolConfig{MaxInFlight: 1}); pool != nil {
+		t.Errorf("A pool was returned without resolvers")
+	}
+
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	pool := NewResolverPoolWithConfig([]Resolver{r}, time.Second, nil, 1, nil,
+		PoolConfig{MaxInFlight: 1, InFlightFailFast: true})
+	defer pool.Stop()
+
+	x := r.(*baseResolver).xchgs
+	limits, err := x.reserve(context.TODO(), PriorityNormal)
+	if err != nil {
+		t.Fatalf("The first reservation failed: %v", err)
+	}
+	defer limits.release(1)
+	if _, err := x.reserve(context.TODO(), PriorityNormal); err != errInFlightCap {
+		t.Errorf("The reservation beyond the cap set at construction returned %v", err)
+	}
+
+	// Resolvers outside of a pool are not capped
+	other := NewBaseResolver("127.0.0.2:53", 10, nil)
+	defer other.Stop()
+	for i := 0; i < 10; i++ {
+		if _, err := other.(*baseResolver).xchgs.reserve(context.TODO(), PriorityNormal); err != nil {
+			t.Fatalf("The reservation without a cap failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import "time"
+
+// PoolSnapshot describes the state of a ResolverPool and each of its resolvers at a moment in time.
+type PoolSnapshot struct {
+	Time time.Time `json:"time"`
+	// InFlight is the number of queries written to the resolvers that are awaiting a response.
+	InFlight int `json:"in_flight"`
+	// Exchanges is the number of queries tracked by the resolvers, including those not yet written.
+	Exchanges int `json:"exchanges"`
+	// Queued is the number of queries waiting to be sent.
+	Queued int `json:"queued"`
+	// Responses is the number of responses received that are waiting to be processed.
+	Responses int `json:"responses"`
+	// Sockets is the number of connections held open by the resolvers.
+	Sockets   int                `json:"sockets"`
+	Resolvers []ResolverSnapshot `json:"resolvers"`
+}
+
+// ResolverSnapshot describes the state of a single resolver in the pool. The counts are only
+// available for the resolvers sending the queries themselves, such as those from NewBaseResolver.
+type ResolverSnapshot struct {
+	Address   string `json:"address"`
+	Stopped   bool   `json:"stopped"`
+	InFlight  int    `json:"in_flight"`
+	Exchanges int    `json:"exchanges"`
+	Queued    int    `json:"queued"`
+	Responses int    `json:"responses"`
+	// Rate is the current number of queries per second permitted, and MaxRate the configured maximum.
+	Rate    int `json:"rate"`
+	MaxRate int `json:"max_rate"`
+	// Mismatches is the number of responses dropped for not matching the query sent.
+	Mismatches uint64 `json:"mismatches"`
+	// SRTT is the smoothed round-trip time of the resolver, and Timeout the time currently allowed for its queries.
+	SRTT    time.Duration `json:"srtt"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// resolverSnapshotter is implemented by the resolvers able to describe their internal state.
+type resolverSnapshotter interface {
+	snapshot() ResolverSnapshot
+}
+
+func (r *baseResolver) snapshot() ResolverSnapshot {
+	return ResolverSnapshot{
+		Address:    r.address,
+		Stopped:    r.Stopped(),
+		InFlight:   r.xchgs.sent(),
+		Exchanges:  r.xchgs.size(),
+		Queued:     r.xchgQueue.Len(),
+		Responses:  r.readMsgs.Len(),
+		Rate:       r.currentRate(),
+		MaxRate:    r.maxRate(),
+		Mismatches: r.responseMismatches(),
+		SRTT:       r.rtt.smoothed(),
+		Timeout:    r.xchgs.queryTimeout(),
+	}
+}
+
+// Snapshot returns the current state of the pool and its resolvers. It is safe to call at any
+// time, including after the pool has been stopped, and is intended for dashboards and callers
+// adapting their behavior to the load placed on the pool.
+func (rp *ResolverPool) Snapshot() PoolSnapshot {
+	s := PoolSnapshot{Time: time.Now()}
+
+	for _, r := range rp.resolvers() {
+		rs := ResolverSnapshot{Address: r.String(), Stopped: r.Stopped()}
+		if ss, ok := r.(resolverSnapshotter); ok {
+			rs = ss.snapshot()
+			if !rs.Stopped {
+				// Each resolver sending the queries itself holds a connection
+				s.Sockets++
+			}
+		}
+
+		s.InFlight += rs.InFlight
+		s.Exchanges += rs.Exchanges
+		s.Queued += rs.Queued
+		s.Responses += rs.Responses
+		s.Resolvers = append(s.Resolvers, rs)
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestPoolSnapshot(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	good := NewBaseResolver(addrstr, 100, nil)
+	stopped := NewBaseResolver(addrstr, 50, nil)
+	stopped.Stop()
+	pool := NewResolverPool([]Resolver{good, stopped}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("www.snapshot.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+
+	snap := pool.Snapshot()
+	if snap.Time.IsZero() || len(snap.Resolvers) != 2 {
+		t.Fatalf("The snapshot described %d resolvers instead of 2", len(snap.Resolvers))
+	}
+	if snap.Sockets != 1 || snap.InFlight != 0 || snap.Exchanges != 0 || snap.Queued != 0 {
+		t.Errorf("The snapshot contained unexpected totals: %+v", snap)
+	}
+
+	for _, rs := range snap.Resolvers {
+		if rs.Address != good.String() {
+			t.Errorf("The snapshot described the resolver %s", rs.Address)
+		}
+		// Both resolvers use the same address, so they are distinguished by their rates
+		if rs.Stopped != (rs.MaxRate == 50) || rs.Rate <= 0 {
+			t.Errorf("The snapshot of the resolver was unexpected: %+v", rs)
+		}
+	}
+
+	pool.Stop()
+	if snap := pool.Snapshot(); snap.Sockets != 0 {
+		t.Errorf("The snapshot of the stopped pool reported %d sockets", snap.Sockets)
+	}
+}
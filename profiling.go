@@ -0,0 +1,45 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// The pprof label keys and the values of the phase label.
+const (
+	LabelPhase    = "phase"
+	LabelResolver = "resolver"
+	// PhaseSend labels the goroutines writing the queries to the resolvers
+	PhaseSend = "send"
+	// PhaseWait labels the goroutines performing the queries while awaiting the responses
+	PhaseWait = "wait"
+	// PhaseParse labels the goroutines reading and unpacking the responses
+	PhaseParse = "parse"
+	// PhaseProcess labels the goroutines processing the responses and returning them to the callers
+	PhaseProcess = "process"
+	// PhaseExpire labels the goroutines returning the queries that timed out
+	PhaseExpire = "expire"
+)
+
+// labelGoroutine sets the pprof labels of the calling goroutine for the phase performed by the resolver.
+func (r *baseResolver) labelGoroutine(phase string) {
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels(LabelResolver, r.address, LabelPhase, phase)))
+}
+
+// profilePhase executes the function with the pprof labels for the phase and resolver,
+// when ProfileQueryPhases is set in the configuration of the pool.
+func (rp *ResolverPool) profilePhase(ctx context.Context, phase, resolver string, f func()) {
+	rp.Lock()
+	enabled := rp.config.ProfileQueryPhases
+	rp.Unlock()
+
+	if !enabled {
+		f()
+		return
+	}
+
+	pprof.Do(ctx, pprof.Labels(LabelResolver, resolver, LabelPhase, phase), func(context.Context) { f() })
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+// goroutineLabels returns the goroutine profile, which includes the labels of each goroutine.
+func goroutineLabels(t *testing.T) string {
+	var buf bytes.Buffer
+
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		t.Fatalf("Failed to write the goroutine profile: %v", err)
+	}
+	return buf.String()
+}
+
+func TestResolverGoroutineLabels(t *testing.T) {
+	r := NewBaseResolver("127.0.0.1:5353", 10, nil)
+	defer r.Stop()
+	// Allow the goroutines to start
+	time.Sleep(50 * time.Millisecond)
+
+	profile := goroutineLabels(t)
+	for _, phase := range []string{PhaseSend, PhaseParse, PhaseProcess, PhaseExpire} {
+		if !strings.Contains(profile, `"phase":"`+phase+`"`) {
+			t.Errorf("No goroutine was labeled with the %s phase", phase)
+		}
+	}
+	if !strings.Contains(profile, `"resolver":"127.0.0.1:5353"`) {
+		t.Errorf("The goroutines were not labeled with the resolver")
+	}
+}
+
+func TestProfilePhase(t *testing.T) {
+	label := `"resolver":"192.0.2.1:53"`
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.1:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.profilePhase(context.Background(), PhaseWait, "192.0.2.1:53", func() {
+		if strings.Contains(goroutineLabels(t), label) {
+			t.Errorf("The attempt was labeled while ProfileQueryPhases was not set")
+		}
+	})
+
+	pool.SetConfig(PoolConfig{ProfileQueryPhases: true})
+	pool.profilePhase(context.Background(), PhaseWait, "192.0.2.1:53", func() {
+		if !strings.Contains(goroutineLabels(t), label) {
+			t.Errorf("The attempt was not labeled with the resolver")
+		}
+	})
+	if strings.Contains(goroutineLabels(t), label) {
+		t.Errorf("The labels remained after the attempt")
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// MXRecord is a parsed MX record.
+type MXRecord struct {
+	Host string
+	Pref uint16
+}
+
+// SRVRecord is a parsed SRV record.
+type SRVRecord struct {
+	Target   string
+	Port     uint16
+	Priority uint16
+	Weight   uint16
+}
+
+// CAARecord is a parsed CAA record.
+type CAARecord struct {
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+// NAPTRRecord is a parsed NAPTR record.
+type NAPTRRecord struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+// SOARecord is a parsed SOA record.
+type SOARecord struct {
+	Zone    string
+	NS      string
+	Mbox    string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	MinTTL  uint32
+}
+
+// lookupRecords returns the records of the qtype in the answer section of the response for the name.
+func lookupRecords(ctx context.Context, r Resolver, name string, qtype uint16) ([]dns.RR, error) {
+	resp, err := r.Query(ctx, QueryMsg(name, qtype), PriorityNormal, RetryPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []dns.RR
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == qtype {
+			records = append(records, rr)
+		}
+	}
+	return records, nil
+}
+
+// LookupMX returns the MX records for the name, sorted by preference.
+func LookupMX(ctx context.Context, r Resolver, name string) ([]MXRecord, error) {
+	records, err := lookupRecords(ctx, r, name, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+
+	var mxs []MXRecord
+	for _, rr := range records {
+		mx := rr.(*dns.MX)
+		mxs = append(mxs, MXRecord{Host: strings.ToLower(RemoveLastDot(mx.Mx)), Pref: mx.Preference})
+	}
+	sort.SliceStable(mxs, func(i, j int) bool { return mxs[i].Pref < mxs[j].Pref })
+	return mxs, nil
+}
+
+// LookupSRV returns the SRV records for the name, sorted by priority.
+func LookupSRV(ctx context.Context, r Resolver, name string) ([]SRVRecord, error) {
+	records, err := lookupRecords(ctx, r, name, dns.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+
+	var srvs []SRVRecord
+	for _, rr := range records {
+		srv := rr.(*dns.SRV)
+		srvs = append(srvs, SRVRecord{
+			Target:   strings.ToLower(RemoveLastDot(srv.Target)),
+			Port:     srv.Port,
+			Priority: srv.Priority,
+			Weight:   srv.Weight,
+		})
+	}
+	sort.SliceStable(srvs, func(i, j int) bool { return srvs[i].Priority < srvs[j].Priority })
+	return srvs, nil
+}
+
+// LookupTXT returns the TXT records for the name, with the strings of each record joined.
+func LookupTXT(ctx context.Context, r Resolver, name string) ([]string, error) {
+	records, err := lookupRecords(ctx, r, name, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	var txts []string
+	for _, rr := range records {
+		txts = append(txts, strings.Join(rr.(*dns.TXT).Txt, ""))
+	}
+	return txts, nil
+}
+
+// LookupCAA returns the CAA records for the name.
+func LookupCAA(ctx context.Context, r Resolver, name string) ([]CAARecord, error) {
+	records, err := lookupRecords(ctx, r, name, dns.TypeCAA)
+	if err != nil {
+		return nil, err
+	}
+
+	var caas []CAARecord
+	for _, rr := range records {
+		caa := rr.(*dns.CAA)
+		caas = append(caas, CAARecord{Flag: caa.Flag, Tag: caa.Tag, Value: caa.Value})
+	}
+	return caas, nil
+}
+
+// LookupNAPTR returns the NAPTR records for the name, sorted by order and preference.
+func LookupNAPTR(ctx context.Context, r Resolver, name string) ([]NAPTRRecord, error) {
+	records, err := lookupRecords(ctx, r, name, dns.TypeNAPTR)
+	if err != nil {
+		return nil, err
+	}
+
+	var naptrs []NAPTRRecord
+	for _, rr := range records {
+		n := rr.(*dns.NAPTR)
+		naptrs = append(naptrs, NAPTRRecord{
+			Order:       n.Order,
+			Preference:  n.Preference,
+			Flags:       n.Flags,
+			Service:     n.Service,
+			Regexp:      n.Regexp,
+			Replacement: strings.ToLower(RemoveLastDot(n.Replacement)),
+		})
+	}
+	sort.SliceStable(naptrs, func(i, j int) bool {
+		if naptrs[i].Order != naptrs[j].Order {
+			return naptrs[i].Order < naptrs[j].Order
+		}
+		return naptrs[i].Preference < naptrs[j].Preference
+	})
+	return naptrs, nil
+}
+
+// LookupSOA returns the SOA record for the name, which is nil when the name is not a zone apex.
+func LookupSOA(ctx context.Context, r Resolver, name string) (*SOARecord, error) {
+	records, err := lookupRecords(ctx, r, name, dns.TypeSOA)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+
+	soa := records[0].(*dns.SOA)
+	return &SOARecord{
+		Zone:    strings.ToLower(RemoveLastDot(soa.Hdr.Name)),
+		NS:      strings.ToLower(RemoveLastDot(soa.Ns)),
+		Mbox:    strings.ToLower(RemoveLastDot(soa.Mbox)),
+		Serial:  soa.Serial,
+		Refresh: soa.Refresh,
+		Retry:   soa.Retry,
+		Expire:  soa.Expire,
+		MinTTL:  soa.Minttl,
+	}, nil
+}
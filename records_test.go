@@ -0,0 +1,73 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func recordsHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	name := req.Question[0].Name
+	hdr := dns.RR_Header{Name: name, Rrtype: req.Question[0].Qtype, Class: dns.ClassINET, Ttl: 300}
+	switch req.Question[0].Qtype {
+	case dns.TypeMX:
+		m.Answer = append(m.Answer,
+			&dns.MX{Hdr: hdr, Preference: 20, Mx: "MX2.records.net."},
+			&dns.MX{Hdr: hdr, Preference: 10, Mx: "mx1.records.net."},
+		)
+	case dns.TypeSRV:
+		m.Answer = append(m.Answer, &dns.SRV{Hdr: hdr, Priority: 1, Weight: 5, Port: 5060, Target: "sip.records.net."})
+	case dns.TypeTXT:
+		m.Answer = append(m.Answer, &dns.TXT{Hdr: hdr, Txt: []string{"v=spf1 ", "-all"}})
+	case dns.TypeCAA:
+		m.Answer = append(m.Answer, &dns.CAA{Hdr: hdr, Tag: "issue", Value: "letsencrypt.org"})
+	case dns.TypeNAPTR:
+		m.Answer = append(m.Answer,
+			&dns.NAPTR{Hdr: hdr, Order: 100, Preference: 20, Flags: "s", Service: "SIP+D2U", Replacement: "_sip._udp.records.net."},
+			&dns.NAPTR{Hdr: hdr, Order: 100, Preference: 10, Flags: "s", Service: "SIP+D2T", Replacement: "_sip._tcp.records.net."},
+		)
+	case dns.TypeSOA:
+		m.Answer = append(m.Answer, &dns.SOA{Hdr: hdr, Ns: "ns.records.net.", Mbox: "admin.records.net.", Serial: 2021})
+	}
+	_ = w.WriteMsg(m)
+}
+
+func TestTypedLookups(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(recordsHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+	ctx := context.TODO()
+
+	if mxs, err := LookupMX(ctx, r, "records.net"); err != nil || len(mxs) != 2 ||
+		mxs[0] != (MXRecord{Host: "mx1.records.net", Pref: 10}) || mxs[1].Host != "mx2.records.net" {
+		t.Errorf("LookupMX returned %v: %v", mxs, err)
+	}
+	if srvs, err := LookupSRV(ctx, r, "_sip._udp.records.net"); err != nil || len(srvs) != 1 ||
+		srvs[0] != (SRVRecord{Target: "sip.records.net", Port: 5060, Priority: 1, Weight: 5}) {
+		t.Errorf("LookupSRV returned %v: %v", srvs, err)
+	}
+	if txts, err := LookupTXT(ctx, r, "records.net"); err != nil || len(txts) != 1 || txts[0] != "v=spf1 -all" {
+		t.Errorf("LookupTXT returned %v: %v", txts, err)
+	}
+	if caas, err := LookupCAA(ctx, r, "records.net"); err != nil || len(caas) != 1 || caas[0].Value != "letsencrypt.org" {
+		t.Errorf("LookupCAA returned %v: %v", caas, err)
+	}
+	if naptrs, err := LookupNAPTR(ctx, r, "records.net"); err != nil || len(naptrs) != 2 || naptrs[0].Service != "SIP+D2T" {
+		t.Errorf("LookupNAPTR returned %v: %v", naptrs, err)
+	}
+	if soa, err := LookupSOA(ctx, r, "records.net"); err != nil || soa == nil || soa.NS != "ns.records.net" || soa.Serial != 2021 {
+		t.Errorf("LookupSOA returned %v: %v", soa, err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// The number of goroutines and queued refreshes used by the refresh-ahead scheduler.
+const (
+	refreshWorkers   = 4
+	refreshQueueSize = 1000
+)
+
+// refreshScheduler re-resolves the cached responses still being requested as their TTLs near expiry.
+type refreshScheduler struct {
+	sync.Mutex
+	fraction float64
+	pending  map[string]struct{}
+	jobs     chan *refreshJob
+}
+
+type refreshJob struct {
+	key string
+	msg *dns.Msg
+}
+
+// SetRefreshAhead causes cached responses requested during the final fraction of their TTL,
+// such as 0.1 for the last tenth, to be resolved again in the background before they expire,
+// so frequently requested names are not missing from the cache. Zero or less disables refreshing.
+// The refreshes are only performed while a cache has been provided to SetCache.
+func (rp *ResolverPool) SetRefreshAhead(fraction float64) {
+	defer rp.configChanged("refresh_ahead", "fraction", fraction)
+	rp.Lock()
+	defer rp.Unlock()
+
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	if rp.refresher != nil {
+		rp.refresher.Lock()
+		rp.refresher.fraction = fraction
+		rp.refresher.Unlock()
+		return
+	}
+	if fraction == 0 {
+		return
+	}
+
+	rp.refresher = &refreshScheduler{
+		fraction: fraction,
+		pending:  make(map[string]struct{}),
+		jobs:     make(chan *refreshJob, refreshQueueSize),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-rp.done
+		cancel()
+	}()
+	for i := 0; i < refreshWorkers; i++ {
+		go rp.refreshWorker(ctx, rp.refresher)
+	}
+}
+
+// refreshAhead schedules a refresh of the cached response when little of its TTL remains.
+func (rp *ResolverPool) refreshAhead(key string, msg *dns.Msg, left float64) {
+	rp.Lock()
+	rs := rp.refresher
+	rp.Unlock()
+
+	if rs == nil {
+		return
+	}
+
+	rs.Lock()
+	defer rs.Unlock()
+
+	if left >= rs.fraction {
+		return
+	}
+	if _, found := rs.pending[key]; found {
+		return
+	}
+
+	job := &refreshJob{key: key, msg: msg.Copy()}
+	select {
+	case rs.jobs <- job:
+		rs.pending[key] = struct{}{}
+	default:
+		// Refreshes are skipped while the scheduler is behind
+	}
+}
+
+func (rp *ResolverPool) refreshWorker(ctx context.Context, rs *refreshScheduler) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-rs.jobs:
+			resp, err := rp.wireQuery(ctx, job.msg, PriorityLow, nil)
+			if rp.bailiwickFiltering() {
+				FilterBailiwick(resp)
+			}
+
+			rp.Lock()
+			cache := rp.cache
+			rp.Unlock()
+			if err == nil && cache != nil {
+				cache.set(job.key, resp)
+			}
+
+			rs.Lock()
+			delete(rs.pending, job.key)
+			rs.Unlock()
+		}
+	}
+}
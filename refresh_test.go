@@ -0,0 +1,62 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	var count int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", ttlHandler(&count))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetCache(NewMemoryCache(10))
+	pool.SetRefreshAhead(0.9)
+
+	msg := QueryMsg("ttl2.refresh.cache.net", dns.TypeA)
+	if _, err := pool.Query(context.TODO(), msg, PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+
+	// The response is requested once most of the TTL has elapsed
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := pool.Query(context.TODO(), msg, PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := atomic.LoadInt32(&count); n != 2 {
+		t.Fatalf("%d queries were sent instead of 2 for the refreshed response", n)
+	}
+
+	// The refreshed response remains cached after the original TTL expired
+	time.Sleep(time.Second)
+	key, _ := flightKey(context.TODO(), msg)
+	if resp, _ := pool.cache.get(key, msg); resp == nil {
+		t.Errorf("The refreshed response was not found in the cache")
+	}
+}
+
+func TestRefreshAheadDisabled(t *testing.T) {
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.2:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetRefreshAhead(0.5)
+	pool.SetRefreshAhead(0)
+
+	pool.refreshAhead("key", QueryMsg("disabled.net", dns.TypeA), 0.1)
+	if len(pool.refresher.jobs) != 0 {
+		t.Errorf("A refresh was scheduled after refreshing was disabled")
+	}
+}
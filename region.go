@@ -0,0 +1,104 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Region describes where a resolver is located on the Internet.
+// A zero value for a field matches any resolver.
+type Region struct {
+	// Country is the ISO 3166-1 alpha-2 country code.
+	Country string
+	ASN     int
+}
+
+func (r Region) matches(tags Region) bool {
+	if r.Country != "" && !strings.EqualFold(r.Country, tags.Country) {
+		return false
+	}
+	if r.ASN != 0 && r.ASN != tags.ASN {
+		return false
+	}
+	return true
+}
+
+type regionKey struct{}
+
+// WithRegion returns a context that restricts queries sent through a ResolverPool
+// to the resolvers tagged with a matching Region.
+func WithRegion(ctx context.Context, region Region) context.Context {
+	return context.WithValue(ctx, regionKey{}, region)
+}
+
+func regionFromContext(ctx context.Context) (Region, bool) {
+	region, ok := ctx.Value(regionKey{}).(Region)
+	if ok && region.Country == "" && region.ASN == 0 {
+		return region, false
+	}
+	return region, ok
+}
+
+// TagResolver assigns the provided Region to the resolver at the provided address.
+// The tag also applies to any resolver later added to the pool for the same address.
+func (rp *ResolverPool) TagResolver(addr string, region Region) {
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.regions[addr] = region
+}
+
+// ResolverRegion returns the Region assigned to the resolver at the provided address.
+func (rp *ResolverPool) ResolverRegion(addr string) (Region, bool) {
+	rp.Lock()
+	defer rp.Unlock()
+
+	region, found := rp.regions[addr]
+	return region, found
+}
+
+// nextRegionResolver selects among the usable resolvers tagged with a Region matching the request.
+func (rp *ResolverPool) nextRegionResolver(region Region) Resolver {
+	rp.Lock()
+	defer rp.Unlock()
+
+	matches := rp.usableResolvers(region)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	rp.regionIdx = (rp.regionIdx + 1) % len(matches)
+	r := matches[rp.regionIdx]
+	rp.outstanding[r.String()]++
+	return r
+}
+
+// usableResolvers returns the resolvers that are neither stopped, paused nor excluded, restricted to the
+// resolvers tagged with a matching Region unless the zero value is provided.
+// The pool lock must already be held by the caller.
+func (rp *ResolverPool) usableResolvers(region Region) []Resolver {
+	var usable []Resolver
+
+	now := time.Now()
+	regional := region != Region{}
+	for _, partition := range rp.partitions {
+		for _, r := range partition {
+			k := r.String()
+			if r.Stopped() || rp.excluded(k) {
+				continue
+			}
+			if t, found := rp.waits[k]; found && !t.IsZero() && now.Before(t) {
+				continue
+			}
+			if tags, found := rp.regions[k]; regional && (!found || !region.matches(tags)) {
+				continue
+			}
+			usable = append(usable, r)
+		}
+	}
+	return usable
+}
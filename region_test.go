@@ -0,0 +1,59 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestRegionSelection(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	de := NewBaseResolver(addrstr, 100, nil)
+	us := NewBaseResolver("127.0.0.2:53", 100, nil)
+	pool := NewResolverPool([]Resolver{us, de}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.TagResolver(de.String(), Region{Country: "DE", ASN: 3320})
+	pool.TagResolver(us.String(), Region{Country: "US", ASN: 15169})
+
+	if region, found := pool.ResolverRegion(de.String()); !found || region.ASN != 3320 {
+		t.Errorf("The resolver region was not returned")
+	}
+
+	ctx := WithRegion(context.Background(), Region{Country: "de"})
+	for i := 0; i < 5; i++ {
+		r := pool.nextResolver(ctx)
+		pool.releaseResolver(r)
+
+		if r != de {
+			t.Errorf("The pool selected a resolver outside of the requested region")
+			break
+		}
+	}
+
+	if r := pool.nextResolver(WithRegion(context.Background(), Region{ASN: 15169})); r != us {
+		t.Errorf("The pool did not select the resolver in the requested ASN")
+	} else {
+		pool.releaseResolver(r)
+	}
+
+	if _, err := pool.Query(ctx, QueryMsg("region.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The query within the region failed: %v", err)
+	}
+
+	ctx = WithRegion(context.Background(), Region{Country: "FR"})
+	_, err = pool.Query(ctx, QueryMsg("region.net", dns.TypeA), PriorityNormal, nil)
+	if reason := ErrorReason(err); reason != ReasonNoResolvers {
+		t.Errorf("The query in an empty region returned reason %s instead of %s", reason, ReasonNoResolvers)
+	}
+}
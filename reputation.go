@@ -0,0 +1,181 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Weight given to the newest observation in the moving averages
+	reputationAlpha float64 = 0.1
+	// Resolvers need this many observations before their score affects selection
+	minReputationSamples int = 20
+	// Resolvers scoring below this value are avoided while better resolvers are available
+	minReputationScore float64 = 0.25
+	// Each hijack signal multiplies the score by this factor
+	hijackPenalty float64 = 0.5
+)
+
+// ResolverReputation describes the reputation of a single resolver in the pool.
+type ResolverReputation struct {
+	Address string
+	// Score is between 0 and 1, with higher values representing better resolvers.
+	Score float64
+	// Samples is the number of queries observed for the resolver.
+	Samples       int
+	AvgRTT        time.Duration
+	TimeoutRate   float64
+	MismatchRate  float64
+	HijackSignals int
+}
+
+type reputationEntry struct {
+	samples  int
+	rtt      float64
+	timeouts float64
+	mismatch float64
+	hijacks  int
+}
+
+type reputationTracker struct {
+	sync.Mutex
+	entries map[string]*reputationEntry
+	// The response times are compared against the query timeout of the pool
+	config resolverConfig
+}
+
+func newReputationTracker() *reputationTracker {
+	return &reputationTracker{entries: make(map[string]*reputationEntry)}
+}
+
+func ewma(avg, value float64, first bool) float64 {
+	if first {
+		return value
+	}
+	return avg + reputationAlpha*(value-avg)
+}
+
+func (rt *reputationTracker) setConfig(c resolverConfig) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	rt.config = c
+}
+
+func (rt *reputationTracker) queryTimeout() time.Duration {
+	_, max := rt.config.timeouts()
+	return max
+}
+
+func (rt *reputationTracker) entry(addr string) *reputationEntry {
+	e, found := rt.entries[addr]
+	if !found {
+		e = new(reputationEntry)
+		rt.entries[addr] = e
+	}
+	return e
+}
+
+// observe records the outcome of a query sent to the resolver at the provided address.
+func (rt *reputationTracker) observe(addr string, rtt time.Duration, timeout bool) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	e := rt.entry(addr)
+	first := e.samples == 0
+	e.samples++
+
+	var t float64
+	if timeout {
+		t = 1
+		rtt = rt.queryTimeout()
+	}
+	e.timeouts = ewma(e.timeouts, t, first)
+	e.rtt = ewma(e.rtt, float64(rtt), first)
+}
+
+// consistency records whether an answer from the resolver was confirmed by the trusted resolvers.
+func (rt *reputationTracker) consistency(addr string, confirmed bool) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	var m float64
+	if !confirmed {
+		m = 1
+	}
+
+	e := rt.entry(addr)
+	e.mismatch = e.mismatch + reputationAlpha*(m-e.mismatch)
+}
+
+func (rt *reputationTracker) hijack(addr string) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	rt.entry(addr).hijacks++
+}
+
+func (rt *reputationTracker) remove(addr string) {
+	rt.Lock()
+	defer rt.Unlock()
+
+	delete(rt.entries, addr)
+}
+
+func (e *reputationEntry) score(timeout time.Duration) float64 {
+	// Responses as slow as the query timeout cost half of the score
+	latency := 1 - 0.5*math.Min(e.rtt/float64(timeout), 1)
+
+	return latency * (1 - e.timeouts) * (1 - e.mismatch) * math.Pow(hijackPenalty, float64(e.hijacks))
+}
+
+// poor returns true when enough has been observed to know the resolver performs badly.
+func (rt *reputationTracker) poor(addr string) bool {
+	rt.Lock()
+	defer rt.Unlock()
+
+	e, found := rt.entries[addr]
+	if !found || (e.samples < minReputationSamples && e.hijacks == 0) {
+		return false
+	}
+	return e.score(rt.queryTimeout()) < minReputationScore
+}
+
+func (rt *reputationTracker) reputation(addr string) ResolverReputation {
+	rt.Lock()
+	defer rt.Unlock()
+
+	rep := ResolverReputation{
+		Address: addr,
+		Score:   1,
+	}
+	if e, found := rt.entries[addr]; found {
+		rep.Score = e.score(rt.queryTimeout())
+		rep.Samples = e.samples
+		rep.AvgRTT = time.Duration(e.rtt)
+		rep.TimeoutRate = e.timeouts
+		rep.MismatchRate = e.mismatch
+		rep.HijackSignals = e.hijacks
+	}
+	return rep
+}
+
+// Reputations returns the current reputation of each resolver in the pool.
+// Resolvers that have not been used yet receive the maximum score.
+func (rp *ResolverPool) Reputations() []ResolverReputation {
+	var reps []ResolverReputation
+
+	for _, addr := range rp.resolverAddrs() {
+		reps = append(reps, rp.rep.reputation(addr))
+	}
+	return reps
+}
+
+// ResolverScore returns the reputation score, between 0 and 1, of the resolver at the provided address.
+func (rp *ResolverPool) ResolverScore(addr string) float64 {
+	return rp.rep.reputation(addr).Score
+}
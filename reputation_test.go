@@ -0,0 +1,87 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReputationTracker(t *testing.T) {
+	rt := newReputationTracker()
+
+	if rep := rt.reputation("fast"); rep.Score != 1 {
+		t.Errorf("An unused resolver received a score of %.2f instead of 1", rep.Score)
+	}
+
+	for i := 0; i < minReputationSamples; i++ {
+		rt.observe("fast", 10*time.Millisecond, false)
+		rt.observe("slow", QueryTimeout/2, false)
+		rt.observe("broken", 0, true)
+	}
+
+	fast := rt.reputation("fast").Score
+	slow := rt.reputation("slow").Score
+	if fast <= slow {
+		t.Errorf("The fast resolver scored %.2f, which is not higher than the slow resolver score of %.2f", fast, slow)
+	}
+	if rt.poor("fast") || rt.poor("slow") {
+		t.Errorf("A responsive resolver was considered poor")
+	}
+	if !rt.poor("broken") {
+		t.Errorf("A resolver that always timed out was not considered poor")
+	}
+
+	rt.consistency("fast", false)
+	if s := rt.reputation("fast").Score; s >= fast {
+		t.Errorf("An inconsistent answer did not reduce the score")
+	}
+
+	rt.hijack("slow")
+	rt.hijack("slow")
+	if !rt.poor("slow") {
+		t.Errorf("A resolver with hijack signals was not considered poor")
+	}
+
+	rt.remove("slow")
+	if rep := rt.reputation("slow"); rep.Samples != 0 || rep.HijackSignals != 0 {
+		t.Errorf("The reputation was not removed")
+	}
+}
+
+func TestPoolAvoidsPoorResolvers(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPServer(":0")
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	good := NewBaseResolver(addrstr, 100, nil)
+	bad := NewBaseResolver("127.0.0.2:53", 100, nil)
+	pool := NewResolverPool([]Resolver{bad, good}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	for i := 0; i < minReputationSamples; i++ {
+		pool.rep.observe(bad.String(), 0, true)
+	}
+
+	for i := 0; i < 10; i++ {
+		r := pool.nextResolver(context.TODO())
+		pool.releaseResolver(r)
+
+		if r != good {
+			t.Errorf("The pool selected the resolver with a poor reputation")
+			break
+		}
+	}
+
+	reps := pool.Reputations()
+	if len(reps) != 2 {
+		t.Fatalf("Reputations returned %d entries instead of 2", len(reps))
+	}
+	if score := pool.ResolverScore(bad.String()); score >= minReputationScore {
+		t.Errorf("The poor resolver received a score of %.2f", score)
+	}
+}
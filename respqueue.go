@@ -0,0 +1,105 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import "sync"
+
+// The number of responses each resolver holds while waiting to be processed, when the pool does not set
+// PoolConfig.ResponseQueueSize. When the responses arrive faster than they are processed, the oldest
+// response waiting is dropped to make room for the newest, and the query it answered fails with a
+// timeout so it can be retried.
+const defaultResponseQueueSize = 4096
+
+// DropQueueOverflow counts the responses discarded since the response queue was full.
+const DropQueueOverflow DropReason = "queue_overflow"
+
+// responseQueue is a bounded queue of the responses read from a connection, written by a single goroutine.
+// The size can be changed while the queue is in use, which drops the oldest responses beyond the new size.
+type responseQueue struct {
+	sync.Mutex
+	msgs  []*readMsg
+	size  int
+	ready chan struct{}
+}
+
+func newResponseQueue(size int) *responseQueue {
+	if size < 1 {
+		size = 1
+	}
+	return &responseQueue{size: size, ready: make(chan struct{}, 1)}
+}
+
+// Append adds the response to the queue and returns the oldest response when it was dropped to make room.
+func (q *responseQueue) Append(read *readMsg) *readMsg {
+	var dropped *readMsg
+
+	q.Lock()
+	if len(q.msgs) >= q.size {
+		dropped = q.pop()
+	}
+	q.msgs = append(q.msgs, read)
+	q.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// Ready returns the channel that signals when responses have been added to the queue.
+func (q *responseQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Drain executes the function for each response in the queue, in the order received.
+func (q *responseQueue) Drain(f func(*readMsg)) {
+	for {
+		q.Lock()
+		read := q.pop()
+		q.Unlock()
+
+		if read == nil {
+			return
+		}
+		f(read)
+	}
+}
+
+// setSize changes the number of responses held, and returns the oldest responses dropped to respect it.
+func (q *responseQueue) setSize(size int) []*readMsg {
+	if size < 1 {
+		size = 1
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	q.size = size
+	var dropped []*readMsg
+	for len(q.msgs) > q.size {
+		dropped = append(dropped, q.pop())
+	}
+	return dropped
+}
+
+// pop removes the oldest response from the queue. The lock must already be held by the caller.
+func (q *responseQueue) pop() *readMsg {
+	if len(q.msgs) == 0 {
+		return nil
+	}
+
+	read := q.msgs[0]
+	q.msgs[0] = nil
+	q.msgs = q.msgs[1:]
+	return read
+}
+
+// Len returns the current depth of the queue.
+func (q *responseQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+
+	return len(q.msgs)
+}
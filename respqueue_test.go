@@ -0,0 +1,93 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestResponseQueueDropOldest(t *testing.T) {
+	q := newResponseQueue(2)
+
+	reads := []*readMsg{{}, {}, {}}
+	for _, read := range reads[:2] {
+		if dropped := q.Append(read); dropped != nil {
+			t.Errorf("A response was dropped before the queue was full")
+		}
+	}
+	if dropped := q.Append(reads[2]); dropped != reads[0] {
+		t.Errorf("The oldest response was not dropped when the queue was full")
+	}
+	if n := q.Len(); n != 2 {
+		t.Errorf("The queue had the depth %d instead of 2", n)
+	}
+
+	var drained []*readMsg
+	q.Drain(func(read *readMsg) { drained = append(drained, read) })
+	if len(drained) != 2 || drained[0] != reads[1] || drained[1] != reads[2] {
+		t.Errorf("The responses were not drained in the order received")
+	}
+	if n := q.Len(); n != 0 {
+		t.Errorf("%d responses remained after draining the queue", n)
+	}
+}
+
+func TestResponseQueueSetSize(t *testing.T) {
+	q := newResponseQueue(4)
+
+	reads := []*readMsg{{}, {}, {}, {}}
+	for _, read := range reads {
+		q.Append(read)
+	}
+	if dropped := q.setSize(2); len(dropped) != 2 || dropped[0] != reads[0] || dropped[1] != reads[1] {
+		t.Errorf("The oldest responses were not dropped when the queue was reduced")
+	}
+	if dropped := q.Append(&readMsg{}); dropped != reads[2] {
+		t.Errorf("The reduced size was not respected by the queue")
+	}
+	select {
+	case <-q.Ready():
+	default:
+		t.Errorf("The queue did not signal the responses added")
+	}
+}
+
+func TestPoolResponseQueueSize(t *testing.T) {
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	q := r.(*baseResolver).readMsgs
+	pool.SetConfig(PoolConfig{ResponseQueueSize: 10})
+	q.Lock()
+	size := q.size
+	q.Unlock()
+	if size != 10 {
+		t.Errorf("The response queue held %d responses instead of the size set for the pool", size)
+	}
+}
+
+func TestDropResponse(t *testing.T) {
+	r := NewBaseResolver("127.0.0.1:53", 10, nil)
+	defer r.Stop()
+
+	base := r.(*baseResolver)
+	req := base.newRequest(context.TODO(), QueryMsg("dropped.queue.net", dns.TypeA))
+	req.Result = make(chan *resolveResult, 1)
+	resp := new(dns.Msg)
+	resp.SetReply(req.Msg)
+
+	base.dropResponse(&readMsg{Req: req, Resp: resp})
+	res := <-req.Result
+	if res.Msg != nil || !res.Again || ErrorReason(res.Err) != ReasonAttemptTimeout {
+		t.Errorf("The query answered by the dropped response did not fail with a timeout")
+	}
+	if n := base.responseCounts().Drops[DropQueueOverflow]; n != 1 {
+		t.Errorf("The dropped response was counted %d times", n)
+	}
+}
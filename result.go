@@ -0,0 +1,96 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The transports reported in a Result.
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+)
+
+// Result contains the outcome of a query along with information on how it was obtained.
+type Result struct {
+	Msg *dns.Msg
+	Err error
+	// Resolver is the address of the resolver that provided the final response.
+	Resolver string
+	// RTT is the round-trip time of the final attempt.
+	RTT time.Duration
+	// Attempts is the number of times the query was sent.
+	Attempts  int
+	Transport string
+	// Validation is the DNSSEC validation status of the response when validation was requested.
+	Validation ValidationStatus
+	// NSID is the identifier returned by the server when it was requested.
+	NSID string
+	// Negative describes the response when it is NXDOMAIN or NODATA.
+	Negative *NegativeResult
+	// Stale indicates that the response was served from the cache after it expired.
+	Stale bool
+}
+
+type resultKey struct{}
+
+// resultInfo collects the Result metadata while the query is performed.
+type resultInfo struct {
+	sync.Mutex
+	Result
+}
+
+func resultInfoFromContext(ctx context.Context) *resultInfo {
+	info, _ := ctx.Value(resultKey{}).(*resultInfo)
+	return info
+}
+
+// attempt records the final attempt made by a Resolver.
+func (i *resultInfo) attempt(addr string, rtt time.Duration, attempts int, transport string) {
+	if i == nil {
+		return
+	}
+
+	i.Lock()
+	defer i.Unlock()
+
+	i.Resolver = addr
+	i.RTT = rtt
+	i.Attempts = attempts
+	i.Transport = transport
+}
+
+// setAttempts replaces the number of attempts counted by the Resolver that provided the response.
+func (i *resultInfo) setAttempts(attempts int) {
+	if i == nil {
+		return
+	}
+
+	i.Lock()
+	defer i.Unlock()
+
+	i.Attempts = attempts
+}
+
+// QueryResult performs the query using the Resolver and returns the response with its metadata.
+func QueryResult(ctx context.Context, r Resolver, msg *dns.Msg, priority int, retry Retry) *Result {
+	info := new(resultInfo)
+
+	resp, err := r.Query(context.WithValue(ctx, resultKey{}, info), msg, priority, retry)
+
+	info.Lock()
+	defer info.Unlock()
+
+	res := info.Result
+	res.Msg = resp
+	res.Err = err
+	res.Negative, _ = NegativeResponse(resp)
+	res.Stale = StaleResponse(resp)
+	return &res
+}
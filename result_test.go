@@ -0,0 +1,40 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestQueryResult(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	good := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{good}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	res := QueryResult(context.TODO(), pool, QueryMsg("result.net", dns.TypeA), PriorityNormal, nil)
+	if res.Err != nil || res.Msg == nil {
+		t.Fatalf("The query failed: %v", res.Err)
+	}
+	if res.Resolver != good.String() {
+		t.Errorf("The result named %s instead of %s as the resolver", res.Resolver, good.String())
+	}
+	if res.Attempts != 1 || res.RTT <= 0 || res.Transport != TransportUDP {
+		t.Errorf("The result contained unexpected metadata: %+v", res)
+	}
+
+	res = LookupResult(context.TODO(), good, "result.net")
+	if res.Err != nil || res.Resolver != good.String() || res.Attempts != 1 {
+		t.Errorf("The lookup result contained unexpected metadata: %+v", res)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Sweep ranges larger than this number of addresses are rejected.
+const maxSweepRange = 1 << 16
+
+// The number of addresses in each block paced by SweepPTR.
+const sweepBlockSize = 256
+
+// The maximum number of blocks swept at the same time.
+const maxSweepBlocks = 64
+
+// PTRRecord contains the hostnames found in the PTR records for an IP address.
+type PTRRecord struct {
+	Addr      string
+	Hostnames []string
+}
+
+// LookupPTR returns the hostnames in the PTR records for the provided IP address.
+func LookupPTR(ctx context.Context, r Resolver, addr string) ([]string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("LookupPTR: %s is not a valid IP address", addr)
+	}
+
+	resp, err := r.Query(ctx, ReverseMsg(ip.String()), PriorityNormal, RetryPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, ptr := range AnswersByType(ExtractAnswers(resp), dns.TypePTR) {
+		names = append(names, RemoveLastDot(ptr.Data))
+	}
+	return names, nil
+}
+
+// SweepPTR performs a PTR query for each address in the CIDR range, and sends the addresses
+// with hostnames found on the returned channel. Queries into each /24 block are paced using the
+// SweepPTRRate of the ResolverPool, or ten each second for other resolvers. The channel is closed
+// once the sweep is complete or the context expires.
+func SweepPTR(ctx context.Context, r Resolver, cidr string) (<-chan *PTRRecord, error) {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("SweepPTR: %s is not a valid range: %v", cidr, err)
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	if bits-ones > 16 {
+		return nil, fmt.Errorf("SweepPTR: The range %s exceeds %d addresses", cidr, maxSweepRange)
+	}
+
+	var blocks [][]net.IP
+	var block []net.IP
+	for cur := ip.Mask(ipnet.Mask); ipnet.Contains(cur); cur = nextIP(cur) {
+		block = append(block, cur)
+		if len(block) == sweepBlockSize {
+			blocks = append(blocks, block)
+			block = nil
+		}
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+
+	rate := defaultSweepPTRRate
+	if rp, ok := r.(*ResolverPool); ok {
+		rate = rp.sweepPTRRate()
+	}
+
+	records := make(chan *PTRRecord, sweepBlockSize)
+	go func() {
+		defer close(records)
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, maxSweepBlocks)
+	loop:
+		for _, b := range blocks {
+			select {
+			case <-ctx.Done():
+				break loop
+			case sem <- struct{}{}:
+			}
+
+			wg.Add(1)
+			go func(addrs []net.IP) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				sweepBlock(ctx, r, addrs, rate, records)
+			}(b)
+		}
+		wg.Wait()
+	}()
+	return records, nil
+}
+
+func sweepBlock(ctx context.Context, r Resolver, addrs []net.IP, rate int, records chan<- *PTRRecord) {
+	t := time.NewTicker(time.Second / time.Duration(rate))
+	defer t.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, ip := range addrs {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+
+			names, err := LookupPTR(ctx, r, addr)
+			if err != nil || len(names) == 0 {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+			case records <- &PTRRecord{Addr: addr, Hostnames: names}:
+			}
+		}(ip.String())
+	}
+}
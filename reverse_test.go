@@ -0,0 +1,68 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestLookupPTR(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(fcrdnsHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	names, err := LookupPTR(context.TODO(), r, "192.168.1.1")
+	if err != nil || len(names) != 1 || names[0] != "host.caffix.net" {
+		t.Errorf("LookupPTR returned %v: %v", names, err)
+	}
+	if _, err := LookupPTR(context.TODO(), r, "192.168.1.3"); err == nil {
+		t.Errorf("LookupPTR did not fail for an address without PTR records")
+	}
+	if _, err := LookupPTR(context.TODO(), r, "caffix.net"); err == nil {
+		t.Errorf("No error was returned for an invalid IP address")
+	}
+}
+
+func TestSweepPTR(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(fcrdnsHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer r.Stop()
+	r.SetConfig(PoolConfig{SweepPTRRate: 100})
+
+	start := time.Now()
+	records, err := SweepPTR(context.TODO(), r, "192.168.1.0/29")
+	if err != nil {
+		t.Fatalf("SweepPTR failed: %v", err)
+	}
+
+	found := make(map[string]string)
+	for rec := range records {
+		found[rec.Addr] = rec.Hostnames[0]
+	}
+	if len(found) != 2 || found["192.168.1.1"] != "host.caffix.net" || found["192.168.1.2"] != "poser.caffix.net" {
+		t.Errorf("SweepPTR returned %v", found)
+	}
+	// Eight queries at the default rate would take most of a second
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("The sweep took %v using the rate of the pool", d)
+	}
+
+	if _, err := SweepPTR(context.TODO(), r, "10.0.0.0/8"); err == nil {
+		t.Errorf("A range exceeding the maximum size was accepted")
+	}
+}
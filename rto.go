@@ -0,0 +1,102 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"sync"
+	"time"
+)
+
+// The lower bound of the timeout derived for the queries sent to each resolver, when the pool does not set
+// PoolConfig.MinQueryTimeout. The timeouts adapt to the round-trip times measured for the resolver.
+const defaultMinQueryTimeout = 250 * time.Millisecond
+
+// How often the requests are checked for expiration, which bounds how late a timeout is detected.
+const timeoutSweepInterval = 100 * time.Millisecond
+
+// The gains and variance multiplier used to compute the retransmission timeout, as in RFC 6298.
+const (
+	rttAlpha    float64 = 0.125
+	rttBeta     float64 = 0.25
+	rttVarScale         = 4
+)
+
+// rttEstimator tracks the smoothed round-trip time and its variance for a resolver,
+// and derives the timeout for the next query sent to the resolver.
+type rttEstimator struct {
+	sync.Mutex
+	srtt    time.Duration
+	rttvar  time.Duration
+	sampled bool
+	// The number of times the timeout has been doubled since the last response
+	backoffs uint
+}
+
+func newRTTEstimator() *rttEstimator {
+	return new(rttEstimator)
+}
+
+// observe updates the estimates using the round-trip time measured for a response.
+func (e *rttEstimator) observe(rtt time.Duration) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.backoffs = 0
+	if !e.sampled {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+		e.sampled = true
+		return
+	}
+
+	delta := e.srtt - rtt
+	if delta < 0 {
+		delta = -delta
+	}
+	e.rttvar = time.Duration((1-rttBeta)*float64(e.rttvar) + rttBeta*float64(delta))
+	e.srtt = time.Duration((1-rttAlpha)*float64(e.srtt) + rttAlpha*float64(rtt))
+}
+
+// backoff doubles the timeout after a query to the resolver timed out, until the next response
+// or the timeout reaches the upper bound.
+func (e *rttEstimator) backoff(max time.Duration) {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.sampled && e.rto()<<e.backoffs < max {
+		e.backoffs++
+	}
+}
+
+// timeout returns the time allowed for the next query sent to the resolver, within the bounds provided.
+func (e *rttEstimator) timeout(min, max time.Duration) time.Duration {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.sampled {
+		return max
+	}
+
+	t := e.rto() << e.backoffs
+	if t < min {
+		t = min
+	}
+	if t > max {
+		t = max
+	}
+	return t
+}
+
+// smoothed returns the smoothed round-trip time measured for the resolver.
+func (e *rttEstimator) smoothed() time.Duration {
+	e.Lock()
+	defer e.Unlock()
+
+	return e.srtt
+}
+
+// rto returns the retransmission timeout without the backoff. The lock must already be held by the caller.
+func (e *rttEstimator) rto() time.Duration {
+	return e.srtt + rttVarScale*e.rttvar
+}
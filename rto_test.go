@@ -0,0 +1,61 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	e := newRTTEstimator()
+	if to := e.timeout(defaultMinQueryTimeout, QueryTimeout); to != QueryTimeout {
+		t.Errorf("The timeout before any samples was %v instead of QueryTimeout", to)
+	}
+
+	e.observe(100 * time.Millisecond)
+	// The first sample sets the variance to half the round-trip time
+	if to := e.timeout(defaultMinQueryTimeout, QueryTimeout); to != 300*time.Millisecond {
+		t.Errorf("The timeout after the first sample was %v instead of 300ms", to)
+	}
+
+	for i := 0; i < 50; i++ {
+		e.observe(20 * time.Millisecond)
+	}
+	if srtt := e.smoothed(); srtt > 25*time.Millisecond {
+		t.Errorf("The smoothed round-trip time %v did not converge on the samples", srtt)
+	}
+	if to := e.timeout(defaultMinQueryTimeout, QueryTimeout); to != defaultMinQueryTimeout {
+		t.Errorf("The timeout for a fast resolver was %v instead of MinQueryTimeout", to)
+	}
+
+	slow := newRTTEstimator()
+	for i := 0; i < 10; i++ {
+		slow.observe(time.Second)
+	}
+	if to := slow.timeout(defaultMinQueryTimeout, QueryTimeout); to < time.Second || to > QueryTimeout {
+		t.Errorf("The timeout for a slow resolver was %v", to)
+	}
+}
+
+func TestRTTEstimatorBackoff(t *testing.T) {
+	e := newRTTEstimator()
+	e.observe(100 * time.Millisecond)
+
+	e.backoff(QueryTimeout)
+	if to := e.timeout(defaultMinQueryTimeout, QueryTimeout); to != 600*time.Millisecond {
+		t.Errorf("The timeout after a backoff was %v instead of 600ms", to)
+	}
+	for i := 0; i < 10; i++ {
+		e.backoff(QueryTimeout)
+	}
+	if to := e.timeout(defaultMinQueryTimeout, QueryTimeout); to != QueryTimeout {
+		t.Errorf("The timeout after repeated backoffs was %v instead of QueryTimeout", to)
+	}
+
+	e.observe(100 * time.Millisecond)
+	if to := e.timeout(defaultMinQueryTimeout, QueryTimeout); to >= 600*time.Millisecond {
+		t.Errorf("The backoff was not reset by the response: %v", to)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Candidate is a usable resolver offered to a Selector.
+type Candidate struct {
+	Resolver Resolver
+	// Outstanding is the number of queries currently sent through the pool to the resolver.
+	Outstanding int
+}
+
+// Selector chooses the resolver for the next query sent through a ResolverPool.
+// Select is always provided at least one candidate.
+type Selector interface {
+	Select(candidates []Candidate) Resolver
+}
+
+type roundRobinSelector struct {
+	sync.Mutex
+	next int
+}
+
+// NewRoundRobinSelector returns a Selector that uses the candidates in turn.
+func NewRoundRobinSelector() Selector {
+	return new(roundRobinSelector)
+}
+
+func (s *roundRobinSelector) Select(candidates []Candidate) Resolver {
+	s.Lock()
+	defer s.Unlock()
+
+	s.next = (s.next + 1) % len(candidates)
+	return candidates[s.next].Resolver
+}
+
+type randomSelector struct{}
+
+// NewRandomSelector returns a Selector that picks a candidate uniformly at random.
+func NewRandomSelector() Selector {
+	return randomSelector{}
+}
+
+func (randomSelector) Select(candidates []Candidate) Resolver {
+	return candidates[rand.Intn(len(candidates))].Resolver
+}
+
+type leastOutstandingSelector struct{}
+
+// NewLeastOutstandingSelector returns a Selector that picks the candidate with the fewest queries outstanding.
+func NewLeastOutstandingSelector() Selector {
+	return leastOutstandingSelector{}
+}
+
+func (leastOutstandingSelector) Select(candidates []Candidate) Resolver {
+	best := candidates[0]
+
+	for _, c := range candidates[1:] {
+		if c.Outstanding < best.Outstanding {
+			best = c
+		}
+	}
+	return best.Resolver
+}
+
+type powerOfTwoSelector struct{}
+
+// NewPowerOfTwoSelector returns a Selector that picks two distinct candidates at random
+// and uses the one with fewer queries outstanding.
+func NewPowerOfTwoSelector() Selector {
+	return powerOfTwoSelector{}
+}
+
+func (powerOfTwoSelector) Select(candidates []Candidate) Resolver {
+	l := len(candidates)
+	if l == 1 {
+		return candidates[0].Resolver
+	}
+
+	i := rand.Intn(l)
+	// Offset the second choice so it cannot be the same candidate
+	j := (i + 1 + rand.Intn(l-1)) % l
+	a, b := candidates[i], candidates[j]
+	if b.Outstanding < a.Outstanding {
+		return b.Resolver
+	}
+	return a.Resolver
+}
+
+// SetSelector replaces the default partitioned round-robin selection of resolvers with the
+// provided Selector. Providing nil restores the default behavior.
+func (rp *ResolverPool) SetSelector(s Selector) {
+	defer rp.configChanged("selector", "enabled", s != nil)
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.selector = s
+}
+
+// selectorResolver uses the configured Selector to choose among the usable resolvers,
+// preferring the resolvers that are neither saturated nor poorly reputed.
+func (rp *ResolverPool) selectorResolver(s Selector) Resolver {
+	rp.Lock()
+	var preferred, others []Candidate
+	for _, r := range rp.usableResolvers(Region{}) {
+		k := r.String()
+		c := Candidate{
+			Resolver:    r,
+			Outstanding: rp.outstanding[k],
+		}
+
+		if resolverSaturated(r, c.Outstanding) || rp.rep.poor(k) {
+			others = append(others, c)
+			continue
+		}
+		preferred = append(preferred, c)
+	}
+	rp.Unlock()
+
+	if len(preferred) == 0 {
+		preferred = others
+	}
+	if len(preferred) == 0 {
+		return nil
+	}
+
+	r := s.Select(preferred)
+	if r == nil {
+		return nil
+	}
+
+	rp.Lock()
+	rp.outstanding[r.String()]++
+	rp.Unlock()
+	return r
+}
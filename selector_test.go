@@ -0,0 +1,93 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testCandidates(t *testing.T) []Candidate {
+	var candidates []Candidate
+
+	for i := 1; i <= 3; i++ {
+		r := NewBaseResolver(fmt.Sprintf("127.0.0.%d:53", i), 100, nil)
+		t.Cleanup(r.Stop)
+
+		candidates = append(candidates, Candidate{
+			Resolver:    r,
+			Outstanding: 3 - i,
+		})
+	}
+	return candidates
+}
+
+func TestSelectors(t *testing.T) {
+	candidates := testCandidates(t)
+
+	rr := NewRoundRobinSelector()
+	seen := make(map[Resolver]struct{})
+	for i := 0; i < len(candidates); i++ {
+		seen[rr.Select(candidates)] = struct{}{}
+	}
+	if len(seen) != len(candidates) {
+		t.Errorf("The round-robin selector used %d of the %d candidates", len(seen), len(candidates))
+	}
+
+	if r := NewLeastOutstandingSelector().Select(candidates); r != candidates[2].Resolver {
+		t.Errorf("The least outstanding selector did not pick the idle candidate")
+	}
+
+	for _, s := range []Selector{NewRandomSelector(), NewPowerOfTwoSelector()} {
+		for i := 0; i < 10; i++ {
+			if r := s.Select(candidates); r == nil {
+				t.Errorf("The selector did not return a candidate")
+			}
+		}
+	}
+
+	p2c := NewPowerOfTwoSelector()
+	for i := 0; i < 20; i++ {
+		if r := p2c.Select(candidates); r == candidates[0].Resolver {
+			t.Errorf("The power of two choices selector picked the busiest candidate")
+			break
+		}
+	}
+}
+
+type fixedSelector struct {
+	r Resolver
+}
+
+func (s *fixedSelector) Select(candidates []Candidate) Resolver {
+	return s.r
+}
+
+func TestPoolSelector(t *testing.T) {
+	candidates := testCandidates(t)
+
+	var res []Resolver
+	for _, c := range candidates {
+		res = append(res, c.Resolver)
+	}
+
+	pool := NewResolverPool(res, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetSelector(&fixedSelector{r: res[1]})
+	for i := 0; i < 5; i++ {
+		r := pool.nextResolver(context.TODO())
+		if r != res[1] {
+			t.Errorf("The pool did not use the resolver chosen by the selector")
+		}
+		pool.releaseResolver(r)
+	}
+
+	pool.SetSelector(nil)
+	if r := pool.nextResolver(context.TODO()); r != res[0] {
+		t.Errorf("The default selection was not restored")
+	}
+}
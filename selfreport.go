@@ -0,0 +1,112 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The number of failing resolvers named in each self report.
+const selfReportTopFailing = 3
+
+type selfReportCounts struct {
+	queries  int
+	failures int
+}
+
+// selfReporter summarizes the activity of the pool since the previous report.
+type selfReporter struct {
+	last     time.Time
+	previous map[string]selfReportCounts
+}
+
+// SelfReport logs a compact summary of the throughput, success rate and top failing resolvers of
+// the pool on the provided interval until the pool is stopped, so long runs show the health of
+// the pool without external tooling. Each summary covers the queries performed since the last.
+func (rp *ResolverPool) SelfReport(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	sr := &selfReporter{
+		last:     time.Now(),
+		previous: selfReportSample(rp.Stats()),
+	}
+	go rp.periodically(interval, func() {
+		rp.logEvent(LevelInfo, "Self report", sr.report(rp.Stats(), time.Now())...)
+	})
+}
+
+func selfReportSample(stats []ResolverStats) map[string]selfReportCounts {
+	sample := make(map[string]selfReportCounts, len(stats))
+
+	for _, s := range stats {
+		c := sample[s.Address]
+		c.queries += s.Queries
+		c.failures += s.Timeouts + s.Servfails
+		sample[s.Address] = c
+	}
+	return sample
+}
+
+// report returns the attributes of the summary for the stats collected since the previous report.
+func (sr *selfReporter) report(stats []ResolverStats, now time.Time) []interface{} {
+	current := selfReportSample(stats)
+
+	type failing struct {
+		addr     string
+		failures int
+	}
+	var queries, failures int
+	var worst []failing
+	for addr, c := range current {
+		p := sr.previous[addr]
+		// Counters lower than before belong to a resolver that was removed and added again
+		if c.queries < p.queries || c.failures < p.failures {
+			p = selfReportCounts{}
+		}
+
+		q, f := c.queries-p.queries, c.failures-p.failures
+		queries += q
+		failures += f
+		if f > 0 {
+			worst = append(worst, failing{addr: addr, failures: f})
+		}
+	}
+	sort.Slice(worst, func(i, j int) bool {
+		if worst[i].failures == worst[j].failures {
+			return worst[i].addr < worst[j].addr
+		}
+		return worst[i].failures > worst[j].failures
+	})
+	if len(worst) > selfReportTopFailing {
+		worst = worst[:selfReportTopFailing]
+	}
+
+	var qps float64
+	if elapsed := now.Sub(sr.last).Seconds(); elapsed > 0 {
+		qps = float64(queries) / elapsed
+	}
+	success := 100.0
+	if queries > 0 {
+		success = 100 * float64(queries-failures) / float64(queries)
+	}
+
+	top := make([]string, 0, len(worst))
+	for _, w := range worst {
+		top = append(top, fmt.Sprintf("%s(%d)", w.addr, w.failures))
+	}
+
+	sr.last = now
+	sr.previous = current
+	return []interface{}{
+		"queries", queries,
+		"qps", fmt.Sprintf("%.1f", qps),
+		"success_rate", fmt.Sprintf("%.1f%%", success),
+		"failing", strings.Join(top, ","),
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSelfReportSummary(t *testing.T) {
+	start := time.Now()
+	sr := &selfReporter{
+		last: start,
+		previous: selfReportSample([]ResolverStats{
+			{Address: "192.0.2.1:53", Queries: 100, Timeouts: 10},
+		}),
+	}
+
+	attrs := sr.report([]ResolverStats{
+		{Address: "192.0.2.1:53", Queries: 150, Timeouts: 12, Servfails: 3},
+		{Address: "192.0.2.2:53", Queries: 40, Timeouts: 8},
+		{Address: "192.0.2.3:53", Queries: 10},
+	}, start.Add(10*time.Second))
+
+	expected := []interface{}{
+		"queries", 100,
+		"qps", "10.0",
+		"success_rate", "87.0%",
+		"failing", "192.0.2.2:53(8),192.0.2.1:53(5)",
+	}
+	if len(attrs) != len(expected) {
+		t.Fatalf("The report contained %v instead of %v", attrs, expected)
+	}
+	for i := range expected {
+		if attrs[i] != expected[i] {
+			t.Errorf("The report contained %v instead of %v", attrs, expected)
+			break
+		}
+	}
+
+	// The next report only covers the queries performed since this one
+	if attrs := sr.report(nil, start.Add(20*time.Second)); attrs[1] != 0 || attrs[5] != "100.0%" {
+		t.Errorf("The empty report contained %v", attrs)
+	}
+}
+
+func TestSelfReport(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	l := new(testEventLogger)
+	pool.SetEventLogger(l)
+	pool.SelfReport(200 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		if _, err := pool.Query(context.TODO(), QueryMsg("www.selfreport.net", dns.TypeA), PriorityNormal, nil); err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	l.Lock()
+	defer l.Unlock()
+
+	var found bool
+	for _, e := range l.events {
+		if e.msg == "Self report" && e.level == LevelInfo {
+			found = true
+			if e.attrs["queries"] != 5 || e.attrs["success_rate"] != "100.0%" || e.attrs["failing"] != "" {
+				t.Errorf("The self report contained unexpected attributes: %v", e.attrs)
+			}
+			break
+		}
+	}
+	if !found {
+		t.Errorf("The self report was not logged: %+v", l.events)
+	}
+}
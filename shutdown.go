@@ -0,0 +1,74 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// How often Shutdown checks whether the outstanding queries have completed.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown gracefully stops the pool. New queries are rejected with an error matching ErrPoolClosed,
+// while the queries already accepted, including their retries, are given until the context is done
+// to complete or time out. The pool is then stopped, which closes the sockets of the resolvers.
+// The context error is returned when queries were still outstanding once the context was done.
+func (rp *ResolverPool) Shutdown(ctx context.Context) error {
+	rp.Lock()
+	rp.draining = true
+	rp.Unlock()
+	defer rp.Stop()
+
+	t := time.NewTicker(shutdownPollInterval)
+	defer t.Stop()
+
+	for {
+		rp.Lock()
+		active := rp.active
+		rp.Unlock()
+
+		if active == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			rp.logEvent(LevelWarn, "Shutdown abandoned outstanding queries", "queries", active)
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// admit accepts the query unless the pool is shutting down, and must be followed by a call to release.
+func (rp *ResolverPool) admit(msg *dns.Msg) error {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if rp.draining {
+		var name string
+		if len(msg.Question) > 0 {
+			name = msg.Question[0].Name
+		}
+		return &ResolveError{
+			Err:    "Resolver: The pool is shutting down and did not accept the query for " + name,
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonResolverStopped,
+		}
+	}
+
+	rp.active++
+	return nil
+}
+
+// release marks a query accepted by admit as completed.
+func (rp *ResolverPool) release() {
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.active--
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestShutdownDrains(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		time.Sleep(200 * time.Millisecond)
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	done := make(chan Result, 1)
+	QueryAsync(context.TODO(), pool, "www.draining.net", dns.TypeA, func(res Result) { done <- res })
+	// Allow the query to be sent before the shutdown begins
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed to drain the outstanding query: %v", err)
+	}
+	if res := <-done; res.Err != nil {
+		t.Errorf("The outstanding query failed during the shutdown: %v", res.Err)
+	}
+	if !pool.Stopped() {
+		t.Errorf("The pool was not stopped after the shutdown")
+	}
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("www.draining.net", dns.TypeA), PriorityNormal, nil); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("The query after the shutdown returned %v instead of ErrPoolClosed", err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(timeoutHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	done := make(chan Result, 1)
+	QueryAsync(context.TODO(), pool, "www.abandoned.net", dns.TypeA, func(res Result) { done <- res })
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown returned %v instead of the context error", err)
+	}
+	// Stopping the pool releases the query abandoned by the shutdown
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("The abandoned query did not return after the pool was stopped")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SLOTargets are the service-level objectives tracked by a ResolverPool.
+// A zero value for a field disables the corresponding objective.
+type SLOTargets struct {
+	// MinAnswerRatio is the minimum fraction of queries, between 0 and 1,
+	// that must receive a definitive answer (NOERROR or NXDOMAIN).
+	MinAnswerRatio float64
+	// MaxP95Latency is the maximum acceptable 95th percentile query latency.
+	MaxP95Latency time.Duration
+}
+
+// SLOViolation counts the queries that failed an objective for the same cause.
+type SLOViolation struct {
+	Cause string
+	Count int
+}
+
+// SLOReport describes the compliance of a ResolverPool with its SLOTargets.
+type SLOReport struct {
+	Targets        SLOTargets
+	Queries        int
+	Answered       int
+	AnswerRatio    float64
+	P95Latency     time.Duration
+	AnswerRatioMet bool
+	LatencyMet     bool
+	// Causes are sorted with the most frequent violation cause first.
+	Causes []SLOViolation
+}
+
+// Met returns true when all the objectives were met.
+func (r *SLOReport) Met() bool {
+	return r.AnswerRatioMet && r.LatencyMet
+}
+
+// String implements the Stringer interface.
+func (r *SLOReport) String() string {
+	status := "met"
+	if !r.Met() {
+		status = "violated"
+	}
+
+	s := fmt.Sprintf("SLO report: %s: %d/%d queries answered (%.2f%%), p95 latency %s",
+		status, r.Answered, r.Queries, r.AnswerRatio*100, r.P95Latency)
+
+	var causes []string
+	for _, v := range r.Causes {
+		causes = append(causes, fmt.Sprintf("%s: %d", v.Cause, v.Count))
+	}
+	if len(causes) > 0 {
+		s += ", violation causes: " + strings.Join(causes, ", ")
+	}
+	return s
+}
+
+const sloSlowCause = "slow response"
+
+type sloTracker struct {
+	sync.Mutex
+	targets   SLOTargets
+	queries   int
+	answered  int
+	latencies latencyHistogram
+	causes    map[string]int
+}
+
+func newSLOTracker(targets SLOTargets) *sloTracker {
+	return &sloTracker{
+		targets: targets,
+		causes:  make(map[string]int),
+	}
+}
+
+func (s *sloTracker) record(err error, rtt time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.queries++
+	s.latencies.observe(rtt)
+
+	if cause := sloFailureCause(err); cause != "" {
+		s.causes[cause]++
+	} else {
+		s.answered++
+	}
+
+	if s.targets.MaxP95Latency > 0 && rtt > s.targets.MaxP95Latency {
+		s.causes[sloSlowCause]++
+	}
+}
+
+// sloFailureCause returns an empty string when the error still represents a definitive answer.
+func sloFailureCause(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	e, ok := err.(*ResolveError)
+	if !ok {
+		return "resolver error"
+	}
+
+	switch e.Rcode {
+	case dns.RcodeNameError:
+		return ""
+	case TimeoutRcode:
+		return "timeout"
+	case ResolverErrRcode:
+		return "resolver error"
+	}
+
+	if str, found := dns.RcodeToString[e.Rcode]; found {
+		return str
+	}
+	return fmt.Sprintf("rcode %d", e.Rcode)
+}
+
+func (s *sloTracker) report() *SLOReport {
+	s.Lock()
+	defer s.Unlock()
+
+	r := &SLOReport{
+		Targets:        s.targets,
+		Queries:        s.queries,
+		Answered:       s.answered,
+		P95Latency:     s.latencies.percentile(0.95),
+		AnswerRatioMet: true,
+		LatencyMet:     true,
+	}
+
+	if s.queries > 0 {
+		r.AnswerRatio = float64(s.answered) / float64(s.queries)
+	}
+	if s.targets.MinAnswerRatio > 0 && r.AnswerRatio < s.targets.MinAnswerRatio {
+		r.AnswerRatioMet = false
+	}
+	if s.targets.MaxP95Latency > 0 && r.P95Latency > s.targets.MaxP95Latency {
+		r.LatencyMet = false
+	}
+
+	for cause, count := range s.causes {
+		r.Causes = append(r.Causes, SLOViolation{
+			Cause: cause,
+			Count: count,
+		})
+	}
+	sort.Slice(r.Causes, func(i, j int) bool {
+		if r.Causes[i].Count == r.Causes[j].Count {
+			return r.Causes[i].Cause < r.Causes[j].Cause
+		}
+		return r.Causes[i].Count > r.Causes[j].Count
+	})
+	return r
+}
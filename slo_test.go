@@ -0,0 +1,77 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSLOTracker(t *testing.T) {
+	slo := newSLOTracker(SLOTargets{
+		MinAnswerRatio: 0.95,
+		MaxP95Latency:  100 * time.Millisecond,
+	})
+
+	for i := 0; i < 18; i++ {
+		slo.record(nil, 10*time.Millisecond)
+	}
+	slo.record(&ResolveError{Err: "nxdomain", Rcode: dns.RcodeNameError}, 10*time.Millisecond)
+	slo.record(&ResolveError{Err: "timeout", Rcode: TimeoutRcode}, 2*time.Second)
+
+	report := slo.report()
+	if report.Queries != 20 || report.Answered != 19 {
+		t.Errorf("The report counted %d/%d answered instead of 19/20", report.Answered, report.Queries)
+	}
+	if !report.AnswerRatioMet {
+		t.Errorf("The answer ratio of %.2f should have met the objective", report.AnswerRatio)
+	}
+	if !report.LatencyMet {
+		t.Errorf("The p95 latency of %s should have met the objective", report.P95Latency)
+	}
+	if len(report.Causes) != 2 {
+		t.Errorf("The report returned %d violation causes instead of 2", len(report.Causes))
+	}
+
+	slo.record(&ResolveError{Err: "servfail", Rcode: dns.RcodeServerFailure}, 10*time.Millisecond)
+	if report = slo.report(); report.Met() || report.AnswerRatioMet {
+		t.Errorf("The answer ratio of %.2f should have violated the objective", report.AnswerRatio)
+	}
+}
+
+func TestPoolSLOReport(t *testing.T) {
+	dns.HandleFunc("slo.net.", typeAHandler)
+	defer dns.HandleRemove("slo.net.")
+
+	s, addrstr, _, err := runLocalUDPServer(":0")
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if pool.SLOReport() != nil {
+		t.Errorf("The pool returned a report before objectives were set")
+	}
+
+	pool.SetSLOTargets(SLOTargets{
+		MinAnswerRatio: 0.97,
+		MaxP95Latency:  time.Second,
+	})
+	for i := 0; i < 10; i++ {
+		if _, err := pool.Query(context.TODO(), QueryMsg("slo.net", dns.TypeA), PriorityNormal, nil); err != nil {
+			t.Errorf("The query failed: %v", err)
+		}
+	}
+
+	if report := pool.SLOReport(); report == nil || report.Queries != 10 || !report.Met() {
+		t.Errorf("The pool did not report meeting the objectives: %v", report)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package resolve
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogEventLogger struct {
+	l *slog.Logger
+}
+
+// SlogEventLogger returns an EventLogger that emits the events of a ResolverPool using the *slog.Logger.
+func SlogEventLogger(l *slog.Logger) EventLogger {
+	return &slogEventLogger{l: l}
+}
+
+// LogEvent implements the EventLogger interface.
+func (s *slogEventLogger) LogEvent(ctx context.Context, level LogLevel, msg string, args ...interface{}) {
+	s.l.Log(ctx, slog.Level(level), msg, args...)
+}
+
+// SetSlogLogger causes the events of the pool to be emitted using the *slog.Logger.
+func (rp *ResolverPool) SetSlogLogger(l *slog.Logger) {
+	if l == nil {
+		rp.SetEventLogger(nil)
+		return
+	}
+	rp.SetEventLogger(SlogEventLogger(l))
+}
@@ -0,0 +1,33 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package resolve
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.2:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	pool.SetResolverQPS("127.0.0.2:53", 5)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to decode the record: %v", err)
+	}
+	if record["level"] != "INFO" || record["msg"] != "Configuration changed" ||
+		record["setting"] != "resolver_qps" || record["qps"] != float64(5) {
+		t.Errorf("The record was unexpected: %v", record)
+	}
+}
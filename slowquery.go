@@ -0,0 +1,126 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SlowQueryConfig controls the reporting of queries that take longer than expected.
+type SlowQueryConfig struct {
+	// Threshold is the total time of a query, including the retries, after which it is reported.
+	// A zero Threshold disables the reporting.
+	Threshold time.Duration
+	// Callback receives each slow query. When nil, the slow queries are logged as warnings.
+	// The callback is executed by the goroutine performing the query and must not block.
+	Callback func(SlowQuery)
+}
+
+// SlowQuery describes a query that exceeded the threshold set using SetSlowQueryLog.
+type SlowQuery struct {
+	Name     string
+	Qtype    uint16
+	Duration time.Duration
+	// Resolvers are the addresses of the resolvers used by each attempt, in the order attempted,
+	// including the attempts made by the trusted resolvers, the type resolvers and the standby set.
+	Resolvers     []string
+	CorrelationID string
+	Err           error
+}
+
+type queryChainKey struct{}
+
+// queryChain collects the resolvers attempted while performing a query.
+type queryChain struct {
+	sync.Mutex
+	resolvers []string
+}
+
+func queryChainFromContext(ctx context.Context) *queryChain {
+	c, _ := ctx.Value(queryChainKey{}).(*queryChain)
+	return c
+}
+
+func (c *queryChain) add(addr string) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.resolvers = append(c.resolvers, addr)
+}
+
+func (c *queryChain) list() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	return append([]string(nil), c.resolvers...)
+}
+
+// SetSlowQueryLog causes the queries taking longer than the threshold to be reported,
+// along with the resolvers attempted, to help identify the resolvers and zones responsible.
+func (rp *ResolverPool) SetSlowQueryLog(config SlowQueryConfig) {
+	defer rp.configChanged("slow_query_log", "threshold", config.Threshold, "callback", config.Callback != nil)
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.slowQueries = config
+}
+
+// startQueryChain returns a context collecting the resolvers attempted for the query, or nil when
+// slow queries are not reported or the query is already collected by another pool.
+func (rp *ResolverPool) startQueryChain(ctx context.Context) (context.Context, *queryChain) {
+	rp.Lock()
+	threshold := rp.slowQueries.Threshold
+	rp.Unlock()
+
+	if threshold <= 0 || queryChainFromContext(ctx) != nil {
+		return ctx, nil
+	}
+
+	c := new(queryChain)
+	return context.WithValue(ctx, queryChainKey{}, c), c
+}
+
+// reportSlowQuery provides the query to the callback, or logs it, when the duration exceeds the threshold.
+func (rp *ResolverPool) reportSlowQuery(ctx context.Context, c *queryChain, msg *dns.Msg, d time.Duration, err error) {
+	if c == nil {
+		return
+	}
+
+	rp.Lock()
+	config := rp.slowQueries
+	rp.Unlock()
+
+	if config.Threshold <= 0 || d < config.Threshold || len(msg.Question) == 0 {
+		return
+	}
+
+	sq := SlowQuery{
+		Name:          RemoveLastDot(msg.Question[0].Name),
+		Qtype:         msg.Question[0].Qtype,
+		Duration:      d,
+		Resolvers:     c.list(),
+		CorrelationID: CorrelationID(ctx),
+		Err:           err,
+	}
+	if config.Callback != nil {
+		config.Callback(sq)
+		return
+	}
+
+	args := []interface{}{"name", sq.Name, "type", dns.TypeToString[sq.Qtype],
+		"duration", sq.Duration, "resolvers", strings.Join(sq.Resolvers, ",")}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	rp.logQueryEvent(ctx, LevelWarn, "Slow query", args...)
+}
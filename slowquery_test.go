@@ -0,0 +1,82 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestSlowQueryLog(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if strings.HasPrefix(req.Question[0].Name, "slow") {
+			time.Sleep(100 * time.Millisecond)
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	reported := make(chan SlowQuery, 4)
+	pool.SetSlowQueryLog(SlowQueryConfig{
+		Threshold: 50 * time.Millisecond,
+		Callback:  func(sq SlowQuery) { reported <- sq },
+	})
+
+	for _, name := range []string{"fast.slowquery.net", "slow.slowquery.net"} {
+		if _, err := pool.Query(context.TODO(), QueryMsg(name, dns.TypeA), PriorityNormal, nil); err != nil {
+			t.Fatalf("The query for %s failed: %v", name, err)
+		}
+	}
+	done := make(chan Result, 1)
+	QueryAsync(context.TODO(), pool, "slow2.slowquery.net", dns.TypeA, func(res Result) { done <- res })
+	<-done
+
+	for _, name := range []string{"slow.slowquery.net", "slow2.slowquery.net"} {
+		select {
+		case sq := <-reported:
+			if sq.Name != name || sq.Qtype != dns.TypeA || sq.Duration < 50*time.Millisecond || sq.Err != nil {
+				t.Errorf("The slow query was reported as %+v", sq)
+			}
+			if len(sq.Resolvers) != 1 || sq.Resolvers[0] != r.String() {
+				t.Errorf("The slow query was reported with the resolvers %v", sq.Resolvers)
+			}
+		default:
+			t.Fatalf("The slow query for %s was not reported", name)
+		}
+	}
+	if len(reported) != 0 {
+		t.Errorf("The fast query was reported as slow: %+v", <-reported)
+	}
+
+	l := new(testEventLogger)
+	pool.SetEventLogger(l)
+	pool.SetSlowQueryLog(SlowQueryConfig{Threshold: 50 * time.Millisecond})
+	if _, err := pool.Query(context.TODO(), QueryMsg("slow3.slowquery.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	var found bool
+	for _, e := range l.events {
+		if e.msg == "Slow query" && e.level == LevelWarn && e.attrs["name"] == "slow3.slowquery.net" && e.attrs["resolvers"] == r.String() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("The slow query was not logged: %+v", l.events)
+	}
+}
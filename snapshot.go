@@ -0,0 +1,138 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The version of the format written by ExportCache.
+const cacheSnapshotVersion = 1
+
+type cacheSnapshot struct {
+	Version  int                  `json:"version"`
+	Exported time.Time            `json:"exported"`
+	Entries  []cacheSnapshotEntry `json:"entries"`
+}
+
+type cacheSnapshotEntry struct {
+	Key     string    `json:"key"`
+	Expires time.Time `json:"expires"`
+	Value   []byte    `json:"value"`
+}
+
+// cacheRanger is implemented by the Cache stores able to enumerate the values they hold.
+// The callback must not call the methods of the store, and returns false to stop the enumeration.
+type cacheRanger interface {
+	Range(fn func(key string, value []byte, expires time.Time) bool)
+}
+
+// Range calls fn for each value held that has not expired.
+func (c *memoryCache) Range(fn func(key string, value []byte, expires time.Time) bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	for _, entry := range c.entries {
+		if now.Before(entry.expires) && !fn(entry.key, entry.value, entry.expires) {
+			return
+		}
+	}
+}
+
+// Range calls fn for each value held that has not expired, from oldest to newest.
+func (c *DiskCache) Range(fn func(key string, value []byte, expires time.Time) bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.f == nil {
+		return
+	}
+
+	now := time.Now()
+	for el := c.order.Back(); el != nil; el = el.Prev() {
+		entry := el.Value.(*diskEntry)
+		if !now.Before(entry.expires) {
+			continue
+		}
+
+		value := make([]byte, entry.length)
+		if _, err := c.f.ReadAt(value, entry.offset); err != nil {
+			continue
+		}
+		if !fn(entry.key, value, entry.expires) {
+			return
+		}
+	}
+}
+
+// ExportCache writes the responses held by the cache provided to SetCache as JSON,
+// so they can be provided to ImportCache in a later run. The Cache must be one provided
+// by this package, or implement the Range method of the memory and disk caches.
+func (rp *ResolverPool) ExportCache(w io.Writer) error {
+	rp.Lock()
+	cache := rp.cache
+	rp.Unlock()
+
+	if cache == nil {
+		return fmt.Errorf("ExportCache: The pool does not have a cache")
+	}
+	cr, ok := cache.store.(cacheRanger)
+	if !ok {
+		return fmt.Errorf("ExportCache: The cache does not support enumerating its values")
+	}
+
+	data := cacheSnapshot{
+		Version:  cacheSnapshotVersion,
+		Exported: time.Now(),
+		Entries:  []cacheSnapshotEntry{},
+	}
+	cr.Range(func(key string, value []byte, expires time.Time) bool {
+		data.Entries = append(data.Entries, cacheSnapshotEntry{
+			Key:     key,
+			Expires: expires,
+			Value:   value,
+		})
+		return true
+	})
+
+	if err := json.NewEncoder(w).Encode(&data); err != nil {
+		return fmt.Errorf("ExportCache: Failed to encode the cache snapshot: %v", err)
+	}
+	return nil
+}
+
+// ImportCache loads the responses written by ExportCache into the cache provided to SetCache.
+// Responses that expired since the snapshot was written are discarded, and the remainder are
+// held for what remains of their TTLs. The number of responses loaded is returned.
+func (rp *ResolverPool) ImportCache(r io.Reader) (int, error) {
+	rp.Lock()
+	cache := rp.cache
+	rp.Unlock()
+
+	if cache == nil {
+		return 0, fmt.Errorf("ImportCache: The pool does not have a cache")
+	}
+
+	var data cacheSnapshot
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return 0, fmt.Errorf("ImportCache: Failed to decode the cache snapshot: %v", err)
+	}
+	if data.Version != cacheSnapshotVersion {
+		return 0, fmt.Errorf("ImportCache: Unsupported cache snapshot version %d", data.Version)
+	}
+
+	var count int
+	now := time.Now()
+	for _, e := range data.Entries {
+		if ttl := e.Expires.Sub(now); ttl > 0 {
+			cache.store.Set(e.Key, e.Value, ttl)
+			count++
+		}
+	}
+	return count, nil
+}
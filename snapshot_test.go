@@ -0,0 +1,91 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestCacheSnapshot(t *testing.T) {
+	var count int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", ttlHandler(&count))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetCache(NewMemoryCache(10))
+
+	for _, name := range []string{"ttl300.snapshot.cache.net", "ttl1.snapshot.cache.net"} {
+		if _, err := pool.Query(context.TODO(), QueryMsg(name, dns.TypeA), PriorityNormal, nil); err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pool.ExportCache(&buf); err != nil {
+		t.Fatalf("Failed to export the cache: %v", err)
+	}
+
+	disk, err := NewDiskCache(filepath.Join(t.TempDir(), "cache.db"), DiskCacheConfig{})
+	if err != nil {
+		t.Fatalf("Failed to open the disk cache: %v", err)
+	}
+	defer disk.Close()
+
+	other := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer other.Stop()
+	other.SetCache(disk)
+
+	// The response with the short TTL expires before the snapshot is loaded
+	time.Sleep(1100 * time.Millisecond)
+	if n, err := other.ImportCache(&buf); err != nil || n != 1 {
+		t.Fatalf("The import loaded %d responses instead of 1: %v", n, err)
+	}
+
+	atomic.StoreInt32(&count, 0)
+	resp, err := other.Query(context.TODO(), QueryMsg("ttl300.snapshot.cache.net", dns.TypeA), PriorityNormal, nil)
+	if err != nil || len(resp.Answer) != 1 {
+		t.Fatalf("The imported response was not returned: %v", err)
+	}
+	if n := atomic.LoadInt32(&count); n != 0 {
+		t.Errorf("%d queries were sent for the imported response", n)
+	}
+
+	// The disk cache can also be exported
+	buf.Reset()
+	if err := other.ExportCache(&buf); err != nil || !strings.Contains(buf.String(), "ttl300.snapshot") {
+		t.Errorf("Failed to export the disk cache: %v", err)
+	}
+}
+
+func TestImportCacheErrors(t *testing.T) {
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.2:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if _, err := pool.ImportCache(strings.NewReader("{}")); err == nil {
+		t.Errorf("The import succeeded without a cache")
+	}
+	if err := pool.ExportCache(&bytes.Buffer{}); err == nil {
+		t.Errorf("The export succeeded without a cache")
+	}
+
+	pool.SetCache(NewMemoryCache(10))
+	if _, err := pool.ImportCache(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Errorf("The import accepted an unsupported version")
+	}
+	if _, err := pool.ImportCache(strings.NewReader("not json")); err == nil {
+		t.Errorf("The import accepted data that is not JSON")
+	}
+}
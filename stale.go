@@ -0,0 +1,100 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// StaleTTL is the TTL in seconds given to the records of stale responses, as recommended by RFC 8767.
+const StaleTTL = 30
+
+// SetServeStale causes the pool to retain cached responses for the provided period after they expire,
+// and to provide them, marked as stale, when the resolvers fail to answer the question (RFC 8767).
+// Zero or less disables serving stale responses. Stale responses require a cache provided to SetCache.
+func (rp *ResolverPool) SetServeStale(maxStale time.Duration) {
+	if maxStale < 0 {
+		maxStale = 0
+	}
+	defer rp.configChanged("serve_stale", "max_stale", maxStale)
+
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.staleWindow = maxStale
+	if rp.cache != nil {
+		atomic.StoreInt64(&rp.cache.stale, int64(maxStale))
+	}
+}
+
+// getStale returns the cached response after it expired, with the records given
+// the StaleTTL and the response marked as stale, or nil when none is retained.
+func (c *responseCache) getStale(key string, msg *dns.Msg) *dns.Msg {
+	if atomic.LoadInt64(&c.stale) <= 0 {
+		return nil
+	}
+
+	resp, age, ttl := c.lookup(key, msg)
+	if resp == nil || age < ttl {
+		return nil
+	}
+
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			if hdr := rr.Header(); hdr.Rrtype != dns.TypeOPT {
+				hdr.Ttl = StaleTTL
+			}
+		}
+	}
+	markStale(resp)
+	atomic.AddUint64(&c.served, 1)
+	return resp
+}
+
+// staleEligible returns true when the error shows that the resolvers failed to answer
+// the question, as opposed to providing a definitive response.
+func staleEligible(err error) bool {
+	e, ok := err.(*ResolveError)
+	if !ok {
+		return false
+	}
+
+	switch e.Rcode {
+	case TimeoutRcode, ResolverErrRcode, dns.RcodeServerFailure, dns.RcodeRefused:
+		return true
+	}
+	return false
+}
+
+// markStale adds the Stale Answer extended DNS error (RFC 8914) to the response.
+func markStale(resp *dns.Msg) {
+	opt := resp.IsEdns0()
+	if opt == nil {
+		resp.SetEdns0(dns.DefaultMsgSize, false)
+		opt = resp.IsEdns0()
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer})
+}
+
+// StaleResponse returns true when the response was served from the cache after it expired.
+func StaleResponse(resp *dns.Msg) bool {
+	if resp == nil {
+		return false
+	}
+
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, o := range opt.Option {
+		if e, ok := o.(*dns.EDNS0_EDE); ok && e.InfoCode == dns.ExtendedErrorCodeStaleAnswer {
+			return true
+		}
+	}
+	return false
+}
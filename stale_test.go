@@ -0,0 +1,87 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestServeStale(t *testing.T) {
+	var count, failing int32
+	answer := ttlHandler(&count)
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if atomic.LoadInt32(&failing) == 1 {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			_ = w.WriteMsg(m)
+			return
+		}
+		answer(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetCache(NewMemoryCache(10))
+	pool.SetServeStale(time.Hour)
+
+	// Failures are not retried, so the test completes quickly
+	ctx := context.WithValue(context.Background(), attemptsKey{}, 1)
+	msg := QueryMsg("ttl1.stale.cache.net", dns.TypeA)
+	if res := QueryResult(ctx, pool, msg, PriorityNormal, nil); res.Err != nil || res.Stale {
+		t.Fatalf("The initial query failed or was stale: %v", res.Err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	atomic.StoreInt32(&failing, 1)
+
+	res := QueryResult(ctx, pool, msg, PriorityNormal, nil)
+	if res.Err != nil {
+		t.Fatalf("The stale response was not served: %v", res.Err)
+	}
+	if !res.Stale || !StaleResponse(res.Msg) {
+		t.Errorf("The response was not marked as stale")
+	}
+	if ttl := res.Msg.Answer[0].Header().Ttl; ttl != StaleTTL {
+		t.Errorf("The stale record had a TTL of %d instead of %d", ttl, StaleTTL)
+	}
+	if n := pool.CacheStats().Stale; n != 1 {
+		t.Errorf("The cache counted %d stale responses instead of 1", n)
+	}
+
+	// Expired responses are not served while the resolvers are answering
+	atomic.StoreInt32(&failing, 0)
+	if res := QueryResult(ctx, pool, msg, PriorityNormal, nil); res.Err != nil || res.Stale {
+		t.Errorf("The stale response was served while the resolver was answering")
+	}
+
+	pool.SetServeStale(0)
+	time.Sleep(1100 * time.Millisecond)
+	atomic.StoreInt32(&failing, 1)
+	if res := QueryResult(ctx, pool, msg, PriorityNormal, nil); res.Err == nil {
+		t.Errorf("The stale response was served after serving stale responses was disabled")
+	}
+}
+
+func TestStaleEligible(t *testing.T) {
+	for _, rcode := range []int{TimeoutRcode, ResolverErrRcode, dns.RcodeServerFailure, dns.RcodeRefused} {
+		if !staleEligible(&ResolveError{Rcode: rcode}) {
+			t.Errorf("Rcode %d did not permit a stale response", rcode)
+		}
+	}
+	if staleEligible(&ResolveError{Rcode: dns.RcodeNameError}) {
+		t.Errorf("NXDOMAIN permitted a stale response")
+	}
+	if StaleResponse(QueryMsg("stale.net", dns.TypeA)) {
+		t.Errorf("The response without the extended error was identified as stale")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+)
+
+// While the standby set is active, one of this many queries is sent through
+// the primary set to find out whether it has recovered.
+const standbyProbeInterval = 10
+
+const defaultStandbyWindow = 100
+
+// StandbyConfig describes the resolvers a ResolverPool switches to when the primary set is failing.
+type StandbyConfig struct {
+	Resolvers []Resolver
+	// MinSuccessRatio is the fraction of primary queries, between 0 and 1, that must receive
+	// a definitive answer for the primary set to be considered healthy.
+	MinSuccessRatio float64
+	// Window is the number of recent primary queries used to calculate the success ratio.
+	Window int
+	// SwitchBack causes the pool to return to the primary set after it recovers.
+	SwitchBack bool
+	// OnSwitch is executed each time the pool changes sets, with active set to true
+	// when the standby set has been activated.
+	OnSwitch func(active bool, ratio float64)
+}
+
+type standbyState struct {
+	config  StandbyConfig
+	pool    *ResolverPool
+	active  bool
+	results []bool
+	next    int
+	filled  int
+	count   int
+}
+
+// SetStandby configures the standby resolver set for the pool.
+func (rp *ResolverPool) SetStandby(config StandbyConfig) {
+	if config.Window <= 0 {
+		config.Window = defaultStandbyWindow
+	}
+
+	pool := NewResolverPool(config.Resolvers, rp.delay, nil, 1, rp.log)
+	if pool == nil {
+		return
+	}
+	rp.inheritObservers(pool)
+	rp.inheritConfig(pool)
+	defer rp.configChanged("standby", "resolvers", len(config.Resolvers))
+
+	rp.Lock()
+	old := rp.standby
+	rp.standby = &standbyState{
+		config:  config,
+		pool:    pool,
+		results: make([]bool, config.Window),
+	}
+	rp.Unlock()
+
+	if old != nil {
+		old.pool.Stop()
+	}
+}
+
+// StandbyActive returns true when the pool is currently using the standby resolver set.
+func (rp *ResolverPool) StandbyActive() bool {
+	rp.Lock()
+	defer rp.Unlock()
+
+	return rp.standby != nil && rp.standby.active
+}
+
+// standbyPool returns the standby pool when it should receive the next query.
+func (rp *ResolverPool) standbyPool() *ResolverPool {
+	rp.Lock()
+	defer rp.Unlock()
+
+	sb := rp.standby
+	if sb == nil || !sb.active {
+		return nil
+	}
+
+	sb.count++
+	if sb.config.SwitchBack && sb.count%standbyProbeInterval == 0 {
+		// Probe the primary set
+		return nil
+	}
+	return sb.pool
+}
+
+func (rp *ResolverPool) standbyQuery(ctx context.Context, msg *dns.Msg, priority int, retry Retry) (*dns.Msg, error) {
+	if sb := rp.standbyPool(); sb != nil {
+		return sb.Query(ctx, msg, priority, retry)
+	}
+
+	resp, err := rp.query(ctx, msg, priority, retry)
+	rp.recordPrimaryResult(sloFailureCause(err) == "")
+	return resp, err
+}
+
+func (rp *ResolverPool) recordPrimaryResult(success bool) {
+	rp.Lock()
+	sb := rp.standby
+	if sb == nil {
+		rp.Unlock()
+		return
+	}
+
+	sb.results[sb.next] = success
+	sb.next = (sb.next + 1) % len(sb.results)
+	if sb.filled < len(sb.results) {
+		sb.filled++
+	}
+	if sb.filled < len(sb.results) {
+		rp.Unlock()
+		return
+	}
+
+	var successes int
+	for _, s := range sb.results {
+		if s {
+			successes++
+		}
+	}
+	ratio := float64(successes) / float64(len(sb.results))
+
+	var changed bool
+	if !sb.active && ratio < sb.config.MinSuccessRatio {
+		sb.active, changed = true, true
+	} else if sb.active && sb.config.SwitchBack && ratio >= sb.config.MinSuccessRatio {
+		sb.active, changed = false, true
+	}
+	if changed {
+		// Measure the primary set again from scratch after each switch
+		sb.next, sb.filled = 0, 0
+	}
+	active := sb.active
+	callback := sb.config.OnSwitch
+	rp.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if active {
+		rp.logEvent(LevelWarn, "Switched to the standby resolvers", "success_ratio", ratio)
+	} else {
+		rp.logEvent(LevelInfo, "Switched back to the primary resolvers", "success_ratio", ratio)
+	}
+	if callback != nil {
+		callback(active, ratio)
+	}
+}
+
+func (rp *ResolverPool) stopStandby() {
+	rp.Lock()
+	sb := rp.standby
+	rp.standby = nil
+	rp.Unlock()
+
+	if sb != nil {
+		sb.pool.Stop()
+	}
+}
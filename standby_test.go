@@ -0,0 +1,88 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestStandbySwitching(t *testing.T) {
+	var lock sync.Mutex
+	refuse := true
+
+	primary, paddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if refuse {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeRefused)
+			w.WriteMsg(m)
+			return
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer primary.Shutdown()
+
+	standby, saddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer standby.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(paddr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	var switches []bool
+	pool.SetStandby(StandbyConfig{
+		Resolvers:       []Resolver{NewBaseResolver(saddr, 100, nil)},
+		MinSuccessRatio: 0.5,
+		Window:          5,
+		SwitchBack:      true,
+		OnSwitch: func(active bool, ratio float64) {
+			switches = append(switches, active)
+		},
+	})
+
+	query := func() error {
+		_, err := pool.Query(context.TODO(), QueryMsg("standby.net", dns.TypeA), PriorityNormal, nil)
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := query(); err == nil {
+			t.Errorf("The refused query was successful")
+		}
+	}
+	if !pool.StandbyActive() {
+		t.Fatalf("The pool did not switch to the standby resolvers")
+	}
+	if err := query(); err != nil {
+		t.Errorf("The query through the standby resolvers failed: %v", err)
+	}
+
+	lock.Lock()
+	refuse = false
+	lock.Unlock()
+
+	for i := 0; i < standbyProbeInterval*5 && pool.StandbyActive(); i++ {
+		if err := query(); err != nil {
+			t.Errorf("The query failed after the primary recovered: %v", err)
+		}
+	}
+	if pool.StandbyActive() {
+		t.Errorf("The pool did not switch back to the primary resolvers")
+	}
+	if len(switches) != 2 || !switches[0] || switches[1] {
+		t.Errorf("The switch events were %v", switches)
+	}
+}
@@ -4,7 +4,9 @@
 package resolve
 
 import (
+	"container/heap"
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -16,42 +18,112 @@ import (
 // QueryTimeout is the duration until a Resolver query expires.
 var QueryTimeout = 2 * time.Second
 
+// Reason is a machine-readable explanation for a query that completed without a usable answer.
+type Reason string
+
+// The reasons attached to ResolveErrors.
+const (
+	ReasonNone                    Reason = ""
+	ReasonTimeout                 Reason = "timeout_after_n_retries"
+	ReasonAttemptTimeout          Reason = "attempt_timeout"
+	ReasonAllResolversQuarantined Reason = "all_resolvers_quarantined"
+	ReasonRateBudgetExhausted     Reason = "rate_budget_exhausted"
+	ReasonSendFailure             Reason = "send_failure"
+	ReasonValidationRejected      Reason = "validation_rejected"
+	ReasonErrorRcode              Reason = "error_rcode"
+	ReasonContextCancelled        Reason = "context_cancelled"
+	ReasonResolverStopped         Reason = "resolver_stopped"
+	ReasonNoResolvers             Reason = "no_resolvers"
+	ReasonInvalidRequest          Reason = "invalid_request"
+	ReasonInFlightCapReached      Reason = "in_flight_cap_reached"
+	ReasonCacheMiss               Reason = "cache_miss"
+	ReasonTruncated               Reason = "truncated"
+	ReasonUnknown                 Reason = "unknown"
+)
+
 // ResolveError contains the Rcode returned during the DNS query.
 type ResolveError struct {
-	Err   string
-	Rcode int
+	Err    string
+	Rcode  int
+	Reason Reason
 }
 
 func (e *ResolveError) Error() string {
 	return e.Err
 }
 
+// ErrorReason returns the Reason attached to the provided error, ReasonNone when the error is nil,
+// or ReasonUnknown when the error was not returned as a ResolveError.
+func ErrorReason(err error) Reason {
+	if err == nil {
+		return ReasonNone
+	}
+	var e *ResolveError
+	if !errors.As(err, &e) {
+		return ReasonUnknown
+	}
+	if e.Reason != ReasonNone {
+		return e.Reason
+	}
+	return ReasonErrorRcode
+}
+
+// retriesExhausted returns the error reported once no more attempts will be made for the query,
+// which replaces the timeout of the last attempt with ReasonTimeout.
+func retriesExhausted(err error) error {
+	if e, ok := err.(*ResolveError); ok && e.Reason == ReasonAttemptTimeout {
+		return &ResolveError{Err: e.Err, Rcode: e.Rcode, Reason: ReasonTimeout}
+	}
+	return err
+}
+
 type resolveRequest struct {
 	ID        uint16
 	Timestamp time.Time
 	Name      string
 	Qtype     uint16
-	Msg       *dns.Msg
-	Result    chan *resolveResult
+	// Question is the question as provided by the caller
+	Question dns.Question
+	Msg      *dns.Msg
+	// Encoded is true when the case of the name sent was randomized
+	Encoded bool
+	Ctx     context.Context
+	Result  chan *resolveResult
+	// Callback receives the result instead of the channel when provided
+	Callback func(*resolveResult)
+	// The key of the request in the xchgManager, normalized once when added
+	key xchgKey
+	// The time the request expires, set when the request is sent
+	deadline time.Time
+	// The in-flight limiter holding the reservation of the request
+	limits *inFlightLimiter
+	// The position of the request in the deadline heap of its xchgShard
+	heapIndex int
 }
 
 type resolveResult struct {
-	Msg   *dns.Msg
-	Again bool
-	Err   error
+	Msg       *dns.Msg
+	Again     bool
+	Err       error
+	Transport string
 }
 
 func (r *baseResolver) returnRequest(req *resolveRequest, res *resolveResult) {
+	if req.Callback != nil {
+		req.Callback(res)
+		return
+	}
 	req.Result <- res
 }
 
-func makeResolveResult(msg *dns.Msg, again bool, err string, rcode int) *resolveResult {
+func makeResolveResult(msg *dns.Msg, again bool, err string, rcode int, reason Reason) *resolveResult {
 	return &resolveResult{
 		Msg:   msg,
 		Again: again,
 		Err: &ResolveError{
-			Err:   err,
-			Rcode: rcode,
+			Err:    err,
+			Rcode:  rcode,
+			Reason: reason,
 		},
 	}
 }
@@ -60,107 +132,307 @@ func checkContext(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
 		return &ResolveError{
-			Err:   "The request context was cancelled",
-			Rcode: ResolverErrRcode,
+			Err:    "The request context was cancelled",
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonContextCancelled,
 		}
 	default:
 	}
 	return nil
 }
 
-type xchgManager struct {
+// The number of shards holding the requests of an xchgManager, so the goroutines sending
+// queries and reading responses rarely contend for the same lock.
+const xchgShards = 16
+
+type xchgShard struct {
 	sync.Mutex
-	xchgs map[string]*resolveRequest
+	xchgs map[xchgKey]*resolveRequest
+	// The requests written to the resolver ordered by the time they expire,
+	// so sweeps only visit the requests that have expired
+	deadlines deadlineHeap
+}
+
+// deadlineHeap implements heap.Interface for the requests ordered by the time they expire.
+type deadlineHeap []*resolveRequest
+
+func (h deadlineHeap) Len() int           { return len(h) }
+func (h deadlineHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+
+func (h deadlineHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *deadlineHeap) Push(x interface{}) {
+	req := x.(*resolveRequest)
+	req.heapIndex = len(*h)
+	*h = append(*h, req)
+}
+
+func (h *deadlineHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	req := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return req
+}
+
+func (h deadlineHeap) contains(req *resolveRequest) bool {
+	i := req.heapIndex
+	return i >= 0 && i < len(h) && h[i] == req
+}
+
+// track places the request sent to the resolver in the deadline heap. The lock must already be held by the caller.
+func (s *xchgShard) track(req *resolveRequest) {
+	if s.deadlines.contains(req) {
+		heap.Fix(&s.deadlines, req.heapIndex)
+		return
+	}
+	heap.Push(&s.deadlines, req)
+}
+
+// untrack removes the request from the deadline heap. The lock must already be held by the caller.
+func (s *xchgShard) untrack(req *resolveRequest) {
+	if s.deadlines.contains(req) {
+		heap.Remove(&s.deadlines, req.heapIndex)
+	}
+}
+
+type xchgManager struct {
+	shards [xchgShards]*xchgShard
+	limits *inFlightLimiter
+	// timeout provides the time allowed for each request once sent within the bounds
+	// of the configuration, defaulting to the upper bound
+	timeout  func(min, max time.Duration) time.Duration
+	cfgLock  sync.Mutex
+	settings resolverConfig
 }
 
 func newXchgManager() *xchgManager {
-	return &xchgManager{xchgs: make(map[string]*resolveRequest)}
+	// The queries are uncapped until the resolver is added to a pool with the MaxInFlight cap set
+	r := &xchgManager{limits: newInFlightLimiter()}
+
+	for i := range r.shards {
+		r.shards[i] = &xchgShard{xchgs: make(map[xchgKey]*resolveRequest)}
+	}
+	return r
+}
+
+// xchgKey identifies a request by the message ID and the normalized name in the question.
+type xchgKey struct {
+	id   uint16
+	name string
+}
+
+func newXchgKey(id uint16, name string) xchgKey {
+	return xchgKey{id: id, name: strings.ToLower(RemoveLastDot(name))}
+}
+
+// shard returns the shard holding the key, selected using the FNV-1a hash of the key.
+func (r *xchgManager) shard(key xchgKey) *xchgShard {
+	h := uint32(2166136261)
+	for _, b := range [2]byte{byte(key.id >> 8), byte(key.id)} {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	for i := 0; i < len(key.name); i++ {
+		h ^= uint32(key.name[i])
+		h *= 16777619
+	}
+	return r.shards[h%xchgShards]
+}
+
+func (r *xchgManager) setConfig(c resolverConfig) {
+	r.cfgLock.Lock()
+	defer r.cfgLock.Unlock()
+
+	r.settings = c
 }
 
-func xchgKey(id uint16, name string) string {
-	return fmt.Sprintf("%d:%s", id, strings.ToLower(RemoveLastDot(name)))
+func (r *xchgManager) config() resolverConfig {
+	r.cfgLock.Lock()
+	defer r.cfgLock.Unlock()
+
+	return r.settings
+}
+
+func (r *xchgManager) queryTimeout() time.Duration {
+	min, max := r.config().timeouts()
+	if r.timeout != nil {
+		return r.timeout(min, max)
+	}
+	return max
+}
+
+// reserve waits for the in-flight cap to allow another request to be added, and returns
+// the limiter holding the reservation, which must be assigned to the request added.
+func (r *xchgManager) reserve(ctx context.Context, priority int) (*inFlightLimiter, error) {
+	limits, max, failFast := r.config().inFlightCap(r.limits)
+	return limits, limits.acquire(ctx, priority, max, failFast)
+}
+
+// release gives back the reservations held by the requests removed.
+func (r *xchgManager) release(reqs []*resolveRequest) {
+	counts := make(map[*inFlightLimiter]int)
+
+	for _, req := range reqs {
+		counts[r.limiter(req)]++
+	}
+	for l, n := range counts {
+		l.release(n)
+	}
 }
 
+func (r *xchgManager) limiter(req *resolveRequest) *inFlightLimiter {
+	if req.limits != nil {
+		return req.limits
+	}
+	return r.limits
+}
+
+// add tracks the request, which must hold a reservation that is given back once the request is removed.
+// The reservation is kept when the key is already in use, so the request can be added with another identifier.
 func (r *xchgManager) add(req *resolveRequest) error {
-	r.Lock()
-	defer r.Unlock()
+	key := newXchgKey(req.ID, req.Name)
+	s := r.shard(key)
+
+	s.Lock()
+	defer s.Unlock()
 
-	key := xchgKey(req.ID, req.Name)
-	if _, found := r.xchgs[key]; found {
-		return fmt.Errorf("Key %s is already in use", key)
+	if _, found := s.xchgs[key]; found {
+		return fmt.Errorf("Key %d:%s is already in use", key.id, key.name)
 	}
 
-	r.xchgs[key] = req
+	req.key = key
+	s.xchgs[key] = req
+	if !req.Timestamp.IsZero() {
+		req.deadline = req.Timestamp.Add(r.queryTimeout())
+		s.track(req)
+	}
 	return nil
 }
 
 func (r *xchgManager) updateTimestamp(id uint16, name string) {
-	r.Lock()
-	defer r.Unlock()
+	key := newXchgKey(id, name)
+	s := r.shard(key)
+	timeout := r.queryTimeout()
 
-	key := xchgKey(id, name)
-	if _, found := r.xchgs[key]; !found {
-		return
-	}
+	s.Lock()
+	defer s.Unlock()
 
-	r.xchgs[key].Timestamp = time.Now()
+	if req, found := s.xchgs[key]; found {
+		req.Timestamp = time.Now()
+		req.deadline = req.Timestamp.Add(timeout)
+		s.track(req)
+	}
 }
 
 func (r *xchgManager) remove(id uint16, name string) *resolveRequest {
-	r.Lock()
-	defer r.Unlock()
+	key := newXchgKey(id, name)
+	s := r.shard(key)
 
-	key := xchgKey(id, name)
-	if _, found := r.xchgs[key]; !found {
-		return nil
+	s.Lock()
+	req, found := s.xchgs[key]
+	if found {
+		delete(s.xchgs, key)
+		s.untrack(req)
 	}
+	s.Unlock()
 
-	reqs := r.delete([]string{key})
-	if len(reqs) != 1 {
+	if !found {
 		return nil
 	}
-
-	return reqs[0]
+	r.limiter(req).release(1)
+	return req
 }
 
-func (r *xchgManager) removeExpired() []*resolveRequest {
-	r.Lock()
-	defer r.Unlock()
+// take removes the request matching the response, when the check function does not return a reason to
+// drop the response. The check is performed while the request is held, so no other goroutine can remove
+// the request between the validation and the removal.
+func (r *xchgManager) take(id uint16, name string, check func(*resolveRequest) DropReason) (*resolveRequest, DropReason) {
+	key := newXchgKey(id, name)
+	s := r.shard(key)
 
-	now := time.Now()
-	var keys []string
-	for key, req := range r.xchgs {
-		if !req.Timestamp.IsZero() && now.After(req.Timestamp.Add(QueryTimeout)) {
-			keys = append(keys, key)
-		}
+	s.Lock()
+	req, found := s.xchgs[key]
+	if !found {
+		s.Unlock()
+		return nil, DropNoExchange
+	}
+	if reason := check(req); reason != "" {
+		s.Unlock()
+		return nil, reason
 	}
+	delete(s.xchgs, key)
+	s.untrack(req)
+	s.Unlock()
 
-	return r.delete(keys)
+	r.limiter(req).release(1)
+	return req, ""
 }
 
-func (r *xchgManager) removeAll() []*resolveRequest {
-	r.Lock()
-	defer r.Unlock()
+// sent returns the number of requests written to the resolver that are awaiting a response.
+func (r *xchgManager) sent() int {
+	var n int
 
-	var keys []string
-	for key := range r.xchgs {
-		keys = append(keys, key)
+	for _, s := range r.shards {
+		s.Lock()
+		n += len(s.deadlines)
+		s.Unlock()
 	}
+	return n
+}
+
+// size returns the number of requests tracked, including those not yet written to the resolver.
+func (r *xchgManager) size() int {
+	var n int
 
-	return r.delete(keys)
+	for _, s := range r.shards {
+		s.Lock()
+		n += len(s.xchgs)
+		s.Unlock()
+	}
+	return n
 }
 
-func (r *xchgManager) delete(keys []string) []*resolveRequest {
+// removeExpired removes the requests sent without a response before their deadline. Only
+// the expired requests are visited, since the earliest deadlines are at the top of the heaps.
+func (r *xchgManager) removeExpired() []*resolveRequest {
 	var removed []*resolveRequest
 
-	for _, k := range keys {
-		req := r.xchgs[k]
+	now := time.Now()
+	for _, s := range r.shards {
+		s.Lock()
+		for len(s.deadlines) > 0 && now.After(s.deadlines[0].deadline) {
+			req := heap.Pop(&s.deadlines).(*resolveRequest)
+
+			delete(s.xchgs, req.key)
+			removed = append(removed, req)
+		}
+		s.Unlock()
+	}
+
+	r.release(removed)
+	return removed
+}
+
+func (r *xchgManager) removeAll() []*resolveRequest {
+	var removed []*resolveRequest
 
-		r.xchgs[k] = nil
-		delete(r.xchgs, k)
-		removed = append(removed, req)
+	for _, s := range r.shards {
+		s.Lock()
+		for _, req := range s.xchgs {
+			removed = append(removed, req)
+		}
+		s.xchgs = make(map[xchgKey]*resolveRequest)
+		s.deadlines = nil
+		s.Unlock()
 	}
 
+	r.release(removed)
 	return removed
 }
 
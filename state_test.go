@@ -4,7 +4,9 @@
 package resolve
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -136,6 +138,89 @@ func TestXchgRemoveAll(t *testing.T) {
 	}
 }
 
+func TestXchgShards(t *testing.T) {
+	xchg := newXchgManager()
+
+	var wg sync.WaitGroup
+	num := 500
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			for j := 0; j < num; j++ {
+				name := fmt.Sprintf("host%d-%d.caffix.net", worker, j)
+				if err := xchg.add(&resolveRequest{ID: uint16(j), Name: name, Timestamp: time.Now()}); err != nil {
+					t.Errorf("Failed to add the request for %s: %v", name, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := xchg.size(); n != 4*num {
+		t.Fatalf("The manager tracked %d requests instead of %d", n, 4*num)
+	}
+	// The requests must be spread across the shards
+	for i, s := range xchg.shards {
+		if len(s.xchgs) == 0 {
+			t.Errorf("Shard %d did not receive any requests", i)
+		}
+	}
+
+	if req := xchg.remove(7, "HOST2-7.caffix.net."); req == nil || req.Name != "host2-7.caffix.net" {
+		t.Errorf("The request was not found using a name differing in case")
+	}
+	if n := len(xchg.removeAll()); n != 4*num-1 {
+		t.Errorf("removeAll returned %d requests instead of %d", n, 4*num-1)
+	}
+	if n := xchg.sent(); n != 0 {
+		t.Errorf("%d requests remained after removing all", n)
+	}
+}
+
+func TestXchgDeadlineOrder(t *testing.T) {
+	xchg := newXchgManager()
+	QueryTimeout = time.Second
+
+	now := time.Now()
+	var reqs []*resolveRequest
+	// Add the requests out of order to ensure the expired requests are found regardless
+	for i, age := range []int{1, 5, 3, 0, 4, 2} {
+		req := &resolveRequest{
+			ID:        uint16(i),
+			Name:      fmt.Sprintf("host%d.caffix.net", i),
+			Timestamp: now.Add(-time.Duration(age) * 400 * time.Millisecond),
+		}
+		if err := xchg.add(req); err != nil {
+			t.Fatalf("Failed to add the request: %v", err)
+		}
+		reqs = append(reqs, req)
+	}
+	// A request not yet sent must never expire
+	if err := xchg.add(&resolveRequest{ID: 100, Name: "unsent.caffix.net"}); err != nil {
+		t.Fatalf("Failed to add the request: %v", err)
+	}
+	if n := xchg.sent(); n != len(reqs) {
+		t.Errorf("The manager reported %d requests sent instead of %d", n, len(reqs))
+	}
+	// The request that would expire first is removed from the heap and must not be returned
+	_ = xchg.remove(reqs[1].ID, reqs[1].Name)
+
+	expired := xchg.removeExpired()
+	if len(expired) != 2 {
+		t.Fatalf("removeExpired returned %d requests instead of 2", len(expired))
+	}
+	for _, req := range expired {
+		if req != reqs[2] && req != reqs[4] {
+			t.Errorf("removeExpired returned %s, which had not expired", req.Name)
+		}
+	}
+	if n := xchg.size(); n != 4 {
+		t.Errorf("The manager tracked %d requests instead of 4", n)
+	}
+}
+
 func TestSlidingWindowBelowMin(t *testing.T) {
 	timeouts := newSlidingWindowTimeouts()
 
@@ -169,3 +254,53 @@ func TestSlidingWindowFailurePercentage(t *testing.T) {
 		t.Errorf("Failed to report true after reaching the failure percentage")
 	}
 }
+
+func TestXchgAdaptiveTimeout(t *testing.T) {
+	xchg := newXchgManager()
+	xchg.timeout = func(min, max time.Duration) time.Duration { return 100 * time.Millisecond }
+
+	fast := &resolveRequest{ID: 1, Name: "fast.caffix.net"}
+	if err := xchg.add(fast); err != nil {
+		t.Fatalf("Failed to add the request: %v", err)
+	}
+	xchg.updateTimestamp(fast.ID, fast.Name)
+
+	xchg.timeout = func(min, max time.Duration) time.Duration { return time.Minute }
+	slow := &resolveRequest{ID: 2, Name: "slow.caffix.net"}
+	if err := xchg.add(slow); err != nil {
+		t.Fatalf("Failed to add the request: %v", err)
+	}
+	xchg.updateTimestamp(slow.ID, slow.Name)
+
+	time.Sleep(150 * time.Millisecond)
+	if expired := xchg.removeExpired(); len(expired) != 1 || expired[0] != fast {
+		t.Errorf("Only the request with the shorter timeout should have expired: %v", expired)
+	}
+}
+
+func TestXchgTake(t *testing.T) {
+	xchg := newXchgManager()
+	req := &resolveRequest{ID: 1, Name: "take.caffix.net", Timestamp: time.Now()}
+	if err := xchg.add(req); err != nil {
+		t.Fatalf("Failed to add the request: %v", err)
+	}
+
+	reject := func(*resolveRequest) DropReason { return DropQuestionMismatch }
+	if r, reason := xchg.take(1, "take.caffix.net.", reject); r != nil || reason != DropQuestionMismatch {
+		t.Errorf("The request was taken for a response that failed the check")
+	}
+	if xchg.size() != 1 || xchg.sent() != 1 {
+		t.Errorf("The request was removed for a response that failed the check")
+	}
+
+	accept := func(*resolveRequest) DropReason { return "" }
+	if r, reason := xchg.take(2, "take.caffix.net.", accept); r != nil || reason != DropNoExchange {
+		t.Errorf("A request was taken for a response with another ID")
+	}
+	if r, reason := xchg.take(1, "TAKE.caffix.net.", accept); r != req || reason != "" {
+		t.Errorf("The request was not taken for a matching response")
+	}
+	if xchg.size() != 0 || xchg.sent() != 0 {
+		t.Errorf("The request remained after being taken")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ResolverStats contains the counters collected by a ResolverPool for one of its resolvers.
+type ResolverStats struct {
+	Address string
+	// Queries is the number of queries sent to the resolver.
+	Queries int
+	// Answers is the number of queries that received a response, regardless of the rcode.
+	Answers   int
+	Timeouts  int
+	Servfails int
+	// AvgRTT is the average round-trip time of the queries that received a response.
+	AvgRTT time.Duration
+	// P50RTT, P95RTT and P99RTT are upper estimates of the round-trip time percentiles,
+	// which reveal the slow responses of overloaded resolvers hidden by the average.
+	P50RTT time.Duration
+	P95RTT time.Duration
+	P99RTT time.Duration
+	// LastSeen is the time of the last response received from the resolver.
+	LastSeen time.Time
+	// CanaryFailures is the number of canary names the resolver answered incorrectly.
+	CanaryFailures int
+	// Mismatches is the number of responses dropped for not matching the query sent.
+	Mismatches uint64
+	// Rcodes is the number of responses received by rcode, and Drops the number of responses dropped by reason.
+	Rcodes map[int]uint64
+	Drops  map[DropReason]uint64
+}
+
+type mismatchCounter interface {
+	responseMismatches() uint64
+}
+
+type statsEntry struct {
+	queries   int
+	answers   int
+	timeouts  int
+	servfails int
+	rtt       time.Duration
+	latency   latencyHistogram
+	lastSeen  time.Time
+	canaries  int
+}
+
+type statsTracker struct {
+	sync.Mutex
+	entries map[string]*statsEntry
+}
+
+func newStatsTracker() *statsTracker {
+	return &statsTracker{entries: make(map[string]*statsEntry)}
+}
+
+func (st *statsTracker) entry(addr string) *statsEntry {
+	e, found := st.entries[addr]
+	if !found {
+		e = new(statsEntry)
+		st.entries[addr] = e
+	}
+	return e
+}
+
+func (st *statsTracker) record(addr string, rtt time.Duration, err error) {
+	st.Lock()
+	defer st.Unlock()
+
+	e := st.entry(addr)
+	e.queries++
+	if err != nil {
+		re, ok := err.(*ResolveError)
+		if !ok || re.Rcode == ResolverErrRcode {
+			return
+		}
+		if re.Rcode == TimeoutRcode {
+			e.timeouts++
+			return
+		}
+		if re.Rcode == dns.RcodeServerFailure {
+			e.servfails++
+		}
+	}
+
+	e.answers++
+	e.rtt += rtt
+	e.latency.observe(rtt)
+	e.lastSeen = time.Now()
+}
+
+func (st *statsTracker) canaryFailures(addr string, failures int) {
+	st.Lock()
+	defer st.Unlock()
+
+	st.entry(addr).canaries += failures
+}
+
+func (st *statsTracker) remove(addr string) {
+	st.Lock()
+	defer st.Unlock()
+
+	delete(st.entries, addr)
+}
+
+func (st *statsTracker) stats(addr string) ResolverStats {
+	st.Lock()
+	defer st.Unlock()
+
+	s := ResolverStats{Address: addr}
+	if e, found := st.entries[addr]; found {
+		s.Queries = e.queries
+		s.Answers = e.answers
+		s.Timeouts = e.timeouts
+		s.Servfails = e.servfails
+		s.LastSeen = e.lastSeen
+		s.CanaryFailures = e.canaries
+		if e.answers > 0 {
+			s.AvgRTT = e.rtt / time.Duration(e.answers)
+		}
+		s.P50RTT = e.latency.percentile(0.50)
+		s.P95RTT = e.latency.percentile(0.95)
+		s.P99RTT = e.latency.percentile(0.99)
+	}
+	return s
+}
+
+// Stats returns the counters collected for each resolver in the pool.
+func (rp *ResolverPool) Stats() []ResolverStats {
+	var stats []ResolverStats
+
+	for _, r := range rp.resolvers() {
+		s := rp.stats.stats(r.String())
+		if mc, ok := r.(mismatchCounter); ok {
+			s.Mismatches = mc.responseMismatches()
+		}
+		if rc, ok := r.(responseCounter); ok {
+			counts := rc.responseCounts()
+			s.Rcodes, s.Drops = counts.Rcodes, counts.Drops
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestPoolStats(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Name == "servfail.stats.net." {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+			return
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	for i := 0; i < 3; i++ {
+		if _, err := pool.Query(context.TODO(), QueryMsg("answer.stats.net", dns.TypeA), PriorityNormal, nil); err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+	}
+	_, _ = pool.Query(context.TODO(), QueryMsg("servfail.stats.net", dns.TypeA), PriorityLow, nil)
+
+	stats := pool.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("Stats returned %d entries instead of 1", len(stats))
+	}
+
+	st := stats[0]
+	if st.Address != r.String() {
+		t.Errorf("The stats were for %s instead of %s", st.Address, r.String())
+	}
+	if st.Answers != st.Queries || st.Answers < 4 {
+		t.Errorf("The stats counted %d answers for %d queries", st.Answers, st.Queries)
+	}
+	if st.Servfails != st.Queries-3 {
+		t.Errorf("The stats counted %d SERVFAILs instead of %d", st.Servfails, st.Queries-3)
+	}
+	if st.Timeouts != 0 {
+		t.Errorf("The stats counted %d unexpected timeouts", st.Timeouts)
+	}
+	if st.AvgRTT <= 0 || st.LastSeen.IsZero() {
+		t.Errorf("The stats did not record the response times")
+	}
+	if st.P50RTT <= 0 || st.P50RTT > st.P95RTT || st.P95RTT > st.P99RTT {
+		t.Errorf("The stats provided inconsistent percentiles: %v, %v, %v", st.P50RTT, st.P95RTT, st.P99RTT)
+	}
+}
+
+func TestStatsPercentiles(t *testing.T) {
+	st := newStatsTracker()
+
+	// A bimodal distribution, with most responses fast and the rest very slow
+	for i := 0; i < 90; i++ {
+		st.record("192.0.2.1:53", 10*time.Millisecond, nil)
+	}
+	for i := 0; i < 10; i++ {
+		st.record("192.0.2.1:53", time.Second, nil)
+	}
+
+	s := st.stats("192.0.2.1:53")
+	if s.P50RTT < 10*time.Millisecond || s.P50RTT > 15*time.Millisecond {
+		t.Errorf("The median was %v instead of near 10ms", s.P50RTT)
+	}
+	if s.P95RTT < 900*time.Millisecond || s.P99RTT != time.Second {
+		t.Errorf("The tail percentiles were %v and %v instead of near one second", s.P95RTT, s.P99RTT)
+	}
+	if s.AvgRTT < 100*time.Millisecond || s.AvgRTT > 110*time.Millisecond {
+		t.Errorf("The average was %v instead of 109ms", s.AvgRTT)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/miekg/dns"
+)
+
+// SetStickyZones causes all queries for names within the same registered domain to be sent
+// through the same resolver, so negative caching and wildcard behavior are coherent per zone.
+// Rendezvous hashing is used, so changes to the resolver set only move the zones of the
+// resolvers that were added or removed.
+func (rp *ResolverPool) SetStickyZones(enabled bool) {
+	defer rp.configChanged("sticky_zones", "enabled", enabled)
+	rp.Lock()
+	defer rp.Unlock()
+
+	rp.sticky = enabled
+}
+
+// stickyZone returns the zone used to select the resolver for the message, or an empty
+// string when sticky assignment is not enabled.
+func (rp *ResolverPool) stickyZone(msg *dns.Msg) string {
+	rp.Lock()
+	defer rp.Unlock()
+
+	if !rp.sticky || len(msg.Question) == 0 {
+		return ""
+	}
+	return registeredDomain(msg.Question[0].Name)
+}
+
+func (rp *ResolverPool) nextStickyResolver(ctx context.Context, zone string) Resolver {
+	region, _ := regionFromContext(ctx)
+
+	rp.Lock()
+	defer rp.Unlock()
+
+	var best Resolver
+	var highest uint64
+	for _, r := range rp.usableResolvers(region) {
+		if w := rendezvousWeight(zone, r.String()); best == nil || w > highest {
+			best = r
+			highest = w
+		}
+	}
+
+	if best != nil {
+		rp.outstanding[best.String()]++
+	}
+	return best
+}
+
+func rendezvousWeight(zone, addr string) uint64 {
+	h := fnv.New64a()
+
+	_, _ = h.Write([]byte(zone))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(addr))
+	return h.Sum64()
+}
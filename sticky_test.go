@@ -0,0 +1,60 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestStickyZones(t *testing.T) {
+	var res []Resolver
+	for i := 1; i <= 5; i++ {
+		r := NewBaseResolver(fmt.Sprintf("127.0.0.%d:53", i), 100, nil)
+		defer r.Stop()
+
+		res = append(res, r)
+	}
+
+	pool := NewResolverPool(res, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	pool.SetStickyZones(true)
+	zone := pool.stickyZone(QueryMsg("www.sticky.co.uk", dns.TypeA))
+	if zone != "sticky.co.uk" {
+		t.Fatalf("The sticky zone was %s instead of sticky.co.uk", zone)
+	}
+
+	first := pool.nextStickyResolver(context.TODO(), zone)
+	pool.releaseResolver(first)
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("host%d.sticky.co.uk", i)
+
+		r := pool.nextStickyResolver(context.TODO(), pool.stickyZone(QueryMsg(name, dns.TypeA)))
+		pool.releaseResolver(r)
+		if r != first {
+			t.Errorf("The query for %s was assigned to %s instead of %s", name, r, first)
+		}
+	}
+
+	// Removing another resolver must not move the zone
+	for _, r := range res {
+		if r != first {
+			pool.removeResolvers([]string{r.String()})
+			break
+		}
+	}
+	if r := pool.nextStickyResolver(context.TODO(), zone); r != first {
+		t.Errorf("The zone moved after removing an unrelated resolver")
+	}
+
+	pool.SetStickyZones(false)
+	if zone := pool.stickyZone(QueryMsg("www.sticky.co.uk", dns.TypeA)); zone != "" {
+		t.Errorf("A sticky zone was returned while the option is disabled")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+)
+
+// StreamResult is a Result produced by QueryStream along with the name that was queried.
+type StreamResult struct {
+	Name string
+	Result
+}
+
+// QueryStream queries each name received from the names channel for the qtype, and sends the results
+// on the returned channel in the order they complete. The number of queries performed at the same time
+// is bounded, and names are only received while the caller keeps reading the results.
+// The returned channel is closed once the names channel is closed and all the queries complete,
+// or once the context expires.
+func (rp *ResolverPool) QueryStream(ctx context.Context, names <-chan string, qtype uint16) <-chan StreamResult {
+	workers := rp.batchConcurrency()
+	results := make(chan StreamResult, workers)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go rp.streamWorker(ctx, &wg, names, qtype, results)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+func (rp *ResolverPool) streamWorker(ctx context.Context, wg *sync.WaitGroup,
+	names <-chan string, qtype uint16, results chan<- StreamResult) {
+	defer wg.Done()
+
+	for {
+		var name string
+		var ok bool
+
+		select {
+		case <-ctx.Done():
+			return
+		case name, ok = <-names:
+			if !ok {
+				return
+			}
+		}
+
+		res := QueryResult(ctx, rp, QueryMsg(name, qtype), PriorityNormal, PoolRetryPolicy)
+		select {
+		case <-ctx.Done():
+			return
+		case results <- StreamResult{Name: name, Result: *res}:
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestQueryStream(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 1000, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	num := 200
+	names := make(chan string)
+	go func() {
+		defer close(names)
+
+		for i := 0; i < num; i++ {
+			names <- fmt.Sprintf("host%d.stream.net", i)
+		}
+	}()
+
+	seen := make(map[string]bool)
+	for res := range pool.QueryStream(context.TODO(), names, dns.TypeA) {
+		if res.Err != nil || res.Msg == nil {
+			t.Errorf("The query for %s failed: %v", res.Name, res.Err)
+		} else if q := RemoveLastDot(res.Msg.Question[0].Name); q != res.Name {
+			t.Errorf("The result for %s contained the response for %s", res.Name, q)
+		}
+		seen[res.Name] = true
+	}
+	if len(seen) != num {
+		t.Errorf("QueryStream returned results for %d names instead of %d", len(seen), num)
+	}
+}
+
+func TestQueryStreamCancelled(t *testing.T) {
+	pool := NewResolverPool([]Resolver{NewBaseResolver("127.0.0.2:53", 10, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	names := make(chan string)
+	results := pool.QueryStream(ctx, names, dns.TypeA)
+	cancel()
+
+	select {
+	case _, ok := <-results:
+		for ok {
+			_, ok = <-results
+		}
+	case <-time.After(time.Second):
+		t.Errorf("The results channel was not closed after the context expired")
+	}
+}
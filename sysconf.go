@@ -0,0 +1,93 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultResolvConf is the location of the resolver configuration file on Unix systems.
+const DefaultResolvConf = "/etc/resolv.conf"
+
+// SystemConfig contains the DNS resolver configuration used by the operating system.
+type SystemConfig struct {
+	// Servers are the nameserver addresses, including the port number.
+	Servers  []string
+	Search   []string
+	Ndots    int
+	Timeout  time.Duration
+	Attempts int
+}
+
+// ResolvConfFromFile parses a resolv.conf(5) file, such as DefaultResolvConf.
+func ResolvConfFromFile(path string) (*SystemConfig, error) {
+	conf, err := dns.ClientConfigFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	port := conf.Port
+	if port == "" {
+		port = "53"
+	}
+
+	var servers []string
+	for _, s := range conf.Servers {
+		servers = append(servers, net.JoinHostPort(s, port))
+	}
+
+	return &SystemConfig{
+		Servers:  servers,
+		Search:   conf.Search,
+		Ndots:    conf.Ndots,
+		Timeout:  time.Duration(conf.Timeout) * time.Second,
+		Attempts: conf.Attempts,
+	}, nil
+}
+
+// SystemResolverConfig returns the DNS resolver configuration of the operating system.
+func SystemResolverConfig() (*SystemConfig, error) {
+	return systemResolverConfig()
+}
+
+// NewSystemResolverPool initializes a ResolverPool seeded with the resolvers used by the operating system.
+// The timeout and attempts of the system configuration are applied to the queries sent by the pool,
+// trying each resolver the number of attempts, as the C library resolver does.
+func NewSystemResolverPool(perSec int, delay time.Duration, logger *log.Logger) (*ResolverPool, error) {
+	conf, err := SystemResolverConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newSystemResolverPool(conf, perSec, delay, logger)
+}
+
+func newSystemResolverPool(conf *SystemConfig, perSec int, delay time.Duration, logger *log.Logger) (*ResolverPool, error) {
+	var resolvers []Resolver
+	for _, addr := range conf.Servers {
+		if r := NewBaseResolver(addr, perSec, logger); r != nil {
+			resolvers = append(resolvers, r)
+		}
+	}
+
+	if len(resolvers) == 0 {
+		return nil, errors.New("NewSystemResolverPool: Failed to initialize any of the system resolvers")
+	}
+
+	pool := NewResolverPool(resolvers, delay, nil, 1, logger)
+	if conf.Timeout > 0 {
+		pool.SetConfig(PoolConfig{QueryTimeout: conf.Timeout})
+	}
+	if conf.Attempts > 0 {
+		pool.SetRetryStrategy(&ExponentialBackoff{
+			Attempts: conf.Attempts * len(resolvers),
+			Switch:   true,
+		})
+	}
+	return pool, nil
+}
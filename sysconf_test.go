@@ -0,0 +1,71 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolvConfFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolvconf")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "resolv.conf")
+	data := "nameserver 8.8.8.8\nnameserver 2001:4860:4860::8888\nsearch caffix.net\noptions ndots:2 timeout:3 attempts:4\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write the resolv.conf file: %v", err)
+	}
+
+	conf, err := ResolvConfFromFile(path)
+	if err != nil {
+		t.Fatalf("Failed to parse the resolv.conf file: %v", err)
+	}
+
+	if len(conf.Servers) != 2 || conf.Servers[0] != "8.8.8.8:53" || conf.Servers[1] != "[2001:4860:4860::8888]:53" {
+		t.Errorf("The servers were parsed as %v", conf.Servers)
+	}
+	if len(conf.Search) != 1 || conf.Search[0] != "caffix.net" {
+		t.Errorf("The search domains were parsed as %v", conf.Search)
+	}
+	if conf.Ndots != 2 || conf.Timeout != 3*time.Second || conf.Attempts != 4 {
+		t.Errorf("The options were parsed as ndots:%d timeout:%s attempts:%d", conf.Ndots, conf.Timeout, conf.Attempts)
+	}
+
+	if _, err := ResolvConfFromFile(filepath.Join(dir, "missing.conf")); err == nil {
+		t.Errorf("No error was returned for a missing file")
+	}
+}
+
+func TestSystemResolverPoolOptions(t *testing.T) {
+	conf := &SystemConfig{
+		Servers:  []string{"127.0.0.1:53", "127.0.0.2:53"},
+		Timeout:  3 * time.Second,
+		Attempts: 4,
+	}
+
+	pool, err := newSystemResolverPool(conf, 10, time.Second, nil)
+	if err != nil {
+		t.Fatalf("Failed to create the pool: %v", err)
+	}
+	defer pool.Stop()
+
+	if to := pool.Config().QueryTimeout; to != 3*time.Second {
+		t.Errorf("The pool used the query timeout %v instead of the system timeout", to)
+	}
+	s := pool.retryStrategy()
+	if s == nil || s.MaxAttempts(PriorityNormal) != 8 || !s.SwitchResolver() {
+		t.Errorf("The pool did not try each system resolver the number of attempts")
+	}
+
+	if _, err := newSystemResolverPool(&SystemConfig{}, 10, time.Second, nil); err == nil {
+		t.Errorf("A pool was created without any system resolvers")
+	}
+}
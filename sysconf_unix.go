@@ -0,0 +1,11 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package resolve
+
+func systemResolverConfig() (*SystemConfig, error) {
+	return ResolvConfFromFile(DefaultResolvConf)
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build windows
+// +build windows
+
+package resolve
+
+import (
+	"errors"
+	"net"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows reports these site-local addresses when an adapter has no DNS servers configured.
+var windowsDefaultDNS = []string{"fec0:0:0:ffff::1", "fec0:0:0:ffff::2", "fec0:0:0:ffff::3"}
+
+func systemResolverConfig() (*SystemConfig, error) {
+	aas, err := adapterAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	conf := &SystemConfig{
+		Ndots:    1,
+		Timeout:  5 * time.Second,
+		Attempts: 2,
+	}
+	for _, aa := range aas {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			ip := dns.Address.IP()
+			if ip == nil || isWindowsDefaultDNS(ip) {
+				continue
+			}
+
+			addr := net.JoinHostPort(ip.String(), "53")
+			if _, found := seen[addr]; !found {
+				seen[addr] = struct{}{}
+				conf.Servers = append(conf.Servers, addr)
+			}
+		}
+	}
+
+	if len(conf.Servers) == 0 {
+		return nil, errors.New("SystemResolverConfig: No DNS servers were found on the network adapters")
+	}
+	return conf, nil
+}
+
+func adapterAddresses() ([]*windows.IpAdapterAddresses, error) {
+	var buf []byte
+
+	size := uint32(15000)
+	for {
+		buf = make([]byte, size)
+		aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_PREFIX, 0, aa, &size)
+		if err == nil {
+			break
+		}
+		if errno, ok := err.(windows.Errno); !ok || errno != windows.ERROR_BUFFER_OVERFLOW || size <= uint32(len(buf)) {
+			return nil, err
+		}
+	}
+
+	var aas []*windows.IpAdapterAddresses
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0])); aa != nil; aa = aa.Next {
+		aas = append(aas, aa)
+	}
+	return aas, nil
+}
+
+func isWindowsDefaultDNS(ip net.IP) bool {
+	for _, d := range windowsDefaultDNS {
+		if ip.Equal(net.ParseIP(d)) {
+			return true
+		}
+	}
+	return false
+}
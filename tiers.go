@@ -0,0 +1,26 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"log"
+	"time"
+)
+
+// NewTieredResolverPool initializes a ResolverPool that sends queries to the fast, untrusted resolvers,
+// and verifies each positive answer against the pool of trusted resolvers before returning it.
+// Untrusted resolvers that return answers the trusted resolvers cannot confirm are stopped.
+func NewTieredResolverPool(untrusted, trusted []Resolver, delay time.Duration, partnum int, logger *log.Logger) *ResolverPool {
+	baseline := NewResolverPool(trusted, delay, nil, 1, logger)
+	if baseline == nil {
+		return nil
+	}
+
+	pool := NewResolverPool(untrusted, delay, baseline, partnum, logger)
+	if pool == nil {
+		baseline.Stop()
+		return nil
+	}
+	return pool
+}
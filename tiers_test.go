@@ -0,0 +1,58 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestTieredResolverPool(t *testing.T) {
+	liar, laddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer liar.Shutdown()
+
+	honest, haddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if req.Question[0].Name == "exists.tiers.net." {
+			typeAHandler(w, req)
+			return
+		}
+
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNameError)
+		w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer honest.Shutdown()
+
+	if pool := NewTieredResolverPool([]Resolver{NewBaseResolver(laddr, 100, nil)}, nil, time.Second, 1, nil); pool != nil {
+		t.Errorf("A pool was returned without any trusted resolvers")
+	}
+
+	untrusted := NewBaseResolver(laddr, 100, nil)
+	pool := NewTieredResolverPool([]Resolver{untrusted}, []Resolver{NewBaseResolver(haddr, 100, nil)}, time.Second, 1, nil)
+	defer pool.Stop()
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("exists.tiers.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The verified query failed: %v", err)
+	}
+	if untrusted.Stopped() {
+		t.Errorf("The untrusted resolver was stopped after a verified answer")
+	}
+
+	_, err = pool.Query(context.TODO(), QueryMsg("forged.tiers.net", dns.TypeA), PriorityNormal, nil)
+	if reason := ErrorReason(err); reason != ReasonValidationRejected {
+		t.Errorf("The forged answer returned reason %s instead of %s", reason, ReasonValidationRejected)
+	}
+	if !untrusted.Stopped() {
+		t.Errorf("The untrusted resolver was not stopped after returning a forged answer")
+	}
+}
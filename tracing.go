@@ -0,0 +1,101 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The attributes set on the spans created for queries and their attempts.
+const (
+	AttrQueryName = "dns.question.name"
+	AttrQueryType = "dns.question.type"
+	AttrResolver  = "dns.resolver"
+	AttrRcode     = "dns.rcode"
+	AttrRTT       = "dns.rtt_ms"
+	AttrAttempt   = "dns.attempt"
+	AttrError     = "error"
+	// AttrCorrelationID is set when the context of the query carries a correlation ID
+	AttrCorrelationID = "correlation.id"
+)
+
+// The names of the spans created for queries and their attempts.
+const (
+	SpanQuery   = "dns.query"
+	SpanAttempt = "dns.attempt"
+)
+
+// Tracer creates the spans describing the queries performed by a ResolverPool, so a tracing system such
+// as OpenTelemetry can be adapted to it without this package depending on one. The span started must be
+// a child of the span found in the provided context, and the returned context must carry the new span.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End()
+}
+
+// SetTracer provides the Tracer used to create a span for each query performed by the pool, with a child
+// span for each attempt, including the trusted resolvers, the type resolvers and the standby set.
+// Providing nil stops the creation of spans.
+func (rp *ResolverPool) SetTracer(t Tracer) {
+	rp.Lock()
+	rp.tracer = t
+	subs := rp.subPools()
+	rp.Unlock()
+
+	for _, sub := range subs {
+		sub.SetTracer(t)
+	}
+}
+
+// startSpan returns a span created by the Tracer of the pool, or nil when tracing is not enabled.
+func (rp *ResolverPool) startSpan(ctx context.Context, name string, msg *dns.Msg) (context.Context, Span) {
+	rp.Lock()
+	t := rp.tracer
+	rp.Unlock()
+
+	if t == nil {
+		return ctx, nil
+	}
+
+	ctx, span := t.Start(ctx, name)
+	if len(msg.Question) > 0 {
+		span.SetAttribute(AttrQueryName, RemoveLastDot(msg.Question[0].Name))
+		span.SetAttribute(AttrQueryType, dns.TypeToString[msg.Question[0].Qtype])
+	}
+	if id := CorrelationID(ctx); id != "" {
+		span.SetAttribute(AttrCorrelationID, id)
+	}
+	return ctx, span
+}
+
+// endSpan sets the attributes describing the outcome on the span, and ends it.
+func endSpan(span Span, r Resolver, resp *dns.Msg, rtt time.Duration, err error) {
+	if span == nil {
+		return
+	}
+
+	if r != nil {
+		span.SetAttribute(AttrResolver, r.String())
+		span.SetAttribute(AttrRTT, float64(rtt)/float64(time.Millisecond))
+	}
+
+	// Timeouts and resolver errors are not rcodes received from the resolver
+	if e, ok := err.(*ResolveError); ok && e.Rcode != TimeoutRcode && e.Rcode != ResolverErrRcode {
+		span.SetAttribute(AttrRcode, dns.RcodeToString[e.Rcode])
+	} else if err == nil && resp != nil {
+		span.SetAttribute(AttrRcode, dns.RcodeToString[resp.Rcode])
+	}
+	if err != nil {
+		span.SetAttribute(AttrError, err.Error())
+	}
+	span.End()
+}
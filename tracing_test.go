@@ -0,0 +1,131 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type testSpanKey struct{}
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	ended  bool
+	tracer *testTracer
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+
+	s.attrs[key] = value
+}
+
+func (s *testSpan) End() {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+
+	s.ended = true
+}
+
+type testTracer struct {
+	sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.Lock()
+	defer t.Unlock()
+
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{
+		name:   name,
+		parent: parent,
+		attrs:  make(map[string]interface{}),
+		tracer: t,
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func TestTracing(t *testing.T) {
+	var lock sync.Mutex
+	counts := make(map[string]int)
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		lock.Lock()
+		counts[req.Question[0].Name]++
+		fail := counts[req.Question[0].Name] < 2
+		lock.Unlock()
+
+		if fail {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeServerFailure)
+			_ = w.WriteMsg(m)
+			return
+		}
+		typeAHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	pool := NewResolverPool([]Resolver{r}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	for _, async := range []bool{false, true} {
+		tracer := new(testTracer)
+		pool.SetTracer(tracer)
+
+		ctx, caller := tracer.Start(context.Background(), "caller")
+		if async {
+			done := make(chan Result, 1)
+			QueryAsync(ctx, pool, "async.tracing.net", dns.TypeA, func(res Result) { done <- res })
+			<-done
+		} else if _, err := pool.Query(ctx, QueryMsg("sync.tracing.net", dns.TypeA), PriorityNormal, nil); err != nil {
+			t.Fatalf("The query failed: %v", err)
+		}
+
+		tracer.Lock()
+		var query *testSpan
+		var attempts []*testSpan
+		for _, span := range tracer.spans {
+			if !span.ended && span != caller {
+				t.Errorf("The %s span was not ended", span.name)
+			}
+			switch span.name {
+			case SpanQuery:
+				query = span
+			case SpanAttempt:
+				attempts = append(attempts, span)
+			}
+		}
+		if query == nil || query.parent != caller {
+			t.Fatalf("The query span was not a child of the caller span")
+		}
+		if query.attrs[AttrRcode] != "NOERROR" || query.attrs[AttrQueryType] != "A" {
+			t.Errorf("The query span had unexpected attributes: %v", query.attrs)
+		}
+		if len(attempts) != 2 {
+			t.Fatalf("%d attempt spans were created instead of 2", len(attempts))
+		}
+		for i, span := range attempts {
+			if span.parent != query || span.attrs[AttrAttempt] != i+1 || span.attrs[AttrResolver] != r.String() {
+				t.Errorf("The attempt span had unexpected attributes: %v", span.attrs)
+			}
+		}
+		if attempts[0].attrs[AttrRcode] != "SERVFAIL" {
+			t.Errorf("The failed attempt span had the rcode %v", attempts[0].attrs[AttrRcode])
+		}
+		tracer.Unlock()
+	}
+}
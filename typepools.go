@@ -0,0 +1,76 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"github.com/miekg/dns"
+)
+
+// SetTypeResolvers routes the queries for the provided types to a separate sub-pool built from the
+// provided resolvers, keeping bulk traffic of one type from starving the queries of other types.
+// Providing no resolvers removes the routing for the types.
+func (rp *ResolverPool) SetTypeResolvers(qtypes []uint16, resolvers []Resolver, partnum int) {
+	var sub *ResolverPool
+	if len(resolvers) > 0 {
+		sub = NewResolverPool(resolvers, rp.delay, nil, partnum, rp.log)
+	}
+	if sub != nil {
+		rp.inheritObservers(sub)
+		rp.inheritConfig(sub)
+	}
+	defer rp.configChanged("type_resolvers", "types", len(qtypes), "resolvers", len(resolvers))
+
+	rp.Lock()
+	var old []*ResolverPool
+	for _, qtype := range qtypes {
+		if prev, found := rp.typePools[qtype]; found {
+			old = append(old, prev)
+		}
+		if sub != nil {
+			rp.typePools[qtype] = sub
+		} else {
+			delete(rp.typePools, qtype)
+		}
+	}
+
+	// Stop the sub-pools that no longer serve any types
+	used := make(map[*ResolverPool]struct{})
+	for _, p := range rp.typePools {
+		used[p] = struct{}{}
+	}
+	rp.Unlock()
+
+	for _, p := range old {
+		if _, found := used[p]; !found {
+			p.Stop()
+		}
+	}
+}
+
+// typePool returns the sub-pool that serves the type of the provided message.
+func (rp *ResolverPool) typePool(msg *dns.Msg) *ResolverPool {
+	if len(msg.Question) == 0 {
+		return nil
+	}
+
+	rp.Lock()
+	defer rp.Unlock()
+
+	return rp.typePools[msg.Question[0].Qtype]
+}
+
+func (rp *ResolverPool) stopTypePools() {
+	rp.Lock()
+	pools := rp.typePools
+	rp.typePools = make(map[uint16]*ResolverPool)
+	rp.Unlock()
+
+	stopped := make(map[*ResolverPool]struct{})
+	for _, p := range pools {
+		if _, found := stopped[p]; !found {
+			stopped[p] = struct{}{}
+			p.Stop()
+		}
+	}
+}
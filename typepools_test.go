@@ -0,0 +1,49 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestTypeResolvers(t *testing.T) {
+	forward, faddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(typeAHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer forward.Shutdown()
+
+	reverse, raddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(nxdomainHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer reverse.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(faddr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	ptr := NewBaseResolver(raddr, 100, nil)
+	pool.SetTypeResolvers([]uint16{dns.TypePTR}, []Resolver{ptr}, 1)
+
+	if _, err := pool.Query(context.TODO(), QueryMsg("types.net", dns.TypeA), PriorityNormal, nil); err != nil {
+		t.Errorf("The forward query failed: %v", err)
+	}
+
+	_, err = pool.Query(context.TODO(), ReverseMsg("192.168.1.1"), PriorityNormal, nil)
+	if e, ok := err.(*ResolveError); !ok || e.Rcode != dns.RcodeNameError {
+		t.Errorf("The PTR query was not sent to the sub-pool: %v", err)
+	}
+
+	pool.SetTypeResolvers([]uint16{dns.TypePTR}, nil, 1)
+	if !ptr.Stopped() {
+		t.Errorf("The unused sub-pool was not stopped")
+	}
+	if _, err := pool.Query(context.TODO(), ReverseMsg("192.168.1.1"), PriorityNormal, nil); err != nil {
+		t.Errorf("The PTR query was not returned to the main pool: %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ValidationStatus is the outcome of DNSSEC validation for a response.
+type ValidationStatus int
+
+// The DNSSEC validation status values.
+const (
+	// ValidationNone indicates that validation was not performed.
+	ValidationNone ValidationStatus = iota
+	// ValidationSecure indicates that every record was authenticated by a chain to the trust anchors.
+	ValidationSecure
+	// ValidationInsecure indicates that records belong to zones proven to be unsigned.
+	ValidationInsecure
+	// ValidationBogus indicates that the signatures expected for the records are missing or invalid.
+	ValidationBogus
+	// ValidationIndeterminate indicates that the chain of trust could not be obtained.
+	ValidationIndeterminate
+)
+
+func (s ValidationStatus) String() string {
+	switch s {
+	case ValidationSecure:
+		return "secure"
+	case ValidationInsecure:
+		return "insecure"
+	case ValidationBogus:
+		return "bogus"
+	case ValidationIndeterminate:
+		return "indeterminate"
+	}
+	return "none"
+}
+
+// RootTrustAnchors are the DS records for the root zone keys used to begin the chain of trust.
+var RootTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBF683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+type zoneTrust struct {
+	keys   []*dns.DNSKEY
+	status ValidationStatus
+}
+
+// validator fetches and authenticates the zone keys needed while validating a single response.
+type validator struct {
+	r     Resolver
+	zones map[string]*zoneTrust
+}
+
+// ValidateResponse performs DNSSEC validation of the records in the response, using the Resolver to
+// obtain the DNSKEY and DS records along the chain of trust to RootTrustAnchors.
+func ValidateResponse(ctx context.Context, r Resolver, resp *dns.Msg) (ValidationStatus, error) {
+	if resp == nil {
+		return ValidationIndeterminate, fmt.Errorf("ValidateResponse: No response was provided")
+	}
+
+	records := resp.Answer
+	if len(records) == 0 {
+		records = resp.Ns
+	}
+	sets := rrsets(records)
+	if len(sets) == 0 {
+		return ValidationIndeterminate, fmt.Errorf("ValidateResponse: The response contains no records to validate")
+	}
+
+	v := &validator{r: r, zones: make(map[string]*zoneTrust)}
+	status := ValidationSecure
+	for _, set := range sets {
+		s, err := v.validateRRset(ctx, set, rrsigs(records, set[0]))
+		if err != nil {
+			return ValidationIndeterminate, err
+		}
+		if s > status {
+			status = s
+		}
+	}
+
+	if len(resp.Answer) == 0 && status == ValidationSecure {
+		// The signed records of a negative response must also prove the denial of the question
+		if len(resp.Question) == 0 {
+			return ValidationIndeterminate, fmt.Errorf("ValidateResponse: The negative response contains no question")
+		}
+
+		q := resp.Question[0]
+		proven, optOut := proveDenial(resp.Ns, q.Name, q.Qtype, resp.Rcode == dns.RcodeNameError)
+		if !proven {
+			return ValidationBogus, nil
+		}
+		if optOut {
+			return ValidationInsecure, nil
+		}
+	}
+	return status, nil
+}
+
+func (v *validator) validateRRset(ctx context.Context, set []dns.RR, sigs []*dns.RRSIG) (ValidationStatus, error) {
+	if len(sigs) == 0 {
+		// Unsigned records are only acceptable from unsigned zones
+		zone, err := v.enclosingZone(ctx, set[0].Header().Name)
+		if err != nil {
+			return ValidationIndeterminate, err
+		}
+
+		trust, err := v.zoneTrust(ctx, zone)
+		if err != nil || trust.status != ValidationSecure {
+			return trust.status, err
+		}
+		return ValidationBogus, nil
+	}
+
+	var insecure bool
+	for _, sig := range sigs {
+		trust, err := v.zoneTrust(ctx, sig.SignerName)
+		if err != nil {
+			return ValidationIndeterminate, err
+		}
+
+		switch trust.status {
+		case ValidationSecure:
+			if verifyRRset(set, sig, trust.keys) {
+				return ValidationSecure, nil
+			}
+		case ValidationInsecure:
+			insecure = true
+		}
+	}
+	if insecure {
+		return ValidationInsecure, nil
+	}
+	return ValidationBogus, nil
+}
+
+// zoneTrust authenticates the DNSKEY records of the zone using the DS records from the parent zone.
+func (v *validator) zoneTrust(ctx context.Context, zone string) (*zoneTrust, error) {
+	zone = strings.ToLower(dns.Fqdn(zone))
+	if trust, found := v.zones[zone]; found {
+		return trust, nil
+	}
+
+	trust := &zoneTrust{status: ValidationBogus}
+	// Prevent the chain from returning to a zone already being authenticated
+	v.zones[zone] = trust
+
+	var dsset []*dns.DS
+	if zone == "." {
+		for _, anchor := range RootTrustAnchors {
+			if rr, err := dns.NewRR(anchor); err == nil {
+				if ds, ok := rr.(*dns.DS); ok {
+					dsset = append(dsset, ds)
+				}
+			}
+		}
+	} else {
+		denied, ds, err := v.delegationSigner(ctx, zone)
+		if err != nil || denied != nil {
+			v.zones[zone] = denied
+			return denied, err
+		}
+		dsset = ds
+	}
+
+	resp, err := v.r.Query(ctx, WalkMsg(zone, dns.TypeDNSKEY), PriorityHigh, RetryPolicy)
+	if err != nil {
+		trust.status = ValidationIndeterminate
+		return trust, err
+	}
+
+	var keys []*dns.DNSKEY
+	for _, rr := range resp.Answer {
+		if key, ok := rr.(*dns.DNSKEY); ok && strings.EqualFold(key.Hdr.Name, zone) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return trust, nil
+	}
+
+	// The key signing keys must match the DS records and sign the DNSKEY RRset
+	var ksks []*dns.DNSKEY
+	for _, key := range keys {
+		if matchesDS(key, dsset) {
+			ksks = append(ksks, key)
+		}
+	}
+	for _, sig := range rrsigs(resp.Answer, keys[0]) {
+		if verifyRRset(dnskeyRRs(keys), sig, ksks) {
+			trust.keys = keys
+			trust.status = ValidationSecure
+			break
+		}
+	}
+	return trust, nil
+}
+
+// delegationSigner returns the authenticated DS records for the zone, or the trust
+// status of the zone when it has been proven to be unsigned.
+func (v *validator) delegationSigner(ctx context.Context, zone string) (*zoneTrust, []*dns.DS, error) {
+	resp, err := v.r.Query(ctx, WalkMsg(zone, dns.TypeDS), PriorityHigh, RetryPolicy)
+	if err != nil && (resp == nil || resp.Rcode != dns.RcodeNameError) {
+		return &zoneTrust{status: ValidationIndeterminate}, nil, err
+	}
+
+	records := resp.Answer
+	var dsset []*dns.DS
+	for _, rr := range records {
+		if ds, ok := rr.(*dns.DS); ok {
+			dsset = append(dsset, ds)
+		}
+	}
+	if len(dsset) == 0 {
+		// The denial of the DS records must be signed by the parent zone
+		records = resp.Ns
+	}
+
+	sets := rrsets(records)
+	if len(sets) == 0 {
+		return &zoneTrust{status: ValidationBogus}, nil, nil
+	}
+	for _, set := range sets {
+		status, err := v.validateRRset(ctx, set, rrsigs(records, set[0]))
+		if err != nil || status != ValidationSecure {
+			return &zoneTrust{status: status}, nil, err
+		}
+	}
+
+	if len(dsset) == 0 {
+		// Signed records from anywhere in the parent zone are not enough, they must deny the DS records of the zone
+		if proven, _ := proveDenial(records, zone, dns.TypeDS, resp.Rcode == dns.RcodeNameError); !proven {
+			return &zoneTrust{status: ValidationBogus}, nil, nil
+		}
+		return &zoneTrust{status: ValidationInsecure}, nil, nil
+	}
+	return nil, dsset, nil
+}
+
+// enclosingZone returns the apex of the zone containing the name, using the SOA record in the response.
+func (v *validator) enclosingZone(ctx context.Context, name string) (string, error) {
+	resp, err := v.r.Query(ctx, WalkMsg(name, dns.TypeSOA), PriorityHigh, RetryPolicy)
+	if err != nil && (resp == nil || resp.Rcode != dns.RcodeNameError) {
+		return "", err
+	}
+
+	for _, rr := range append(resp.Answer, resp.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok && dns.IsSubDomain(soa.Hdr.Name, dns.Fqdn(name)) {
+			return strings.ToLower(soa.Hdr.Name), nil
+		}
+	}
+	return "", fmt.Errorf("ValidateResponse: Failed to find the zone containing %s", RemoveLastDot(name))
+}
+
+func matchesDS(key *dns.DNSKEY, dsset []*dns.DS) bool {
+	for _, ds := range dsset {
+		if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+			continue
+		}
+		if d := key.ToDS(ds.DigestType); d != nil && strings.EqualFold(d.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyRRset(set []dns.RR, sig *dns.RRSIG, keys []*dns.DNSKEY) bool {
+	if !sig.ValidityPeriod(time.Now()) || !dns.IsSubDomain(sig.SignerName, set[0].Header().Name) {
+		return false
+	}
+
+	for _, key := range keys {
+		if key.KeyTag() == sig.KeyTag && key.Algorithm == sig.Algorithm &&
+			strings.EqualFold(key.Hdr.Name, sig.SignerName) && sig.Verify(key, set) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rrsets groups the records, other than signatures, by owner name and type.
+func rrsets(records []dns.RR) [][]dns.RR {
+	var sets [][]dns.RR
+
+	idx := make(map[string]int)
+	for _, rr := range records {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeRRSIG || hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+
+		k := fmt.Sprintf("%s/%d", strings.ToLower(hdr.Name), hdr.Rrtype)
+		if i, found := idx[k]; found {
+			sets[i] = append(sets[i], rr)
+			continue
+		}
+		idx[k] = len(sets)
+		sets = append(sets, []dns.RR{rr})
+	}
+	return sets
+}
+
+// rrsigs returns the signatures covering the RRset of the provided record.
+func rrsigs(records []dns.RR, rr dns.RR) []*dns.RRSIG {
+	var sigs []*dns.RRSIG
+
+	hdr := rr.Header()
+	for _, r := range records {
+		if sig, ok := r.(*dns.RRSIG); ok && sig.TypeCovered == hdr.Rrtype && strings.EqualFold(sig.Hdr.Name, hdr.Name) {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+func dnskeyRRs(keys []*dns.DNSKEY) []dns.RR {
+	rrs := make([]dns.RR, 0, len(keys))
+
+	for _, key := range keys {
+		rrs = append(rrs, key)
+	}
+	return rrs
+}
+
+// validateResult sets the validation status of the result, and rejects responses that failed validation.
+func validateResult(ctx context.Context, r Resolver, res *Result) {
+	status, err := ValidateResponse(ctx, r, res.Msg)
+	res.Validation = status
+	if status == ValidationBogus && res.Err == nil {
+		res.Err = &ResolveError{
+			Err:    fmt.Sprintf("The response for %s failed DNSSEC validation", RemoveLastDot(res.Msg.Question[0].Name)),
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonValidationRejected,
+		}
+	} else if err != nil && res.Err == nil {
+		res.Err = err
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"crypto"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type signedZone struct {
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newSignedZone(t *testing.T, zone string) *signedZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("Failed to generate the key for %s: %v", zone, err)
+	}
+	return &signedZone{key: key, priv: priv.(crypto.Signer)}
+}
+
+func (z *signedZone) sign(t *testing.T, set ...dns.RR) []dns.RR {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: set[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		Algorithm:  z.key.Algorithm,
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.key.Hdr.Name,
+	}
+	if err := sig.Sign(z.priv, set); err != nil {
+		t.Fatalf("Failed to sign the RRset: %v", err)
+	}
+	return append(set, sig)
+}
+
+func validationHandler(t *testing.T) (dns.HandlerFunc, *signedZone) {
+	root := newSignedZone(t, ".")
+	example := newSignedZone(t, "example.")
+
+	a := func(name string) dns.RR {
+		return &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300}, A: net.ParseIP("192.168.1.1")}
+	}
+	soa := func(zone string) dns.RR {
+		return &dns.SOA{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300}, Ns: "ns.nic.", Mbox: "admin.nic."}
+	}
+
+	bad := example.sign(t, a("bad.example."))
+	bad[0].(*dns.A).A = net.ParseIP("10.0.0.1")
+
+	answers := map[string][]dns.RR{
+		".":                 root.sign(t, root.key),
+		"example.":          example.sign(t, example.key),
+		"www.example.":      example.sign(t, a("www.example.")),
+		"bad.example.":      bad,
+		"unsigned.example.": {a("unsigned.example.")},
+		"www.insecure.":     {a("www.insecure.")},
+		"www.other.":        {a("www.other.")},
+	}
+	nsec := func(name, next string, types ...uint16) dns.RR {
+		return &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+			NextDomain: next,
+			TypeBitMap: append(types, dns.TypeRRSIG, dns.TypeNSEC),
+		}
+	}
+
+	// The same signed denial of the DS records for insecure is replayed for other
+	denial := root.sign(t, nsec("insecure.", "zzz.", dns.TypeNS))
+	ds := map[string][]dns.RR{
+		"example.": root.sign(t, example.key.ToDS(dns.SHA256)),
+	}
+	negative := map[string][]dns.RR{
+		"missing.example.":  append(example.sign(t, soa("example.")), example.sign(t, nsec("example.", "www.example.", dns.TypeSOA))...),
+		"forged.example.":   example.sign(t, soa("example.")),
+		"replayed.example.": append(example.sign(t, soa("example.")), example.sign(t, nsec("www.example.", "zzz.example.", dns.TypeA))...),
+	}
+	nodata := append(example.sign(t, soa("example.")), example.sign(t, nsec("www.example.", "zzz.example.", dns.TypeA))...)
+
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		name := req.Question[0].Name
+		switch req.Question[0].Qtype {
+		case dns.TypeDS:
+			if set, found := ds[name]; found {
+				m.Answer = set
+			} else {
+				m.Ns = denial
+			}
+		case dns.TypeSOA:
+			zone := "example."
+			if dns.IsSubDomain("insecure.", name) {
+				zone = "insecure."
+			} else if dns.IsSubDomain("other.", name) {
+				zone = "other."
+			}
+			m.Ns = []dns.RR{soa(zone)}
+		case dns.TypeTXT:
+			m.Ns = nodata
+		default:
+			if set, found := negative[name]; found {
+				m.Rcode = dns.RcodeNameError
+				m.Ns = set
+				break
+			}
+			m.Answer = answers[name]
+		}
+		_ = w.WriteMsg(m)
+	}, root
+}
+
+func TestValidateResponse(t *testing.T) {
+	handler, root := validationHandler(t)
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", handler)
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	anchors := RootTrustAnchors
+	RootTrustAnchors = []string{root.key.ToDS(dns.SHA256).String()}
+	defer func() { RootTrustAnchors = anchors }()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	cases := []struct {
+		name  string
+		qtype uint16
+		want  ValidationStatus
+	}{
+		{name: "www.example", qtype: dns.TypeA, want: ValidationSecure},
+		{name: "bad.example", qtype: dns.TypeA, want: ValidationBogus},
+		{name: "unsigned.example", qtype: dns.TypeA, want: ValidationBogus},
+		{name: "www.insecure", qtype: dns.TypeA, want: ValidationInsecure},
+		// The denial of the DS records for another zone does not make this zone insecure
+		{name: "www.other", qtype: dns.TypeA, want: ValidationBogus},
+		{name: "www.example", qtype: dns.TypeTXT, want: ValidationSecure},
+		{name: "missing.example", qtype: dns.TypeA, want: ValidationSecure},
+		{name: "forged.example", qtype: dns.TypeA, want: ValidationBogus},
+		{name: "replayed.example", qtype: dns.TypeA, want: ValidationBogus},
+	}
+	for _, c := range cases {
+		resp, err := r.Query(context.TODO(), WalkMsg(c.name, c.qtype), PriorityNormal, nil)
+		if err != nil && resp == nil {
+			t.Fatalf("The query for %s failed: %v", c.name, err)
+		}
+
+		if status, err := ValidateResponse(context.TODO(), r, resp); err != nil || status != c.want {
+			t.Errorf("The response for %s %s was %s instead of %s: %v", c.name, dns.TypeToString[c.qtype], status, c.want, err)
+		}
+	}
+
+	res := LookupResult(context.TODO(), r, "www.example", WithValidation())
+	if res.Err != nil || res.Validation != ValidationSecure {
+		t.Errorf("The lookup returned validation status %s: %v", res.Validation, res.Err)
+	}
+	res = LookupResult(context.TODO(), r, "bad.example", WithValidation())
+	if reason := ErrorReason(res.Err); res.Validation != ValidationBogus || reason != ReasonValidationRejected {
+		t.Errorf("The bogus lookup returned validation status %s and reason %s", res.Validation, reason)
+	}
+}
@@ -5,7 +5,6 @@ package resolve
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"github.com/miekg/dns"
@@ -15,13 +14,18 @@ import (
 func NsecTraversal(ctx context.Context, r Resolver, domain string, priority int) ([]*dns.NSEC, bool, error) {
 	if priority != PriorityCritical && priority != PriorityHigh && priority != PriorityLow {
 		return nil, false, &ResolveError{
-			Err:   fmt.Sprintf("Resolver: Invalid priority parameter: %d", priority),
-			Rcode: ResolverErrRcode,
+			Err:    fmt.Sprintf("Resolver: Invalid priority parameter: %d", priority),
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonInvalidRequest,
 		}
 	}
 
 	if r.Stopped() {
-		return nil, true, errors.New("Resolver: The resolver has been stopped")
+		return nil, true, &ResolveError{
+			Err:    "Resolver: The resolver has been stopped",
+			Rcode:  ResolverErrRcode,
+			Reason: ReasonResolverStopped,
+		}
 	}
 
 	found := true
@@ -53,7 +57,7 @@ func NsecTraversal(ctx context.Context, r Resolver, domain string, priority int)
 func searchGap(ctx context.Context, r Resolver, name, domain string, priority int) (*dns.NSEC, error) {
 	msg, err := r.Query(ctx, WalkMsg(name, dns.TypeNSEC), priority, RetryPolicy)
 	if err != nil || msg == nil {
-		return nil, fmt.Errorf("NsecTraversal: Query for %s NSEC record failed: %v", name, err)
+		return nil, fmt.Errorf("NsecTraversal: Query for %s NSEC record failed: %w", name, err)
 	}
 
 	for _, rr := range append(msg.Answer, msg.Ns...) {
@@ -0,0 +1,98 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"time"
+
+	"github.com/caffix/stringset"
+)
+
+// WildcardEventType identifies what occurred during DNS wildcard detection.
+type WildcardEventType int
+
+// The types of events emitted by DNS wildcard detection.
+const (
+	// WildcardDetected indicates that a wildcard was found for a subdomain without one.
+	WildcardDetected WildcardEventType = iota + 1
+	// WildcardChanged indicates that detection performed again for a subdomain produced a
+	// different type of wildcard or, for static wildcards, different answers.
+	WildcardChanged
+	// WildcardFailed indicates that the probes for a subdomain did not obtain a single
+	// response able to show whether the subdomain has a wildcard.
+	WildcardFailed
+)
+
+func (t WildcardEventType) String() string {
+	switch t {
+	case WildcardDetected:
+		return "detected"
+	case WildcardChanged:
+		return "changed"
+	case WildcardFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// WildcardEvent describes a change in the wildcard determination for a subdomain.
+type WildcardEvent struct {
+	Type         WildcardEventType
+	Subdomain    string
+	WildcardType int
+	// PreviousType is the type of the determination replaced by the detection.
+	PreviousType int
+	// Answers are the answers of a static wildcard or the sample collected from a dynamic wildcard.
+	Answers []*ExtractedAnswer
+	Time    time.Time
+}
+
+// wildcardEvent returns the event for the outcome of the test, or nil when nothing of interest occurred.
+func wildcardEvent(sub string, prev, w *wildcard, failed bool) *WildcardEvent {
+	event := &WildcardEvent{
+		Subdomain:    sub,
+		WildcardType: w.WildcardType,
+		Answers:      copyAnswers(w.Answers),
+		Time:         w.detected,
+	}
+	if w.WildcardType == WildcardTypeDynamic {
+		event.Answers = copyAnswers(w.sample)
+	}
+	if prev != nil {
+		event.PreviousType = prev.WildcardType
+	}
+
+	switch {
+	case failed:
+		event.Type = WildcardFailed
+	case event.PreviousType == WildcardTypeNone && w.WildcardType != WildcardTypeNone:
+		event.Type = WildcardDetected
+	case prev == nil:
+		return nil
+	case prev.WildcardType != w.WildcardType:
+		event.Type = WildcardChanged
+	case w.WildcardType == WildcardTypeStatic && !sameRecordData(prev.Answers, w.Answers):
+		event.Type = WildcardChanged
+	default:
+		return nil
+	}
+	return event
+}
+
+// sameRecordData returns true when the answers contain the same record data.
+func sameRecordData(a, b []*ExtractedAnswer) bool {
+	x := stringset.New()
+	defer x.Close()
+	y := stringset.New()
+	defer y.Close()
+
+	insertRecordData(x, a)
+	insertRecordData(y, b)
+	if x.Len() != y.Len() {
+		return false
+	}
+
+	x.Intersect(y)
+	return x.Len() == y.Len()
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestWildcardEvents(t *testing.T) {
+	var lock sync.Mutex
+	addr := "10.0.0.1"
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		name := req.Question[0].Name
+		if strings.HasSuffix(name, ".failed.domain.com.") {
+			m.Rcode = dns.RcodeServerFailure
+		} else if strings.HasSuffix(name, ".events.domain.com.") {
+			lock.Lock()
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.ParseIP(addr),
+			})
+			lock.Unlock()
+		} else {
+			m.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	var events []WildcardEvent
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetWildcardConfig(WildcardConfig{
+		Probes:     2,
+		QueryTypes: []uint16{dns.TypeA},
+		TTL:        500 * time.Millisecond,
+		Events: func(event WildcardEvent) {
+			lock.Lock()
+			events = append(events, event)
+			lock.Unlock()
+		},
+	})
+
+	msg := QueryMsg("www.events.domain.com", dns.TypeA)
+	pool.WildcardType(context.TODO(), msg, "events.domain.com")
+
+	time.Sleep(600 * time.Millisecond)
+	lock.Lock()
+	addr = "10.0.0.2"
+	lock.Unlock()
+	pool.WildcardType(context.TODO(), msg, "events.domain.com")
+
+	pool.WildcardType(context.TODO(), QueryMsg("www.failed.domain.com", dns.TypeA), "failed.domain.com")
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	expected := []struct {
+		etype WildcardEventType
+		sub   string
+		wtype int
+		prev  int
+	}{
+		{WildcardDetected, "events.domain.com", WildcardTypeStatic, WildcardTypeNone},
+		{WildcardChanged, "events.domain.com", WildcardTypeStatic, WildcardTypeStatic},
+		{WildcardFailed, "failed.domain.com", WildcardTypeNone, WildcardTypeNone},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("%d events were emitted instead of %d: %+v", len(events), len(expected), events)
+	}
+	for i, e := range expected {
+		got := events[i]
+		if got.Type != e.etype || got.Subdomain != e.sub || got.WildcardType != e.wtype || got.PreviousType != e.prev {
+			t.Errorf("Event %d was %s for %s of type %d from %d", i, got.Type, got.Subdomain, got.WildcardType, got.PreviousType)
+		}
+	}
+	if a := events[1].Answers; len(a) != 1 || a[0].Data != "10.0.0.2" {
+		t.Errorf("The changed wildcard event provided the answers %v", a)
+	}
+}
+
+func TestSameRecordData(t *testing.T) {
+	a := []*ExtractedAnswer{{Data: "10.0.0.1"}, {Data: "10.0.0.2"}}
+	b := []*ExtractedAnswer{{Data: "10.0.0.2"}, {Data: "10.0.0.1"}}
+
+	if !sameRecordData(a, b) {
+		t.Errorf("The answers with the same data were reported as different")
+	}
+	if sameRecordData(a, b[:1]) {
+		t.Errorf("The answers with different data were reported as the same")
+	}
+}
@@ -6,6 +6,8 @@ package resolve
 import (
 	"context"
 	"math/rand"
+	"net"
+	"sort"
 	"strings"
 	"time"
 
@@ -25,6 +27,110 @@ const (
 
 const numOfWildcardTests = 3
 
+// wildcardTestTimeout is the time permitted for wildcard detection of a subdomain.
+const wildcardTestTimeout = 30 * time.Second
+
+// WildcardConfig tunes the probes sent during DNS wildcard detection.
+// Zero values select the defaults used when no configuration is provided.
+type WildcardConfig struct {
+	// Probes is the number of names with unlikely labels queried for each subdomain.
+	Probes int
+	// MinLabelLen and MaxLabelLen bound the length of the unlikely labels.
+	MinLabelLen int
+	MaxLabelLen int
+	// Charset provides the characters used to build the unlikely labels.
+	Charset string
+	// QueryTypes are the types queried for each of the unlikely names.
+	QueryTypes []uint16
+	// Samples is the number of names queried to collect the answers of dynamic wildcards, which
+	// change for each query, so names can be compared using the overlap with the sample.
+	Samples int
+	// ASNLookup optionally provides the autonomous system number announcing an address, so names
+	// with answers in the same networks as the sample of a dynamic wildcard are matched.
+	ASNLookup func(ip net.IP) int
+	// TTL is how long the wildcard determination for a subdomain is used before detection is performed again.
+	TTL time.Duration
+	// TrustedOnly restricts the probes to the trusted resolvers of a pool created by NewTieredResolverPool,
+	// so untrusted resolvers cannot corrupt the determinations used to filter the other answers.
+	// Pools without trusted resolvers perform no wildcard detection when it is set.
+	TrustedOnly bool
+	// Events, when provided, receives the events describing new wildcards, changes to the determinations
+	// and failed detection. It is executed by the goroutine managing the determinations, and must neither
+	// block nor request wildcard detection.
+	Events func(event WildcardEvent)
+}
+
+// DefaultWildcardTTL is how long wildcard determinations are used when no TTL has been configured.
+const DefaultWildcardTTL = time.Hour
+
+// WildcardState describes the wildcard determination held for a subdomain.
+type WildcardState struct {
+	Subdomain    string
+	WildcardType int
+	Detected     time.Time
+	Expires      time.Time
+	// Testing indicates that detection is in progress for the subdomain.
+	Testing bool
+	// Answers are the records returned for every unlikely name queried, which identify a static wildcard.
+	Answers []*ExtractedAnswer
+	// Sample contains the records collected from a dynamic wildcard.
+	Sample []*ExtractedAnswer
+	// Inherited is the closest enclosing subdomain whose wildcard also answers for this subdomain,
+	// such as example.com for dev.example.com when only *.example.com exists.
+	Inherited string
+}
+
+// withDefaults returns the configuration with the defaults assigned to the zero values.
+func (c WildcardConfig) withDefaults() WildcardConfig {
+	if c.Probes <= 0 {
+		c.Probes = numOfWildcardTests
+	}
+	if c.MinLabelLen <= 0 {
+		c.MinLabelLen = MinLabelLen
+	}
+	if c.MaxLabelLen <= 0 {
+		c.MaxLabelLen = MaxLabelLen
+	}
+	if c.MaxLabelLen > MaxDNSLabelLen {
+		c.MaxLabelLen = MaxDNSLabelLen
+	}
+	if c.MinLabelLen > c.MaxLabelLen {
+		c.MinLabelLen = c.MaxLabelLen
+	}
+	if len(c.Charset) < 2 {
+		c.Charset = LDHChars
+	}
+	if len(c.QueryTypes) == 0 {
+		c.QueryTypes = wildcardQueryTypes
+	}
+	if c.Samples <= 0 {
+		c.Samples = defaultWildcardSamples
+	}
+	if c.Samples < c.Probes {
+		c.Samples = c.Probes
+	}
+	if c.TTL <= 0 {
+		c.TTL = DefaultWildcardTTL
+	}
+	return c
+}
+
+// wildcardConfigurer is implemented by the Resolvers that accept a WildcardConfig.
+type wildcardConfigurer interface {
+	setWildcardConfig(config WildcardConfig)
+}
+
+// wildcardLeveler is implemented by the Resolvers able to attribute names to the level of a wildcard.
+type wildcardLeveler interface {
+	wildcardLevel(ctx context.Context, msg *dns.Msg, domain string) (string, int)
+}
+
+// wildcardStateHolder is implemented by the Resolvers that hold wildcard determinations.
+type wildcardStateHolder interface {
+	wildcardStates() []*WildcardState
+	invalidateWildcards(sub string)
+}
+
 // Names for the different types of wildcards that can be detected.
 const (
 	WildcardTypeNone = iota
@@ -41,17 +147,25 @@ var wildcardQueryTypes = []uint16{
 type wildcard struct {
 	WildcardType int
 	Answers      []*ExtractedAnswer
-	beingTested  bool
+	// The answers collected from dynamic wildcards
+	sample      []*ExtractedAnswer
+	beingTested bool
+	detected    time.Time
+	// The requests waiting for the test in progress
+	waiters []chan *wildcard
+	// The expired determination replaced by the test in progress
+	previous *wildcard
 }
 
 type wildcardChans struct {
 	WildcardReq     queue.Queue
 	IPsAcrossLevels chan *ipsAcrossLevels
 	TestResult      chan *testResult
+	States          chan chan []*WildcardState
+	Invalidate      chan string
 }
 
 type wildcardReq struct {
-	Ctx   context.Context
 	Sub   string
 	Start time.Time
 	Ch    chan *wildcard
@@ -61,22 +175,42 @@ type ipsAcrossLevels struct {
 	Name    string
 	Domain  string
 	Records []*ExtractedAnswer
-	Ch      chan int
+	Ch      chan string
 }
 
 type testResult struct {
 	Sub    string
 	Result *wildcard
+	Failed bool
+}
+
+func (r *baseResolver) setWildcardConfig(config WildcardConfig) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.wcConfig = config.withDefaults()
+}
+
+func (r *baseResolver) wildcardConfig() WildcardConfig {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.wcConfig.withDefaults()
 }
 
 // WildcardType returns the DNS wildcard type for the provided subdomain name.
 func (r *baseResolver) WildcardType(ctx context.Context, msg *dns.Msg, domain string) int {
-	return r.wildcard(ctx, msg, domain)
+	_, wtype := r.wildcardLevel(ctx, msg, domain)
+	return wtype
 }
 
-func (r *baseResolver) wildcard(ctx context.Context, msg *dns.Msg, domain string) int {
+// wildcardLevel returns the subdomain whose wildcard answered for the name, along with the wildcard type.
+// Each label between the domain and the name is checked, starting with the domain, so names matching a
+// wildcard inherited from an enclosing subdomain are attributed to the level where the wildcard exists.
+func (r *baseResolver) wildcardLevel(ctx context.Context, msg *dns.Msg, domain string) (string, int) {
 	name := strings.ToLower(RemoveLastDot(msg.Question[0].Name))
 	domain = strings.ToLower(RemoveLastDot(domain))
+	answers := r.terminalAnswers(ctx, name, ExtractAnswers(msg))
 
 	base := len(strings.Split(domain, "."))
 	labels := strings.Split(name, ".")
@@ -86,48 +220,101 @@ func (r *baseResolver) wildcard(ctx context.Context, msg *dns.Msg, domain string
 
 	// Check for a DNS wildcard at each label starting with the root domain
 	for i := len(labels) - base; i >= 0; i-- {
-		w := r.fetchWildcardType(ctx, strings.Join(labels[i:], "."))
+		sub := strings.Join(labels[i:], ".")
+		w := r.fetchWildcardType(ctx, sub)
 
 		if w.WildcardType == WildcardTypeDynamic {
-			return WildcardTypeDynamic
+			// Names with answers unlike those in the sample belong to the subdomain
+			if len(answers) == 0 || len(w.sample) == 0 || sampleMatches(answers, w.sample, r.wildcardConfig().ASNLookup) {
+				return sub, WildcardTypeDynamic
+			}
 		} else if w.WildcardType == WildcardTypeStatic {
 			if len(msg.Answer) == 0 {
-				return w.WildcardType
+				return sub, w.WildcardType
 			}
 
 			set := stringset.New()
 			defer set.Close()
 
-			insertRecordData(set, ExtractAnswers(msg))
+			insertRecordData(set, answers)
 			intersectRecordData(set, w.Answers)
 			if set.Len() > 0 {
-				return w.WildcardType
+				return sub, w.WildcardType
 			}
 		}
 	}
 
-	return r.checkIPsAcrossLevels(&ipsAcrossLevels{
+	if sub := r.checkIPsAcrossLevels(&ipsAcrossLevels{
 		Name:    name,
 		Domain:  domain,
-		Records: ExtractAnswers(msg),
-	})
+		Records: answers,
+	}); sub != "" {
+		return sub, WildcardTypeStatic
+	}
+	return "", WildcardTypeNone
+}
+
+// terminalAnswers adds the addresses of the final CNAME target when the answers contain CNAME records
+// without the addresses, so wildcards answering with CNAMEs to varying targets, as CDNs do, are
+// compared using the terminal resolution of the names.
+func (r *baseResolver) terminalAnswers(ctx context.Context, name string, answers []*ExtractedAnswer) []*ExtractedAnswer {
+	name = strings.ToLower(RemoveLastDot(name))
+	targets := make(map[string]string)
+	for _, a := range AnswersByType(answers, dns.TypeCNAME) {
+		targets[a.Name] = strings.ToLower(a.Data)
+	}
+
+	terminal := name
+	for i := 0; i < DefaultChaseDepth; i++ {
+		next, found := targets[terminal]
+		if !found {
+			break
+		}
+		terminal = next
+	}
+	if terminal == name {
+		return answers
+	}
+
+	for _, a := range answers {
+		if a.Name == terminal && (a.Type == dns.TypeA || a.Type == dns.TypeAAAA) {
+			return answers
+		}
+	}
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		chain, err := ChaseCNAME(ctx, r, terminal, qtype, DefaultChaseDepth)
+		if err != nil {
+			continue
+		}
+
+		resp := &dns.Msg{Answer: append(chain.Links, chain.Records...)}
+		answers = append(answers, ExtractAnswers(resp)...)
+	}
+	return answers
 }
 
 func (r *baseResolver) fetchWildcardType(ctx context.Context, sub string) *wildcard {
 	ch := make(chan *wildcard, 2)
 
 	r.wildcardChannels.WildcardReq.Append(&wildcardReq{
-		Ctx:   ctx,
 		Sub:   sub,
 		Start: time.Now(),
 		Ch:    ch,
 	})
 
-	return <-ch
+	select {
+	case w := <-ch:
+		return w
+	case <-ctx.Done():
+	case <-r.done:
+	}
+	return &wildcard{WildcardType: WildcardTypeNone}
 }
 
-func (r *baseResolver) checkIPsAcrossLevels(req *ipsAcrossLevels) int {
-	ch := make(chan int, 2)
+// checkIPsAcrossLevels returns the shallowest subdomain of the levels that share the answers of the name.
+func (r *baseResolver) checkIPsAcrossLevels(req *ipsAcrossLevels) string {
+	ch := make(chan string, 2)
 
 	req.Ch = ch
 	r.wildcardChannels.IPsAcrossLevels <- req
@@ -147,31 +334,36 @@ func (r *baseResolver) manageWildcards(chs *wildcardChans) {
 				r.wildcardRequest(wildcards, element.(*wildcardReq))
 			}
 		case test := <-chs.TestResult:
-			wildcards[test.Sub] = test.Result
+			r.wildcardResult(wildcards, test)
 		case ips := <-chs.IPsAcrossLevels:
 			r.testIPsAcrossLevels(wildcards, ips)
+		case ch := <-chs.States:
+			ch <- r.collectWildcardStates(wildcards)
+		case sub := <-chs.Invalidate:
+			for k, w := range wildcards {
+				if !w.beingTested && (sub == "" || k == sub || strings.HasSuffix(k, "."+sub)) {
+					delete(wildcards, k)
+				}
+			}
 		}
 	}
 }
 
 func (r *baseResolver) wildcardRequest(wildcards map[string]*wildcard, req *wildcardReq) {
-	// Check if this test should timeout
-	if time.Now().After(req.Start.Add(30 * time.Second)) {
-		wildcards[req.Sub] = &wildcard{
-			WildcardType: WildcardTypeDynamic,
-			Answers:      []*ExtractedAnswer{},
-			beingTested:  false,
-		}
-		req.Ch <- wildcards[req.Sub]
-		return
+	var previous *wildcard
+	// Determinations that expired before the request was made are replaced by performing detection again
+	if w, found := wildcards[req.Sub]; found && !w.beingTested &&
+		w.detected.Before(req.Start) && time.Since(w.detected) >= r.wildcardConfig().TTL {
+		previous = w
+		delete(wildcards, req.Sub)
 	}
 	// Check if the wildcard information has been cached
 	if w, found := wildcards[req.Sub]; found && !w.beingTested {
 		req.Ch <- w
 		return
 	} else if found && w.beingTested {
-		// Wait for the test to complete
-		go r.delayAppend(req)
+		// Wait for the test already in progress to complete
+		w.waiters = append(w.waiters, req.Ch)
 		return
 	}
 
@@ -180,26 +372,131 @@ func (r *baseResolver) wildcardRequest(wildcards map[string]*wildcard, req *wild
 		WildcardType: WildcardTypeNone,
 		Answers:      []*ExtractedAnswer{},
 		beingTested:  true,
+		waiters:      []chan *wildcard{req.Ch},
+		previous:     previous,
 	}
-	go r.wildcardTest(req.Ctx, req.Sub)
-	go r.delayAppend(req)
+	go r.wildcardTest(req.Sub)
 }
 
-func (r *baseResolver) delayAppend(req *wildcardReq) {
-	time.Sleep(time.Second)
-	r.wildcardChannels.WildcardReq.Append(req)
+// wildcardResult stores the outcome of the test and provides it to the requests waiting for it.
+func (r *baseResolver) wildcardResult(wildcards map[string]*wildcard, test *testResult) {
+	var previous *wildcard
+	if w, found := wildcards[test.Sub]; found {
+		previous = w.previous
+		for _, ch := range w.waiters {
+			ch <- test.Result
+		}
+	}
+	wildcards[test.Sub] = test.Result
+
+	if events := r.wildcardConfig().Events; events != nil {
+		if event := wildcardEvent(test.Sub, previous, test.Result, test.Failed); event != nil {
+			events(*event)
+		}
+	}
+}
+
+func (r *baseResolver) collectWildcardStates(wildcards map[string]*wildcard) []*WildcardState {
+	ttl := r.wildcardConfig().TTL
+
+	states := make([]*WildcardState, 0, len(wildcards))
+	for sub, w := range wildcards {
+		state := &WildcardState{
+			Subdomain:    sub,
+			WildcardType: w.WildcardType,
+			Testing:      w.beingTested,
+		}
+		if !w.beingTested {
+			state.Detected = w.detected
+			state.Expires = w.detected.Add(ttl)
+			state.Answers = copyAnswers(w.Answers)
+			state.Sample = copyAnswers(w.sample)
+		}
+		states = append(states, state)
+	}
+	for _, state := range states {
+		state.Inherited = inheritedWildcard(wildcards, state.Subdomain)
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Subdomain < states[j].Subdomain })
+	return states
+}
+
+// inheritedWildcard returns the closest enclosing subdomain with a wildcard that also
+// answers for the subdomain, so the determination can be attributed to that level.
+func inheritedWildcard(wildcards map[string]*wildcard, sub string) string {
+	w, found := wildcards[sub]
+	if !found || w.beingTested || w.WildcardType == WildcardTypeNone {
+		return ""
+	}
+
+	for parent := parentName(sub); strings.Contains(parent, "."); parent = parentName(parent) {
+		p, found := wildcards[parent]
+		if !found || p.beingTested || p.WildcardType != w.WildcardType {
+			continue
+		}
+
+		if w.WildcardType == WildcardTypeDynamic {
+			if sampleMatches(w.sample, p.sample, nil) {
+				return parent
+			}
+			continue
+		}
+
+		set := stringset.New()
+		insertRecordData(set, w.Answers)
+		intersectRecordData(set, p.Answers)
+		matched := set.Len() > 0
+		set.Close()
+		if matched {
+			return parent
+		}
+	}
+	return ""
+}
+
+// copyAnswers prevents the answers held by the wildcard manager from being modified by callers.
+func copyAnswers(answers []*ExtractedAnswer) []*ExtractedAnswer {
+	if len(answers) == 0 {
+		return nil
+	}
+
+	c := make([]*ExtractedAnswer, 0, len(answers))
+	for _, a := range answers {
+		dup := *a
+		c = append(c, &dup)
+	}
+	return c
+}
+
+func (r *baseResolver) wildcardStates() []*WildcardState {
+	ch := make(chan []*WildcardState, 1)
+
+	select {
+	case <-r.done:
+		return nil
+	case r.wildcardChannels.States <- ch:
+	}
+	return <-ch
+}
+
+func (r *baseResolver) invalidateWildcards(sub string) {
+	select {
+	case <-r.done:
+	case r.wildcardChannels.Invalidate <- strings.ToLower(RemoveLastDot(sub)):
+	}
 }
 
 func (r *baseResolver) testIPsAcrossLevels(wildcards map[string]*wildcard, req *ipsAcrossLevels) {
 	if len(req.Records) == 0 {
-		req.Ch <- WildcardTypeNone
+		req.Ch <- ""
 		return
 	}
 
 	base := len(strings.Split(req.Domain, "."))
 	labels := strings.Split(strings.ToLower(req.Name), ".")
 	if len(labels) <= base || (len(labels)-base) < 3 {
-		req.Ch <- WildcardTypeNone
+		req.Ch <- ""
 		return
 	}
 
@@ -207,8 +504,10 @@ func (r *baseResolver) testIPsAcrossLevels(wildcards map[string]*wildcard, req *
 	records := stringset.New()
 	defer records.Close()
 
+	var level string
 	for i := 1; i <= l; i++ {
-		w, found := wildcards[strings.Join(labels[i:], ".")]
+		sub := strings.Join(labels[i:], ".")
+		w, found := wildcards[sub]
 		if !found || w.Answers == nil || len(w.Answers) == 0 {
 			break
 		}
@@ -218,44 +517,68 @@ func (r *baseResolver) testIPsAcrossLevels(wildcards map[string]*wildcard, req *
 		} else {
 			intersectRecordData(records, w.Answers)
 		}
+		level = sub
 	}
 
-	result := WildcardTypeNone
-	if records.Len() > 0 {
-		result = WildcardTypeStatic
+	if records.Len() == 0 {
+		level = ""
 	}
-
-	req.Ch <- result
+	req.Ch <- level
 }
 
-func (r *baseResolver) wildcardTest(ctx context.Context, sub string) {
-	var retRecords bool
+// wildcardTest performs detection for the subdomain once on behalf of all the requests waiting for it.
+// Tests that cannot complete within wildcardTestTimeout are treated as dynamic wildcards.
+func (r *baseResolver) wildcardTest(sub string) {
+	ctx, cancel := context.WithTimeout(context.Background(), wildcardTestTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var retRecords, responded bool
 	var answers []*ExtractedAnswer
 
 	set := stringset.New()
 	defer set.Close()
 
-	// Query multiple times with unlikely names against this subdomain
-	for i := 0; i < numOfWildcardTests; i++ {
+	config := r.wildcardConfig()
+	probe := func() []*ExtractedAnswer {
 		var name string
 
 		// Generate the unlikely label / name
 		for j := 0; j < 10; j++ {
-			name = UnlikelyName(sub)
+			name = unlikelyName(sub, config)
 			if name != "" {
 				break
 			}
 		}
 
 		var ans []*ExtractedAnswer
-		for _, t := range wildcardQueryTypes {
+		for _, t := range config.QueryTypes {
 			msg := QueryMsg(name, t)
 
-			if resp, err := r.Query(ctx, msg, PriorityCritical, RetryPolicy); err == nil && len(resp.Answer) > 0 {
+			resp, err := r.Query(ctx, msg, PriorityCritical, RetryPolicy)
+			if err == nil && len(resp.Answer) > 0 {
 				retRecords = true
 				ans = append(ans, ExtractAnswers(resp)...)
 			}
+			if e, ok := err.(*ResolveError); err == nil || (ok && e.Rcode == dns.RcodeNameError) {
+				responded = true
+			}
 		}
+		if len(ans) > 0 {
+			ans = r.terminalAnswers(ctx, name, ans)
+		}
+		return ans
+	}
+
+	// Query multiple times with unlikely names against this subdomain
+	for i := 0; i < config.Probes; i++ {
+		ans := probe()
 
 		if i == 0 {
 			insertRecordData(set, ans)
@@ -280,38 +603,60 @@ func (r *baseResolver) wildcardTest(ctx context.Context, sub string) {
 	}
 
 	// Determine whether the subdomain has a DNS wildcard, and if so, which type is it?
+	var sample []*ExtractedAnswer
 	wildcardType := WildcardTypeNone
-	if retRecords {
+	if ctx.Err() != nil {
+		wildcardType = WildcardTypeDynamic
+		final = []*ExtractedAnswer{}
+	} else if retRecords {
 		wildcardType = WildcardTypeStatic
 
 		if len(final) == 0 {
 			wildcardType = WildcardTypeDynamic
+			// Collect a larger sample of the changing answers for the heuristics
+			for i := config.Probes; i < config.Samples; i++ {
+				answers = append(answers, probe()...)
+			}
+			sample = uniqueAnswers(answers)
 		}
 
 		r.log.Printf("DNS wildcard detected: Resolver %s: %s: type: %d", r.String(), "*."+sub, wildcardType)
 	}
 
-	r.wildcardChannels.TestResult <- &testResult{
+	result := &testResult{
 		Sub: sub,
 		Result: &wildcard{
 			WildcardType: wildcardType,
 			Answers:      final,
+			sample:       sample,
 			beingTested:  false,
+			detected:     time.Now(),
 		},
+		Failed: ctx.Err() != nil || !responded,
+	}
+
+	select {
+	case <-r.done:
+	case r.wildcardChannels.TestResult <- result:
 	}
 }
 
 // UnlikelyName takes a subdomain name and returns an unlikely DNS name within that subdomain.
 func UnlikelyName(sub string) string {
-	ldh := []rune(LDHChars)
+	return unlikelyName(sub, WildcardConfig{}.withDefaults())
+}
+
+// unlikelyName builds the unlikely DNS name using the label length and characters in the configuration.
+func unlikelyName(sub string, config WildcardConfig) string {
+	ldh := []rune(config.Charset)
 	ldhLen := len(ldh)
 
 	// Determine the max label length
 	l := MaxDNSNameLen - (len(sub) + 1)
-	if l > MaxLabelLen {
-		l = MaxLabelLen
-	} else if l < MinLabelLen {
-		l = MinLabelLen
+	if l > config.MaxLabelLen {
+		l = config.MaxLabelLen
+	} else if l < config.MinLabelLen {
+		l = config.MinLabelLen
 	}
 	// Shuffle our LDH characters
 	rand.Shuffle(ldhLen, func(i, j int) {
@@ -319,7 +664,7 @@ func UnlikelyName(sub string) string {
 	})
 
 	var newlabel string
-	l = MinLabelLen + rand.Intn((l-MinLabelLen)+1)
+	l = config.MinLabelLen + rand.Intn((l-config.MinLabelLen)+1)
 	for i := 0; i < l; i++ {
 		sel := rand.Int() % (ldhLen - 1)
 
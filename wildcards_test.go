@@ -5,9 +5,13 @@ package resolve
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -91,3 +95,395 @@ func wildcardHandler(w dns.ResponseWriter, req *dns.Msg) {
 	}
 	w.WriteMsg(m)
 }
+
+func TestWildcardConfig(t *testing.T) {
+	var lock sync.Mutex
+	var probes []string
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if name := req.Question[0].Name; strings.HasSuffix(name, ".config.domain.com.") {
+			lock.Lock()
+			probes = append(probes, fmt.Sprintf("%s/%d", name, req.Question[0].Qtype))
+			lock.Unlock()
+		}
+		wildcardHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetWildcardConfig(WildcardConfig{
+		Probes:      5,
+		MinLabelLen: 8,
+		MaxLabelLen: 8,
+		Charset:     "xyz",
+		QueryTypes:  []uint16{dns.TypeA},
+	})
+
+	msg := QueryMsg("www.config.domain.com", dns.TypeA)
+	if got := pool.WildcardType(context.TODO(), msg, "domain.com"); got != WildcardTypeNone {
+		t.Errorf("Wildcard detection returned %d instead of %d", got, WildcardTypeNone)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(probes) != 5 {
+		t.Fatalf("%d probes were sent instead of 5", len(probes))
+	}
+	for _, p := range probes {
+		label := strings.Split(p, ".")[0]
+		if strings.Trim(label, "xyz") != "" || len(label) > 8 || !strings.HasSuffix(p, "/1") {
+			t.Errorf("The probe %s did not respect the configuration", p)
+		}
+	}
+}
+
+func TestWildcardCNAMETargets(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		q := req.Question[0]
+		switch {
+		case q.Name == "www.cdn.domain.com.":
+			m.Answer = append(m.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: q.Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+				Target: "www.origin.net.",
+			})
+		case strings.HasSuffix(q.Name, ".cdn.domain.com."):
+			// Each query receives a CNAME to a different target without the addresses
+			m.Answer = append(m.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: q.Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+				Target: UnlikelyName("edge.cdnprovider.net") + ".",
+			})
+		case q.Name == "www.origin.net." && q.Qtype == dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.ParseIP("192.168.5.5"),
+			})
+		case strings.HasSuffix(q.Name, ".edge.cdnprovider.net.") && q.Qtype == dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+				A:   net.ParseIP("10.1.1.1"),
+			})
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	cases := []struct {
+		input string
+		want  int
+	}{
+		{input: "www.cdn.domain.com", want: WildcardTypeNone},
+		{input: "jeff_foley.cdn.domain.com", want: WildcardTypeStatic},
+	}
+	for _, c := range cases {
+		resp, err := r.Query(context.TODO(), QueryMsg(c.input, dns.TypeCNAME), PriorityNormal, nil)
+		if err != nil {
+			t.Fatalf("The query for %s failed: %v", c.input, err)
+		}
+		if got := r.WildcardType(context.TODO(), resp, "domain.com"); got != c.want {
+			t.Errorf("Wildcard detection for %s returned %d instead of %d", c.input, got, c.want)
+		}
+	}
+}
+
+func TestWildcardStates(t *testing.T) {
+	var probes int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if name := req.Question[0].Name; name != "ns.wildcard.domain.com." && strings.HasSuffix(name, ".wildcard.domain.com.") {
+			atomic.AddInt32(&probes, 1)
+		}
+		wildcardHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetWildcardConfig(WildcardConfig{QueryTypes: []uint16{dns.TypeA}, TTL: 2 * time.Second})
+
+	msg, err := pool.Query(context.TODO(), QueryMsg("ns.wildcard.domain.com", dns.TypeA), PriorityNormal, nil)
+	if err != nil {
+		t.Fatalf("The query failed: %v", err)
+	}
+	detect := func() {
+		if got := pool.WildcardType(context.TODO(), msg, "domain.com"); got != WildcardTypeNone {
+			t.Errorf("Wildcard detection returned %d instead of %d", got, WildcardTypeNone)
+		}
+	}
+
+	detect()
+	states := pool.WildcardStates()
+	if len(states) != 2 || states[1].Subdomain != "wildcard.domain.com" || states[1].WildcardType != WildcardTypeStatic {
+		t.Fatalf("The wildcard states were not provided as expected: %+v", states)
+	}
+	if !states[1].Expires.After(states[1].Detected) {
+		t.Errorf("The wildcard state did not provide the expiration time")
+	}
+
+	// Detection is performed again once the determination expires
+	sent := atomic.LoadInt32(&probes)
+	detect()
+	if n := atomic.LoadInt32(&probes); n != sent {
+		t.Errorf("Detection was performed again before the determination expired")
+	}
+	time.Sleep(2100 * time.Millisecond)
+	detect()
+	if n := atomic.LoadInt32(&probes); n == sent {
+		t.Errorf("Detection was not performed again after the determination expired")
+	}
+
+	pool.InvalidateWildcards("wildcard.domain.com")
+	if states := pool.WildcardStates(); len(states) != 1 || states[0].Subdomain != "domain.com" {
+		t.Errorf("The invalidated wildcard state was still provided: %+v", states)
+	}
+	pool.InvalidateWildcards("")
+	if states := pool.WildcardStates(); len(states) != 0 {
+		t.Errorf("The wildcard states were not all invalidated: %+v", states)
+	}
+}
+
+func TestWildcardAnswers(t *testing.T) {
+	dns.HandleFunc("domain.com.", wildcardHandler)
+	defer dns.HandleRemove("domain.com.")
+
+	s, addrstr, _, err := runLocalUDPServer(":0")
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	if _, found := pool.WildcardAnswers("wildcard.domain.com"); found {
+		t.Errorf("Answers were provided before wildcard detection was performed")
+	}
+
+	msg := QueryMsg("jeff_foley.wildcard.domain.com", dns.TypeA)
+	pool.WildcardType(context.TODO(), msg, "domain.com")
+
+	answers, found := pool.WildcardAnswers("Wildcard.Domain.com.")
+	if !found || len(answers) != 1 || answers[0].Data != "192.168.1.64" {
+		t.Errorf("The wildcard answers were not provided as expected: %v", answers)
+	}
+	if _, found := pool.WildcardAnswers("domain.com"); found {
+		t.Errorf("Answers were provided for a subdomain without a wildcard")
+	}
+
+	// The answers provided cannot modify the state held by the pool
+	answers[0].Data = "modified"
+	if answers, _ := pool.WildcardAnswers("wildcard.domain.com"); answers[0].Data != "192.168.1.64" {
+		t.Errorf("The wildcard answers held by the pool were modified")
+	}
+}
+
+func TestConcurrentWildcardChecks(t *testing.T) {
+	var probes int32
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if name := req.Question[0].Name; !strings.HasPrefix(name, "host") && strings.HasSuffix(name, ".wildcard.domain.com.") {
+			atomic.AddInt32(&probes, 1)
+			// Keep the test in progress while the other checks arrive
+			time.Sleep(50 * time.Millisecond)
+		}
+		wildcardHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 1000, nil)
+	defer r.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			msg := QueryMsg(fmt.Sprintf("host%d.wildcard.domain.com", i), dns.TypeA)
+			if got := r.WildcardType(context.TODO(), msg, "domain.com"); got != WildcardTypeStatic {
+				t.Errorf("Wildcard detection returned %d instead of %d", got, WildcardTypeStatic)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	want := int32(numOfWildcardTests * len(wildcardQueryTypes))
+	if n := atomic.LoadInt32(&probes); n != want {
+		t.Errorf("%d probes were sent instead of %d for the concurrent checks", n, want)
+	}
+}
+
+func TestWildcardCheckCancelled(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(timeoutHandler))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	r := NewBaseResolver(addrstr, 100, nil)
+	defer r.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	r.WildcardType(ctx, QueryMsg("www.slow.domain.com", dns.TypeA), "domain.com")
+	if time.Since(start) > time.Second {
+		t.Errorf("The wildcard check did not return once the context expired")
+	}
+}
+
+func TestWildcardLevels(t *testing.T) {
+	s, addrstr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		var addr string
+		// *.dev.nested.domain.com is nested within *.nested.domain.com
+		if name := req.Question[0].Name; strings.HasSuffix(name, ".dev.nested.domain.com.") {
+			addr = "10.0.0.2"
+		} else if strings.HasSuffix(name, ".nested.domain.com.") {
+			addr = "10.0.0.1"
+		}
+		if addr == "" || req.Question[0].Qtype != dns.TypeA {
+			m.Rcode = dns.RcodeNameError
+			_ = w.WriteMsg(m)
+			return
+		}
+
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.ParseIP(addr),
+		})
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer s.Shutdown()
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(addrstr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+
+	for _, test := range []struct {
+		name  string
+		level string
+	}{
+		{"www.dev.nested.domain.com", "dev.nested.domain.com"},
+		{"www.stage.nested.domain.com", "nested.domain.com"},
+		{"www.nested.domain.com", "nested.domain.com"},
+	} {
+		resp, err := pool.Query(context.TODO(), QueryMsg(test.name, dns.TypeA), PriorityNormal, nil)
+		if err != nil {
+			t.Fatalf("The query for %s failed: %v", test.name, err)
+		}
+
+		level, wtype := pool.WildcardLevel(context.TODO(), resp, "domain.com")
+		if level != test.level || wtype != WildcardTypeStatic {
+			t.Errorf("%s was attributed to the %s wildcard of type %d instead of %s", test.name, level, wtype, test.level)
+		}
+	}
+
+	// Answers unlike those of the wildcards cause each level to be checked
+	msg := QueryMsg("www.stage.nested.domain.com", dns.TypeA)
+	msg.Answer = append(msg.Answer, mustRR(t, "www.stage.nested.domain.com. 0 IN A 10.9.9.9"))
+	if level, wtype := pool.WildcardLevel(context.TODO(), msg, "nested.domain.com"); level != "" || wtype != WildcardTypeNone {
+		t.Errorf("www.stage.nested.domain.com was attributed to the %s wildcard of type %d", level, wtype)
+	}
+
+	inherited := make(map[string]string)
+	for _, state := range pool.WildcardStates() {
+		inherited[state.Subdomain] = state.Inherited
+	}
+	if got := inherited["stage.nested.domain.com"]; got != "nested.domain.com" {
+		t.Errorf("The stage.nested.domain.com wildcard was inherited from %q instead of nested.domain.com", got)
+	}
+	if got := inherited["dev.nested.domain.com"]; got != "" {
+		t.Errorf("The dev.nested.domain.com wildcard was reported as inherited from %q", got)
+	}
+
+	if level, wtype := pool.WildcardLevel(context.TODO(), QueryMsg("www.domain.com", dns.TypeA), "domain.com"); level != "" || wtype != WildcardTypeNone {
+		t.Errorf("www.domain.com was attributed to the %s wildcard of type %d", level, wtype)
+	}
+}
+
+func TestWildcardTrustedOnly(t *testing.T) {
+	var lies int32
+	ls, laddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		atomic.AddInt32(&lies, 1)
+
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+			A:   net.ParseIP("10.1.1.1"),
+		})
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer ls.Shutdown()
+
+	var probes int32
+	ts, taddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if strings.HasSuffix(req.Question[0].Name, ".wildcard.domain.com.") {
+			atomic.AddInt32(&probes, 1)
+		}
+		wildcardHandler(w, req)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer ts.Shutdown()
+
+	config := WildcardConfig{
+		Probes:      2,
+		QueryTypes:  []uint16{dns.TypeA},
+		TrustedOnly: true,
+	}
+	msg := QueryMsg("www.wildcard.domain.com", dns.TypeA)
+	msg.Answer = append(msg.Answer, mustRR(t, "www.wildcard.domain.com. 0 IN A 192.168.1.64"))
+
+	pool := NewResolverPool([]Resolver{NewBaseResolver(laddr, 100, nil)}, time.Second, nil, 1, nil)
+	defer pool.Stop()
+	pool.SetWildcardConfig(config)
+
+	if got := pool.WildcardType(context.TODO(), msg, "domain.com"); got != WildcardTypeNone {
+		t.Errorf("The pool without trusted resolvers returned wildcard type %d", got)
+	}
+	if n := atomic.LoadInt32(&lies); n != 0 {
+		t.Errorf("%d probes were sent to the untrusted resolver", n)
+	}
+
+	tiered := NewTieredResolverPool([]Resolver{NewBaseResolver(laddr, 100, nil)},
+		[]Resolver{NewBaseResolver(taddr, 100, nil)}, time.Second, 1, nil)
+	defer tiered.Stop()
+	tiered.SetWildcardConfig(config)
+
+	if got := tiered.WildcardType(context.TODO(), msg, "domain.com"); got != WildcardTypeStatic {
+		t.Errorf("Wildcard detection returned %d instead of %d", got, WildcardTypeStatic)
+	}
+	if n := atomic.LoadInt32(&lies); n != 0 {
+		t.Errorf("%d probes were sent to the untrusted resolver", n)
+	}
+	if n := atomic.LoadInt32(&probes); n != int32(config.Probes) {
+		t.Errorf("The trusted resolver received %d probes instead of %d", n, config.Probes)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TSIGKey is the key used to sign zone transfer requests.
+type TSIGKey struct {
+	Name string
+	// Algorithm defaults to HMAC-SHA256.
+	Algorithm string
+	// Secret is the base64 encoded key.
+	Secret string
+}
+
+// TransferConfig controls the zone transfers attempted by ZoneTransfer and TransferZones.
+type TransferConfig struct {
+	// Serial requests an IXFR from the provided serial number when non-zero, and an AXFR otherwise.
+	Serial uint32
+	TSIG   *TSIGKey
+	// Timeout applies to each network operation, defaulting to the query timeout of the
+	// pool provided to TransferZones, or QueryTimeout.
+	Timeout time.Duration
+	// Port is used by TransferZones to reach the nameservers, defaulting to 53.
+	Port int
+}
+
+// TransferRecord is a resource record received during a zone transfer,
+// or the error that ended the transfer when Err is not nil.
+type TransferRecord struct {
+	Zone   string
+	Server string
+	RR     dns.RR
+	Err    error
+}
+
+// ZoneTransfer attempts a transfer of the zone from the server, and sends the records received on
+// the returned channel. The channel is closed once the transfer completes or the context expires.
+func ZoneTransfer(ctx context.Context, zone, server string, config TransferConfig) (<-chan *TransferRecord, error) {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultQueryTimeout()
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	zone = strings.ToLower(dns.Fqdn(zone))
+
+	m := new(dns.Msg)
+	if config.Serial > 0 {
+		m.SetIxfr(zone, config.Serial, ".", ".")
+	} else {
+		m.SetAxfr(zone)
+	}
+
+	d := &net.Dialer{Timeout: config.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, fmt.Errorf("ZoneTransfer: Failed to connect to %s: %v", server, err)
+	}
+
+	t := &dns.Transfer{
+		Conn:         &dns.Conn{Conn: conn},
+		ReadTimeout:  config.Timeout,
+		WriteTimeout: config.Timeout,
+	}
+	if key := config.TSIG; key != nil {
+		alg := key.Algorithm
+		if alg == "" {
+			alg = dns.HmacSHA256
+		}
+
+		name := strings.ToLower(dns.Fqdn(key.Name))
+		t.TsigSecret = map[string]string{name: key.Secret}
+		m.SetTsig(name, dns.Fqdn(alg), 300, time.Now().Unix())
+	}
+
+	envs, err := t.In(m, server)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ZoneTransfer: Failed to request %s from %s: %v", zone, server, err)
+	}
+
+	records := make(chan *TransferRecord, 100)
+	go func() {
+		defer close(records)
+		defer func() {
+			// The transfer goroutine blocks sending on the channel until it observes the closed connection
+			conn.Close()
+			for range envs {
+			}
+		}()
+
+		zname := RemoveLastDot(zone)
+		for {
+			var env *dns.Envelope
+			var ok bool
+
+			select {
+			case <-ctx.Done():
+				return
+			case env, ok = <-envs:
+				if !ok {
+					return
+				}
+			}
+
+			if env.Error != nil {
+				select {
+				case <-ctx.Done():
+				case records <- &TransferRecord{Zone: zname, Server: server, Err: env.Error}:
+				}
+				return
+			}
+			for _, rr := range env.RR {
+				select {
+				case <-ctx.Done():
+					return
+				case records <- &TransferRecord{Zone: zname, Server: server, RR: rr}:
+				}
+			}
+		}
+	}()
+	return records, nil
+}
+
+// TransferZones looks up the nameservers of each zone using the Resolver, attempts a transfer of the
+// zone from every nameserver address, and sends the records received on the returned channel.
+// Failed attempts are sent as records with the Err field set. The channel is closed once all
+// the attempts complete or the context expires.
+func TransferZones(ctx context.Context, r Resolver, zones []string, config TransferConfig) <-chan *TransferRecord {
+	if rp, ok := r.(*ResolverPool); ok && config.Timeout <= 0 {
+		config.Timeout = rp.queryTimeout()
+	}
+	port := strconv.Itoa(53)
+	if config.Port > 0 {
+		port = strconv.Itoa(config.Port)
+	}
+
+	records := make(chan *TransferRecord, 100)
+	go func() {
+		defer close(records)
+
+		var wg sync.WaitGroup
+		for _, zone := range zones {
+			for _, addr := range nameserverAddrs(ctx, r, zone) {
+				wg.Add(1)
+				go func(zone, server string) {
+					defer wg.Done()
+
+					forwardTransfer(ctx, zone, server, config, records)
+				}(RemoveLastDot(zone), net.JoinHostPort(addr, port))
+			}
+		}
+		wg.Wait()
+	}()
+	return records
+}
+
+func forwardTransfer(ctx context.Context, zone, server string, config TransferConfig, records chan<- *TransferRecord) {
+	ch, err := ZoneTransfer(ctx, zone, server, config)
+	if err != nil {
+		select {
+		case <-ctx.Done():
+		case records <- &TransferRecord{Zone: zone, Server: server, Err: err}:
+		}
+		return
+	}
+
+	for rec := range ch {
+		select {
+		case <-ctx.Done():
+		case records <- rec:
+		}
+	}
+}
+
+// nameserverAddrs returns the IPv4 addresses of the nameservers for the zone.
+func nameserverAddrs(ctx context.Context, r Resolver, zone string) []string {
+	resp, err := r.Query(ctx, QueryMsg(zone, dns.TypeNS), PriorityNormal, RetryPolicy)
+	if err != nil {
+		return nil
+	}
+
+	var addrs []string
+	for _, ns := range AnswersByType(ExtractAnswers(resp), dns.TypeNS) {
+		resp, err := r.Query(ctx, QueryMsg(ns.Data, dns.TypeA), PriorityNormal, RetryPolicy)
+		if err != nil {
+			continue
+		}
+
+		for _, a := range AnswersByType(ExtractAnswers(resp), dns.TypeA) {
+			addrs = append(addrs, a.Data)
+		}
+	}
+	return addrs
+}
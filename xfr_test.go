@@ -0,0 +1,194 @@
+// Copyright 2021 Jeff Foley. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package resolve
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const xfrSecret = "c2VjcmV0IGtleSBmb3IgdGVzdGluZw=="
+
+func xfrHandler(w dns.ResponseWriter, req *dns.Msg) {
+	zone := "xfr.net."
+	soa := &dns.SOA{
+		Hdr:    dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+		Ns:     "ns.xfr.net.",
+		Mbox:   "admin.xfr.net.",
+		Serial: 2021,
+	}
+	a := &dns.A{
+		Hdr: dns.RR_Header{Name: "www.xfr.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP("192.168.1.1"),
+	}
+
+	if req.Question[0].Name != zone {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeRefused)
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	ch := make(chan *dns.Envelope, 1)
+	ch <- &dns.Envelope{RR: []dns.RR{soa, a, soa}}
+	close(ch)
+
+	tr := new(dns.Transfer)
+	_ = tr.Out(w, req, ch)
+	w.Hijack()
+}
+
+func runLocalTCPHandlerServer(t *testing.T, handler dns.Handler, tsig map[string]string) (*dns.Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{Listener: l, Handler: handler, TsigSecret: tsig, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = server.ActivateAndServe() }()
+
+	<-started
+	return server, l.Addr().String()
+}
+
+func TestZoneTransfer(t *testing.T) {
+	s, addr := runLocalTCPHandlerServer(t, dns.HandlerFunc(xfrHandler), map[string]string{"xfr-key.": xfrSecret})
+	defer s.Shutdown()
+
+	configs := []TransferConfig{
+		{Timeout: time.Second},
+		{Timeout: time.Second, TSIG: &TSIGKey{Name: "xfr-key", Secret: xfrSecret}},
+	}
+	for _, config := range configs {
+		records, err := ZoneTransfer(context.TODO(), "xfr.net", addr, config)
+		if err != nil {
+			t.Fatalf("ZoneTransfer failed: %v", err)
+		}
+
+		var num int
+		for rec := range records {
+			if rec.Err != nil {
+				t.Errorf("The transfer failed: %v", rec.Err)
+				continue
+			}
+			num++
+		}
+		if num != 3 {
+			t.Errorf("The transfer returned %d records instead of 3", num)
+		}
+	}
+
+	records, err := ZoneTransfer(context.TODO(), "refused.net", addr, TransferConfig{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("ZoneTransfer failed: %v", err)
+	}
+	if rec := <-records; rec == nil || rec.Err == nil {
+		t.Errorf("The refused transfer did not return an error")
+	}
+}
+
+func TestZoneTransferCancelled(t *testing.T) {
+	s, addr := runLocalTCPHandlerServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		soa := &dns.SOA{
+			Hdr:    dns.RR_Header{Name: "xfr.net.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+			Ns:     "ns.xfr.net.",
+			Mbox:   "admin.xfr.net.",
+			Serial: 2021,
+		}
+		a := &dns.A{
+			Hdr: dns.RR_Header{Name: "www.xfr.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP("192.168.1.1"),
+		}
+
+		// The transfer continues to send envelopes after the client stops reading them
+		ch := make(chan *dns.Envelope)
+		go func() {
+			defer close(ch)
+
+			ch <- &dns.Envelope{RR: []dns.RR{soa, a}}
+			for i := 0; i < 5; i++ {
+				time.Sleep(50 * time.Millisecond)
+				ch <- &dns.Envelope{RR: []dns.RR{a}}
+			}
+			ch <- &dns.Envelope{RR: []dns.RR{soa}}
+		}()
+
+		tr := new(dns.Transfer)
+		_ = tr.Out(w, req, ch)
+		w.Hijack()
+	}), nil)
+	defer s.Shutdown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	records, err := ZoneTransfer(ctx, "xfr.net", addr, TransferConfig{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("ZoneTransfer failed: %v", err)
+	}
+
+	<-records
+	cancel()
+	for range records {
+	}
+
+	for i := 0; i < 40; i++ {
+		buf := make([]byte, 1<<20)
+		if !strings.Contains(string(buf[:runtime.Stack(buf, true)]), "inAxfr") {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Errorf("The transfer goroutine remained blocked after the context was cancelled")
+}
+
+func TestTransferZones(t *testing.T) {
+	s, addr := runLocalTCPHandlerServer(t, dns.HandlerFunc(xfrHandler), nil)
+	defer s.Shutdown()
+	_, portstr, _ := net.SplitHostPort(addr)
+	port, _ := strconv.Atoi(portstr)
+
+	us, usaddr, _, err := runLocalUDPHandlerServer(":0", dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		name := req.Question[0].Name
+		hdr := dns.RR_Header{Name: name, Rrtype: req.Question[0].Qtype, Class: dns.ClassINET}
+		switch req.Question[0].Qtype {
+		case dns.TypeNS:
+			m.Answer = append(m.Answer, &dns.NS{Hdr: hdr, Ns: "ns." + name})
+		case dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("127.0.0.1")})
+		}
+		_ = w.WriteMsg(m)
+	}))
+	if err != nil {
+		t.Fatalf("Unable to run test server: %v", err)
+	}
+	defer us.Shutdown()
+
+	r := NewBaseResolver(usaddr, 100, nil)
+	defer r.Stop()
+
+	var num, failed int
+	for rec := range TransferZones(context.TODO(), r, []string{"xfr.net", "refused.net"}, TransferConfig{Port: port}) {
+		if rec.Err != nil {
+			if rec.Zone != "refused.net" {
+				t.Errorf("The transfer of %s failed: %v", rec.Zone, rec.Err)
+			}
+			failed++
+			continue
+		}
+		num++
+	}
+	if num != 3 || failed != 1 {
+		t.Errorf("TransferZones returned %d records and %d failures", num, failed)
+	}
+}